@@ -4,9 +4,11 @@ package accounts
 
 import (
 	"fmt"
+	"slices"
 
 	comm "github.com/cupogo/andvari/models/comm"
 	oid "github.com/cupogo/andvari/models/oid"
+	utils "github.com/cupogo/andvari/utils"
 	core "github.com/cupogo/scaffold/pkg/models/core"
 )
 
@@ -24,9 +26,9 @@ func (z *RoleType) Decode(s string) error {
 	switch s {
 	case "0", "non", "none":
 		*z = RoleTypeNone
-	case "1", "nor", "normal", "Normal":
+	case "1", "nor", "normal", "Normal", "普通用户":
 		*z = RoleTypeNormal
-	case "2", "adm", "admin", "Admin":
+	case "2", "adm", "admin", "Admin", "管理员":
 		*z = RoleTypeAdmin
 	default:
 		return fmt.Errorf("invalid roleType: %q", s)
@@ -45,6 +47,18 @@ func (z RoleType) String() string {
 		return fmt.Sprintf("roleType %d", int8(z))
 	}
 }
+func (z RoleType) Label() string {
+	switch z {
+	case RoleTypeNone:
+		return "none"
+	case RoleTypeNormal:
+		return "普通用户"
+	case RoleTypeAdmin:
+		return "管理员"
+	default:
+		return fmt.Sprintf("roleType#%d", int8(z))
+	}
+}
 func AllRoleType() []RoleType {
 	return []RoleType{
 		RoleTypeNone,
@@ -95,6 +109,18 @@ func (z AccountStatus) String() string {
 		return fmt.Sprintf("accountStatus %d", int8(z))
 	}
 }
+func (z AccountStatus) Label() string {
+	switch z {
+	case AccountStatusNone:
+		return "none"
+	case AccountStatusActive:
+		return "active"
+	case AccountStatusForbid:
+		return "forbid"
+	default:
+		return fmt.Sprintf("accountStatus#%d", int8(z))
+	}
+}
 
 // consts of Account 账号
 const (
@@ -228,6 +254,77 @@ func (z *Account) SetWith(o AccountSet) {
 		z.SetChange("meta")
 	}
 }
+
+// RedactFor 隐去角色不可见的字段
+func (z *Account) RedactFor(roles ...string) {
+	z.Password = ""
+}
+
+func (z Accounts) RedactFor(roles ...string) {
+	for i := range z {
+		z[i].RedactFor(roles...)
+	}
+}
+
+// DeniedField 返回角色无权写入的字段名，为空表示允许
+func (o AccountBasic) DeniedField(roles ...string) string {
+	if !utils.IsZero(o.RoleType) && !slices.Contains(roles, "admin") {
+		return "rt"
+	}
+	return ""
+}
+
+// DeniedField 返回角色无权写入的字段名，为空表示允许
+func (o AccountSet) DeniedField(roles ...string) string {
+	if o.RoleType != nil && !slices.Contains(roles, "admin") {
+		return "rt"
+	}
+	return ""
+}
+
+// ExportColumns 导出的列，依次为字段名和表头
+func (_ *Account) ExportColumns() [][2]string {
+	return [][2]string{
+		{"id", "编号"},
+		{"createdAt", "创建时间"},
+		{"updatedAt", "变更时间"},
+		{"username", "登录名"},
+		{"nickname", "昵称"},
+		{"avatar", "头像路径"},
+		{"rt", "角色类型"},
+		{"status", "状态"},
+		{"email", "邮箱"},
+		{"description", "描述"},
+	}
+}
+
+// ExportValue 导出的字段值
+func (z *Account) ExportValue(k string) any {
+	switch k {
+	case "id":
+		return z.StringID()
+	case "createdAt":
+		return z.CreatedAt
+	case "updatedAt":
+		return z.UpdatedAt
+	case "username":
+		return z.Username
+	case "nickname":
+		return z.Nickname
+	case "avatar":
+		return z.AvatarPath
+	case "rt":
+		return z.RoleType.Label()
+	case "status":
+		return z.Status.Label()
+	case "email":
+		return z.Email
+	case "description":
+		return z.Description
+	}
+	return nil
+}
+
 func (in *AccountBasic) MetaAddKVs(args ...any) *AccountBasic {
 	in.MetaDiff = comm.MetaDiffAddKVs(in.MetaDiff, args...)
 	return in
@@ -30,9 +30,9 @@ type ChannelBasic struct {
 	// 自定义短ID
 	Slug string `bun:"slug,notnull,type:name,unique" extensions:"x-order=A" form:"slug" json:"key" pg:"slug,notnull,type:name,unique"`
 	// 父级ID
-	ParentID oid.OID `bun:",notnull" extensions:"x-order=B" json:"parentID" pg:",notnull,use_zero" swaggertype:"string"`
+	ParentID oid.OID `bun:",notnull,unique:cms_channel_parent_id_name_key" extensions:"x-order=B" json:"parentID" pg:",notnull,use_zero,unique:cms_channel_parent_id_name_key" swaggertype:"string"`
 	// 名称
-	Name string `bun:",notnull" extensions:"x-order=C" form:"name" json:"name" pg:",notnull"`
+	Name string `bun:",notnull,unique:cms_channel_parent_id_name_key" extensions:"x-order=C" form:"name" json:"name" pg:",notnull,unique:cms_channel_parent_id_name_key"`
 	// 描述
 	Description string `bun:",notnull" extensions:"x-order=D" form:"description" json:"description,omitempty" pg:",notnull,use_zero"`
 	// for meta update
@@ -102,6 +102,41 @@ func (z *Channel) SetWith(o ChannelSet) {
 		z.SetChange("meta")
 	}
 }
+
+// ExportColumns 导出的列，依次为字段名和表头
+func (_ *Channel) ExportColumns() [][2]string {
+	return [][2]string{
+		{"id", "编号"},
+		{"createdAt", "创建时间"},
+		{"updatedAt", "变更时间"},
+		{"key", "自定义短ID"},
+		{"parentID", "父级ID"},
+		{"name", "名称"},
+		{"description", "描述"},
+	}
+}
+
+// ExportValue 导出的字段值
+func (z *Channel) ExportValue(k string) any {
+	switch k {
+	case "id":
+		return z.StringID()
+	case "createdAt":
+		return z.CreatedAt
+	case "updatedAt":
+		return z.UpdatedAt
+	case "key":
+		return z.Slug
+	case "parentID":
+		return z.ParentID
+	case "name":
+		return z.Name
+	case "description":
+		return z.Description
+	}
+	return nil
+}
+
 func (in *ChannelBasic) MetaAddKVs(args ...any) *ChannelBasic {
 	in.MetaDiff = comm.MetaDiffAddKVs(in.MetaDiff, args...)
 	return in
@@ -127,11 +162,22 @@ type Article struct {
 
 	comm.DefaultModel
 
+	comm.OwnerField
+
 	ArticleBasic
 
+	// 附件
+	Attachments Attachments `bun:"rel:has-many,join:id=article_id" extensions:"x-order=H" json:"attachments,omitempty" pg:"rel:has-many,join:id=article_id"`
+
 	comm.MetaField
 
 	comm.TextSearchField
+
+	// 租户编号
+	TenantID oid.OID `bun:"tenant_id,notnull" extensions:"x-order=I" json:"tenantID" pg:"tenant_id,notnull" swaggertype:"string"`
+
+	// 全文检索的关键词摘要，查询参数 hl 为真时返回
+	Headline map[string]string `bun:"-" json:"headline,omitempty" pg:"-"`
 } // @name cms1Article
 
 type ArticleBasic struct {
@@ -151,10 +197,28 @@ type ArticleBasic struct {
 	Src string `bun:",notnull" extensions:"x-order=G" form:"src" json:"src" pg:",notnull,use_zero"`
 	// for meta update
 	MetaDiff *comm.MetaDiff `bson:"-" bun:"-" json:"metaUp,omitempty" pg:"-" swaggerignore:"true"`
+	// 附件
+	Attachments []AttachmentBasic `bun:"-" extensions:"x-order=I" json:"attachments,omitempty" pg:"-"`
 } // @name cms1ArticleBasic
 
 type Articles []Article
 
+// ArticleStat 文章统计的一行，未参与分组的字段为空
+type ArticleStat struct {
+	// 状态
+	Status *int16 `bun:"status" json:"status,omitempty"`
+	// 来源
+	Src *string `bun:"src" json:"src,omitempty"`
+	// 数量
+	Count int64 `bun:"count" json:"count"`
+	// 新闻时间 最小值
+	MinNewsPublish *comm.DateTime `bun:"min_news_publish" json:"minNewsPublish,omitempty"`
+	// 新闻时间 最大值
+	MaxNewsPublish *comm.DateTime `bun:"max_news_publish" json:"maxNewsPublish,omitempty"`
+} // @name cms1ArticleStat
+
+type ArticleStats []ArticleStat
+
 // Creating function call to it's inner fields defined hooks
 func (z *Article) Creating() error {
 	if z.IsZeroID() {
@@ -200,6 +264,10 @@ type ArticleSet struct {
 	Src *string `extensions:"x-order=G" json:"src"`
 	// for meta update
 	MetaDiff *comm.MetaDiff `json:"metaUp,omitempty" swaggerignore:"true"`
+	// 仅用于更新所有者(负责人)
+	OwnerID *string `extensions:"x-order=H" json:"ownerID,omitempty"`
+	// 附件
+	Attachments *[]AttachmentNested `extensions:"x-order=J" json:"attachments,omitempty"`
 } // @name cms1ArticleSet
 
 func (z *Article) SetWith(o ArticleSet) {
@@ -236,7 +304,98 @@ func (z *Article) SetWith(o ArticleSet) {
 	if o.MetaDiff != nil && z.MetaUp(o.MetaDiff) {
 		z.SetChange("meta")
 	}
+	if o.OwnerID != nil {
+		if id := oid.Cast(*o.OwnerID); z.OwnerID != id {
+			z.LogChangeValue("owner_id", z.OwnerID, id)
+			z.SetOwnerID(id)
+		}
+	}
 }
+
+// ExportColumns 导出的列，依次为字段名和表头
+func (_ *Article) ExportColumns() [][2]string {
+	return [][2]string{
+		{"id", "编号"},
+		{"createdAt", "创建时间"},
+		{"updatedAt", "变更时间"},
+		{"author", "作者"},
+		{"title", "标题"},
+		{"content", "内容"},
+		{"newsPublish", "新闻时间"},
+		{"status", "状态"},
+		{"authorID", "作者编号"},
+		{"src", "来源"},
+		{"tenantID", "租户编号"},
+	}
+}
+
+// ExportValue 导出的字段值
+func (z *Article) ExportValue(k string) any {
+	switch k {
+	case "id":
+		return z.StringID()
+	case "createdAt":
+		return z.CreatedAt
+	case "updatedAt":
+		return z.UpdatedAt
+	case "author":
+		return z.Author
+	case "title":
+		return z.Title
+	case "content":
+		return z.Content
+	case "newsPublish":
+		return z.NewsPublish
+	case "status":
+		return z.Status
+	case "authorID":
+		return z.AuthorID
+	case "src":
+		return z.Src
+	case "tenantID":
+		return z.TenantID
+	}
+	return nil
+}
+
+// ImportColumns 导入的列，依次为字段名和表头
+func (_ *ArticleBasic) ImportColumns() [][2]string {
+	return [][2]string{
+		{"author", "作者"},
+		{"title", "标题"},
+		{"content", "内容"},
+		{"newsPublish", "新闻时间"},
+		{"status", "状态"},
+		{"authorID", "作者编号"},
+		{"src", "来源"},
+	}
+}
+
+// IndexMapping 搜索索引的字段类型，键为 json 字段名
+func (_ *Article) IndexMapping() map[string]string {
+	return map[string]string{
+		"author":      "keyword",
+		"authorID":    "keyword",
+		"content":     "text",
+		"createdAt":   "date",
+		"id":          "keyword",
+		"newsPublish": "date",
+		"src":         "keyword",
+		"status":      "long",
+		"tenantID":    "keyword",
+		"title":       "text",
+		"updatedAt":   "date",
+	}
+}
+
+func (z *Article) GetTenantID() oid.OID {
+	return z.TenantID
+}
+
+func (z *Article) SetTenantID(id oid.OID) {
+	z.TenantID = id
+}
+
 func (in *ArticleBasic) MetaAddKVs(args ...any) *ArticleBasic {
 	in.MetaDiff = comm.MetaDiffAddKVs(in.MetaDiff, args...)
 	return in
@@ -263,6 +422,9 @@ type Attachment struct {
 	AttachmentBasic
 
 	comm.MetaField
+
+	// 租户编号
+	TenantID oid.OID `bun:"tenant_id,notnull" extensions:"x-order=F" json:"tenantID" pg:"tenant_id,notnull" swaggertype:"string"`
 } // @name cms1Attachment
 
 type AttachmentBasic struct {
@@ -273,6 +435,8 @@ type AttachmentBasic struct {
 	// 类型
 	Mime string `bun:",notnull" extensions:"x-order=C" form:"mime" json:"mime" pg:",notnull"`
 	Path string `bun:"path,notnull" extensions:"x-order=D" form:"path" json:"path" pg:"path,notnull"`
+	// 大小 字节数
+	Size int64 `bun:",notnull" extensions:"x-order=E" form:"size" json:"size" pg:",notnull,use_zero"`
 	// for meta update
 	MetaDiff *comm.MetaDiff `bson:"-" bun:"-" json:"metaUp,omitempty" pg:"-" swaggerignore:"true"`
 } // @name cms1AttachmentBasic
@@ -312,6 +476,8 @@ type AttachmentSet struct {
 	// 类型
 	Mime *string `extensions:"x-order=C" json:"mime"`
 	Path *string `extensions:"x-order=D" json:"path"`
+	// 大小 字节数
+	Size *int64 `extensions:"x-order=E" json:"size"`
 	// for meta update
 	MetaDiff *comm.MetaDiff `json:"metaUp,omitempty" swaggerignore:"true"`
 } // @name cms1AttachmentSet
@@ -335,10 +501,70 @@ func (z *Attachment) SetWith(o AttachmentSet) {
 		z.LogChangeValue("path", z.Path, o.Path)
 		z.Path = *o.Path
 	}
+	if o.Size != nil && z.Size != *o.Size {
+		z.LogChangeValue("size", z.Size, o.Size)
+		z.Size = *o.Size
+	}
 	if o.MetaDiff != nil && z.MetaUp(o.MetaDiff) {
 		z.SetChange("meta")
 	}
 }
+
+// AttachmentNested 随主对象保存的附件，有编号的更新，无编号的新建
+type AttachmentNested struct {
+	// 编号
+	ID string `json:"id,omitempty"`
+	AttachmentSet
+} // @name cms1AttachmentNested
+
+// ExportColumns 导出的列，依次为字段名和表头
+func (_ *Attachment) ExportColumns() [][2]string {
+	return [][2]string{
+		{"id", "编号"},
+		{"createdAt", "创建时间"},
+		{"updatedAt", "变更时间"},
+		{"articleID", "文章编号"},
+		{"name", "名称"},
+		{"mime", "类型"},
+		{"path", "Path"},
+		{"size", "大小"},
+		{"tenantID", "租户编号"},
+	}
+}
+
+// ExportValue 导出的字段值
+func (z *Attachment) ExportValue(k string) any {
+	switch k {
+	case "id":
+		return z.StringID()
+	case "createdAt":
+		return z.CreatedAt
+	case "updatedAt":
+		return z.UpdatedAt
+	case "articleID":
+		return z.ArticleID
+	case "name":
+		return z.Name
+	case "mime":
+		return z.Mime
+	case "path":
+		return z.Path
+	case "size":
+		return z.Size
+	case "tenantID":
+		return z.TenantID
+	}
+	return nil
+}
+
+func (z *Attachment) GetTenantID() oid.OID {
+	return z.TenantID
+}
+
+func (z *Attachment) SetTenantID(id oid.OID) {
+	z.TenantID = id
+}
+
 func (in *AttachmentBasic) MetaAddKVs(args ...any) *AttachmentBasic {
 	in.MetaDiff = comm.MetaDiffAddKVs(in.MetaDiff, args...)
 	return in
@@ -406,6 +632,31 @@ func (z *Clause) SetWith(o ClauseSet) {
 	}
 }
 
+// ExportColumns 导出的列，依次为字段名和表头
+func (_ *Clause) ExportColumns() [][2]string {
+	return [][2]string{
+		{"id", "编号"},
+		{"createdAt", "创建时间"},
+		{"updatedAt", "变更时间"},
+		{"text", "Text"},
+	}
+}
+
+// ExportValue 导出的字段值
+func (z *Clause) ExportValue(k string) any {
+	switch k {
+	case "id":
+		return z.StringID()
+	case "createdAt":
+		return z.CreatedAt
+	case "updatedAt":
+		return z.UpdatedAt
+	case "text":
+		return z.Text
+	}
+	return nil
+}
+
 // consts of File a
 const (
 	FileLabel = "file"
@@ -20,6 +20,7 @@ type AccountStore interface {
 	AccountStoreX
 
 	ListAccount(ctx context.Context, spec *AccountSpec) (data accounts.Accounts, total int, err error)
+	ExportAccount(ctx context.Context, spec *AccountSpec, fn func(accounts.Accounts) error) error
 	GetAccount(ctx context.Context, id string) (obj *accounts.Account, err error)
 	CreateAccount(ctx context.Context, in accounts.AccountBasic) (obj *accounts.Account, err error)
 	UpdateAccount(ctx context.Context, id string, in accounts.AccountSet) error
@@ -30,6 +31,14 @@ type AccountSpec struct {
 	PageSpec
 	ModelSpec
 
+	// 排序，多个以逗号分隔，前缀 - 表示倒序，如 -created,id
+	Sort string `collectionFormat:"csv" enums:"id,-id,created,-created,updated,-updated" extensions:"x-order=|" form:"sort" json:"sort,omitempty" swaggertype:"array,string"`
+	// 过滤条件，子句以分号分隔，格式 key:op:value，如 username:eq:x
+	// 可用的字段: username,nickname,status,email; op: eq,ne,in,like,gt,gte,lt,lte
+	Filter string `extensions:"x-order=~" form:"filter" json:"filter,omitempty"`
+	// 返回的字段，多个以逗号分隔，省略时为全部
+	Fields string `extensions:"x-order=~" form:"fields" json:"fields,omitempty"`
+
 	// 登录名 唯一
 	Username string `extensions:"x-order=A" form:"username" json:"username"`
 	// 昵称
@@ -50,20 +59,50 @@ func (spec *AccountSpec) Sift(q *ormQuery) *ormQuery {
 	q, _ = siftMatch(q, "nickname", spec.Nickname, false)
 	q, _ = siftEqual(q, "status", spec.Status, false)
 	q, _ = siftMatch(q, "email", spec.Email, false)
+	q = siftFilter(q, spec.Filter, spec)
 
 	return q
 }
+func (spec *AccountSpec) GetSort() string {
+	return spec.Sort
+}
+func (spec *AccountSpec) CanFilter(k string) (FilterField, bool) {
+	switch k {
+	case "username":
+		return FilterField{"username", FilterString}, true
+	case "nickname":
+		return FilterField{"nickname", FilterString}, true
+	case "status":
+		return FilterField{"status", FilterInt}, true
+	case "email":
+		return FilterField{"email", FilterString}, true
+	}
+	return FilterField{}, false
+}
 
 type accountStore struct {
 	w *Wrap
 }
 
 func (s *accountStore) ListAccount(ctx context.Context, spec *AccountSpec) (data accounts.Accounts, total int, err error) {
+	spec.Column(ColumnsFromContext(ctx)...)
 	total, err = s.w.db.ListModel(ctx, spec, &data)
 	return
 }
+func (s *accountStore) ExportAccount(ctx context.Context, spec *AccountSpec, fn func(accounts.Accounts) error) error {
+	spec.Column(ColumnsFromContext(ctx)...)
+	return queryBatches(ctx, s.w.db, spec.Sift, fn, func(o *accounts.Account) any {
+		return int64(o.ID)
+	})
+}
 func (s *accountStore) GetAccount(ctx context.Context, id string) (obj *accounts.Account, err error) {
-	obj, err = GetAccount(ctx, s.w.db, id, ColumnsFromContext(ctx)...)
+	obj = new(accounts.Account)
+	if !cacheGetByID(ctx, s.w, "auth_account", id, obj) {
+		obj, err = GetAccount(ctx, s.w.db, id, ColumnsFromContext(ctx)...)
+		if err == nil {
+			cacheSet(ctx, s.w, "auth_account", obj)
+		}
+	}
 	if err == nil {
 		err = s.afterLoadAccount(ctx, obj)
 	}
@@ -89,6 +128,7 @@ func (s *accountStore) CreateAccount(ctx context.Context, in accounts.AccountBas
 	return
 }
 func (s *accountStore) UpdateAccount(ctx context.Context, id string, in accounts.AccountSet) error {
+	defer cacheDel[accounts.Account](ctx, s.w, "auth_account", id)
 	return s.w.db.RunInTx(ctx, nil, func(ctx context.Context, tx pgTx) (err error) {
 		exist := new(accounts.Account)
 		if err = dbGetWithPKID(ctx, tx, exist, id); err != nil {
@@ -107,6 +147,7 @@ func (s *accountStore) UpdateAccount(ctx context.Context, id string, in accounts
 	})
 }
 func (s *accountStore) DeleteAccount(ctx context.Context, id string) error {
+	defer cacheDel[accounts.Account](ctx, s.w, "auth_account", id)
 	obj := new(accounts.Account)
 	return s.w.db.DeleteModel(ctx, obj, id)
 }
@@ -0,0 +1,274 @@
+package stores
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cupogo/andvari/stores/pgx"
+)
+
+// BulkBatch 批量写入时每条语句的行数
+var BulkBatch = 500
+
+// BulkResult 批量写入中一条的结果，Error 不为空时仅该条回滚
+type BulkResult struct {
+	ID    string
+	Error error
+}
+
+// bulkResults 由逐条的 objs 和 errs 得到结果
+func bulkResults[O pgx.Model](objs []O, errs []error) []BulkResult {
+	res := make([]BulkResult, len(errs))
+	for i, err := range errs {
+		if err != nil {
+			res[i].Error = err
+		} else {
+			res[i].ID = fmt.Sprint(objs[i].GetID())
+		}
+	}
+	return res
+}
+
+// bulkCreate 在一个事务中批量创建，prep 逐条新建并调用创建前的钩子，以多行的 INSERT 写入，再由 after 逐条调用创建后的钩子，见 bulkRun
+func bulkCreate[E any, O pgx.Model](ctx context.Context, db ormDB, in []E,
+	prep func(ctx context.Context, tx pgTx, in E) (O, error),
+	after func(ctx context.Context, tx pgTx, in E, obj O) error) (objs []O, res []BulkResult, err error) {
+	objs = make([]O, len(in))
+	var errs []error
+	err = db.RunInTx(ctx, nil, func(ctx context.Context, tx pgTx) error {
+		errs = bulkRun(ctx, tx, len(in), func(ctx context.Context, tx pgTx, i int) (err error) {
+			if objs[i], err = prep(ctx, tx, in[i]); err == nil {
+				err = bulkBeforeInsert(ctx, objs[i])
+			}
+			return
+		}, func(ctx context.Context, tx pgTx, idx []int) error {
+			return dbBulkInsert(ctx, tx, bulkPick(objs, idx))
+		}, func(ctx context.Context, tx pgTx, i int) error {
+			err := pgx.TryToAfterCreateHooks(objs[i])
+			if err == nil && after != nil {
+				err = after(ctx, tx, in[i], objs[i])
+			}
+			return err
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return objs, bulkResults(objs, errs), nil
+}
+
+// bulkUpdate 在一个事务中批量更新，prep 逐条读取、修改并调用更新前的钩子，
+// 有变化的按相同的列以 UPDATE ... FROM (VALUES ...) 写入，再由 after 逐条调用更新后的钩子，见 bulkRun
+func bulkUpdate[E any, O pgx.Model](ctx context.Context, db ormDB, ids []string, in []E,
+	prep func(ctx context.Context, tx pgTx, id string, in E) (O, error),
+	after func(ctx context.Context, tx pgTx, in E, obj O) error) (objs []O, res []BulkResult, err error) {
+	if len(ids) != len(in) {
+		return nil, nil, fmt.Errorf("mismatch length: %d ids, %d items", len(ids), len(in))
+	}
+	objs = make([]O, len(in))
+	var errs []error
+	err = db.RunInTx(ctx, nil, func(ctx context.Context, tx pgTx) error {
+		errs = bulkRun(ctx, tx, len(in), func(ctx context.Context, tx pgTx, i int) (err error) {
+			if objs[i], err = prep(ctx, tx, ids[i], in[i]); err == nil {
+				err = pgx.TryToBeforeUpdateHooks(ctx, objs[i])
+			}
+			return
+		}, func(ctx context.Context, tx pgTx, idx []int) error {
+			return dbBulkUpdate(ctx, tx, bulkPick(objs, idx))
+		}, func(ctx context.Context, tx pgTx, i int) error {
+			err := pgx.TryToAfterUpdateHooks(objs[i])
+			if err == nil && after != nil {
+				err = after(ctx, tx, in[i], objs[i])
+			}
+			return err
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return objs, bulkResults(objs, errs), nil
+}
+
+// bulkRun 在事务 tx 中写入 n 条，返回逐条的错误：
+// 先在一个保存点中逐条 prep，各在其保存点中，出错的回滚该条并跳过；其余由 write 整批写入，再逐条 after；
+// 整批出错时回滚整个保存点，再逐条在各自的保存点中重新 prep、write 和 after，出错的只回滚该条。
+// 各条在事务中记下的提交后执行的函数（见 queueCommit）仅在该条写入成功时并入 ctx 的队列
+func bulkRun(ctx context.Context, tx pgTx, n int,
+	prep func(ctx context.Context, tx pgTx, i int) error,
+	write func(ctx context.Context, tx pgTx, idx []int) error,
+	after func(ctx context.Context, tx pgTx, i int) error) []error {
+	errs := make([]error, n)
+	rctx, queues := make([]context.Context, n), make([]*commitQueue, n)
+	batch := func(ctx context.Context, tx pgTx, idx []int) error {
+		if err := write(ctx, tx, idx); err != nil {
+			return err
+		}
+		for _, i := range idx {
+			if err := after(rctx[i], tx, i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err := tx.RunInTx(ctx, nil, func(ctx context.Context, tx pgTx) error {
+		var idx []int
+		for i := range errs {
+			rctx[i], queues[i] = withCommits(ctx)
+			if errs[i] = tx.RunInTx(rctx[i], nil, func(ctx context.Context, tx pgTx) error {
+				return prep(ctx, tx, i)
+			}); errs[i] == nil {
+				idx = append(idx, i)
+			}
+		}
+		if len(idx) == 0 {
+			return nil
+		}
+		return batch(ctx, tx, idx)
+	})
+	if err != nil {
+		for i := range errs {
+			if errs[i] != nil { // prep 出错的不再重试
+				continue
+			}
+			rctx[i], queues[i] = withCommits(ctx)
+			errs[i] = tx.RunInTx(rctx[i], nil, func(ctx context.Context, tx pgTx) error {
+				if err := prep(ctx, tx, i); err != nil {
+					return err
+				}
+				return batch(ctx, tx, []int{i})
+			})
+		}
+	}
+	for i := range errs {
+		if errs[i] == nil {
+			queues[i].mergeInto(ctx)
+		}
+	}
+	return errs
+}
+
+// bulkPick 按序号取出的各条
+func bulkPick[O any](objs []O, idx []int) []O {
+	rows := make([]O, len(idx))
+	for j, i := range idx {
+		rows[j] = objs[i]
+	}
+	return rows
+}
+
+// bulkBeforeInsert 同 DoInsert 写入前的 Creating 等钩子和上下文的创建时间
+func bulkBeforeInsert(ctx context.Context, obj pgx.Model) error {
+	if err := pgx.TryToBeforeCreateHooks(ctx, obj); err != nil {
+		return err
+	}
+	if dtf, ok := obj.(pgx.CreatedSetter); ok {
+		if ts, ok := pgx.CreatedFromContext(ctx); ok && ts > 0 {
+			dtf.SetCreated(ts)
+		}
+	}
+	return nil
+}
+
+// dbBulkInsert 以多行的 INSERT 写入，每 BulkBatch 行一条语句，编号由 RETURNING 取回
+func dbBulkInsert[O pgx.Model](ctx context.Context, db ormDB, objs []O) error {
+	for start := 0; start < len(objs); start += BulkBatch {
+		rows := objs[start:min(start+BulkBatch, len(objs))]
+		if _, err := db.NewInsert().Model(&rows).Returning("id").Exec(ctx); err != nil {
+			return fmt.Errorf("bulk create %s fail: %w", pgx.ModelName(rows[0]), err)
+		}
+		if err := dbBulkTsVec(ctx, db, rows, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbBulkUpdate 按变化的列分组，每组每 BulkBatch 行一条 UPDATE ... FROM (VALUES ...)，没有变化的跳过
+// 不用 bun 的 Bulk，其 VALUES 含全部的列
+func dbBulkUpdate[O pgx.Model](ctx context.Context, db ormDB, objs []O) error {
+	var keys []string
+	groups := make(map[string][]O)
+	for _, obj := range objs {
+		vo, ok := any(obj).(pgx.Changeable)
+		if !ok || vo.CountChange() == 0 {
+			continue
+		}
+		vo.SetChange("updated")
+		cols := slices.Clone(vo.GetChanges())
+		slices.Sort(cols)
+		key := strings.Join(cols, ",")
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], obj)
+	}
+	for _, key := range keys {
+		cols := strings.Split(key, ",")
+		all := groups[key]
+		for start := 0; start < len(all); start += BulkBatch {
+			rows := all[start:min(start+BulkBatch, len(all))]
+			q := db.NewUpdate().With("_data", db.NewValues(&rows).Column(append([]string{"id"}, cols...)...)).
+				Model(&rows).TableExpr("_data").Where("?TableAlias.id = _data.id")
+			for _, col := range cols {
+				q.Set("? = _data.?", pgIdent(col), pgIdent(col))
+			}
+			if _, err := q.Exec(ctx); err != nil {
+				return fmt.Errorf("bulk update %s fail: %w", pgx.ModelName(rows[0]), err)
+			}
+			if err := dbBulkTsVec(ctx, db, rows, true); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dbBulkTsVec 同 DoInsert、DoUpdate 中全文检索的 ts_vec，已有触发器的模型不需要
+// 有关键词文本的逐条更新，更新时其余按 ts 列以一条语句更新
+func dbBulkTsVec[O pgx.Model](ctx context.Context, db ormDB, objs []O, isup bool) error {
+	if len(objs) == 0 || !pgx.LastFTSEnabled() {
+		return nil
+	}
+	var (
+		cfg  string
+		cols []string
+		ids  []any
+	)
+	for _, obj := range objs {
+		tso, ok := any(obj).(pgx.TextSearchable)
+		if !ok {
+			return nil
+		}
+		if cfg = tso.GetTsConfig(); len(cfg) == 0 {
+			cfg = pgx.LastFTSConfig()
+		}
+		if ktg, ok := tso.(pgx.KeywordTextGetter); ok {
+			txt := ktg.GetKeywordText()
+			if len(txt) == 0 {
+				continue
+			}
+			q := db.NewUpdate().Model(obj).Set("ts_vec = to_tsvector(?, ?)", cfg, txt)
+			if vck, ok := tso.(pgx.IColumnKeyword); ok && len(vck.ColumnKeyword()) > 0 {
+				q.Set("? = ?", pgIdent(vck.ColumnKeyword()), txt)
+			}
+			if _, err := q.WherePK().Exec(ctx); err != nil {
+				return err
+			}
+		} else if isup {
+			if cols = tso.GetTsColumns(); len(cols) > 0 {
+				ids = append(ids, obj.GetID())
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := db.NewUpdate().Model(objs[0]).
+		Set("ts_vec = to_tsvector(?, jsonb_build_array("+strings.Join(cols, ",")+"))", cfg).
+		Where("?TableAlias.id IN (?)", pgIn(ids)).Exec(ctx)
+	return err
+}
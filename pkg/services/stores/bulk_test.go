@@ -0,0 +1,193 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cupogo/andvari/models/oid"
+	"github.com/cupogo/andvari/stores/pgx"
+	"github.com/cupogo/scaffold/pkg/models/cms1"
+)
+
+// failOn 以 prefix 开头且含 sub 的语句返回 err
+func failOn(prefix, sub string, err error) func(q string) error {
+	return func(q string) error {
+		if strings.HasPrefix(q, prefix) && strings.Contains(q, sub) {
+			return err
+		}
+		return nil
+	}
+}
+
+func TestBulkCreate(t *testing.T) {
+	ctx := context.Background()
+	drv := &fakeDriver{fail: failOn("INSERT", "'dup'", pgx.ErrDuplicate)}
+	w := newFakeWrap(drv)
+
+	errEmpty, errAfter := errors.New("empty text"), errors.New("after fail")
+	in := []cms1.ClauseBasic{{Text: "a"}, {Text: "dup"}, {Text: ""}, {Text: "b"}, {Text: "c"}}
+	var done []string
+	ctx, cq := withCommits(ctx)
+	objs, res, err := bulkCreate(ctx, w.db, in, func(ctx context.Context, tx pgTx, in cms1.ClauseBasic) (*cms1.Clause, error) {
+		if len(in.Text) == 0 {
+			return nil, errEmpty
+		}
+		return cms1.NewClauseWithBasic(in), nil
+	}, func(ctx context.Context, tx pgTx, in cms1.ClauseBasic, obj *cms1.Clause) error {
+		queueCommit(ctx, "Clause", func(context.Context, *Wrap) error {
+			done = append(done, in.Text)
+			return nil
+		})
+		if in.Text == "b" {
+			return errAfter
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != len(in) {
+		t.Fatalf("want %d results, got %d", len(in), len(res))
+	}
+	for _, i := range []int{0, 4} {
+		if res[i].Error != nil || len(res[i].ID) == 0 || res[i].ID != objs[i].StringID() {
+			t.Errorf("#%d: want id %s, got %+v", i, objs[i].StringID(), res[i])
+		}
+	}
+	if !IsDuplicateError(res[1].Error) {
+		t.Errorf("#1: want duplicate, got %v", res[1].Error)
+	}
+	if !errors.Is(res[2].Error, errEmpty) || !errors.Is(res[3].Error, errAfter) {
+		t.Errorf("want %v and %v, got %v and %v", errEmpty, errAfter, res[2].Error, res[3].Error)
+	}
+	// 整批出错后逐条写入，失败的只回滚各自的保存点
+	if n := len(drv.Execs("INSERT")); n != 5 {
+		t.Errorf("want 1 batch and 4 single inserts, got %d: %q", n, drv.execs)
+	}
+	if len(drv.Execs("COMMIT")) != 1 || len(drv.Execs("ROLLBACK TO SAVEPOINT")) != 4 {
+		t.Errorf("unexpected statements: %q", drv.execs)
+	}
+	// 仅写入成功的各条记下的函数在提交后执行
+	if err := w.runCommits(ctx, "Clause", cq); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(done, []string{"a", "c"}) {
+		t.Errorf("after commit: want [a c], got %v", done)
+	}
+}
+
+func TestBulkCreateOneStatement(t *testing.T) {
+	drv := &fakeDriver{}
+	w := newFakeWrap(drv)
+	in := []cms1.ClauseBasic{{Text: "a"}, {Text: "b"}, {Text: "c"}}
+	_, res, err := bulkCreate(context.Background(), w.db, in, func(ctx context.Context, tx pgTx, in cms1.ClauseBasic) (*cms1.Clause, error) {
+		return cms1.NewClauseWithBasic(in), nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range res {
+		if r.Error != nil || len(r.ID) == 0 {
+			t.Errorf("#%d: %+v", i, r)
+		}
+	}
+	if n := len(drv.Execs("INSERT")); n != 1 {
+		t.Errorf("want 1 insert, got %d: %q", n, drv.execs)
+	}
+}
+
+func TestBulkUpdate(t *testing.T) {
+	ctx := context.Background()
+	drv := &fakeDriver{fail: failOn("WITH", "'dup'", pgx.ErrDuplicate)}
+	w := newFakeWrap(drv)
+
+	ids := []string{oid.NewID(oid.OtArticle).String(), oid.NewID(oid.OtArticle).String(), "bad"}
+	text := func(s string) cms1.ClauseSet { return cms1.ClauseSet{Text: &s} }
+	in := []cms1.ClauseSet{text("a"), text("dup"), text("b")}
+	_, res, err := bulkUpdate(ctx, w.db, ids, in, func(ctx context.Context, tx pgTx, id string, in cms1.ClauseSet) (*cms1.Clause, error) {
+		if _, err := oid.CheckID(id); err != nil {
+			return nil, ErrNotFound
+		}
+		obj := cms1.NewClauseWithID(id)
+		obj.SetWith(in)
+		return obj, nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res[0].Error != nil || res[0].ID != ids[0] {
+		t.Errorf("#0: %+v", res[0])
+	}
+	if !IsDuplicateError(res[1].Error) || !errors.Is(res[2].Error, ErrNotFound) {
+		t.Errorf("unexpected results: %+v", res)
+	}
+	if len(drv.Execs("COMMIT")) != 1 {
+		t.Errorf("unexpected statements: %q", drv.execs)
+	}
+
+	if _, _, err := bulkUpdate[cms1.ClauseSet, *cms1.Clause](ctx, w.db, ids, in[:1], nil, nil); err == nil {
+		t.Error("want mismatch length error")
+	}
+}
+
+func TestImportChunks(t *testing.T) {
+	ctx := context.Background()
+	drv := &fakeDriver{fail: failOn("INSERT", "'dup'", pgx.ErrDuplicate)}
+	w := newFakeWrap(drv)
+	batch := ImportBatch
+	ImportBatch = 2
+	t.Cleanup(func() { ImportBatch = batch })
+
+	in := []cms1.ClauseBasic{{Text: "a"}, {Text: "dup"}, {Text: "b"}, {Text: "c"}, {Text: "dup"}}
+	var done []string
+	ctx, cq := withCommits(ctx)
+	objs, err := importChunks(ctx, w.db, in, false, func(ctx context.Context, tx pgTx, in cms1.ClauseBasic) (*cms1.Clause, error) {
+		obj := cms1.NewClauseWithBasic(in)
+		queueCommit(ctx, "Clause", func(context.Context, *Wrap) error {
+			done = append(done, in.Text)
+			return nil
+		})
+		return obj, dbInsert(ctx, tx, obj)
+	})
+	// 出错的只回滚该条，其后的照常写入
+	var ies ImportErrors
+	if !errors.As(err, &ies) || len(ies) != 2 || ies[0].Index != 1 || ies[1].Index != 4 || !IsDuplicateError(ies[0]) {
+		t.Fatalf("want import errors at #1 and #4, got %v", err)
+	}
+	if len(objs) != len(in) {
+		t.Fatalf("want %d objs, got %d", len(in), len(objs))
+	}
+	for i, obj := range objs {
+		if (obj == nil) != (i == 1 || i == 4) {
+			t.Errorf("#%d: %v", i, obj)
+		}
+	}
+	if len(drv.Execs("COMMIT")) != 3 || len(drv.Execs("ROLLBACK TO SAVEPOINT")) != 2 {
+		t.Errorf("unexpected statements: %q", drv.execs)
+	}
+	if err := w.runCommits(ctx, "Clause", cq); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(done, []string{"a", "b", "c"}) {
+		t.Errorf("after commit: want [a b c], got %v", done)
+	}
+
+	// 事务出错时停止，返回此前各批的记录和错误
+	errConn := errors.New("conn lost")
+	drv.fail = func(q string) error {
+		if q == "COMMIT" && len(drv.Execs("COMMIT")) > 4 { // 此次的第二批提交时
+			return errConn
+		}
+		return failOn("INSERT", "'dup'", pgx.ErrDuplicate)(q)
+	}
+	objs, err = importChunks(context.Background(), w.db, in, false, func(ctx context.Context, tx pgTx, in cms1.ClauseBasic) (*cms1.Clause, error) {
+		obj := cms1.NewClauseWithBasic(in)
+		return obj, dbInsert(ctx, tx, obj)
+	})
+	if !errors.Is(err, errConn) || !errors.As(err, &ies) || len(ies) != 1 || ies[0].Index != 1 || len(objs) != 2 {
+		t.Errorf("interrupted: want %d objs and errors at #1, got %d %v", 2, len(objs), err)
+	}
+}
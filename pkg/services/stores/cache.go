@@ -0,0 +1,301 @@
+package stores
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/cupogo/scaffold/pkg/settings"
+)
+
+// Cache 模型的读缓存，值为编码后的记录，出错时按未命中处理
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool)
+	Set(ctx context.Context, key string, val []byte, ttl time.Duration)
+	Del(ctx context.Context, keys ...string)
+}
+
+// CacheCount 缓存的命中计数
+type CacheCount struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+type cacheCounter struct {
+	hits, misses atomic.Uint64
+}
+
+var (
+	cacheOnce sync.Once
+	cacheX    Cache
+
+	cacheCounters sync.Map // prefix: *cacheCounter
+)
+
+// SetCache 替换默认的缓存，应在首次使用前调用
+func SetCache(c Cache) {
+	cacheOnce.Do(func() {})
+	cacheX = c
+}
+
+// SgtCache 默认的缓存，CACHE_STORE 为 redis 时使用 REDIS_URI，否则为进程内 LRU
+func SgtCache() Cache {
+	cacheOnce.Do(func() {
+		if settings.Current.CacheStore == "redis" {
+			c, err := NewRedisCache(settings.Current.RedisURI)
+			if err == nil {
+				cacheX = c
+				return
+			}
+			logger().Warnw("redis cache fail, fallback to lru", "err", err)
+		}
+		cacheX = NewLRUCache(settings.Current.CacheSize)
+	})
+	return cacheX
+}
+
+// CacheCounts 各模型缓存的命中计数，键为表名
+func CacheCounts() map[string]CacheCount {
+	out := make(map[string]CacheCount)
+	cacheCounters.Range(func(k, v any) bool {
+		cc := v.(*cacheCounter)
+		out[k.(string)] = CacheCount{Hits: cc.hits.Load(), Misses: cc.misses.Load()}
+		return true
+	})
+	return out
+}
+
+func countCache(prefix string, hit bool) {
+	v, _ := cacheCounters.LoadOrStore(prefix, new(cacheCounter))
+	if hit {
+		v.(*cacheCounter).hits.Add(1)
+	} else {
+		v.(*cacheCounter).misses.Add(1)
+	}
+}
+
+// cacheModel 可缓存的记录
+type cacheModel interface {
+	SetID(id any) bool
+	StringID() string
+}
+
+// cacheKey 由编号得到缓存键，编号无效时为空
+func cacheKey[T any, P interface {
+	*T
+	cacheModel
+}](prefix, id string) string {
+	if obj := P(new(T)); obj.SetID(id) {
+		return prefix + ":" + obj.StringID()
+	}
+	return ""
+}
+
+// cacheable 指定列、加载关联或在事务中时不使用缓存
+func cacheable(ctx context.Context, w *Wrap) bool {
+	return !w.inTx() && len(ColumnsFromContext(ctx)) == 0 && len(RelationFromContext(ctx)) == 0
+}
+
+// cacheGet 按编号读缓存到 obj，命中时返回真
+func cacheGet[T any, P interface {
+	*T
+	cacheModel
+}](ctx context.Context, w *Wrap, prefix, id string, obj P) bool {
+	key := cacheKey[T, P](prefix, id)
+	if len(key) == 0 || !cacheable(ctx, w) {
+		return false
+	}
+	if b, ok := SgtCache().Get(ctx, key); ok {
+		if err := msgpack.Unmarshal(b, obj); err == nil {
+			countCache(prefix, true)
+			return true
+		}
+		*obj = *new(T)
+	}
+	countCache(prefix, false)
+	return false
+}
+
+// cacheGetByID 同 cacheGet，但 id 须为规范的编号，
+// 用于还可按别名（如 slug）读取的模型，别名不读缓存，以免被解析成其他记录的编号
+func cacheGetByID[T any, P interface {
+	*T
+	cacheModel
+}](ctx context.Context, w *Wrap, prefix, id string, obj P) bool {
+	if cacheKey[T, P](prefix, id) != prefix+":"+id {
+		return false
+	}
+	return cacheGet(ctx, w, prefix, id, obj)
+}
+
+// cacheSet 写缓存，键取记录自身的编号
+func cacheSet[T any, P interface {
+	*T
+	cacheModel
+}](ctx context.Context, w *Wrap, prefix string, obj P) {
+	if !cacheable(ctx, w) {
+		return
+	}
+	b, err := msgpack.Marshal(obj)
+	if err != nil {
+		logger().Infow("cache encode fail", "prefix", prefix, "err", err)
+		return
+	}
+	SgtCache().Set(ctx, prefix+":"+obj.StringID(), b, settings.Current.CacheTTL)
+}
+
+// cacheDel 写入后清除缓存，在事务中时提交后再清除一次
+func cacheDel[T any, P interface {
+	*T
+	cacheModel
+}](ctx context.Context, w *Wrap, prefix, id string) {
+	key := cacheKey[T, P](prefix, id)
+	if len(key) == 0 {
+		return
+	}
+	SgtCache().Del(ctx, key)
+	if t, ok := w.db.(*txDB); ok {
+		t.afterCommit(func(ctx context.Context) { SgtCache().Del(ctx, key) })
+	}
+}
+
+// LRUCache 进程内的 LRU 缓存
+type LRUCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	val     []byte
+	expires time.Time
+}
+
+var _ Cache = (*LRUCache)(nil)
+
+// NewLRUCache size 为最多保存的条数
+func NewLRUCache(size int) *LRUCache {
+	if size <= 0 {
+		size = 1000
+	}
+	return &LRUCache{size: size, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *LRUCache) Get(_ context.Context, key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	ent := el.Value.(*lruEntry)
+	if !ent.expires.IsZero() && time.Now().After(ent.expires) {
+		c.ll.Remove(el)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return ent.val, true
+}
+
+func (c *LRUCache) Set(_ context.Context, key string, val []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ent := &lruEntry{key: key, val: val}
+	if ttl > 0 {
+		ent.expires = time.Now().Add(ttl)
+	}
+	if el, ok := c.items[key]; ok {
+		el.Value = ent
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.ll.PushFront(ent)
+	for c.ll.Len() > c.size {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.items, el.Value.(*lruEntry).key)
+	}
+}
+
+func (c *LRUCache) Del(_ context.Context, keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := c.items[key]; ok {
+			c.ll.Remove(el)
+			delete(c.items, key)
+		}
+	}
+}
+
+// RedisCache 使用 Redis 的缓存，键以 settings.Name 为前缀
+type RedisCache struct {
+	rc     *redis.Client
+	prefix string
+}
+
+var _ Cache = (*RedisCache)(nil)
+
+// RedisTimeout 连接和读写的超时
+var RedisTimeout = time.Second
+
+// NewRedisCache uri 如 redis://:password@localhost:6379/1
+func NewRedisCache(uri string) (*RedisCache, error) {
+	opt, err := redis.ParseURL(uri)
+	if err != nil {
+		return nil, err
+	}
+	opt.DialTimeout, opt.ReadTimeout, opt.WriteTimeout = RedisTimeout, RedisTimeout, RedisTimeout
+	c := &RedisCache{rc: redis.NewClient(opt), prefix: strings.ToLower(settings.Name) + ":"}
+	ctx, cancel := context.WithTimeout(context.Background(), RedisTimeout)
+	defer cancel()
+	if err = c.rc.Ping(ctx).Err(); err != nil {
+		_ = c.rc.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, bool) {
+	b, err := c.rc.Get(ctx, c.prefix+key).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			logger().Infow("redis get fail", "key", key, "err", err)
+		}
+		return nil, false
+	}
+	return b, true
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, val []byte, ttl time.Duration) {
+	if err := c.rc.Set(ctx, c.prefix+key, val, ttl).Err(); err != nil {
+		logger().Infow("redis set fail", "key", key, "err", err)
+	}
+}
+
+func (c *RedisCache) Del(ctx context.Context, keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	pks := make([]string, len(keys))
+	for i, key := range keys {
+		pks[i] = c.prefix + key
+	}
+	if err := c.rc.Del(ctx, pks...).Err(); err != nil {
+		logger().Infow("redis del fail", "keys", keys, "err", err)
+	}
+}
+
+// Close 关闭连接池
+func (c *RedisCache) Close() error {
+	return c.rc.Close()
+}
@@ -0,0 +1,80 @@
+package stores
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/cupogo/andvari/models/oid"
+
+	"github.com/cupogo/scaffold/pkg/models/cms1"
+)
+
+func TestCacheChannel(t *testing.T) {
+	prev := SgtCache()
+	SetCache(NewLRUCache(10))
+	t.Cleanup(func() { SetCache(prev) })
+	cacheCounters.Delete("cms_channel")
+
+	ctx := context.Background()
+	id := oid.NewID(oid.OtArticle)
+	// 另一记录的 slug 形如编号，会被解析成 id
+	alias := "x-" + id.IID().String()
+	if oid.Cast(alias) != id {
+		t.Fatalf("alias %q should cast to %s", alias, id)
+	}
+	other := oid.NewID(oid.OtArticle)
+	name := "news"
+	drv := &fakeDriver{query: func(q string) ([]string, [][]driver.Value) {
+		cols := []string{"id", "slug", "name"}
+		if strings.Contains(q, "slug") && strings.Contains(q, alias) {
+			return cols, [][]driver.Value{{int64(other), alias, "other"}}
+		}
+		return cols, [][]driver.Value{{int64(id), "news", name}}
+	}}
+	s := newFakeWrap(drv).Content()
+	selects := func() int { return len(drv.Execs("SELECT")) }
+
+	get := func(key, want string) {
+		t.Helper()
+		obj, err := s.GetChannel(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if obj.Name != want {
+			t.Errorf("get %s: want %q, got %q", key, want, obj.Name)
+		}
+	}
+
+	get(id.String(), "news") // 未命中，读库
+	n := selects()
+	get(id.String(), "news") // 命中
+	if selects() != n {
+		t.Error("cache hit should not query db")
+	}
+	if c := CacheCounts()["cms_channel"]; c.Hits != 1 || c.Misses != 1 {
+		t.Errorf("counts: %+v", c)
+	}
+
+	// 别名不读缓存
+	get(alias, "other")
+	if selects() == n {
+		t.Error("alias should query db")
+	}
+
+	// 更新后清除
+	slug, upd := "news", "updated"
+	if _, err := s.PutChannel(ctx, id.String(), cms1.ChannelSet{Slug: &slug, Name: &upd}); err != nil {
+		t.Fatal(err)
+	}
+	if len(drv.Execs("UPDATE")) == 0 {
+		t.Fatal("put should update")
+	}
+	name = upd
+	n = selects()
+	get(id.String(), "updated")
+	if selects() == n {
+		t.Error("get after update should query db")
+	}
+}
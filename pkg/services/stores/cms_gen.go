@@ -4,8 +4,11 @@ package stores
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 
+	oid "github.com/cupogo/andvari/models/oid"
 	pgx "github.com/cupogo/andvari/stores/pgx"
 	utils "github.com/cupogo/andvari/utils"
 	"github.com/cupogo/scaffold/pkg/models/cms1"
@@ -23,22 +26,32 @@ func init() {
 
 type ContentStore interface {
 	ListClause(ctx context.Context, spec *ClauseSpec) (data cms1.Clauses, total int, err error)
+	ExportClause(ctx context.Context, spec *ClauseSpec, fn func(cms1.Clauses) error) error
 	GetClause(ctx context.Context, id string) (obj *cms1.Clause, err error)
 	PutClause(ctx context.Context, id string, in cms1.ClauseSet) (obj *cms1.Clause, err error)
 	DeleteClause(ctx context.Context, id string) error
 
 	ListChannel(ctx context.Context, spec *ChannelSpec) (data cms1.Channels, total int, err error)
+	ExportChannel(ctx context.Context, spec *ChannelSpec, fn func(cms1.Channels) error) error
 	GetChannel(ctx context.Context, id string) (obj *cms1.Channel, err error)
+	GetChannelByParentIDName(ctx context.Context, parentID string, name string) (obj *cms1.Channel, err error)
 	PutChannel(ctx context.Context, id string, in cms1.ChannelSet) (obj *cms1.Channel, err error)
 	DeleteChannel(ctx context.Context, id string) error
 
 	ListArticle(ctx context.Context, spec *ArticleSpec) (data cms1.Articles, total int, err error)
+	FacetArticle(ctx context.Context, spec *ArticleSpec) (data Facets, err error)
+	ExportArticle(ctx context.Context, spec *ArticleSpec, fn func(cms1.Articles) error) (err error)
+	AggregateArticle(ctx context.Context, spec *ArticleStatSpec) (data cms1.ArticleStats, err error)
 	GetArticle(ctx context.Context, id string) (obj *cms1.Article, err error)
 	CreateArticle(ctx context.Context, in cms1.ArticleBasic) (obj *cms1.Article, err error)
-	UpdateArticle(ctx context.Context, id string, in cms1.ArticleSet) error
-	DeleteArticle(ctx context.Context, id string) error
+	CreateArticles(ctx context.Context, in []cms1.ArticleBasic) (res []BulkResult, err error)
+	UpdateArticle(ctx context.Context, id string, in cms1.ArticleSet) (err error)
+	UpdateArticles(ctx context.Context, ids []string, in []cms1.ArticleSet) (res []BulkResult, err error)
+	DeleteArticle(ctx context.Context, id string) (err error)
+	ImportArticle(ctx context.Context, in []cms1.ArticleBasic, dryRun bool) (ids []string, err error)
 
 	ListAttachment(ctx context.Context, spec *AttachmentSpec) (data cms1.Attachments, total int, err error)
+	ExportAttachment(ctx context.Context, spec *AttachmentSpec, fn func(cms1.Attachments) error) (err error)
 	GetAttachment(ctx context.Context, id string) (obj *cms1.Attachment, err error)
 	CreateAttachment(ctx context.Context, in cms1.AttachmentBasic) (obj *cms1.Attachment, err error)
 	DeleteAttachment(ctx context.Context, id string) error
@@ -48,20 +61,47 @@ type ClauseSpec struct {
 	PageSpec
 	ModelSpec
 
+	// 排序，多个以逗号分隔，前缀 - 表示倒序，如 -created,id
+	Sort string `collectionFormat:"csv" enums:"id,-id,created,-created,updated,-updated" extensions:"x-order=|" form:"sort" json:"sort,omitempty" swaggertype:"array,string"`
+	// 过滤条件，子句以分号分隔，格式 key:op:value，如 text:eq:x
+	// 可用的字段: text; op: eq,ne,in,like,gt,gte,lt,lte
+	Filter string `extensions:"x-order=~" form:"filter" json:"filter,omitempty"`
+	// 返回的字段，多个以逗号分隔，省略时为全部
+	Fields string `extensions:"x-order=~" form:"fields" json:"fields,omitempty"`
+
 	Text string `extensions:"x-order=A" form:"text" json:"text"`
 }
 
 func (spec *ClauseSpec) Sift(q *ormQuery) *ormQuery {
 	q = spec.ModelSpec.Sift(q)
 	q, _ = siftMatch(q, "text", spec.Text, false)
+	q = siftFilter(q, spec.Filter, spec)
 
 	return q
 }
+func (spec *ClauseSpec) GetSort() string {
+	return spec.Sort
+}
+func (spec *ClauseSpec) CanFilter(k string) (FilterField, bool) {
+	switch k {
+	case "text":
+		return FilterField{"text", FilterString}, true
+	}
+	return FilterField{}, false
+}
 
 type ChannelSpec struct {
 	PageSpec
 	ModelSpec
 
+	// 排序，多个以逗号分隔，前缀 - 表示倒序，如 -created,id
+	Sort string `collectionFormat:"csv" enums:"id,-id,created,-created,updated,-updated" extensions:"x-order=|" form:"sort" json:"sort,omitempty" swaggertype:"array,string"`
+	// 过滤条件，子句以分号分隔，格式 key:op:value，如 slug:eq:x
+	// 可用的字段: slug,parentID,name; op: eq,ne,in,like,gt,gte,lt,lte
+	Filter string `extensions:"x-order=~" form:"filter" json:"filter,omitempty"`
+	// 返回的字段，多个以逗号分隔，省略时为全部
+	Fields string `extensions:"x-order=~" form:"fields" json:"fields,omitempty"`
+
 	// 自定义短ID
 	Slug string `extensions:"x-order=A" form:"slug" json:"key"`
 	// 父级ID
@@ -75,35 +115,79 @@ func (spec *ChannelSpec) Sift(q *ormQuery) *ormQuery {
 	q, _ = siftEqual(q, "slug", spec.Slug, false)
 	q, _ = siftOID(q, "parent_id", spec.ParentID, false)
 	q, _ = siftMatch(q, "name", spec.Name, false, true)
+	q = siftFilter(q, spec.Filter, spec)
 
 	return q
 }
+func (spec *ChannelSpec) GetSort() string {
+	return spec.Sort
+}
+func (spec *ChannelSpec) CanFilter(k string) (FilterField, bool) {
+	switch k {
+	case "slug":
+		return FilterField{"slug", FilterString}, true
+	case "parentID":
+		return FilterField{"parent_id", FilterOID}, true
+	case "name":
+		return FilterField{"name", FilterString}, true
+	}
+	return FilterField{}, false
+}
 
 type ArticleSpec struct {
 	PageSpec
 	ModelSpec
-	TextSearchSpec
-
+	TenantSpec
+	OwnerSpec
+	TsRankSpec
+	CursorSpec
+
+	// 排序，多个以逗号分隔，前缀 - 表示倒序，如 -created,id
+	Sort string `collectionFormat:"csv" enums:"id,-id,created,-created,updated,-updated,author,-author,newsPublish,-newsPublish" extensions:"x-order=|" form:"sort" json:"sort,omitempty" swaggertype:"array,string"`
+	// 过滤条件，子句以分号分隔，格式 key:op:value，如 author:eq:x
+	// 可用的字段: author,title,newsPublish,status,authorID,src; op: eq,ne,in,like,gt,gte,lt,lte
+	Filter string `extensions:"x-order=~" form:"filter" json:"filter,omitempty"`
+	// 返回的字段，多个以逗号分隔，省略时为全部
+	Fields string `extensions:"x-order=~" form:"fields" json:"fields,omitempty"`
+	// 是否返回分面计数，字段: status,authorID,src
+	Facets bool `extensions:"x-order=~" form:"facets" json:"facets,omitempty"`
+
+	// 所有者编号 (多值使用逗号分隔)
+	OwnerID string `extensions:"x-order=A" form:"owner" json:"owner,omitempty"`
 	// 作者
-	Author string `extensions:"x-order=A" form:"author" json:"author"`
+	Author string `extensions:"x-order=B" form:"author" json:"author"`
 	// 标题
-	Title string `extensions:"x-order=B" form:"title" json:"title"`
+	Title string `extensions:"x-order=C" form:"title" json:"title"`
 	// 新闻时间 + during
-	NewsPublish string `extensions:"x-order=C" form:"newsPublish" json:"newsPublish,omitempty"`
+	NewsPublish string `extensions:"x-order=D" form:"newsPublish" json:"newsPublish,omitempty"`
 	// 状态 (多值逗号分隔)
-	Statuses string `extensions:"x-order=D" form:"statuses" json:"statuses,omitempty"`
+	Statuses string `extensions:"x-order=E" form:"statuses" json:"statuses,omitempty"`
 	// 状态
-	Status int16 `extensions:"x-order=E" form:"status" json:"status"`
+	Status int16 `extensions:"x-order=F" form:"status" json:"status"`
 	// 作者编号
-	AuthorID string `extensions:"x-order=F" form:"authorID" json:"authorID"`
+	AuthorID string `extensions:"x-order=G" form:"authorID" json:"authorID"`
 	// 来源 (多值逗号分隔)
-	Srcs string `extensions:"x-order=G" form:"srcs" json:"srcs,omitempty"`
+	Srcs string `extensions:"x-order=H" form:"srcs" json:"srcs,omitempty"`
 	// 来源
-	Src string `extensions:"x-order=H" form:"src" json:"src"`
+	Src string `extensions:"x-order=I" form:"src" json:"src"`
+
+	// include relation names: `Attachments`,...
+	WithRel string `extensions:"x-order=J" form:"rel" json:"rel"`
 }
 
 func (spec *ArticleSpec) Sift(q *ormQuery) *ormQuery {
+	rels, _ := ParseRelations(spec.WithRel, "Attachments")
+	for _, rel := range rels {
+		switch rel {
+		case "Attachments":
+			q.Relation(rel, spec.TenantSpec.Sift)
+		}
+	}
+
 	q = spec.ModelSpec.Sift(q)
+	q = spec.TenantSpec.Sift(q)
+	q = spec.OwnerSpec.Sift(q)
+	q, _ = siftOIDs(q, "owner_id", spec.OwnerID, false)
 	q, _ = siftICE(q, "author", spec.Author, false)
 	q, _ = siftMatch(q, "title", spec.Title, false)
 	q, _ = siftDate(q, "news_publish", spec.NewsPublish, true, false)
@@ -118,10 +202,51 @@ func (spec *ArticleSpec) Sift(q *ormQuery) *ormQuery {
 	} else {
 		q, _ = siftEqual(q, "src", spec.Src, false)
 	}
+	q = siftFilter(q, spec.Filter, spec)
 	q = spec.TextSearchSpec.SiftTS(q, !spec.HasColumn())
+	q = spec.SiftRank(q, spec.GetSort())
 
 	return q
 }
+
+// GetSort 排序参数，其中的 json 名换为列名
+func (spec *ArticleSpec) GetSort() string {
+	return sortColumns(spec.Sort, "newsPublish", "news_publish")
+}
+func (spec *ArticleSpec) CanFilter(k string) (FilterField, bool) {
+	switch k {
+	case "author":
+		return FilterField{"author", FilterString}, true
+	case "title":
+		return FilterField{"title", FilterString}, true
+	case "newsPublish":
+		return FilterField{"news_publish", FilterDateTime}, true
+	case "status":
+		return FilterField{"status", FilterInt}, true
+	case "authorID":
+		return FilterField{"author_id", FilterOID}, true
+	case "src":
+		return FilterField{"src", FilterString}, true
+	}
+	return FilterField{}, false
+}
+
+// facetSift 去掉分面字段自身条件的查询条件
+func (spec *ArticleSpec) facetSift(key string) func(*ormQuery) *ormQuery {
+	var zero ArticleSpec
+	sp := *spec
+	sp.Filter = dropFilter(sp.Filter, key)
+	sp.SetTsRank(false)
+	switch key {
+	case "status":
+		sp.Statuses, sp.Status = zero.Statuses, zero.Status
+	case "authorID":
+		sp.AuthorID = zero.AuthorID
+	case "src":
+		sp.Srcs, sp.Src = zero.Srcs, zero.Src
+	}
+	return sp.Sift
+}
 func (spec *ArticleSpec) CanSort(k string) bool {
 	switch k {
 	case "author", "news_publish":
@@ -131,9 +256,31 @@ func (spec *ArticleSpec) CanSort(k string) bool {
 	}
 }
 
+// ArticleStatSpec 文章统计的查询条件
+type ArticleStatSpec struct {
+	ArticleSpec
+
+	// 分组，多个以逗号分隔，默认全部
+	By string `collectionFormat:"csv" enums:"status,src" form:"by" json:"by,omitempty" swaggertype:"array,string"`
+}
+
+// GroupBy 选出的分组列，参数无效时返回 StatByError
+func (spec *ArticleStatSpec) GroupBy() ([]string, error) {
+	return statGroupBy(spec.By, StatGroup{"status", "status"}, StatGroup{"src", "src"})
+}
+
 type AttachmentSpec struct {
 	PageSpec
 	ModelSpec
+	TenantSpec
+
+	// 排序，多个以逗号分隔，前缀 - 表示倒序，如 -created,id
+	Sort string `collectionFormat:"csv" enums:"id,-id,created,-created,updated,-updated" extensions:"x-order=|" form:"sort" json:"sort,omitempty" swaggertype:"array,string"`
+	// 过滤条件，子句以分号分隔，格式 key:op:value，如 articleID:eq:x
+	// 可用的字段: articleID,name,mime,path,size; op: eq,ne,in,like,gt,gte,lt,lte
+	Filter string `extensions:"x-order=~" form:"filter" json:"filter,omitempty"`
+	// 返回的字段，多个以逗号分隔，省略时为全部
+	Fields string `extensions:"x-order=~" form:"fields" json:"fields,omitempty"`
 
 	// 文章编号
 	ArticleID string `extensions:"x-order=A" form:"articleID" json:"articleID"`
@@ -142,35 +289,87 @@ type AttachmentSpec struct {
 	// 类型
 	Mime string `extensions:"x-order=C" form:"mime" json:"mime"`
 	Path string `extensions:"x-order=D" form:"path" json:"path"`
+	// 大小 字节数 (范围 min~max，可省略一端，以 ( ) 包围表示不含边界)
+	Size string `extensions:"x-order=E" form:"size" json:"size"`
 }
 
 func (spec *AttachmentSpec) Sift(q *ormQuery) *ormQuery {
 	q = spec.ModelSpec.Sift(q)
+	q = spec.TenantSpec.Sift(q)
 	q, _ = siftOID(q, "article_id", spec.ArticleID, false)
 	q, _ = siftMatch(q, "name", spec.Name, false)
 	q, _ = siftICE(q, "mime", spec.Mime, false)
 	q, _ = siftMatch(q, "path", spec.Path, false)
+	q, _ = siftRange(q, "size", spec.Size, false, false, false)
+	q = siftFilter(q, spec.Filter, spec)
 
 	return q
 }
+func (spec *AttachmentSpec) GetSort() string {
+	return spec.Sort
+}
+func (spec *AttachmentSpec) CanFilter(k string) (FilterField, bool) {
+	switch k {
+	case "articleID":
+		return FilterField{"article_id", FilterOID}, true
+	case "name":
+		return FilterField{"name", FilterString}, true
+	case "mime":
+		return FilterField{"mime", FilterString}, true
+	case "path":
+		return FilterField{"path", FilterString}, true
+	case "size":
+		return FilterField{"size", FilterInt}, true
+	}
+	return FilterField{}, false
+}
 
 func newContentStore(w *Wrap) *contentStore {
 	s := &contentStore{w: w}
-	RegisterESMigrate((*cms1.Article)(nil), s.MigrateESArticle)
+	if !w.inTx() {
+		RegisterReindex((*cms1.Article)(nil), s.MigrateESArticle)
+		registerOutboxIndex("Article", s.outboxESArticle)
+	}
 	return s
 }
 
+// outboxESArticle 由变更事件同步文章的搜索索引，出错时按事件退避重试
+func (s *contentStore) outboxESArticle(ctx context.Context, ev *OutboxEvent) error {
+	obj := cms1.NewArticleWithID(ev.ObjID)
+	if ev.Action == OutboxDelete {
+		return s.deleteESArticle(ctx, obj)
+	}
+	err := dbGetWithPKID(ctx, s.w.db, obj, ev.ObjID)
+	if errors.Is(err, ErrNotFound) {
+		return s.deleteESArticle(ctx, obj)
+	}
+	if err != nil {
+		return err
+	}
+	return s.upsertESArticle(ctx, obj)
+}
+
 type contentStore struct {
 	w *Wrap
 }
 
 func (s *contentStore) ListClause(ctx context.Context, spec *ClauseSpec) (data cms1.Clauses, total int, err error) {
-	total, err = s.w.db.ListModel(ctx, spec, &data)
+	db := s.w.rdb(ctx)
+	spec.Column(ColumnsFromContext(ctx)...)
+	total, err = db.ListModel(ctx, spec, &data)
 	return
 }
+func (s *contentStore) ExportClause(ctx context.Context, spec *ClauseSpec, fn func(cms1.Clauses) error) error {
+	spec.Column(ColumnsFromContext(ctx)...)
+	return queryBatches(ctx, s.w.db, spec.Sift, fn, func(o *cms1.Clause) any {
+		return int64(o.ID)
+	})
+}
 func (s *contentStore) GetClause(ctx context.Context, id string) (obj *cms1.Clause, err error) {
+	db := s.w.rdb(ctx)
+	cols := ColumnsFromContext(ctx)
 	obj = new(cms1.Clause)
-	err = dbGetWithPKID(ctx, s.w.db, obj, id)
+	err = dbGetWithPKID(ctx, db, obj, id, cols...)
 
 	return
 }
@@ -184,18 +383,41 @@ func (s *contentStore) DeleteClause(ctx context.Context, id string) error {
 }
 
 func (s *contentStore) ListChannel(ctx context.Context, spec *ChannelSpec) (data cms1.Channels, total int, err error) {
+	spec.Column(ColumnsFromContext(ctx)...)
 	total, err = s.w.db.ListModel(ctx, spec, &data)
 	return
 }
+func (s *contentStore) ExportChannel(ctx context.Context, spec *ChannelSpec, fn func(cms1.Channels) error) error {
+	spec.Column(ColumnsFromContext(ctx)...)
+	return queryBatches(ctx, s.w.db, spec.Sift, fn, func(o *cms1.Channel) any {
+		return int64(o.ID)
+	})
+}
 func (s *contentStore) GetChannel(ctx context.Context, id string) (obj *cms1.Channel, err error) {
 	obj = new(cms1.Channel)
-	if err = dbGetWith(ctx, s.w.db, obj, "slug", "=", id); err != nil && obj.SetID(id) {
-		err = dbGetWithPK(ctx, s.w.db, obj)
+	if !cacheGetByID(ctx, s.w, "cms_channel", id, obj) {
+		cols := ColumnsFromContext(ctx)
+		if err = dbGetWith(ctx, s.w.db, obj, "slug", "=", id, cols...); err != nil && obj.SetID(id) {
+			err = dbGetWithPK(ctx, s.w.db, obj, cols...)
+		}
+		if err == nil {
+			cacheSet(ctx, s.w, "cms_channel", obj)
+		}
 	}
 
 	return
 }
+func (s *contentStore) GetChannelByParentIDName(ctx context.Context, parentID string, name string) (obj *cms1.Channel, err error) {
+	obj = new(cms1.Channel)
+	err = dbGet(ctx, s.w.db, obj, "parent_id = ? AND name = ?", oid.Cast(parentID), name)
+	return
+}
 func (s *contentStore) PutChannel(ctx context.Context, id string, in cms1.ChannelSet) (obj *cms1.Channel, err error) {
+	defer func() {
+		if obj != nil {
+			cacheDel[cms1.Channel](ctx, s.w, "cms_channel", obj.StringID())
+		}
+	}()
 	if in.Slug == nil || *in.Slug == "" {
 		err = fmt.Errorf("need slug")
 		return
@@ -208,42 +430,221 @@ func (s *contentStore) PutChannel(ctx context.Context, id string, in cms1.Channe
 	return
 }
 func (s *contentStore) DeleteChannel(ctx context.Context, id string) error {
+	defer cacheDel[cms1.Channel](ctx, s.w, "cms_channel", id)
 	obj := new(cms1.Channel)
 	return s.w.db.DeleteModel(ctx, obj, id)
 }
 
 func (s *contentStore) ListArticle(ctx context.Context, spec *ArticleSpec) (data cms1.Articles, total int, err error) {
+	ctx, ts := traceStart(ctx, "Article", "List")
+	defer func() {
+		ts.End(ctx, err)
+	}()
+	db := s.w.rdb(ctx)
+	if err = spec.SetTenant(ctx); err != nil {
+		return
+	}
+	if err = spec.SetOwner(ctx); err != nil {
+		return
+	}
 	spec.SetTsConfig(s.w.db.GetTsCfg())
 	spec.SetTsFallback("title", "content")
-	q := s.w.db.NewSelect().Model(&data)
-	if err = s.beforeListArticle(ctx, spec, q); err != nil {
+	spec.Column(ColumnsFromContext(ctx)...)
+	if spec.HasColumn() {
+		spec.Column("created")
+	}
+	q := queryList(ctx, db, spec, &data)
+	if err = traceHook(ctx, "Article", "beforeList", func(ctx context.Context) error {
+		return s.beforeListArticle(ctx, spec, q)
+	}); err != nil {
 		return
 	}
-	total, err = queryPager(ctx, spec, q)
+	total, err = queryCursor(ctx, spec, &spec.CursorSpec, q, &data, "created", true, func(o *cms1.Article) (any, any) {
+		return o.CreatedAt, int64(o.ID)
+	})
 	if err == nil {
-		err = s.afterListArticle(ctx, spec, data)
+		err = queryHeadlines(ctx, db, &spec.TsRankSpec, data, func(o *cms1.Article) any {
+			return int64(o.ID)
+		}, func(o *cms1.Article, hl map[string]string) {
+			o.Headline = hl
+		}, [2]string{"title", "title"}, [2]string{"content", "content"})
+	}
+	if err == nil {
+		err = traceHook(ctx, "Article", "afterList", func(ctx context.Context) error {
+			return s.afterListArticle(ctx, spec, data)
+		})
 	}
 	return
 }
+func (s *contentStore) FacetArticle(ctx context.Context, spec *ArticleSpec) (data Facets, err error) {
+	ctx, ts := traceStart(ctx, "Article", "Facet")
+	defer func() {
+		ts.End(ctx, err)
+	}()
+	if err = spec.SetTenant(ctx); err != nil {
+		return
+	}
+	if err = spec.SetOwner(ctx); err != nil {
+		return
+	}
+	spec.SetTsConfig(s.w.db.GetTsCfg())
+	spec.SetTsFallback("title", "content")
+	return queryFacets(ctx, s.w.db, (*cms1.Article)(nil), spec.facetSift, FacetField{"status", "status", FilterInt}, FacetField{"authorID", "author_id", FilterOID}, FacetField{"src", "src", FilterString})
+}
+func (s *contentStore) ExportArticle(ctx context.Context, spec *ArticleSpec, fn func(cms1.Articles) error) (err error) {
+	ctx, ts := traceStart(ctx, "Article", "Export")
+	defer func() {
+		ts.End(ctx, err)
+	}()
+	if err = spec.SetTenant(ctx); err != nil {
+		return
+	}
+	if err = spec.SetOwner(ctx); err != nil {
+		return
+	}
+	spec.SetTsConfig(s.w.db.GetTsCfg())
+	spec.SetTsFallback("title", "content")
+	spec.SetTsRank(false)
+	spec.Column(ColumnsFromContext(ctx)...)
+	return queryBatches(ctx, s.w.db, spec.Sift, fn, func(o *cms1.Article) any {
+		return int64(o.ID)
+	})
+}
+func (s *contentStore) AggregateArticle(ctx context.Context, spec *ArticleStatSpec) (data cms1.ArticleStats, err error) {
+	ctx, ts := traceStart(ctx, "Article", "Aggregate")
+	defer func() {
+		ts.End(ctx, err)
+	}()
+	cols, err := spec.GroupBy()
+	if err != nil {
+		return
+	}
+	if err = spec.SetTenant(ctx); err != nil {
+		return
+	}
+	if err = spec.SetOwner(ctx); err != nil {
+		return
+	}
+	spec.SetTsConfig(s.w.db.GetTsCfg())
+	spec.SetTsFallback("title", "content")
+	spec.SetTsRank(false)
+	spec.Column(cols...)
+	spec.Column("news_publish")
+	sub := spec.Sift(s.w.db.NewSelect().Model((*cms1.Article)(nil)))
+	q := s.w.db.NewSelect().TableExpr("(?) AS t", sub)
+	for _, col := range cols {
+		q.ColumnExpr("t.?", pgIdent(col)).GroupExpr("t.?", pgIdent(col)).OrderExpr("t.?", pgIdent(col))
+	}
+	q.ColumnExpr("count(*) AS count")
+	q.ColumnExpr("min(t.news_publish) AS min_news_publish")
+	q.ColumnExpr("max(t.news_publish) AS max_news_publish")
+	err = q.Scan(ctx, &data)
+	return
+}
 func (s *contentStore) GetArticle(ctx context.Context, id string) (obj *cms1.Article, err error) {
+	ctx, ts := traceStart(ctx, "Article", "Get")
+	defer func() {
+		ts.End(ctx, err)
+	}()
+	db := s.w.rdb(ctx)
+	cols := ownerColumns(ColumnsFromContext(ctx))
 	obj = new(cms1.Article)
-	err = dbGetWithPKID(ctx, s.w.db, obj, id)
+	err = dbGetWithTenant(ctx, db, obj, id, cols...)
+	if err == nil {
+		err = ownerCheck(ctx, obj)
+	}
+	if err == nil {
+		for _, rn := range RelationFromContext(ctx) {
+			if rn == "Attachments" {
+				if err = db.NewSelect().Model(&obj.Attachments).Where("article_id = ?", obj.ID).Apply(tenantSift(ctx)).Scan(ctx); err != nil {
+					return
+				}
+				continue
+			}
+		}
+	}
 	if err == nil {
-		err = s.afterLoadArticle(ctx, obj)
+		err = traceHook(ctx, "Article", "afterLoad", func(ctx context.Context) error {
+			return runHooks(ctx, s.w.db, obj, s.afterLoadArticle, HookAfterLoad)
+		})
 	}
 	return
 }
 func (s *contentStore) CreateArticle(ctx context.Context, in cms1.ArticleBasic) (obj *cms1.Article, err error) {
+	ctx, ts := traceStart(ctx, "Article", "Create")
+	defer func() {
+		ts.End(ctx, err)
+	}()
 	err = s.w.db.RunInTx(ctx, nil, func(ctx context.Context, tx pgTx) (err error) {
 		obj, err = CreateArticle(ctx, tx, in)
 		return err
 	})
 	if err == nil {
-		err = s.upsertESArticle(ctx, obj)
+		err = s.w.afterCommit(ctx, "Article", func(ctx context.Context) error {
+			return traceHook(ctx, "Article", "afterCreated", func(ctx context.Context) error {
+				return runHooks(ctx, s.w.db, obj, nil, HookAfterCreated)
+			})
+		})
 	}
 	return
 }
-func (s *contentStore) UpdateArticle(ctx context.Context, id string, in cms1.ArticleSet) error {
+func (s *contentStore) CreateArticles(ctx context.Context, in []cms1.ArticleBasic) (res []BulkResult, err error) {
+	ctx, ts := traceStart(ctx, "Article", "CreateBulk")
+	defer func() {
+		ts.End(ctx, err)
+	}()
+	objs, res, err := bulkCreate(ctx, s.w.db, in, func(ctx context.Context, tx pgTx, in cms1.ArticleBasic) (obj *cms1.Article, err error) {
+		obj = cms1.NewArticleWithBasic(in)
+		if err = tenantStamp(ctx, obj); err != nil {
+			return
+		}
+		if err = ownerStamp(ctx, obj); err != nil {
+			return
+		}
+		if tscfg, ok := DbTsCheck(); ok {
+			obj.TsCfgName = tscfg
+			obj.SetTsColumns("title", "content")
+		}
+		if err = traceHook(ctx, "Article", "beforeCreating", func(ctx context.Context) error {
+			return runTxHooks(ctx, tx, obj, dbBeforeSaveArticle, HookBeforeCreating, HookBeforeSaving)
+		}); err != nil {
+			return
+		}
+		dbMetaUp(ctx, tx, obj)
+		return
+	}, func(ctx context.Context, tx pgTx, in cms1.ArticleBasic, obj *cms1.Article) (err error) {
+		if err == nil {
+			err = traceHook(ctx, "Article", "afterCreating", func(ctx context.Context) error {
+				return runTxHooks(ctx, tx, obj, dbAfterCreateArticle, HookAfterCreating, HookAfterSaving)
+			})
+		}
+		if err == nil && len(in.Attachments) > 0 {
+			err = dbCreateArticleAttachments(ctx, tx, obj, in.Attachments)
+		}
+		if err == nil {
+			err = dbOutbox(ctx, tx, "Article", obj.StringID(), OutboxCreate, nil)
+		}
+		return
+	})
+	for i, obj := range objs {
+		if res[i].Error != nil {
+			continue
+		}
+		if err1 := s.w.afterCommit(ctx, "Article", func(ctx context.Context) error {
+			return traceHook(ctx, "Article", "afterCreated", func(ctx context.Context) error {
+				return runHooks(ctx, s.w.db, obj, nil, HookAfterCreated)
+			})
+		}); err1 != nil {
+			logger().Infow("bulk after commit fail", "id", obj.ID, "err", err1)
+		}
+	}
+	return
+}
+func (s *contentStore) UpdateArticle(ctx context.Context, id string, in cms1.ArticleSet) (err error) {
+	ctx, ts := traceStart(ctx, "Article", "Update")
+	defer func() {
+		ts.End(ctx, err)
+	}()
 	var exist *cms1.Article
 	if err := s.w.db.RunInTx(ctx, nil, func(ctx context.Context, tx pgTx) (err error) {
 		exist, err = UpdateArticle(ctx, tx, id, in)
@@ -251,32 +652,183 @@ func (s *contentStore) UpdateArticle(ctx context.Context, id string, in cms1.Art
 	}); err != nil {
 		return err
 	}
-	return s.upsertESArticle(ctx, exist)
+	return s.w.afterCommit(ctx, "Article", func(ctx context.Context) error {
+		return traceHook(ctx, "Article", "afterUpdated", func(ctx context.Context) error {
+			return runHooks(ctx, s.w.db, exist, nil, HookAfterUpdated)
+		})
+	})
 }
-func (s *contentStore) DeleteArticle(ctx context.Context, id string) error {
+func (s *contentStore) UpdateArticles(ctx context.Context, ids []string, in []cms1.ArticleSet) (res []BulkResult, err error) {
+	ctx, ts := traceStart(ctx, "Article", "UpdateBulk")
+	defer func() {
+		ts.End(ctx, err)
+	}()
+	objs, res, err := bulkUpdate(ctx, s.w.db, ids, in, func(ctx context.Context, tx pgTx, id string, in cms1.ArticleSet) (exist *cms1.Article, err error) {
+		exist = new(cms1.Article)
+		if err = dbGetWithTenant(ctx, tx, exist, id); err != nil {
+			return
+		}
+		if err = ownerCheck(ctx, exist); err != nil {
+			return
+		}
+		exist.SetIsUpdate(true)
+		exist.SetWith(in)
+		if tscfg, ok := DbTsCheck(); ok {
+			exist.TsCfgName = tscfg
+			exist.SetTsColumns("title", "content")
+			exist.SetChange("ts_cfg")
+		}
+		if err = traceHook(ctx, "Article", "beforeUpdating", func(ctx context.Context) error {
+			return runTxHooks(ctx, tx, exist, dbBeforeSaveArticle, HookBeforeUpdating, HookBeforeSaving)
+		}); err != nil {
+			return
+		}
+		if in.Attachments != nil {
+			if err = dbSaveArticleAttachments(ctx, tx, exist, *in.Attachments); err != nil {
+				return
+			}
+		}
+		dbMetaUp(ctx, tx, exist)
+		return
+	}, func(ctx context.Context, tx pgTx, in cms1.ArticleSet, exist *cms1.Article) (err error) {
+		if err = traceHook(ctx, "Article", "afterUpdating", func(ctx context.Context) error {
+			return runTxHooks(ctx, tx, exist, dbAfterUpdateArticle, HookAfterUpdating, HookAfterSaving)
+		}); err != nil {
+			return
+		}
+		return dbOutbox(ctx, tx, "Article", exist.StringID(), OutboxUpdate, exist.ChangedValues())
+	})
+	for i, obj := range objs {
+		if res[i].Error != nil {
+			continue
+		}
+		if err1 := s.w.afterCommit(ctx, "Article", func(ctx context.Context) error {
+			return traceHook(ctx, "Article", "afterUpdated", func(ctx context.Context) error {
+				return runHooks(ctx, s.w.db, obj, nil, HookAfterUpdated)
+			})
+		}); err1 != nil {
+			logger().Infow("bulk after commit fail", "id", obj.ID, "err", err1)
+		}
+	}
+	return
+}
+func (s *contentStore) DeleteArticle(ctx context.Context, id string) (err error) {
+	ctx, ts := traceStart(ctx, "Article", "Delete")
+	defer func() {
+		ts.End(ctx, err)
+	}()
 	obj := new(cms1.Article)
-	if err := dbGetWithPKID(ctx, s.w.db, obj, id); err != nil {
+	if err := dbGetWithTenant(ctx, s.w.db, obj, id); err != nil {
+		return err
+	}
+	if err := ownerCheck(ctx, obj); err != nil {
 		return err
 	}
 	if err := s.w.db.RunInTx(ctx, nil, func(ctx context.Context, tx pgTx) (err error) {
+		if err = traceHook(ctx, "Article", "beforeDeleting", func(ctx context.Context) error {
+			return runTxHooks(ctx, tx, obj, nil, HookBeforeDeleting)
+		}); err != nil {
+			return
+		}
 		err = dbDeleteM(ctx, tx, s.w.db.Schema(), s.w.db.SchemaCrap(), obj)
 		if err != nil {
 			return
 		}
-		return dbAfterDeleteArticle(ctx, tx, obj)
+		if err = traceHook(ctx, "Article", "afterDeleting", func(ctx context.Context) error {
+			return runTxHooks(ctx, tx, obj, dbAfterDeleteArticle, HookAfterDeleting)
+		}); err != nil {
+			return
+		}
+		return dbOutbox(ctx, tx, "Article", obj.StringID(), OutboxDelete, nil)
 	}); err != nil {
 		return err
 	}
-	return s.deleteESArticle(ctx, obj)
+	return s.w.afterCommit(ctx, "Article", func(ctx context.Context) error {
+		return traceHook(ctx, "Article", "afterDeleted", func(ctx context.Context) error {
+			return runHooks(ctx, s.w.db, obj, nil, HookAfterDeleted)
+		})
+	})
 }
 
+func (s *contentStore) ImportArticle(ctx context.Context, in []cms1.ArticleBasic, dryRun bool) (ids []string, err error) {
+	ctx, ts := traceStart(ctx, "Article", "Import")
+	defer func() {
+		ts.End(ctx, err)
+	}()
+	objs, err := importChunks(ctx, s.w.db, in, dryRun, func(ctx context.Context, tx pgTx, in cms1.ArticleBasic) (obj *cms1.Article, err error) {
+		obj = cms1.NewArticleWithBasic(in)
+		if err = tenantStamp(ctx, obj); err != nil {
+			return
+		}
+		if err = ownerStamp(ctx, obj); err != nil {
+			return
+		}
+		if tscfg, ok := DbTsCheck(); ok {
+			obj.TsCfgName = tscfg
+			obj.SetTsColumns("title", "content")
+		}
+		if err = traceHook(ctx, "Article", "beforeCreating", func(ctx context.Context) error {
+			return runTxHooks(ctx, tx, obj, dbBeforeSaveArticle, HookBeforeCreating, HookBeforeSaving)
+		}); err != nil {
+			return
+		}
+		dbMetaUp(ctx, tx, obj)
+		err = dbInsert(ctx, tx, obj)
+		if err == nil {
+			err = traceHook(ctx, "Article", "afterCreating", func(ctx context.Context) error {
+				return runTxHooks(ctx, tx, obj, dbAfterCreateArticle, HookAfterCreating, HookAfterSaving)
+			})
+		}
+		if err == nil && len(in.Attachments) > 0 {
+			err = dbCreateArticleAttachments(ctx, tx, obj, in.Attachments)
+		}
+		if err == nil {
+			err = dbOutbox(ctx, tx, "Article", obj.StringID(), OutboxCreate, nil)
+		}
+		return
+	})
+	for _, obj := range objs {
+		// 出错而跳过的
+		if obj == nil {
+			ids = append(ids, "")
+			continue
+		}
+		ids = append(ids, obj.StringID())
+		if !dryRun {
+			if err1 := s.w.afterCommit(ctx, "Article", func(ctx context.Context) error {
+				return traceHook(ctx, "Article", "afterCreated", func(ctx context.Context) error {
+					return runHooks(ctx, s.w.db, obj, nil, HookAfterCreated)
+				})
+			}); err1 != nil {
+				logger().Infow("import after created fail", "id", obj.ID, "err", err1)
+			}
+		}
+	}
+	return
+}
 func (s *contentStore) ListAttachment(ctx context.Context, spec *AttachmentSpec) (data cms1.Attachments, total int, err error) {
-	total, err = s.w.db.ListModel(ctx, spec, &data)
+	db := s.w.rdb(ctx)
+	if err = spec.SetTenant(ctx); err != nil {
+		return
+	}
+	spec.Column(ColumnsFromContext(ctx)...)
+	total, err = db.ListModel(ctx, spec, &data)
 	return
 }
+func (s *contentStore) ExportAttachment(ctx context.Context, spec *AttachmentSpec, fn func(cms1.Attachments) error) (err error) {
+	if err = spec.SetTenant(ctx); err != nil {
+		return
+	}
+	spec.Column(ColumnsFromContext(ctx)...)
+	return queryBatches(ctx, s.w.db, spec.Sift, fn, func(o *cms1.Attachment) any {
+		return int64(o.ID)
+	})
+}
 func (s *contentStore) GetAttachment(ctx context.Context, id string) (obj *cms1.Attachment, err error) {
+	db := s.w.rdb(ctx)
+	cols := ColumnsFromContext(ctx)
 	obj = new(cms1.Attachment)
-	err = dbGetWithPKID(ctx, s.w.db, obj, id)
+	err = dbGetWithTenant(ctx, db, obj, id, cols...)
 
 	return
 }
@@ -286,28 +838,65 @@ func (s *contentStore) CreateAttachment(ctx context.Context, in cms1.AttachmentB
 }
 func (s *contentStore) DeleteAttachment(ctx context.Context, id string) error {
 	obj := new(cms1.Attachment)
+	if err := dbGetWithTenant(ctx, s.w.db, obj, id); err != nil {
+		return err
+	}
 	return s.w.db.DeleteModel(ctx, obj, id)
 }
 
 func CreateArticle(ctx context.Context, db ormDB, in cms1.ArticleBasic) (obj *cms1.Article, err error) {
 	obj = cms1.NewArticleWithBasic(in)
+	if err = tenantStamp(ctx, obj); err != nil {
+		return
+	}
+	if err = ownerStamp(ctx, obj); err != nil {
+		return
+	}
 	if tscfg, ok := DbTsCheck(); ok {
 		obj.TsCfgName = tscfg
 		obj.SetTsColumns("title", "content")
 	}
-	if err = dbBeforeSaveArticle(ctx, db, obj); err != nil {
+	if err = traceHook(ctx, "Article", "beforeCreating", func(ctx context.Context) error {
+		return runTxHooks(ctx, db, obj, dbBeforeSaveArticle, HookBeforeCreating, HookBeforeSaving)
+	}); err != nil {
 		return
 	}
 	dbMetaUp(ctx, db, obj)
 	err = dbInsert(ctx, db, obj)
 	if err == nil {
-		err = dbAfterCreateArticle(ctx, db, obj)
+		err = traceHook(ctx, "Article", "afterCreating", func(ctx context.Context) error {
+			return runTxHooks(ctx, db, obj, dbAfterCreateArticle, HookAfterCreating, HookAfterSaving)
+		})
+	}
+	if err == nil && len(in.Attachments) > 0 {
+		err = dbCreateArticleAttachments(ctx, db, obj, in.Attachments)
+	}
+	if err == nil {
+		err = dbOutbox(ctx, db, "Article", obj.StringID(), OutboxCreate, nil)
+	}
+	return
+}
+
+// dbCreateArticleAttachments 创建从属的附件
+func dbCreateArticleAttachments(ctx context.Context, db ormDB, obj *cms1.Article, items []cms1.AttachmentBasic) (err error) {
+	for _, in := range items {
+		co := cms1.NewAttachmentWithBasic(in)
+		co.ArticleID = obj.ID
+		co.TenantID = obj.TenantID
+		dbMetaUp(ctx, db, co)
+		if err = dbInsert(ctx, db, co); err != nil {
+			return
+		}
+		obj.Attachments = append(obj.Attachments, *co)
 	}
 	return
 }
 func UpdateArticle(ctx context.Context, db ormDB, id string, in cms1.ArticleSet) (exist *cms1.Article, err error) {
 	exist = new(cms1.Article)
-	if err = dbGetWithPKID(ctx, db, exist, id); err != nil {
+	if err = dbGetWithTenant(ctx, db, exist, id); err != nil {
+		return
+	}
+	if err = ownerCheck(ctx, exist); err != nil {
 		return
 	}
 	exist.SetIsUpdate(true)
@@ -317,18 +906,79 @@ func UpdateArticle(ctx context.Context, db ormDB, id string, in cms1.ArticleSet)
 		exist.SetTsColumns("title", "content")
 		exist.SetChange("ts_cfg")
 	}
-	if err = dbBeforeSaveArticle(ctx, db, exist); err != nil {
+	if err = traceHook(ctx, "Article", "beforeUpdating", func(ctx context.Context) error {
+		return runTxHooks(ctx, db, exist, dbBeforeSaveArticle, HookBeforeUpdating, HookBeforeSaving)
+	}); err != nil {
 		return
 	}
+	if in.Attachments != nil {
+		if err = dbSaveArticleAttachments(ctx, db, exist, *in.Attachments); err != nil {
+			return
+		}
+	}
 	dbMetaUp(ctx, db, exist)
 	if err = dbUpdate(ctx, db, exist); err != nil {
 		return
 	}
-	err = dbAfterUpdateArticle(ctx, db, exist)
+	if err = traceHook(ctx, "Article", "afterUpdating", func(ctx context.Context) error {
+		return runTxHooks(ctx, db, exist, dbAfterUpdateArticle, HookAfterUpdating, HookAfterSaving)
+	}); err != nil {
+		return
+	}
+	err = dbOutbox(ctx, db, "Article", exist.StringID(), OutboxUpdate, exist.ChangedValues())
+	return
+}
+
+// dbSaveArticleAttachments 保存从属的附件，有编号的更新，无编号的新建，不在列表中的删除
+func dbSaveArticleAttachments(ctx context.Context, db ormDB, obj *cms1.Article, items []cms1.AttachmentNested) (err error) {
+	var olds cms1.Attachments
+	if err = db.NewSelect().Model(&olds).Where("article_id = ?", obj.ID).Apply(tenantSift(ctx)).Scan(ctx); err != nil {
+		return
+	}
+	obj.Attachments = nil
+	for _, it := range items {
+		if len(it.ID) == 0 {
+			co := new(cms1.Attachment)
+			co.SetWith(it.AttachmentSet)
+			co.ArticleID = obj.ID
+			co.TenantID = obj.TenantID
+			dbMetaUp(ctx, db, co)
+			if err = dbInsert(ctx, db, co); err != nil {
+				return
+			}
+			obj.Attachments = append(obj.Attachments, *co)
+			continue
+		}
+		i := slices.IndexFunc(olds, func(o cms1.Attachment) bool {
+			return o.StringID() == it.ID
+		})
+		if i < 0 {
+			return ErrNotFound
+		}
+		co := &olds[i]
+		co.SetIsUpdate(true)
+		co.SetWith(it.AttachmentSet)
+		co.ArticleID = obj.ID
+		dbMetaUp(ctx, db, co)
+		if err = dbUpdate(ctx, db, co); err != nil {
+			return
+		}
+		obj.Attachments = append(obj.Attachments, *co)
+		olds = slices.Delete(olds, i, i+1)
+	}
+	for i := range olds {
+		co := &olds[i]
+		if err = dbDeleteM(ctx, db, dbSchema(), dbSchemaCrap(), co); err != nil {
+			return
+		}
+	}
 	return
 }
 func CreateAttachment(ctx context.Context, db ormDB, in cms1.AttachmentBasic) (obj *cms1.Attachment, err error) {
 	obj = cms1.NewAttachmentWithBasic(in)
+	if err = tenantStamp(ctx, obj); err != nil {
+		return
+	}
 	dbMetaUp(ctx, db, obj)
 	err = dbInsert(ctx, db, obj)
 	return
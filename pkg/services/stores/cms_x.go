@@ -30,53 +30,16 @@ func (s *contentStore) upsertESArticle(ctx context.Context, obj *cms1.Article) e
 	if obj == nil {
 		return nil
 	}
-	// TODO:
-	err := UpsertESDoc(ctx, obj.IdentityTable(), obj)
-	if err != nil {
-		logger().Infow("UpsertESDoc", "index", obj.IdentityTable(), "error", err)
-		return nil
-	}
-	return nil
+	return indexUpsert(ctx, obj)
 }
-func (s *contentStore) MigrateESArticle(ctx context.Context) (err error) {
-	var (
-		ms          cms1.Articles
-		limit, page = 1000, 1
-	)
-	for {
-		var spec ArticleSpec
-		spec.Limit = limit
-		spec.Page = page
-		spec.Sort = "created desc"
-		// TODO:
-		ms, _, err = s.w.Content().ListArticle(ctx, &spec)
-		if err != nil && err != ErrNoRows {
-			logger().Infow("get Article", "error", err)
-			return
-		}
-		if len(ms) == 0 {
-			break
-		}
-		for i := range ms {
-			err = s.upsertESArticle(ctx, &ms[i])
-			if err != nil {
-				return
-			}
-		}
-		page++
-	}
-	return
+func (s *contentStore) MigrateESArticle(ctx context.Context, after string, limit int) (last string, n int, err error) {
+	return reindexBatch[cms1.Articles](ctx, s.w.db, after, limit)
 }
 func (s *contentStore) deleteESArticle(ctx context.Context, obj *cms1.Article) error {
 	if obj == nil {
 		return nil
 	}
-	err := DeleteESDoc(ctx, obj.IdentityTable(), obj.StringID())
-	if err != nil {
-		logger().Infow("DeleteESDoc", "index", obj.IdentityTable(), "error", err)
-		return nil
-	}
-	return nil
+	return indexDelete(ctx, obj.IdentityTable(), obj.StringID())
 }
 func dbAfterCreateArticle(ctx context.Context, db ormDB, obj *cms1.Article) error {
 	// TODO: need implement
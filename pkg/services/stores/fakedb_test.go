@@ -0,0 +1,109 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+
+	"github.com/cupogo/andvari/stores/pgx"
+)
+
+// fakeDriver 记下执行的 SQL 的 database/sql 驱动，不连接数据库
+// 查询的结果由 query 给出，出错由 fail 决定，均可为空
+type fakeDriver struct {
+	mu    sync.Mutex
+	execs []string
+
+	query func(q string) (cols []string, rows [][]driver.Value)
+	fail  func(q string) error
+}
+
+// newFakeWrap 以 fakeDriver 为数据库的存储
+func newFakeWrap(drv *fakeDriver) *Wrap {
+	return NewWithDB(&pgx.DB{DB: bun.NewDB(sql.OpenDB(drv), pgdialect.New())})
+}
+
+func (d *fakeDriver) record(q string) error {
+	d.mu.Lock()
+	d.execs = append(d.execs, q)
+	d.mu.Unlock()
+	if d.fail != nil {
+		return d.fail(q)
+	}
+	return nil
+}
+
+// Execs 执行过的 SQL 中含 sub 的
+func (d *fakeDriver) Execs(sub string) (out []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, q := range d.execs {
+		if strings.Contains(q, sub) {
+			out = append(out, q)
+		}
+	}
+	return
+}
+
+func (d *fakeDriver) Connect(context.Context) (driver.Conn, error) { return fakeConn{d}, nil }
+func (d *fakeDriver) Driver() driver.Driver                        { return d }
+func (d *fakeDriver) Open(string) (driver.Conn, error)             { return fakeConn{d}, nil }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("fake: prepare") }
+func (c fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return fakeTx{c.d}, c.d.record("BEGIN")
+}
+
+func (c fakeConn) ExecContext(_ context.Context, q string, _ []driver.NamedValue) (driver.Result, error) {
+	if err := c.d.record(q); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c fakeConn) QueryContext(_ context.Context, q string, _ []driver.NamedValue) (driver.Rows, error) {
+	if err := c.d.record(q); err != nil {
+		return nil, err
+	}
+	rs := &fakeRows{}
+	if c.d.query != nil {
+		rs.cols, rs.rows = c.d.query(q)
+	}
+	return rs, nil
+}
+
+type fakeTx struct{ d *fakeDriver }
+
+func (t fakeTx) Commit() error   { return t.d.record("COMMIT") }
+func (t fakeTx) Rollback() error { return t.d.record("ROLLBACK") }
+
+type fakeRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
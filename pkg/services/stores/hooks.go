@@ -0,0 +1,106 @@
+package stores
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/cupogo/andvari/stores/pgx"
+)
+
+// HookEvent 模型的钩子事件，同 hooks 中的键
+type HookEvent string
+
+const (
+	HookBeforeSaving   HookEvent = "beforeSaving"
+	HookAfterSaving    HookEvent = "afterSaving"
+	HookBeforeCreating HookEvent = "beforeCreating"
+	HookAfterCreating  HookEvent = "afterCreating"
+	HookBeforeUpdating HookEvent = "beforeUpdating"
+	HookAfterUpdating  HookEvent = "afterUpdating"
+	HookBeforeDeleting HookEvent = "beforeDeleting"
+	HookAfterDeleting  HookEvent = "afterDeleting"
+	HookAfterCreated   HookEvent = "afterCreated"
+	HookAfterUpdated   HookEvent = "afterUpdated"
+	HookAfterDeleted   HookEvent = "afterDeleted"
+	HookAfterLoad      HookEvent = "afterLoad"
+)
+
+// HookFunc 注册的钩子，...ing 事件中 db 为当前的事务，其余为存储的连接
+type HookFunc[T any] func(ctx context.Context, db pgx.IDB, obj *T) error
+
+type hookKey struct {
+	typ reflect.Type
+	ev  HookEvent
+}
+
+type hookEntry struct {
+	order int
+	seq   int
+	fn    any
+}
+
+var (
+	hooksMu  sync.RWMutex
+	hooksSeq int
+	hooksReg = make(map[hookKey][]hookEntry)
+)
+
+// OnHook 注册模型 T 在 ev 上的钩子，order 小的先调用，相同的按注册的先后，通常在 init 中注册
+// 仅对开启 hookRegistry 的模型生效，在 hooks 中定义的钩子先于注册的调用
+func OnHook[T any](ev HookEvent, order int, fn HookFunc[T]) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooksSeq++
+	key := hookKey{reflect.TypeFor[T](), ev}
+	hooksReg[key] = append(hooksReg[key], hookEntry{order: order, seq: hooksSeq, fn: fn})
+}
+
+// hooksOf 模型 T 在 evs 上注册的钩子，按 order 和注册的先后排序
+func hooksOf[T any](evs ...HookEvent) (out []hookEntry) {
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	typ := reflect.TypeFor[T]()
+	for _, ev := range evs {
+		out = append(out, hooksReg[hookKey{typ, ev}]...)
+	}
+	slices.SortFunc(out, func(a, b hookEntry) int {
+		if a.order != b.order {
+			return a.order - b.order
+		}
+		return a.seq - b.seq
+	})
+	return
+}
+
+// runTxHooks 事务中的钩子，先调用定义的 fn，再依次调用 evs 上注册的，出错即止
+func runTxHooks[T any](ctx context.Context, db ormDB, obj *T,
+	fn func(ctx context.Context, db ormDB, obj *T) error, evs ...HookEvent) error {
+	if fn != nil {
+		if err := fn(ctx, db, obj); err != nil {
+			return err
+		}
+	}
+	return callHooks(ctx, db, obj, evs)
+}
+
+// runHooks 提交后或读取后的钩子，先调用定义的 fn，再依次调用 evs 上注册的，出错即止
+func runHooks[T any](ctx context.Context, db ormDB, obj *T,
+	fn func(ctx context.Context, obj *T) error, evs ...HookEvent) error {
+	if fn != nil {
+		if err := fn(ctx, obj); err != nil {
+			return err
+		}
+	}
+	return callHooks(ctx, db, obj, evs)
+}
+
+func callHooks[T any](ctx context.Context, db ormDB, obj *T, evs []HookEvent) error {
+	for _, he := range hooksOf[T](evs...) {
+		if err := he.fn.(HookFunc[T])(ctx, db, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package stores
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cupogo/andvari/models/oid"
+	"github.com/cupogo/andvari/stores/pgx"
+
+	"github.com/cupogo/scaffold/pkg/models/cms1"
+)
+
+// resetHooks 测试结束后去掉 T 在 evs 上注册的钩子
+func resetHooks[T any](t *testing.T, evs ...HookEvent) {
+	t.Cleanup(func() {
+		hooksMu.Lock()
+		defer hooksMu.Unlock()
+		for _, ev := range evs {
+			delete(hooksReg, hookKey{reflect.TypeFor[T](), ev})
+		}
+	})
+}
+
+type hookThing struct{ calls []string }
+
+func TestHookOrder(t *testing.T) {
+	resetHooks[hookThing](t, HookBeforeCreating, HookBeforeSaving, HookAfterCreated)
+	add := func(ev HookEvent, order int, name string, err error) {
+		OnHook(ev, order, func(_ context.Context, _ pgx.IDB, obj *hookThing) error {
+			obj.calls = append(obj.calls, name)
+			return err
+		})
+	}
+	add(HookBeforeSaving, 2, "saving2", nil)
+	add(HookBeforeCreating, 1, "creating1", nil)
+	add(HookBeforeSaving, 1, "saving1", nil) // 同 order 的按注册的先后
+	add(HookBeforeCreating, 3, "creating3", nil)
+	add(HookAfterCreated, 0, "created", nil)
+
+	ctx := context.Background()
+	obj := new(hookThing)
+	err := runTxHooks(ctx, nil, obj, func(_ context.Context, _ ormDB, obj *hookThing) error {
+		obj.calls = append(obj.calls, "defined")
+		return nil
+	}, HookBeforeCreating, HookBeforeSaving)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"defined", "creating1", "saving1", "saving2", "creating3"}; !slices.Equal(obj.calls, want) {
+		t.Errorf("want %v, got %v", want, obj.calls)
+	}
+
+	// 出错即止
+	errAbort := errors.New("abort")
+	add(HookBeforeSaving, 1, "abort", errAbort)
+	obj = new(hookThing)
+	if err = runTxHooks(ctx, nil, obj, nil, HookBeforeCreating, HookBeforeSaving); !errors.Is(err, errAbort) {
+		t.Errorf("want %v, got %v", errAbort, err)
+	}
+	if want := []string{"creating1", "saving1", "abort"}; !slices.Equal(obj.calls, want) {
+		t.Errorf("want %v, got %v", want, obj.calls)
+	}
+	obj = new(hookThing)
+	if err = runHooks(ctx, nil, obj, func(context.Context, *hookThing) error { return errAbort }, HookAfterCreated); !errors.Is(err, errAbort) || len(obj.calls) > 0 {
+		t.Errorf("defined hook fail: %v %v", err, obj.calls)
+	}
+}
+
+func TestHooksOnDelete(t *testing.T) {
+	resetHooks[cms1.Article](t, HookBeforeDeleting, HookAfterDeleted)
+	uid, tid := oid.NewID(oid.OtAccount), oid.NewID(oid.OtCompany)
+	drv := &fakeDriver{query: func(q string) ([]string, [][]driver.Value) {
+		switch {
+		case strings.Contains(q, "op_affect_delete"):
+			return []string{"ret"}, [][]driver.Value{{int64(1)}}
+		case !strings.HasPrefix(q, `SELECT "a".`):
+			return nil, nil
+		}
+		return []string{"id", "tenant_id", "owner_id"}, [][]driver.Value{{int64(oid.NewID(oid.OtArticle)), int64(tid), int64(uid)}}
+	}}
+	w := newFakeWrap(drv)
+	ctx := ContextWithTenant(ContextWithCaller(context.Background(), Caller{ID: uid}), tid)
+	id := oid.NewID(oid.OtArticle).String()
+
+	var abort error
+	var deleted []int // 调用时已提交的次数
+	OnHook(HookBeforeDeleting, 0, func(context.Context, pgx.IDB, *cms1.Article) error { return abort })
+	OnHook(HookAfterDeleted, 0, func(context.Context, pgx.IDB, *cms1.Article) error {
+		deleted = append(deleted, len(drv.Execs("COMMIT")))
+		return nil
+	})
+
+	// 删除前的钩子出错时回滚，不删除，也不调用提交后的钩子
+	abort = errors.New("abort")
+	if err := w.Content().DeleteArticle(ctx, id); !errors.Is(err, abort) {
+		t.Fatalf("want %v, got %v", abort, err)
+	}
+	if len(drv.Execs("op_affect_delete")) > 0 || len(drv.Execs("ROLLBACK")) != 1 || len(deleted) > 0 {
+		t.Errorf("aborted: deleted %v, statements %q", deleted, drv.execs)
+	}
+
+	// 提交后才调用
+	abort = nil
+	if err := w.Content().DeleteArticle(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(deleted, []int{1}) || len(drv.Execs("op_affect_delete")) != 1 {
+		t.Errorf("after commit: want [1], got %v", deleted)
+	}
+
+	// 在 InTx 中时待最外层事务提交，回滚时不调用
+	errTx := errors.New("tx fail")
+	err := w.InTx(ctx, func(sto Storage) error {
+		if err := sto.Content().DeleteArticle(ctx, id); err != nil {
+			return err
+		}
+		if len(deleted) != 1 {
+			t.Error("afterDeleted called before InTx commits")
+		}
+		return errTx
+	})
+	if !errors.Is(err, errTx) || len(deleted) != 1 {
+		t.Errorf("rolled back: %v, deleted %v", err, deleted)
+	}
+	if err = w.InTx(ctx, func(sto Storage) error {
+		return sto.Content().DeleteArticle(ctx, id)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(deleted, []int{1, 2}) {
+		t.Errorf("in tx: want [1 2], got %v", deleted)
+	}
+}
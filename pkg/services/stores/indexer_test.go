@@ -0,0 +1,287 @@
+package stores
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cupogo/andvari/models/oid"
+	"github.com/cupogo/scaffold/pkg/models/cms1"
+)
+
+// esStub 模拟 Elasticsearch 的 HTTP 接口，记录收到的请求
+type esStub struct {
+	mu   sync.Mutex
+	reqs []esStubReq
+
+	head int    // HEAD 索引的状态码
+	put  int    // PUT 索引的状态码
+	body string // PUT 索引或 _bulk 的响应
+}
+
+type esStubReq struct {
+	method, path, ct, user, pass string
+	body                         []byte
+}
+
+func (s *esStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := io.ReadAll(r.Body)
+	user, pass, _ := r.BasicAuth()
+	s.mu.Lock()
+	s.reqs = append(s.reqs, esStubReq{r.Method, r.URL.Path, r.Header.Get("Content-Type"), user, pass, b})
+	s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodHead:
+		w.WriteHeader(s.head)
+	case r.Method == http.MethodPut:
+		w.WriteHeader(s.put)
+		_, _ = io.WriteString(w, s.body)
+	case r.URL.Path == "/_bulk":
+		_, _ = io.WriteString(w, s.body)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newESStub(t *testing.T, stub *esStub) *ESIndexer {
+	t.Helper()
+	srv := httptest.NewServer(stub)
+	t.Cleanup(srv.Close)
+	ix, err := NewESIndexer(strings.Replace(srv.URL, "http://", "http://elastic:secret@", 1) + "/app_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ix
+}
+
+func TestESIndexerEnsureIndex(t *testing.T) {
+	ctx := context.Background()
+	mapping := map[string]string{"title": "text", "status": "keyword"}
+
+	stub := &esStub{head: http.StatusNotFound, put: http.StatusOK, body: `{"acknowledged":true}`}
+	ix := newESStub(t, stub)
+	if err := ix.EnsureIndex(ctx, "cms_article", mapping); err != nil {
+		t.Fatalf("ensure: %s", err)
+	}
+	if len(stub.reqs) != 2 {
+		t.Fatalf("want HEAD and PUT, got %d requests", len(stub.reqs))
+	}
+	head, put := stub.reqs[0], stub.reqs[1]
+	if head.method != http.MethodHead || head.path != "/app_cms_article" {
+		t.Errorf("head: %s %s", head.method, head.path)
+	}
+	if put.method != http.MethodPut || put.path != "/app_cms_article" || put.ct != "application/json" {
+		t.Errorf("put: %s %s %s", put.method, put.path, put.ct)
+	}
+	if put.user != "elastic" || put.pass != "secret" {
+		t.Errorf("basic auth: %q %q", put.user, put.pass)
+	}
+	var body struct {
+		Mappings struct {
+			Properties map[string]map[string]string `json:"properties"`
+		} `json:"mappings"`
+	}
+	if err := json.Unmarshal(put.body, &body); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range mapping {
+		if got := body.Mappings.Properties[k]["type"]; got != v {
+			t.Errorf("mapping %s: want %q, got %q", k, v, got)
+		}
+	}
+
+	// 已存在时只有 HEAD
+	stub = &esStub{head: http.StatusOK}
+	ix = newESStub(t, stub)
+	if err := ix.EnsureIndex(ctx, "cms_article", mapping); err != nil {
+		t.Fatalf("ensure existing: %s", err)
+	}
+	if len(stub.reqs) != 1 {
+		t.Errorf("want HEAD only, got %d requests", len(stub.reqs))
+	}
+
+	// 并发创建时 PUT 返回 already exists
+	stub = &esStub{head: http.StatusNotFound, put: http.StatusBadRequest,
+		body: `{"error":{"type":"resource_already_exists_exception"},"status":400}`}
+	if err := newESStub(t, stub).EnsureIndex(ctx, "cms_article", mapping); err != nil {
+		t.Errorf("already exists: %s", err)
+	}
+
+	stub = &esStub{head: http.StatusNotFound, put: http.StatusBadRequest,
+		body: `{"error":{"type":"mapper_parsing_exception"},"status":400}`}
+	if err := newESStub(t, stub).EnsureIndex(ctx, "cms_article", mapping); err == nil {
+		t.Error("want error for invalid mapping")
+	}
+}
+
+func TestESIndexerBulk(t *testing.T) {
+	ctx := context.Background()
+
+	stub := &esStub{body: `{"errors":false,"items":[{"index":{"_id":"a","status":201}},{"index":{"_id":"b","status":200}}]}`}
+	ix := newESStub(t, stub)
+	docs := []IndexDoc{{ID: "a", Body: map[string]string{"title": "A"}}, {ID: "b", Body: map[string]string{"title": "B"}}}
+	if err := ix.Upsert(ctx, "cms_article", docs...); err != nil {
+		t.Fatalf("upsert: %s", err)
+	}
+	req := stub.reqs[0]
+	if req.method != http.MethodPost || req.path != "/_bulk" || req.ct != "application/x-ndjson" {
+		t.Errorf("bulk: %s %s %s", req.method, req.path, req.ct)
+	}
+	var lines []string
+	for sc := bufio.NewScanner(bytes.NewReader(req.body)); sc.Scan(); {
+		lines = append(lines, sc.Text())
+	}
+	want := []string{
+		`{"index":{"_id":"a","_index":"app_cms_article"}}`, `{"title":"A"}`,
+		`{"index":{"_id":"b","_index":"app_cms_article"}}`, `{"title":"B"}`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("bulk body:\n%s", req.body)
+	}
+
+	stub.body = `{"errors":true,"items":[{"index":{"_id":"a","status":201}},` +
+		`{"index":{"_id":"b","status":400,"error":{"type":"mapper_parsing_exception"}}}]}`
+	err := ix.Upsert(ctx, "cms_article", docs...)
+	if err == nil || !strings.Contains(err.Error(), "index b: 400") || !strings.Contains(err.Error(), "mapper_parsing_exception") {
+		t.Errorf("want item error of b, got %v", err)
+	}
+
+	// 删除不存在的文档不算失败
+	stub.body = `{"errors":true,"items":[{"delete":{"_id":"a","status":200}},{"delete":{"_id":"x","status":404}}]}`
+	if err = ix.Delete(ctx, "cms_article", "a", "x"); err != nil {
+		t.Errorf("delete missing: %s", err)
+	}
+	stub.body = `{"errors":true,"items":[{"delete":{"_id":"a","status":429,"error":{"type":"es_rejected_execution_exception"}}}]}`
+	if err = ix.Delete(ctx, "cms_article", "a"); err == nil || !strings.Contains(err.Error(), "delete a: 429") {
+		t.Errorf("want delete error, got %v", err)
+	}
+
+	n := len(stub.reqs)
+	if err = ix.Delete(ctx, "cms_article"); err != nil || len(stub.reqs) != n {
+		t.Errorf("empty delete should not request: %v", err)
+	}
+}
+
+func TestMemIndexer(t *testing.T) {
+	ctx := context.Background()
+	ix := NewMemIndexer()
+	if err := ix.Upsert(ctx, "cms_article", IndexDoc{ID: "a", Body: 1}); err == nil {
+		t.Error("want error before EnsureIndex")
+	}
+
+	mapping := map[string]string{"title": "text"}
+	if err := ix.EnsureIndex(ctx, "cms_article", mapping); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.EnsureIndex(ctx, "cms_article", map[string]string{"other": "keyword"}); err != nil {
+		t.Fatal(err)
+	}
+	if m := ix.Mapping("cms_article"); m["title"] != "text" || len(m) != 1 {
+		t.Errorf("mapping replaced: %v", m)
+	}
+
+	docs := []IndexDoc{{ID: "a", Body: map[string]string{"title": "A"}}, {ID: "b", Body: map[string]string{"title": "B"}}}
+	if err := ix.Upsert(ctx, "cms_article", docs...); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Upsert(ctx, "cms_article", IndexDoc{ID: "a", Body: map[string]string{"title": "A2"}}); err != nil {
+		t.Fatal(err)
+	}
+	if n := ix.Count("cms_article"); n != 2 {
+		t.Errorf("count: want 2, got %d", n)
+	}
+	if b, ok := ix.Get("cms_article", "a"); !ok || string(b) != `{"title":"A2"}` {
+		t.Errorf("get a: %s %v", b, ok)
+	}
+
+	if err := ix.Delete(ctx, "cms_article", "a", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ix.Get("cms_article", "a"); ok {
+		t.Error("a not deleted")
+	}
+	if n := ix.Count("cms_article"); n != 1 {
+		t.Errorf("count after delete: want 1, got %d", n)
+	}
+}
+
+// failIndexer 在 fail 不为空时写入和删除均返回该错误
+type failIndexer struct {
+	*MemIndexer
+	fail error
+}
+
+func (f *failIndexer) Upsert(ctx context.Context, index string, docs ...IndexDoc) error {
+	if f.fail != nil {
+		return f.fail
+	}
+	return f.MemIndexer.Upsert(ctx, index, docs...)
+}
+
+func (f *failIndexer) Delete(ctx context.Context, index string, ids ...string) error {
+	if f.fail != nil {
+		return f.fail
+	}
+	return f.MemIndexer.Delete(ctx, index, ids...)
+}
+
+func TestOutboxIndex(t *testing.T) {
+	ctx := context.Background()
+	ix := &failIndexer{MemIndexer: NewMemIndexer()}
+	SetIndexer(ix)
+	t.Cleanup(func() { SetIndexer(nil) })
+
+	id := oid.NewID(oid.OtArticle)
+	found := true
+	newFakeWrap(&fakeDriver{query: func(q string) ([]string, [][]driver.Value) {
+		if !found {
+			return nil, nil
+		}
+		return []string{"id", "title"}, [][]driver.Value{{int64(id), "hello"}}
+	}})
+	table := cms1.ArticleTable
+	ev := &OutboxEvent{Model: "Article", ObjID: id.String(), Action: OutboxCreate}
+	if err := deliverOutbox(ctx, ev); err != nil {
+		t.Fatal(err)
+	}
+	if b, ok := ix.Get(table, id.String()); !ok || !strings.Contains(string(b), "hello") {
+		t.Errorf("create: %s %v", b, ok)
+	}
+
+	// 索引出错时返回，由 dispatchOutbox 退避重试
+	ix.fail = errors.New("search down")
+	ev.Action = OutboxUpdate
+	if err := deliverOutbox(ctx, ev); !errors.Is(err, ix.fail) {
+		t.Errorf("update: want %v, got %v", ix.fail, err)
+	}
+	ix.fail = nil
+
+	// 记录已不存在时删除其文档
+	found = false
+	if err := deliverOutbox(ctx, ev); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ix.Get(table, id.String()); ok {
+		t.Error("update of a deleted record should remove the doc")
+	}
+
+	found = true
+	ev.Action = OutboxCreate
+	_ = deliverOutbox(ctx, ev)
+	ev.Action = OutboxDelete
+	if err := deliverOutbox(ctx, ev); err != nil {
+		t.Fatal(err)
+	}
+	if n := ix.Count(table); n != 0 {
+		t.Errorf("delete: want 0 docs, got %d", n)
+	}
+}
@@ -13,13 +13,9 @@ type ModelIdentity interface {
 }
 
 type Storage interface {
+	// InTx 在一个事务中执行 fn，fn 中经 sto 的调用共用此事务
+	InTx(ctx context.Context, fn func(sto Storage) error) error
+
 	Content() ContentStore // gened
 	Account() AccountStore // gened
 }
-
-var UpsertESDoc func(ctx context.Context, index string, mi ModelIdentity) error
-var DeleteESDoc func(ctx context.Context, index, id string) error
-
-func RegisterESMigrate(ModelIdentity, func(context.Context) error) {
-
-}
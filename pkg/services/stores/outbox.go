@@ -0,0 +1,188 @@
+package stores
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cupogo/andvari/models/comm"
+)
+
+// 变更事件的动作
+const (
+	OutboxCreate = "create"
+	OutboxUpdate = "update"
+	OutboxDelete = "delete"
+)
+
+// vars
+var (
+	OutboxBatch    = 100         // 每次分发的事件数
+	OutboxInterval = time.Second // 没有待分发的事件时的轮询间隔
+	OutboxMaxRetry = 10          // 最多尝试次数，之后留在表中待人工处理
+	OutboxLease    = time.Minute // 领取后的租期，处理未完成而进程退出时，到期后重新分发
+)
+
+// outboxLockKey 领取事件的事务级 advisory lock，使多个实例依次领取
+const outboxLockKey int64 = 0x6f7574626f78
+
+// OutboxEvent 模型变更事件，与变更在同一事务中写入，由 RunOutbox 分发
+type OutboxEvent struct {
+	comm.BaseModel `bun:"table:outbox_event,alias:oe" json:"-"`
+
+	ID        int64             `bun:"id,pk,autoincrement" json:"id"`
+	Model     string            `bun:"model,notnull,type:name" json:"model"`
+	ObjID     string            `bun:"obj_id,notnull" json:"objID"`
+	Action    string            `bun:"action,notnull,type:name" json:"action"`
+	Changes   comm.ChangeValues `bun:"changes,type:jsonb" json:"changes,omitempty"` // 更新时变化的列
+	Attempts  int               `bun:"attempts,notnull,default:0" json:"attempts"`
+	LastError string            `bun:"last_error" json:"lastError,omitempty"`
+	NextAt    time.Time         `bun:"next_at,notnull,default:current_timestamp" json:"nextAt"`
+	Created   time.Time         `bun:"created,notnull,default:current_timestamp" json:"created"`
+	DoneAt    *time.Time        `bun:"done_at" json:"doneAt,omitempty"`
+}
+
+func init() {
+	RegisterModel((*OutboxEvent)(nil))
+}
+
+// OutboxHandler 处理一个事件，返回错误时稍后重试，需能接受重复的事件
+type OutboxHandler func(ctx context.Context, ev *OutboxEvent) error
+
+var (
+	outboxMu       sync.RWMutex
+	outboxHandlers = map[string][]OutboxHandler{}
+)
+
+// RegisterOutbox 注册模型变更事件的处理函数，model 为空时处理全部模型
+func RegisterOutbox(model string, fn OutboxHandler) {
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+	outboxHandlers[model] = append(outboxHandlers[model], fn)
+}
+
+var outboxIndexers = map[string]OutboxHandler{}
+
+// registerOutboxIndex 由变更事件同步模型的搜索索引，先于其他处理函数，重复注册时替换
+// 出错时同其他处理函数按退避重试，见 dispatchOutbox
+func registerOutboxIndex(model string, fn OutboxHandler) {
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+	outboxIndexers[model] = fn
+}
+
+// dbOutbox 写入变更事件，应在变更所在的事务中调用
+func dbOutbox(ctx context.Context, db ormDB, model, id, action string, cvs comm.ChangeValues) error {
+	ev := &OutboxEvent{Model: model, ObjID: id, Action: action, Changes: cvs}
+	_, err := db.NewInsert().Model(ev).Exec(ctx)
+	return err
+}
+
+// RunOutbox 在后台分发变更事件，直到 ctx 结束
+// 多个实例可同时运行，各自领取不同的事件；同一记录的事件按写入的顺序分发
+func (w *Wrap) RunOutbox(ctx context.Context) {
+	ctx = ContextWithSystem(ctx) // 事件的处理函数不限定租户和所有者
+	tk := time.NewTicker(OutboxInterval)
+	defer tk.Stop()
+	for {
+		n, err := w.dispatchOutbox(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger().Infow("dispatch outbox fail", "err", err)
+		}
+		if err == nil && n == OutboxBatch {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tk.C:
+		}
+	}
+}
+
+// claimOutbox 在短事务中领取一批到期的事件，将其 next_at 推后 OutboxLease
+// 同一记录之前有未完成且未到期（含已被领取）的事件时跳过，以保持顺序
+func (w *Wrap) claimOutbox(ctx context.Context) (evs []OutboxEvent, err error) {
+	err = w.db.RunInTx(ctx, nil, func(ctx context.Context, tx pgTx) error {
+		var locked bool
+		if err := tx.NewRaw("SELECT pg_try_advisory_xact_lock(?)", outboxLockKey).Scan(ctx, &locked); err != nil || !locked {
+			return err
+		}
+		err := tx.NewSelect().Model(&evs).
+			Where("done_at IS NULL").Where("next_at <= now()").Where("attempts < ?", OutboxMaxRetry).
+			Where("NOT EXISTS (SELECT 1 FROM ?TableName AS p WHERE p.model = ?TableAlias.model AND p.obj_id = ?TableAlias.obj_id"+
+				" AND p.id < ?TableAlias.id AND p.done_at IS NULL AND p.attempts < ? AND p.next_at > now())", OutboxMaxRetry).
+			OrderExpr("id").Limit(OutboxBatch).Scan(ctx)
+		if err != nil || len(evs) == 0 {
+			return err
+		}
+		ids := make([]int64, len(evs))
+		for i := range evs {
+			ids[i] = evs[i].ID
+		}
+		_, err = tx.NewUpdate().Model((*OutboxEvent)(nil)).
+			Set("next_at = now() + ? * interval '1 second'", OutboxLease.Seconds()).
+			Where("id IN (?)", pgIn(ids)).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		evs = nil
+	}
+	return
+}
+
+// dispatchOutbox 领取一批事件后在事务外依次交给处理函数，返回事件数
+// 某记录的事件失败时，同批中此记录之后的事件放回，待其成功后再分发
+func (w *Wrap) dispatchOutbox(ctx context.Context) (n int, err error) {
+	evs, err := w.claimOutbox(ctx)
+	if err != nil {
+		return 0, err
+	}
+	failed := make(map[[2]string]bool)
+	for i := range evs {
+		if ctx.Err() != nil { // 未处理的事件在租期到后重新分发
+			return len(evs), ctx.Err()
+		}
+		ev := &evs[i]
+		key := [2]string{ev.Model, ev.ObjID}
+		q := w.db.NewUpdate().Model(ev).WherePK()
+		if failed[key] {
+			q.Set("next_at = now()")
+		} else if err := deliverOutbox(ctx, ev); err != nil {
+			failed[key] = true
+			ev.Attempts++
+			ev.LastError = err.Error()
+			ev.NextAt = time.Now().Add(outboxBackoff(ev.Attempts))
+			q.Column("attempts", "last_error", "next_at")
+			logger().Infow("deliver outbox fail", "id", ev.ID, "model", ev.Model, "attempts", ev.Attempts, "err", err)
+		} else {
+			q.Set("done_at = now()")
+		}
+		if _, err := q.Exec(ctx); err != nil {
+			return len(evs), err
+		}
+	}
+	return len(evs), nil
+}
+
+// deliverOutbox 交给模型和全部模型的处理函数，没有处理函数时视为完成
+func deliverOutbox(ctx context.Context, ev *OutboxEvent) error {
+	outboxMu.RLock()
+	fns := slices.Concat(outboxHandlers[ev.Model], outboxHandlers[""])
+	if fn, ok := outboxIndexers[ev.Model]; ok {
+		fns = slices.Insert(fns, 0, fn)
+	}
+	outboxMu.RUnlock()
+	for _, fn := range fns {
+		if err := fn(ctx, ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// outboxBackoff 第 n 次失败后的等待时间，指数增长，最长一小时
+func outboxBackoff(n int) time.Duration {
+	return min(time.Second<<min(n, 12), time.Hour)
+}
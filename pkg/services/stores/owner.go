@@ -0,0 +1,106 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/cupogo/andvari/models/oid"
+)
+
+// vars
+var (
+	ErrNotOwner = errors.New("not owner")
+)
+
+// Caller 请求者，由登录验证中间件放入上下文
+type Caller struct {
+	ID    oid.OID // 账号编号
+	Admin bool    // 管理员不受所有者限制
+}
+
+type callerCtxKey struct{}
+
+// ContextWithCaller 设置上下文的请求者，之后仅能读写其所有的记录
+func ContextWithCaller(ctx context.Context, c Caller) context.Context {
+	return context.WithValue(ctx, callerCtxKey{}, c)
+}
+
+// CallerFromContext 上下文的请求者
+func CallerFromContext(ctx context.Context) (Caller, bool) {
+	c, ok := ctx.Value(callerCtxKey{}).(Caller)
+	return c, ok
+}
+
+// OwnerModel 有所有者的模型，即含 comm.OwnerField
+type OwnerModel interface {
+	GetOwnerID() oid.OID
+	SetOwnerID(id any) bool
+}
+
+// ownerStamp 创建时没有所有者的，取上下文的请求者，既没有请求者又不是系统范围时返回 ErrNotOwner
+func ownerStamp(ctx context.Context, obj OwnerModel) error {
+	c, ok := CallerFromContext(ctx)
+	if !ok {
+		if IsSystemContext(ctx) {
+			return nil
+		}
+		return ErrNotOwner
+	}
+	if obj.GetOwnerID().IsZero() {
+		obj.SetOwnerID(c.ID)
+	}
+	return nil
+}
+
+// ownerCheck 请求者须为记录的所有者，管理员或系统范围时不限，没有请求者时不能读写
+func ownerCheck(ctx context.Context, obj OwnerModel) error {
+	c, ok := CallerFromContext(ctx)
+	if !ok {
+		if IsSystemContext(ctx) {
+			return nil
+		}
+		return ErrNotOwner
+	}
+	if c.Admin || obj.GetOwnerID() == c.ID {
+		return nil
+	}
+	return ErrNotOwner
+}
+
+// ownerColumns 指定了列时加上所有者的列，以便校验
+func ownerColumns(cols []string) []string {
+	if len(cols) > 0 && !slices.Contains(cols, "owner_id") {
+		return append(cols, "owner_id")
+	}
+	return cols
+}
+
+// OwnerSpec 所有者的查询条件，由存储从上下文设置，不接收请求参数
+type OwnerSpec struct {
+	ownerID oid.OID
+	scoped  bool
+	denied  bool
+}
+
+// SetOwner 取上下文的请求者，管理员或系统范围时不限定，都没有时返回 ErrNotOwner，查询为空
+func (s *OwnerSpec) SetOwner(ctx context.Context) error {
+	c, ok := CallerFromContext(ctx)
+	switch {
+	case ok && !c.Admin:
+		s.ownerID, s.scoped = c.ID, true
+	case !ok && !IsSystemContext(ctx):
+		s.denied = true
+		return ErrNotOwner
+	}
+	return nil
+}
+
+func (s *OwnerSpec) Sift(q *ormQuery) *ormQuery {
+	if s.denied {
+		q.Where("false")
+	} else if s.scoped {
+		q.Where("?TableAlias.owner_id = ?", s.ownerID)
+	}
+	return q
+}
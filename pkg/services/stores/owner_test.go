@@ -0,0 +1,69 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+
+	"github.com/cupogo/andvari/models/oid"
+	"github.com/cupogo/scaffold/pkg/models/cms1"
+)
+
+func TestOwnerScope(t *testing.T) {
+	owner, other := oid.NewID(oid.OtAccount), oid.NewID(oid.OtAccount)
+	obj := new(cms1.Article)
+	obj.SetOwnerID(owner)
+	db := bun.NewDB(&sql.DB{}, pgdialect.New())
+
+	bg := context.Background()
+	for _, c := range []struct {
+		name  string
+		ctx   context.Context
+		check error  // ownerCheck 的结果
+		sift  string // SetOwner 后 Sift 的条件，空为不限定
+		deny  bool   // SetOwner 返回 ErrNotOwner
+	}{
+		{"owner", ContextWithCaller(bg, Caller{ID: owner}), nil, fmt.Sprintf(`"a".owner_id = %d`, owner), false},
+		{"non-owner", ContextWithCaller(bg, Caller{ID: other}), ErrNotOwner, fmt.Sprintf(`"a".owner_id = %d`, other), false},
+		{"admin", ContextWithCaller(bg, Caller{ID: other, Admin: true}), nil, "", false},
+		{"anonymous", bg, ErrNotOwner, "false", true},
+		{"system", ContextWithSystem(bg), nil, "", false},
+	} {
+		if err := ownerCheck(c.ctx, obj); !errors.Is(err, c.check) || (c.check == nil) != (err == nil) {
+			t.Errorf("%s: ownerCheck want %v, got %v", c.name, c.check, err)
+		}
+		var spec OwnerSpec
+		if err := spec.SetOwner(c.ctx); (err != nil) != c.deny {
+			t.Errorf("%s: SetOwner got %v", c.name, err)
+		}
+		sql := spec.Sift(db.NewSelect().Model((*cms1.Article)(nil))).String()
+		where := strings.Contains(sql, "WHERE")
+		if len(c.sift) == 0 && where || len(c.sift) > 0 && !strings.Contains(sql, c.sift) {
+			t.Errorf("%s: Sift want %q, got %s", c.name, c.sift, sql)
+		}
+	}
+}
+
+func TestOwnerStamp(t *testing.T) {
+	owner := oid.NewID(oid.OtAccount)
+	bg := context.Background()
+
+	obj := new(cms1.Article)
+	if err := ownerStamp(ContextWithCaller(bg, Caller{ID: owner}), obj); err != nil || obj.GetOwnerID() != owner {
+		t.Errorf("stamp caller: %v %v", err, obj.GetOwnerID())
+	}
+	if err := ownerStamp(bg, new(cms1.Article)); !errors.Is(err, ErrNotOwner) {
+		t.Errorf("stamp anonymous: want ErrNotOwner, got %v", err)
+	}
+	obj = new(cms1.Article)
+	obj.SetOwnerID(owner)
+	if err := ownerStamp(ContextWithSystem(bg), obj); err != nil || obj.GetOwnerID() != owner {
+		t.Errorf("stamp system: %v %v", err, obj.GetOwnerID())
+	}
+}
@@ -0,0 +1,456 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cupogo/andvari/models/comm"
+	"github.com/cupogo/andvari/models/oid"
+	"github.com/uptrace/bun"
+)
+
+// vars
+var (
+	ReindexBatch = 500 // 每批写入索引的记录数
+
+	ErrReindexRunning = errors.New("reindex is running")
+	ErrReindexUnknown = errors.New("unknown reindex model")
+
+	reindexJobsKeep = 20 // 保留的已结束任务数
+)
+
+// reindexLockSpace 重建索引的会话级 advisory lock 的第一个键，第二个键为 hashtext(reindexKey)
+const reindexLockSpace int32 = 0x72697864
+
+// ReindexFunc 按编号顺序写入 after 之后的至多 limit 条记录的索引，返回最后的编号和条数
+type ReindexFunc func(ctx context.Context, after string, limit int) (last string, n int, err error)
+
+// ReindexState 重建索引的进度，按模型和租户保存检查点，中断后从此继续
+type ReindexState struct {
+	comm.BaseModel `bun:"table:reindex_state,alias:rs" json:"-"`
+
+	Model     string     `bun:"model,pk,type:name" json:"model"`      // 表名，即索引名
+	LastID    string     `bun:"last_id,notnull" json:"lastID"`        // 已写入的最后编号
+	Total     int        `bun:"total,notnull,default:0" json:"total"` // 已写入的记录数
+	Errors    int        `bun:"errors,notnull,default:0" json:"errors"`
+	LastError string     `bun:"last_error" json:"lastError,omitempty"` // 最近一批的错误
+	Started   time.Time  `bun:"started,notnull,default:current_timestamp" json:"started"`
+	Updated   time.Time  `bun:"updated,notnull,default:current_timestamp" json:"updated"`
+	DoneAt    *time.Time `bun:"done_at" json:"doneAt,omitempty"`
+
+	// 限定的租户，系统范围时为空
+	TenantID oid.OID `bun:"tenant_id,pk,notnull,default:0" json:"tenantID,omitempty" swaggertype:"string"`
+
+	Running bool `bun:"-" json:"running"` // 是否正在运行，含其他实例
+}
+
+func init() {
+	RegisterModel((*ReindexState)(nil))
+}
+
+// ReindexOption 重建索引的选项
+type ReindexOption struct {
+	Restart  bool                   // 忽略检查点，从头开始
+	Batch    int                    // 每批的记录数，默认 ReindexBatch
+	Progress func(st *ReindexState) // 每批之后及出错时调用
+}
+
+var (
+	reindexMu     sync.RWMutex
+	reindexFuncs  = map[string]ReindexFunc{}
+	reindexTenant = map[string]bool{} // 按租户隔离的模型
+)
+
+// RegisterReindex 注册模型的重建索引函数，以表名为键
+func RegisterReindex(mi ModelIdentity, fn ReindexFunc) {
+	reindexMu.Lock()
+	defer reindexMu.Unlock()
+	reindexFuncs[mi.IdentityTable()] = fn
+	_, reindexTenant[mi.IdentityTable()] = mi.(TenantModel)
+}
+
+// ReindexModels 已注册的可重建索引的表名
+func ReindexModels() []string {
+	reindexMu.RLock()
+	defer reindexMu.RUnlock()
+	names := make([]string, 0, len(reindexFuncs))
+	for k := range reindexFuncs {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// reindexModelsIn 租户可重建的表名，即按租户隔离的模型，系统范围时为全部
+func reindexModelsIn(tid oid.OID) []string {
+	names := ReindexModels()
+	if tid.IsZero() {
+		return names
+	}
+	reindexMu.RLock()
+	defer reindexMu.RUnlock()
+	return slices.DeleteFunc(names, func(name string) bool { return !reindexTenant[name] })
+}
+
+// reindexKey 检查点和锁的键，租户的为 表名:租户编号
+func reindexKey(model string, tid oid.OID) string {
+	if tid.IsZero() {
+		return model
+	}
+	return model + ":" + tid.String()
+}
+
+// reindexBatch 按编号的键集分页取一批记录并写入索引，ReindexFunc 的通用实现
+// 按租户隔离的模型只取上下文租户的记录
+func reindexBatch[S ~[]E, E any, P interface {
+	*E
+	Indexable
+	GetID() any
+	SetID(id any) bool
+}](ctx context.Context, db ormDB, after string, limit int) (last string, n int, err error) {
+	var data S
+	q := db.NewSelect().Model(&data).OrderExpr("?TableAlias.id").Limit(limit)
+	if len(after) > 0 {
+		obj := P(new(E))
+		if !obj.SetID(after) {
+			return after, 0, fmt.Errorf("invalid checkpoint id: %q", after)
+		}
+		q.Where("?TableAlias.id > ?", obj.GetID())
+	}
+	if _, ok := any(P(nil)).(TenantModel); ok {
+		var ts TenantSpec
+		if err = ts.SetTenant(ctx); err != nil {
+			return after, 0, err
+		}
+		ts.Sift(q)
+	}
+	if err = q.Scan(ctx); err != nil {
+		return after, 0, err
+	}
+	if n = len(data); n == 0 {
+		return after, 0, nil
+	}
+	if err = indexUpsertAll[S, E, P](ctx, data); err != nil {
+		return after, 0, err
+	}
+	return P(&data[n-1]).StringID(), n, nil
+}
+
+// Reindex 重建模型的索引，model 为空时依次重建全部
+// 上下文有租户时只重建此租户按租户隔离的模型，否则须为系统范围
+// 每批之后保存检查点，出错时停止，再次运行时从检查点继续；已完成的从头开始
+func (w *Wrap) Reindex(ctx context.Context, model string, opt ReindexOption) error {
+	models, err := reindexScope(ctx, model)
+	if err != nil {
+		return err
+	}
+	for _, name := range models {
+		if err := w.reindexModel(ctx, name, opt); err != nil {
+			return fmt.Errorf("reindex %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// reindexScope 上下文可重建的表名，model 不在其中时返回 ErrReindexUnknown
+func reindexScope(ctx context.Context, model string) ([]string, error) {
+	tid, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	models := reindexModelsIn(tid)
+	if len(model) == 0 {
+		return models, nil
+	}
+	if !slices.Contains(models, model) {
+		return nil, ErrReindexUnknown
+	}
+	return []string{model}, nil
+}
+
+func (w *Wrap) reindexModel(ctx context.Context, model string, opt ReindexOption) error {
+	reindexMu.RLock()
+	fn, ok := reindexFuncs[model]
+	reindexMu.RUnlock()
+	if !ok {
+		return ErrReindexUnknown
+	}
+	tid, _ := TenantFromContext(ctx)
+	unlock, err := w.reindexLock(ctx, reindexKey(model, tid))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	st := &ReindexState{Model: model, TenantID: tid}
+	err = w.db.NewSelect().Model(st).WherePK().Scan(ctx)
+	if err != nil && !errorIs(err, ErrNoRows) {
+		return err
+	}
+	if err != nil || opt.Restart || st.DoneAt != nil {
+		st = &ReindexState{Model: model, TenantID: tid, Started: time.Now()}
+	}
+	st.Running = true
+	batch := opt.Batch
+	if batch <= 0 {
+		batch = ReindexBatch
+	}
+
+	for {
+		last, n, err := fn(ctx, st.LastID, batch)
+		st.Updated = time.Now()
+		if err != nil {
+			st.Errors++
+			st.LastError = err.Error()
+		} else if n == 0 {
+			st.DoneAt = &st.Updated
+		} else {
+			st.LastID = last
+			st.Total += n
+			st.LastError = ""
+		}
+		if err := w.saveReindexState(ctx, st); err != nil {
+			return err
+		}
+		if opt.Progress != nil {
+			opt.Progress(st)
+		}
+		if err != nil || st.DoneAt != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// reindexLock 在独占的连接上取得 reindexKey 的会话级 advisory lock，多个实例间只有一个在重建
+// 连接断开时锁随之释放，不会因进程退出而残留
+func (w *Wrap) reindexLock(ctx context.Context, key string) (unlock func(), err error) {
+	db, ok := w.db.(interface {
+		Conn(ctx context.Context) (bun.Conn, error)
+	})
+	if !ok {
+		return nil, errors.New("reindex in transaction")
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var locked bool
+	err = conn.NewRaw("SELECT pg_try_advisory_lock(?, hashtext(?))", reindexLockSpace, key).Scan(ctx, &locked)
+	if err != nil || !locked {
+		_ = conn.Close()
+		if err == nil {
+			err = ErrReindexRunning
+		}
+		return nil, err
+	}
+	return func() {
+		if _, err := conn.ExecContext(context.Background(),
+			"SELECT pg_advisory_unlock(?, hashtext(?))", reindexLockSpace, key); err != nil {
+			logger().Infow("reindex unlock fail", "key", key, "err", err)
+		}
+		_ = conn.Close()
+	}, nil
+}
+
+// reindexLocked 查询 reindexKey 的 advisory lock 是否被持有，即是否有实例正在重建
+func (w *Wrap) reindexLocked(ctx context.Context, key string) (locked bool, err error) {
+	err = w.db.NewRaw("SELECT EXISTS (SELECT 1 FROM pg_locks WHERE locktype = 'advisory'"+
+		" AND database = (SELECT oid FROM pg_database WHERE datname = current_database())"+
+		" AND classid = ?::oid AND objid = hashtext(?)::oid AND objsubid = 2 AND granted)",
+		reindexLockSpace, key).Scan(ctx, &locked)
+	return
+}
+
+func (w *Wrap) saveReindexState(ctx context.Context, st *ReindexState) error {
+	_, err := w.db.NewInsert().Model(st).
+		On("CONFLICT (model, tenant_id) DO UPDATE").
+		Set("last_id = EXCLUDED.last_id, total = EXCLUDED.total, errors = EXCLUDED.errors").
+		Set("last_error = EXCLUDED.last_error, started = EXCLUDED.started").
+		Set("updated = EXCLUDED.updated, done_at = EXCLUDED.done_at").
+		Exec(ctx)
+	return err
+}
+
+// ReindexStates 上下文可重建的模型的进度，未运行过的只有表名
+func (w *Wrap) ReindexStates(ctx context.Context) ([]ReindexState, error) {
+	tid, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var saved []ReindexState
+	if err := w.db.NewSelect().Model(&saved).Where("?TableAlias.tenant_id = ?", tid).Scan(ctx); err != nil {
+		return nil, err
+	}
+	models := reindexModelsIn(tid)
+	data := make([]ReindexState, len(models))
+	for i, name := range models {
+		data[i].Model, data[i].TenantID = name, tid
+		if j := slices.IndexFunc(saved, func(st ReindexState) bool { return st.Model == name }); j >= 0 {
+			data[i] = saved[j]
+		}
+		running, err := w.reindexLocked(ctx, reindexKey(name, tid))
+		if err != nil {
+			return nil, err
+		}
+		data[i].Running = running
+	}
+	return data, nil
+}
+
+// ReindexJob 后台重建索引的任务，由 StartReindex 创建，可按编号查看和取消
+type ReindexJob struct {
+	ID       string         `json:"id"`
+	Model    string         `json:"model,omitempty"`                         // 表名，为空时为全部
+	TenantID oid.OID        `json:"tenantID,omitempty" swaggertype:"string"` // 限定的租户，系统范围时为空
+	Running  bool           `json:"running"`
+	Started  time.Time      `json:"started"`
+	DoneAt   *time.Time     `json:"doneAt,omitempty"`
+	Error    string         `json:"error,omitempty"`  // 出错或取消时的原因
+	States   []ReindexState `json:"states,omitempty"` // 各模型最近一批之后的进度
+
+	cancel context.CancelFunc
+}
+
+var (
+	reindexJobsMu sync.Mutex
+	reindexJobs   []*ReindexJob // 按创建的顺序
+)
+
+// overlaps 与范围 model、tid 重叠，系统范围与全部租户重叠
+func (j *ReindexJob) overlaps(model string, tid oid.OID) bool {
+	return (j.TenantID == tid || j.TenantID.IsZero() || tid.IsZero()) &&
+		(len(j.Model) == 0 || len(model) == 0 || j.Model == model)
+}
+
+// visible 上下文可见，系统范围可见全部，租户只可见自己的
+func (j *ReindexJob) visible(ctx context.Context) bool {
+	tid, err := tenantScope(ctx)
+	return err == nil && (tid.IsZero() || j.TenantID == tid)
+}
+
+func (j *ReindexJob) snapshot() *ReindexJob {
+	out := *j
+	out.States = slices.Clone(j.States)
+	out.cancel = nil
+	return &out
+}
+
+// StartReindex 在后台运行 Reindex，范围同 Reindex，返回任务，其上下文不随 ctx 取消
+// 与本进程正在运行的任务或其他实例持有的锁范围重叠时返回 ErrReindexRunning
+func (w *Wrap) StartReindex(ctx context.Context, model string, opt ReindexOption) (*ReindexJob, error) {
+	models, err := reindexScope(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+	tid, _ := TenantFromContext(ctx)
+
+	reindexJobsMu.Lock()
+	defer reindexJobsMu.Unlock()
+	for _, j := range reindexJobs {
+		if j.Running && j.overlaps(model, tid) {
+			return nil, ErrReindexRunning
+		}
+	}
+	for _, name := range models {
+		locked, err := w.reindexLocked(ctx, reindexKey(name, tid))
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			return nil, ErrReindexRunning
+		}
+	}
+
+	jctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	job := &ReindexJob{ID: oid.NewID(oid.OtEvent).String(), Model: model, TenantID: tid,
+		Running: true, Started: time.Now(), cancel: cancel}
+	progress := opt.Progress
+	opt.Progress = func(st *ReindexState) {
+		reindexJobsMu.Lock()
+		if i := slices.IndexFunc(job.States, func(s ReindexState) bool { return s.Model == st.Model }); i >= 0 {
+			job.States[i] = *st
+		} else {
+			job.States = append(job.States, *st)
+		}
+		reindexJobsMu.Unlock()
+		if progress != nil {
+			progress(st)
+		}
+	}
+	reindexJobs = append(reindexJobs, job)
+	pruneReindexJobs()
+
+	go func() {
+		defer cancel()
+		err := w.Reindex(jctx, model, opt)
+		if err != nil {
+			logger().Infow("reindex fail", "job", job.ID, "model", model, "err", err)
+		}
+		reindexJobsMu.Lock()
+		defer reindexJobsMu.Unlock()
+		now := time.Now()
+		job.Running, job.DoneAt = false, &now
+		if err != nil {
+			job.Error = err.Error()
+		}
+	}()
+
+	return job.snapshot(), nil
+}
+
+// pruneReindexJobs 只保留最近 reindexJobsKeep 个已结束的任务，调用时须持有 reindexJobsMu
+func pruneReindexJobs() {
+	var done int
+	for i := len(reindexJobs) - 1; i >= 0; i-- {
+		if !reindexJobs[i].Running {
+			if done++; done > reindexJobsKeep {
+				reindexJobs = slices.Delete(reindexJobs, i, i+1)
+			}
+		}
+	}
+}
+
+// ReindexJobs 上下文可见的任务，新的在前
+func (w *Wrap) ReindexJobs(ctx context.Context) []ReindexJob {
+	reindexJobsMu.Lock()
+	defer reindexJobsMu.Unlock()
+	var data []ReindexJob
+	for i := len(reindexJobs) - 1; i >= 0; i-- {
+		if j := reindexJobs[i]; j.visible(ctx) {
+			data = append(data, *j.snapshot())
+		}
+	}
+	return data
+}
+
+// ReindexJobOf 按编号取任务，不存在或不可见时返回 ErrNotFound
+func (w *Wrap) ReindexJobOf(ctx context.Context, id string) (*ReindexJob, error) {
+	reindexJobsMu.Lock()
+	defer reindexJobsMu.Unlock()
+	for _, j := range reindexJobs {
+		if j.ID == id && j.visible(ctx) {
+			return j.snapshot(), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// CancelReindex 取消任务，当前一批写完后停止，已结束的不处理；返回取消时的任务
+func (w *Wrap) CancelReindex(ctx context.Context, id string) (*ReindexJob, error) {
+	reindexJobsMu.Lock()
+	defer reindexJobsMu.Unlock()
+	for _, j := range reindexJobs {
+		if j.ID == id && j.visible(ctx) {
+			j.cancel()
+			return j.snapshot(), nil
+		}
+	}
+	return nil, ErrNotFound
+}
@@ -0,0 +1,148 @@
+package stores
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cupogo/andvari/models/oid"
+
+	"github.com/cupogo/scaffold/pkg/models/cms1"
+)
+
+func TestStartReindex(t *testing.T) {
+	bg := context.Background()
+	tid := oid.NewID(oid.OtCompany)
+	var locked atomic.Bool
+	drv := &fakeDriver{query: func(q string) ([]string, [][]driver.Value) {
+		switch {
+		case strings.Contains(q, "pg_try_advisory_lock"):
+			return []string{"locked"}, [][]driver.Value{{true}}
+		case strings.Contains(q, "pg_locks"):
+			return []string{"exists"}, [][]driver.Value{{locked.Load()}}
+		}
+		return nil, nil
+	}}
+	w := newFakeWrap(drv)
+
+	var gotTenant atomic.Value
+	reindexMu.Lock()
+	reindexFuncs["test_sys"] = func(ctx context.Context, after string, limit int) (string, int, error) {
+		<-ctx.Done() // 直到取消
+		return after, 0, ctx.Err()
+	}
+	reindexFuncs["test_tenant"] = func(ctx context.Context, after string, limit int) (string, int, error) {
+		id, _ := TenantFromContext(ctx)
+		gotTenant.Store(id)
+		return after, 0, nil
+	}
+	reindexTenant["test_tenant"] = true
+	reindexMu.Unlock()
+	t.Cleanup(func() {
+		reindexMu.Lock()
+		delete(reindexFuncs, "test_sys")
+		delete(reindexFuncs, "test_tenant")
+		delete(reindexTenant, "test_tenant")
+		reindexMu.Unlock()
+		reindexJobsMu.Lock()
+		reindexJobs = nil
+		reindexJobsMu.Unlock()
+	})
+
+	sys := ContextWithSystem(bg)
+	tctx := ContextWithTenant(bg, tid)
+	wait := func(ctx context.Context, id string) *ReindexJob {
+		t.Helper()
+		for i := 0; i < 200; i++ {
+			job, err := w.ReindexJobOf(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !job.Running {
+				return job
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("job %s not done", id)
+		return nil
+	}
+
+	if _, err := w.StartReindex(bg, "test_sys", ReindexOption{}); !errors.Is(err, ErrNoTenant) {
+		t.Errorf("no scope: want ErrNoTenant, got %v", err)
+	}
+	if _, err := w.StartReindex(tctx, "test_sys", ReindexOption{}); !errors.Is(err, ErrReindexUnknown) {
+		t.Errorf("tenant on a shared model: want ErrReindexUnknown, got %v", err)
+	}
+
+	job, err := w.StartReindex(sys, "test_sys", ReindexOption{})
+	if err != nil || !job.Running || len(job.ID) == 0 || !job.TenantID.IsZero() {
+		t.Fatalf("start: %+v %v", job, err)
+	}
+	if _, err = w.StartReindex(sys, "", ReindexOption{}); !errors.Is(err, ErrReindexRunning) {
+		t.Errorf("overlap: want ErrReindexRunning, got %v", err)
+	}
+
+	// 租户的任务只重建此租户，与其他模型的任务不冲突
+	tjob, err := w.StartReindex(tctx, "test_tenant", ReindexOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tjob = wait(tctx, tjob.ID)
+	if tjob.TenantID != tid || len(tjob.Error) > 0 || len(tjob.States) != 1 || tjob.States[0].DoneAt == nil {
+		t.Errorf("tenant job: %+v", tjob)
+	}
+	if got, _ := gotTenant.Load().(oid.OID); got != tid {
+		t.Errorf("tenant job ran with tenant %s", got)
+	}
+	if len(drv.Execs("test_tenant:"+tid.String())) == 0 {
+		t.Error("tenant job should lock its own key")
+	}
+
+	// 租户看不到也不能取消系统范围的任务
+	if _, err = w.ReindexJobOf(tctx, job.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("tenant get: want ErrNotFound, got %v", err)
+	}
+	if _, err = w.CancelReindex(tctx, job.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("tenant cancel: want ErrNotFound, got %v", err)
+	}
+	if jobs := w.ReindexJobs(tctx); len(jobs) != 1 || jobs[0].ID != tjob.ID {
+		t.Errorf("tenant jobs: %+v", jobs)
+	}
+	if jobs := w.ReindexJobs(sys); len(jobs) != 2 || jobs[0].ID != tjob.ID {
+		t.Errorf("system jobs: %+v", jobs)
+	}
+
+	if _, err = w.CancelReindex(sys, job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if job = wait(sys, job.ID); !strings.Contains(job.Error, context.Canceled.Error()) || job.DoneAt == nil {
+		t.Errorf("canceled: %+v", job)
+	}
+
+	// 其他实例持有锁
+	locked.Store(true)
+	if _, err = w.StartReindex(sys, "test_sys", ReindexOption{}); !errors.Is(err, ErrReindexRunning) {
+		t.Errorf("locked: want ErrReindexRunning, got %v", err)
+	}
+}
+
+func TestReindexBatchTenant(t *testing.T) {
+	bg := context.Background()
+	drv := &fakeDriver{}
+	w := newFakeWrap(drv)
+	if _, _, err := reindexBatch[cms1.Articles](bg, w.db, "", 10); !errors.Is(err, ErrNoTenant) {
+		t.Errorf("no scope: want ErrNoTenant, got %v", err)
+	}
+	tid := oid.NewID(oid.OtCompany)
+	if _, n, err := reindexBatch[cms1.Articles](ContextWithTenant(bg, tid), w.db, "", 10); err != nil || n != 0 {
+		t.Fatal(n, err)
+	}
+	if qs := drv.Execs("tenant_id = " + strconv.FormatInt(int64(tid), 10)); len(qs) != 1 {
+		t.Errorf("tenant batch: %q", qs)
+	}
+}
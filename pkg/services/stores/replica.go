@@ -0,0 +1,129 @@
+package stores
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"github.com/cupogo/andvari/stores/pgx"
+
+	"github.com/cupogo/scaffold/pkg/settings"
+)
+
+// vars
+var (
+	replicaOnce sync.Once
+	replicaDBs  []WrapDB
+	replicaNext atomic.Uint32
+)
+
+// SgtReplicas 打开从库的单例，取自 PG_REPLICA_DSNS，连接失败的跳过
+// 有从库时主库记下写入，见 ContextWithWriteMark
+func SgtReplicas() []WrapDB {
+	replicaOnce.Do(func() {
+		if len(settings.Current.PgReplicaDSNs) == 0 {
+			return
+		}
+		primary := SgtDB()
+		for _, dsn := range settings.Current.PgReplicaDSNs {
+			db, _, err := pgx.OpenDB(dsn)
+			if err != nil {
+				logger().Warnw("connect to replica fail", "err", err)
+				if db != nil {
+					_ = db.Close()
+				}
+				continue
+			}
+			replicaDBs = append(replicaDBs, &replicaDB{DB: db, db: primary})
+		}
+		if len(replicaDBs) > 0 {
+			primary.AddQueryHook(writeHook{})
+		}
+	})
+	return replicaDBs
+}
+
+// WithReplicas 设置从库，事务外的 List、Get 轮流读取
+func (w *Wrap) WithReplicas(dbs ...WrapDB) *Wrap {
+	w.replicas = dbs
+	return w
+}
+
+// rdb 读取使用的数据库，在事务中、没有从库或上下文近期有写入时为主库
+func (w *Wrap) rdb(ctx context.Context) WrapDB {
+	if len(w.replicas) == 0 || w.inTx() {
+		return w.db
+	}
+	if t := WroteAt(ctx); !t.IsZero() && time.Since(t) < settings.Current.PgReadYourWrites {
+		return w.db
+	}
+	return w.replicas[int(replicaNext.Add(1)%uint32(len(w.replicas)))]
+}
+
+// replicaDB 只读的从库，其余配置取自主库
+type replicaDB struct {
+	*bun.DB
+	db WrapDB
+}
+
+func (r *replicaDB) GetTsCfg() (string, bool) { return r.db.GetTsCfg() }
+func (r *replicaDB) Schema() string           { return r.db.Schema() }
+func (r *replicaDB) SchemaCrap() string       { return r.db.SchemaCrap() }
+
+// ListModel 同 pgx.DB.ListModel，在从库中查询
+func (r *replicaDB) ListModel(ctx context.Context, spec pgx.ListArg, dataptr any) (total int, err error) {
+	return listModel(ctx, r.DB, r.SchemaCrap(), spec, dataptr)
+}
+
+// DeleteModel 写入仍使用主库
+func (r *replicaDB) DeleteModel(ctx context.Context, obj pgx.ModelIdentity, id any) error {
+	return r.db.DeleteModel(ctx, obj, id)
+}
+
+// writeMark 上下文的写入标记，记下最近写入主库的时间
+type writeMark struct {
+	at atomic.Int64
+}
+
+type writeMarkCtxKey struct{}
+
+// ContextWithWriteMark 上下文加上写入标记，last 为此前（如同一客户端的上个请求）写入的时间
+// 之后在此上下文中写入主库时更新标记，ReadYourWrites 时间内的读取使用主库
+func ContextWithWriteMark(ctx context.Context, last time.Time) context.Context {
+	wm := new(writeMark)
+	if !last.IsZero() {
+		wm.at.Store(last.UnixNano())
+	}
+	return context.WithValue(ctx, writeMarkCtxKey{}, wm)
+}
+
+// WroteAt 上下文最近写入主库的时间，没有标记或没有写入时为零值
+func WroteAt(ctx context.Context) time.Time {
+	if wm, ok := ctx.Value(writeMarkCtxKey{}).(*writeMark); ok {
+		if n := wm.at.Load(); n > 0 {
+			return time.Unix(0, n)
+		}
+	}
+	return time.Time{}
+}
+
+// writeHook 主库的查询钩子，成功的写入更新上下文的写入标记
+type writeHook struct{}
+
+func (writeHook) BeforeQuery(ctx context.Context, _ *bun.QueryEvent) context.Context { return ctx }
+
+func (writeHook) AfterQuery(ctx context.Context, ev *bun.QueryEvent) {
+	if ev.Err != nil {
+		return
+	}
+	switch strings.ToUpper(ev.Operation()) {
+	case "INSERT", "UPDATE", "DELETE", "MERGE":
+		if wm, ok := ctx.Value(writeMarkCtxKey{}).(*writeMark); ok {
+			wm.at.Store(time.Now().UnixNano())
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package stores
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceName 存储的跟踪及度量的名称
+const TraceName = "github.com/cupogo/scaffold/pkg/services/stores"
+
+// 属性键
+const (
+	TraceModelKey  = attribute.Key("store.model")
+	TraceActionKey = attribute.Key("store.action")
+	TraceHookKey   = attribute.Key("store.hook")
+)
+
+// storeMetrics 存储方法的耗时和错误数，默认使用全局的 MeterProvider
+type storeMetrics struct {
+	duration metric.Float64Histogram
+	errors   metric.Int64Counter
+}
+
+var (
+	stoTracer  = otel.Tracer(TraceName)
+	stoMetrics = newStoreMetrics(otel.Meter(TraceName))
+)
+
+// SetTracerProvider 改用指定的 TracerProvider，须在存储使用前调用
+func SetTracerProvider(tp trace.TracerProvider) {
+	stoTracer = tp.Tracer(TraceName)
+}
+
+// SetMeterProvider 改用指定的 MeterProvider，须在存储使用前调用
+func SetMeterProvider(mp metric.MeterProvider) {
+	stoMetrics = newStoreMetrics(mp.Meter(TraceName))
+}
+
+func newStoreMetrics(meter metric.Meter) (m storeMetrics) {
+	m.duration, _ = meter.Float64Histogram("store.duration",
+		metric.WithDescription("Duration of store methods and hooks"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10),
+	)
+	m.errors, _ = meter.Int64Counter("store.errors",
+		metric.WithDescription("Errors of store methods and hooks"),
+	)
+	return
+}
+
+// traceSpan 存储方法或钩子的跟踪
+type traceSpan struct {
+	span  trace.Span
+	attrs []attribute.KeyValue
+	start time.Time
+}
+
+// traceStart 开始存储方法的跟踪，ctx 为其子跟踪
+func traceStart(ctx context.Context, model, action string) (context.Context, *traceSpan) {
+	return startSpan(ctx, "store."+model+"."+action,
+		TraceModelKey.String(model), TraceActionKey.String(action))
+}
+
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, *traceSpan) {
+	ctx, span := stoTracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindInternal), trace.WithAttributes(attrs...))
+	return ctx, &traceSpan{span: span, attrs: attrs, start: time.Now()}
+}
+
+// End 结束跟踪并记录耗时，出错时标记错误并计数
+func (ts *traceSpan) End(ctx context.Context, err error) {
+	opt := metric.WithAttributes(ts.attrs...)
+	stoMetrics.duration.Record(ctx, time.Since(ts.start).Seconds(), opt)
+	if err != nil {
+		ts.span.RecordError(err)
+		ts.span.SetStatus(codes.Error, err.Error())
+		stoMetrics.errors.Add(ctx, 1, opt)
+	}
+	ts.span.End()
+}
+
+// traceHook 在跟踪中调用模型的钩子
+func traceHook(ctx context.Context, model, hook string, fn func(ctx context.Context) error) (err error) {
+	ctx, ts := startSpan(ctx, "store."+model+".hook."+hook,
+		TraceModelKey.String(model), TraceHookKey.String(hook))
+	defer func() { ts.End(ctx, err) }()
+	return fn(ctx)
+}
@@ -0,0 +1,105 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTelemetry(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	reader := sdkmetric.NewManualReader()
+	SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() {
+		SetTracerProvider(otel.GetTracerProvider())
+		SetMeterProvider(otel.GetMeterProvider())
+	})
+
+	ctx := context.Background()
+	errHook := errors.New("hook fail")
+	cctx, ts := traceStart(ctx, "Article", "Create")
+	err := traceHook(cctx, "Article", "beforeCreate", func(ctx context.Context) error { return errHook })
+	ts.End(cctx, err)
+	_, ts = traceStart(ctx, "Article", "Get")
+	ts.End(ctx, nil)
+
+	spans := sr.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("want 3 spans, got %d", len(spans))
+	}
+	hook, create, get := spans[0], spans[1], spans[2]
+	for _, c := range []struct {
+		span  sdktrace.ReadOnlySpan
+		name  string
+		attrs []attribute.KeyValue
+		code  codes.Code
+	}{
+		{hook, "store.Article.hook.beforeCreate", []attribute.KeyValue{TraceModelKey.String("Article"), TraceHookKey.String("beforeCreate")}, codes.Error},
+		{create, "store.Article.Create", []attribute.KeyValue{TraceModelKey.String("Article"), TraceActionKey.String("Create")}, codes.Error},
+		{get, "store.Article.Get", []attribute.KeyValue{TraceModelKey.String("Article"), TraceActionKey.String("Get")}, codes.Unset},
+	} {
+		if c.span.Name() != c.name {
+			t.Errorf("span name: want %s, got %s", c.name, c.span.Name())
+		}
+		got := attribute.NewSet(c.span.Attributes()...)
+		if want := attribute.NewSet(c.attrs...); !got.Equals(&want) {
+			t.Errorf("%s attrs: want %v, got %v", c.name, want.ToSlice(), got.ToSlice())
+		}
+		if st := c.span.Status(); st.Code != c.code {
+			t.Errorf("%s status: want %v, got %v", c.name, c.code, st.Code)
+		}
+	}
+	if create.Status().Description != errHook.Error() || len(create.Events()) == 0 {
+		t.Errorf("create error not recorded: %+v", create.Status())
+	}
+	if hook.Parent().SpanID() != create.SpanContext().SpanID() {
+		t.Error("hook span should be a child of the store method")
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatal(err)
+	}
+	var durations, errs int
+	for _, sm := range rm.ScopeMetrics {
+		if sm.Scope.Name != TraceName {
+			continue
+		}
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Histogram[float64]:
+				if m.Name != "store.duration" {
+					continue
+				}
+				for _, dp := range data.DataPoints {
+					durations += int(dp.Count)
+				}
+			case metricdata.Sum[int64]:
+				if m.Name != "store.errors" {
+					continue
+				}
+				for _, dp := range data.DataPoints {
+					if v, _ := dp.Attributes.Value(TraceActionKey); v.AsString() == "Get" {
+						t.Error("Get should not count as error")
+					}
+					errs += int(dp.Value)
+				}
+			}
+		}
+	}
+	if durations != 3 {
+		t.Errorf("store.duration: want 3 records, got %d", durations)
+	}
+	if errs != 2 {
+		t.Errorf("store.errors: want 2, got %d", errs)
+	}
+}
@@ -0,0 +1,119 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cupogo/andvari/models/oid"
+	"github.com/cupogo/andvari/stores/pgx"
+)
+
+// vars
+var (
+	ErrNoTenant = errors.New("tenant is required")
+)
+
+type tenantCtxKey struct{}
+
+// ContextWithTenant 设置上下文的租户，之后的存储操作限定在此租户内
+func ContextWithTenant(ctx context.Context, id oid.OID) context.Context {
+	return context.WithValue(ctx, tenantCtxKey{}, id)
+}
+
+// TenantFromContext 上下文的租户
+func TenantFromContext(ctx context.Context) (oid.OID, bool) {
+	id, ok := ctx.Value(tenantCtxKey{}).(oid.OID)
+	return id, ok && !id.IsZero()
+}
+
+// TenantModel 按租户隔离的模型
+type TenantModel interface {
+	GetTenantID() oid.OID
+	SetTenantID(id oid.OID)
+}
+
+// tenantScope 上下文限定的租户，系统范围时为空，既没有租户又不是系统范围时返回 ErrNoTenant
+func tenantScope(ctx context.Context) (id oid.OID, err error) {
+	id, ok := TenantFromContext(ctx)
+	if !ok && !IsSystemContext(ctx) {
+		err = ErrNoTenant
+	}
+	return
+}
+
+// tenantStamp 创建时写入上下文的租户，没有租户时不能创建
+func tenantStamp(ctx context.Context, obj TenantModel) error {
+	id, ok := TenantFromContext(ctx)
+	if !ok {
+		return ErrNoTenant
+	}
+	obj.SetTenantID(id)
+	return nil
+}
+
+// tenantMatch 记录属于上下文的租户，系统范围时均属于
+func tenantMatch(ctx context.Context, obj TenantModel) bool {
+	id, err := tenantScope(ctx)
+	return err == nil && (id.IsZero() || obj.GetTenantID() == id)
+}
+
+// tenantCheck 其他租户的记录视为不存在
+func tenantCheck(ctx context.Context, obj TenantModel) error {
+	id, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
+	if !id.IsZero() && obj.GetTenantID() != id {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// tenantSift 限定上下文租户的条件，用于关联的子记录
+func tenantSift(ctx context.Context) func(*ormQuery) *ormQuery {
+	var ts TenantSpec
+	_ = ts.SetTenant(ctx)
+	return ts.Sift
+}
+
+// dbGetWithTenant 同 dbGetWithPKID，上下文有租户时加上租户的条件
+func dbGetWithTenant(ctx context.Context, db ormDB, obj pgx.Model, id any, cols ...string) error {
+	tid, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
+	if tid.IsZero() {
+		return dbGetWithPKID(ctx, db, obj, id, cols...)
+	}
+	if !obj.SetID(id) {
+		return fmt.Errorf("invalid id: '%+v'", id)
+	}
+	err = db.NewSelect().Model(obj).Column(cols...).WherePK().Where("?TableAlias.tenant_id = ?", tid).Scan(ctx)
+	if errorIs(err, ErrNoRows) {
+		return fmt.Errorf("model %s with pk %v: %w", pgx.ModelName(obj), id, ErrNotFound)
+	}
+	return err
+}
+
+// TenantSpec 租户的查询条件，由存储从上下文设置，不接收请求参数
+type TenantSpec struct {
+	tenantID oid.OID
+	denied   bool
+}
+
+// SetTenant 取上下文的租户，系统范围时不限定，都没有时返回 ErrNoTenant，查询为空
+func (s *TenantSpec) SetTenant(ctx context.Context) (err error) {
+	s.tenantID, err = tenantScope(ctx)
+	s.denied = err != nil
+	return
+}
+
+func (s *TenantSpec) Sift(q *ormQuery) *ormQuery {
+	if s.denied {
+		q.Where("false")
+	} else if !s.tenantID.IsZero() {
+		q.Where("?TableAlias.tenant_id = ?", s.tenantID)
+	}
+	return q
+}
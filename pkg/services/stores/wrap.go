@@ -1,16 +1,27 @@
 package stores
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/uptrace/bun/dialect/pgdialect"
 
 	"github.com/cupogo/andvari/database/embeds"
 	"github.com/cupogo/andvari/models/comm"
+	"github.com/cupogo/andvari/models/oid"
 	"github.com/cupogo/andvari/stores/pgx"
 	"github.com/cupogo/andvari/utils"
+	"github.com/cupogo/andvari/utils/sqlutil"
 	"github.com/cupogo/andvari/utils/zlog"
 
 	"github.com/cupogo/scaffold/pkg/settings"
@@ -39,6 +50,8 @@ var (
 	ErrNotFound = pgx.ErrNotFound
 	ErrEmptyKey = pgx.ErrEmptyKey
 
+	ErrInvalidCursor = errors.New("invalid cursor")
+
 	dbGet           = pgx.Get
 	dbFirst         = pgx.First
 	dbLast          = pgx.Last
@@ -55,6 +68,8 @@ var (
 	dbDeleteT       = pgx.DoDeleteT
 	dbStoreSimple   = pgx.StoreSimple
 	dbMetaUp        = pgx.DoMetaUp
+	dbSchema        = pgx.LastSchema
+	dbSchemaCrap    = pgx.LastSchemaCrap
 
 	sift      = pgx.Sift
 	siftEqual = pgx.SiftEqual
@@ -95,9 +110,20 @@ var (
 	stoW    *Wrap
 )
 
+// WrapDB 存储使用的数据库，为连接池 *pgx.DB 或 InTx 中的事务
+type WrapDB interface {
+	ormDB
+	GetTsCfg() (string, bool)
+	Schema() string
+	SchemaCrap() string
+	ListModel(ctx context.Context, spec pgx.ListArg, dataptr any) (total int, err error)
+	DeleteModel(ctx context.Context, obj pgx.ModelIdentity, id any) error
+}
+
 // Wrap implements Storages
 type Wrap struct {
-	db *pgx.DB
+	db       WrapDB
+	replicas []WrapDB // 只读的从库，见 rdb
 
 	contentStore *contentStore // gened
 
@@ -105,7 +131,7 @@ type Wrap struct {
 }
 
 // NewWithDB return new instance of Wrap
-func NewWithDB(db *pgx.DB) *Wrap {
+func NewWithDB(db WrapDB) *Wrap {
 	w := &Wrap{db: db}
 
 	w.contentStore = newContentStore(w)  // gened
@@ -139,19 +165,972 @@ func SgtDB(args ...string) *pgx.DB {
 // Sgt start and return a singleton instance of Storage
 func Sgt() *Wrap {
 	stoOnce.Do(func() {
-		stoW = NewWithDB(SgtDB())
+		stoW = NewWithDB(SgtDB()).WithReplicas(SgtReplicas()...)
 	})
 	return stoW
 }
 
 func (w *Wrap) Close() {
-	_ = w.db.Close()
+	if db, ok := w.db.(*pgx.DB); ok {
+		_ = db.Close()
+	}
+	for _, r := range w.replicas {
+		if db, ok := r.(*replicaDB); ok {
+			_ = db.Close()
+		}
+	}
+}
+
+// InTx 在一个事务中执行 fn，其中各存储的调用共用此事务，钩子照常执行
+// fn 返回错误时回滚；已在事务中时使用保存点
+// 写入后的钩子和搜索索引的同步待最外层事务提交后再执行，出错只记录
+func (w *Wrap) InTx(ctx context.Context, fn func(sto Storage) error) error {
+	t := &txDB{db: w.db}
+	tw := NewWithDB(t)
+	err := w.db.RunInTx(ctx, nil, func(ctx context.Context, tx pgTx) error {
+		t.pgTx = tx
+		return fn(tw)
+	})
+	tw.db = t.root() // 事务结束后，提交后执行的钩子经原来的数据库
+	// 回滚时丢弃记下的函数，保存点亦然
+	if err != nil {
+		return err
+	}
+	if p, ok := w.db.(*txDB); ok { // 保存点已释放，待外层事务提交
+		for _, f := range t.commits {
+			p.afterCommit(f)
+		}
+		return nil
+	}
+	for _, f := range t.commits {
+		f(ctx)
+	}
+	return nil
+}
+
+// inTx 是否为 InTx 中的实例
+func (w *Wrap) inTx() bool {
+	_, ok := w.db.(*txDB)
+	return ok
+}
+
+// afterCommit 调用写入后的钩子 fn，在 InTx 中时待最外层事务提交后再调用，出错只记录
+func (w *Wrap) afterCommit(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	t, ok := w.db.(*txDB)
+	if !ok {
+		return fn(ctx)
+	}
+	t.afterCommit(func(ctx context.Context) {
+		if err := fn(ctx); err != nil {
+			logger().Infow("after commit fail", "name", name, "err", err)
+		}
+	})
+	return nil
+}
+
+type commitsCtxKey struct{}
+
+// commitQueue 事务中记下的提交后执行的函数，如从属对象的缓存和搜索索引，见 withCommits
+type commitQueue struct {
+	mu  sync.Mutex
+	fns []func(ctx context.Context, w *Wrap) error
+}
+
+// withCommits 在 ctx 中加入新的队列，事务中由 queueCommit 记入，提交后由 Wrap.runCommits 执行
+func withCommits(ctx context.Context) (context.Context, *commitQueue) {
+	cq := new(commitQueue)
+	return context.WithValue(ctx, commitsCtxKey{}, cq), cq
+}
+
+// queueCommit 记下事务提交后执行的 fn，ctx 中没有队列时丢弃
+func queueCommit(ctx context.Context, name string, fn func(ctx context.Context, w *Wrap) error) {
+	cq, ok := ctx.Value(commitsCtxKey{}).(*commitQueue)
+	if !ok {
+		logger().Infow("no commit queue, skip", "name", name)
+		return
+	}
+	cq.add(fn)
+}
+
+func (cq *commitQueue) add(fns ...func(ctx context.Context, w *Wrap) error) {
+	cq.mu.Lock()
+	cq.fns = append(cq.fns, fns...)
+	cq.mu.Unlock()
+}
+
+// mergeInto 将记下的函数并入 ctx 中的队列，用于保存点或分批的事务成功后
+func (cq *commitQueue) mergeInto(ctx context.Context) {
+	if p, ok := ctx.Value(commitsCtxKey{}).(*commitQueue); ok && p != cq {
+		cq.mu.Lock()
+		fns := cq.fns
+		cq.fns = nil
+		cq.mu.Unlock()
+		p.add(fns...)
+	}
+}
+
+// runCommits 事务提交后依次执行 cq 中的函数，在 InTx 中时待最外层事务提交，见 afterCommit
+func (w *Wrap) runCommits(ctx context.Context, name string, cq *commitQueue) error {
+	cq.mu.Lock()
+	fns := cq.fns
+	cq.fns = nil
+	cq.mu.Unlock()
+	if len(fns) == 0 {
+		return nil
+	}
+	return w.afterCommit(ctx, name, func(ctx context.Context) error {
+		var errs []error
+		for _, fn := range fns {
+			if err := fn(ctx, w); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	})
+}
+
+// txDB 事务，其余配置取自原来的数据库
+type txDB struct {
+	pgTx
+	db WrapDB
+
+	mu      sync.Mutex
+	commits []func(ctx context.Context)
+}
+
+// afterCommit 记下事务提交后执行的函数，嵌套的在保存点释放后由 InTx 交给外层
+func (t *txDB) afterCommit(f func(ctx context.Context)) {
+	t.mu.Lock()
+	t.commits = append(t.commits, f)
+	t.mu.Unlock()
+}
+
+// root 最外层事务之外的数据库
+func (t *txDB) root() WrapDB {
+	if p, ok := t.db.(*txDB); ok {
+		return p.root()
+	}
+	return t.db
+}
+
+func (t *txDB) GetTsCfg() (string, bool) { return t.db.GetTsCfg() }
+func (t *txDB) Schema() string           { return t.db.Schema() }
+func (t *txDB) SchemaCrap() string       { return t.db.SchemaCrap() }
+
+// ListModel 同 pgx.DB.ListModel，在事务中查询
+func (t *txDB) ListModel(ctx context.Context, spec pgx.ListArg, dataptr any) (total int, err error) {
+	return listModel(ctx, t.pgTx, t.SchemaCrap(), spec, dataptr)
+}
+
+// listModel 同 pgx.DB.ListModel，crap 为回收站的 schema
+func listModel(ctx context.Context, db ormDB, crap string, spec pgx.ListArg, dataptr any) (total int, err error) {
+	q := queryList(ctx, db, spec, dataptr)
+	if spec.Deleted() {
+		q.ModelTableExpr(crap + ".?TableName AS ?TableAlias")
+	}
+	if !spec.HasColumn() && !spec.HasExcludeColumn() {
+		q = pgx.ApplyQueryContext(ctx, q)
+	}
+	return queryPager(ctx, spec, q)
+}
+
+// DeleteModel 同 pgx.DB.DeleteModel，在事务中删除
+func (t *txDB) DeleteModel(ctx context.Context, obj pgx.ModelIdentity, id any) error {
+	if !obj.SetID(id) || obj.IsZeroID() {
+		return pgx.ErrEmptyPK
+	}
+	return t.pgTx.RunInTx(ctx, nil, func(ctx context.Context, tx pgTx) error {
+		return pgx.DoDeleteM(ctx, tx, t.Schema(), t.SchemaCrap(), obj)
+	})
 }
 
 func DbTsCheck() (cfg string, enable bool) {
 	return Sgt().db.GetTsCfg()
 }
 
+// TsRankSpec 全文检索，有关键词且未指定排序时按相关度倒序，可返回关键词摘要
+type TsRankSpec struct {
+	TextSearchSpec
+
+	cfgname string
+	norank  bool
+	ranked  bool
+
+	// 是否返回关键词摘要
+	Headline bool `extensions:"x-order=9" form:"hl" json:"hl,omitempty"`
+}
+
+func (s *TsRankSpec) SetTsConfig(cn string, en bool) {
+	s.cfgname = cn
+	s.TextSearchSpec.SetTsConfig(cn, en)
+}
+
+// SetTsRank 是否按相关度排序，按主键分批读取时需关闭
+func (s *TsRankSpec) SetTsRank(on bool) {
+	s.norank = !on
+}
+
+// TsRanked 已按相关度排序，此时不能用游标分页
+func (s *TsRankSpec) TsRanked() bool {
+	return s.ranked
+}
+
+// tsQuery 关键词的 tsquery 表达式及参数
+func (s *TsRankSpec) tsQuery() (string, []any) {
+	return pgx.GetTSQname(s.SearchStyle) + "(?, ?)", []any{s.cfgname, sqlutil.CleanWildcard(s.SearchKeyWord)}
+}
+
+// SiftRank 有关键词且未指定排序时按相关度倒序
+func (s *TsRankSpec) SiftRank(q *ormQuery, sort string) *ormQuery {
+	s.ranked = !s.norank && len(sort) == 0 && s.TsEnabled() && len(s.SearchKeyWord) > 0
+	if s.ranked {
+		expr, args := s.tsQuery()
+		q.OrderExpr("ts_rank(?TableAlias.ts_vec, "+expr+") DESC", args...)
+	}
+	return q
+}
+
+// queryHeadlines 请求摘要时按编号查出各列的 ts_headline，cols 依次为列名和摘要的键
+func queryHeadlines[S ~[]E, E any](ctx context.Context, db ormDB, s *TsRankSpec, data S,
+	idOf func(*E) any, set func(*E, map[string]string), cols ...[2]string) error {
+	if !s.Headline || !s.TsEnabled() || len(s.SearchKeyWord) == 0 || len(data) == 0 {
+		return nil
+	}
+	ids := make([]any, len(data))
+	for i := range data {
+		ids[i] = idOf(&data[i])
+	}
+	expr, args := s.tsQuery()
+	q := db.NewSelect().Model((*E)(nil)).Column("id").Where("?TableAlias.id IN (?)", pgIn(ids))
+	for _, c := range cols {
+		q.ColumnExpr("ts_headline(?, ?TableAlias.?, "+expr+") AS ?",
+			append([]any{s.cfgname, pgIdent(c[0])}, append(args, pgIdent(c[1]))...)...)
+	}
+	var rows []map[string]any
+	if err := q.Scan(ctx, &rows); err != nil {
+		return err
+	}
+	hls := make(map[string]map[string]string, len(rows))
+	for _, row := range rows {
+		hl := make(map[string]string, len(cols))
+		for _, c := range cols {
+			if v, ok := row[c[1]].(string); ok {
+				hl[c[1]] = v
+			}
+		}
+		hls[fmt.Sprint(row["id"])] = hl
+	}
+	for i := range data {
+		if hl, ok := hls[fmt.Sprint(idOf(&data[i]))]; ok {
+			set(&data[i], hl)
+		}
+	}
+	return nil
+}
+
+// FacetMax 每个分面最多返回的值的个数
+var FacetMax = 50
+
+// FacetField 分面计数的字段，Key 为参数名
+type FacetField struct {
+	Key    string
+	Column string
+	Kind   FilterKind
+}
+
+// FacetCount 分面字段的一个值及其记录数
+type FacetCount struct {
+	Value any `json:"value"`
+	Count int `json:"count"`
+} // @name FacetCount
+
+// Facets 各分面字段的计数，键为参数名，按记录数倒序
+type Facets map[string][]FacetCount
+
+// queryFacets 逐个字段分组计数，sift 返回去掉该字段自身条件的查询条件
+func queryFacets(ctx context.Context, db ormDB, model any, sift func(key string) func(*ormQuery) *ormQuery, fields ...FacetField) (Facets, error) {
+	out := make(Facets, len(fields))
+	for _, ff := range fields {
+		sub := sift(ff.Key)(db.NewSelect().Model(model))
+		data := []FacetCount{}
+		err := db.NewSelect().TableExpr("(?) AS t", sub).
+			ColumnExpr("t.? AS value", pgIdent(ff.Column)).ColumnExpr("count(*) AS count").
+			GroupExpr("t.?", pgIdent(ff.Column)).OrderExpr("count DESC").OrderExpr("t.?", pgIdent(ff.Column)).
+			Limit(FacetMax).Scan(ctx, &data)
+		if err != nil {
+			return nil, err
+		}
+		for i := range data {
+			switch v := data[i].Value.(type) {
+			case int64:
+				if ff.Kind == FilterOID {
+					data[i].Value = oid.OID(v).String()
+				}
+			case []byte:
+				data[i].Value = string(v)
+			}
+		}
+		out[ff.Key] = data
+	}
+	return out, nil
+}
+
+// siftRange 按范围匹配，格式 min~max，可省略一端，以 ( 或 ) 包围表示不含边界，如 (10~20]
+//
+//	isTime 值为日期或时间，isInt 是指用整数(毫秒)表示的时间
+func siftRange(q *ormQuery, field string, s string, isTime, isInt, isOr bool) (*ormQuery, bool) {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return q, false
+	}
+	minOp, maxOp := ">=", "<="
+	if strings.HasPrefix(s, "(") {
+		minOp = ">"
+	}
+	if strings.HasSuffix(s, ")") {
+		maxOp = "<"
+	}
+	a, b, ok := strings.Cut(strings.Trim(s, "[]()"), "~")
+	if !ok {
+		logger().Infow("invalid range", "field", field, "range", s)
+		return q, false
+	}
+	prefix := "?TableAlias."
+	if strings.Contains(field, ".") {
+		prefix = ""
+	}
+	var conds []string
+	var args []any
+	bounds := [][2]string{
+		{minOp, a},
+		{maxOp, b},
+	}
+	for _, bound := range bounds {
+		v := strings.TrimSpace(bound[1])
+		if len(v) == 0 {
+			continue
+		}
+		val, err := rangeValue(v, isTime, isInt)
+		if err != nil {
+			logger().Infow("invalid range", "field", field, "range", s, "err", err)
+			return q, false
+		}
+		conds = append(conds, prefix+"? "+bound[0]+" ?")
+		args = append(args, pgIdent(field), val)
+	}
+	if len(conds) == 0 {
+		return q, false
+	}
+	if isOr {
+		return q.WhereOr(strings.Join(conds, " AND "), args...), true
+	}
+	return q.Where(strings.Join(conds, " AND "), args...), true
+}
+
+func rangeValue(s string, isTime, isInt bool) (any, error) {
+	if !isTime {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n, nil
+		}
+		return strconv.ParseFloat(s, 64)
+	}
+	for _, layout := range []string{time.RFC3339, time.DateTime, time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			if isInt {
+				return t.UnixMilli(), nil
+			}
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid time %q", s)
+}
+
+// CursorSpec 游标分页参数，按排序键和主键定位，不使用偏移，默认不计算总数
+// 仅在有 cursor、after 或 before 时启用，否则仍按偏移分页并计算总数
+type CursorSpec struct {
+	// 是否游标分页，首次请求时设置，之后带上 after 或 before
+	Cursor bool `json:"cursor,omitempty" form:"cursor" extensions:"x-order=~"`
+	// 游标，取此位置之后的记录，即上次结果中的 next
+	After string `json:"after,omitempty" form:"after" extensions:"x-order=~"`
+	// 游标，取此位置之前的记录，即上次结果中的 prev
+	Before string `json:"before,omitempty" form:"before" extensions:"x-order=~"`
+	// 是否计算总数
+	Count bool `json:"count,omitempty" form:"count" extensions:"x-order=~"`
+
+	next, prev string
+} // @name CursorSpec
+
+// Cursors 返回本次结果的前后游标，为空表示没有更多
+func (cs *CursorSpec) Cursors() (next, prev string) {
+	return cs.next, cs.prev
+}
+
+func encodeCursor(key, id any) string {
+	b, _ := json.Marshal([]any{key, id})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (key, id any, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return
+	}
+	var vals []any
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err = dec.Decode(&vals); err == nil && len(vals) != 2 {
+		err = fmt.Errorf("invalid cursor %q", s)
+	}
+	if err != nil {
+		return
+	}
+	return vals[0], vals[1], nil
+}
+
+// queryCursor 按游标分页查询，key 为排序列，desc 为倒序，keyOf 返回记录的排序值和主键
+//
+//	没有 cursor、after 和 before 时，仍按偏移分页；游标分页时只能按 key 排序，
+//	排序参数为其他时返回 ErrInvalidCursor，以免游标与实际的顺序不符
+func queryCursor[S ~[]E, E any](ctx context.Context, p pgx.Pager, cs *CursorSpec, q *ormQuery,
+	data *S, key string, desc bool, keyOf func(*E) (any, any)) (total int, err error) {
+	if r, ok := p.(interface{ TsRanked() bool }); ok && r.TsRanked() {
+		return queryPager(ctx, p, q)
+	}
+	if !cs.Cursor && len(cs.After) == 0 && len(cs.Before) == 0 {
+		return queryPager(ctx, p, q)
+	}
+	if rule := p.GetSort(); !cursorSorted(rule, key, desc) {
+		return 0, fmt.Errorf("%w: sort %q, only %s", ErrInvalidCursor, rule, cursorSort(key, desc))
+	}
+	if cs.Count {
+		if total, err = q.Count(ctx); err != nil {
+			return
+		}
+	}
+	backward := len(cs.After) == 0 && len(cs.Before) > 0
+	token := cs.After
+	if backward {
+		token = cs.Before
+	}
+	op, order := ">", "ASC"
+	if desc != backward {
+		op, order = "<", "DESC"
+	}
+	if len(token) > 0 {
+		kv, id, e := decodeCursor(token)
+		if e != nil {
+			return 0, fmt.Errorf("%w: %w", ErrInvalidCursor, e)
+		}
+		q.Where("(?TableAlias.?, ?TableAlias.id) "+op+" (?, ?)", pgIdent(key), kv, id)
+	}
+	q.OrderExpr("?TableAlias.? "+order+", ?TableAlias.id "+order, pgIdent(key))
+
+	limit := p.GetLimit()
+	if limit <= 0 {
+		limit = 20
+	}
+	if err = q.Limit(limit + 1).Scan(ctx); err != nil {
+		return
+	}
+	rows := *data
+	more := len(rows) > limit
+	if more {
+		rows = rows[:limit]
+	}
+	if backward {
+		slices.Reverse(rows)
+	}
+	*data = rows
+	cs.next, cs.prev = "", ""
+	if n := len(rows); n > 0 {
+		if more || backward {
+			cs.next = encodeCursor(keyOf(&rows[n-1]))
+		}
+		if len(cs.After) > 0 || backward && more {
+			cs.prev = encodeCursor(keyOf(&rows[0]))
+		}
+	}
+	return
+}
+
+// cursorSort 游标分页的排序参数，如 -created
+func cursorSort(key string, desc bool) string {
+	if desc {
+		return "-" + key
+	}
+	return key
+}
+
+// cursorSorted 排序参数为空或与游标的排序相同
+func cursorSorted(rule, key string, desc bool) bool {
+	if len(rule) == 0 || rule == cursorSort(key, desc) {
+		return true
+	}
+	k, op, ok := strings.Cut(rule, " ")
+	return ok && k == key && strings.EqualFold(op, "DESC") == desc && (desc || strings.EqualFold(op, "ASC"))
+}
+
+// ExportBatch 导出时每批读取的记录数
+var ExportBatch = 500
+
+// queryBatches 按主键顺序分批读取符合条件的记录，每批调用 fn，用于流式导出
+func queryBatches[S ~[]E, E any](ctx context.Context, db ormDB, sift func(*ormQuery) *ormQuery,
+	fn func(S) error, idOf func(*E) any) error {
+	var last any
+	for {
+		var data S
+		q := sift(db.NewSelect().Model(&data))
+		if last != nil {
+			q.Where("?TableAlias.id > ?", last)
+		}
+		if err := q.OrderExpr("?TableAlias.id").Limit(ExportBatch).Scan(ctx); err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			return nil
+		}
+		if err := fn(data); err != nil {
+			return err
+		}
+		if len(data) < ExportBatch {
+			return nil
+		}
+		last = idOf(&data[len(data)-1])
+	}
+}
+
+// ImportBatch 导入时每个事务写入的记录数
+var ImportBatch = 200
+
+// ImportError 导入第 Index 条记录时的错误
+type ImportError struct {
+	Index int
+	Err   error
+}
+
+func (e *ImportError) Error() string    { return fmt.Sprintf("import #%d: %s", e.Index, e.Err) }
+func (e *ImportError) Unwrap() error    { return e.Err }
+func (e *ImportError) ImportIndex() int { return e.Index }
+
+// ImportErrors 导入中出错而跳过的各条，其他的照常写入
+type ImportErrors []*ImportError
+
+func (e ImportErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%s, and %d more", e[0], len(e)-1)
+}
+
+func (e ImportErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i := range e {
+		errs[i] = e[i]
+	}
+	return errs
+}
+
+var errDryRun = errors.New("dry run")
+
+// importChunks 按批在事务中逐条创建，每条在各自的保存点中，出错的只回滚该条并以 ImportErrors 返回，dryRun 时整批写入后回滚
+// out 与已处理的 in 依次对应，出错的为零值；事务出错时停止，返回此前各批的记录和错误
+// 各条记下的提交后执行的函数（见 queueCommit）仅在该条写入成功且该批提交后并入 ctx 的队列
+func importChunks[E any, O any](ctx context.Context, db ormDB, in []E, dryRun bool,
+	fn func(ctx context.Context, tx pgTx, in E) (O, error)) (out []O, err error) {
+	var failed ImportErrors
+	for start := 0; start < len(in) && err == nil; start += ImportBatch {
+		end := min(start+ImportBatch, len(in))
+		var objs []O
+		var errs ImportErrors
+		cctx, cq := withCommits(ctx) // 该批提交后才并入
+		err = db.RunInTx(cctx, nil, func(ctx context.Context, tx pgTx) error {
+			objs, errs = make([]O, end-start), nil
+			for i := start; i < end; i++ {
+				rctx, rq := withCommits(ctx)
+				if err := tx.RunInTx(rctx, nil, func(ctx context.Context, tx pgTx) (err error) {
+					objs[i-start], err = fn(ctx, tx, in[i])
+					return
+				}); err != nil {
+					var zero O
+					objs[i-start] = zero
+					errs = append(errs, &ImportError{Index: i, Err: err})
+					continue
+				}
+				rq.mergeInto(ctx)
+			}
+			if dryRun {
+				return errDryRun
+			}
+			return nil
+		})
+		if errors.Is(err, errDryRun) {
+			err = nil
+		}
+		if err == nil {
+			if !dryRun {
+				cq.mergeInto(ctx)
+			}
+			out = append(out, objs...)
+			failed = append(failed, errs...)
+		}
+	}
+	if len(failed) > 0 {
+		err = errors.Join(failed, err)
+	}
+	return
+}
+
+// IsDuplicateError 是否违反唯一约束
+func IsDuplicateError(err error) bool {
+	if errors.Is(err, pgx.ErrDuplicate) {
+		return true
+	}
+	var pe pgx.PGError
+	return errors.As(err, &pe) && pe.Field('C') == "23505"
+}
+
+// SortError 无效的排序参数
+type SortError string
+
+func (e SortError) Error() string { return "invalid sort: " + string(e) }
+func (e SortError) Field() string { return "sort" }
+
+// RelationError 无效的关联名
+type RelationError string
+
+func (e RelationError) Error() string { return "invalid rel: " + string(e) }
+func (e RelationError) Field() string { return "rel" }
+
+// ParseRelations 解析查询参数 rel，多个以逗号分隔，1 或 true 表示全部的 names，其他不在 names 中的返回 RelationError
+func ParseRelations(rel string, names ...string) ([]string, error) {
+	if rel = strings.TrimSpace(rel); len(rel) == 0 {
+		return nil, nil
+	}
+	if rel == "1" || strings.EqualFold(rel, "true") {
+		return names, nil
+	}
+	var out []string
+	for _, rn := range strings.Split(rel, ",") {
+		if rn = strings.TrimSpace(rn); len(rn) == 0 {
+			continue
+		}
+		if !slices.Contains(names, rn) {
+			return nil, RelationError(rn)
+		}
+		if !slices.Contains(out, rn) {
+			out = append(out, rn)
+		}
+	}
+	return out, nil
+}
+
+// CheckSort 检查排序参数，格式为 key [asc|desc] 或 [-]key，多个以逗号分隔
+func CheckSort(p pgx.Sortable) error {
+	rule := p.GetSort()
+	if len(rule) == 0 {
+		return nil
+	}
+	for _, order := range strings.Split(rule, ",") {
+		key := order
+		if k, op, ok := strings.Cut(order, " "); ok {
+			if op = strings.ToUpper(op); op != "ASC" && op != "DESC" {
+				return SortError(order)
+			}
+			key = k
+		} else {
+			key = strings.TrimPrefix(key, "-")
+		}
+		if len(key) == 0 || !p.CanSort(key) {
+			return SortError(order)
+		}
+	}
+	return nil
+}
+
+// sortColumns 把排序参数中的 json 名换为列名，pairs 依次为 json 名和列名，其余不变
+func sortColumns(rule string, pairs ...string) string {
+	if len(rule) == 0 {
+		return rule
+	}
+	orders := strings.Split(rule, ",")
+	for i, order := range orders {
+		key, op, spaced := strings.Cut(order, " ")
+		prefix := ""
+		if !spaced && strings.HasPrefix(key, "-") {
+			prefix, key = "-", key[1:]
+		}
+		for j := 0; j+1 < len(pairs); j += 2 {
+			if key == pairs[j] {
+				key = pairs[j+1]
+				break
+			}
+		}
+		if spaced {
+			orders[i] = key + " " + op
+		} else {
+			orders[i] = prefix + key
+		}
+	}
+	return strings.Join(orders, ",")
+}
+
+// FilterKind filter 参数中字段值的类型
+type FilterKind int8
+
+const (
+	FilterString   FilterKind = iota
+	FilterInt                 // 整数
+	FilterFloat               // 小数
+	FilterBool                // 布尔
+	FilterOID                 // 编号
+	FilterTime                // 时间
+	FilterDateTime            // 以毫秒整数表示的时间
+)
+
+// filterOps 各类型允许的操作
+var filterOps = map[FilterKind][]string{
+	FilterString:   {"eq", "ne", "in", "like"},
+	FilterInt:      {"eq", "ne", "in", "gt", "gte", "lt", "lte"},
+	FilterFloat:    {"eq", "ne", "in", "gt", "gte", "lt", "lte"},
+	FilterBool:     {"eq", "ne"},
+	FilterOID:      {"eq", "ne", "in"},
+	FilterTime:     {"gt", "gte", "lt", "lte"},
+	FilterDateTime: {"gt", "gte", "lt", "lte"},
+}
+
+var filterSQLOps = map[string]string{
+	"eq": "=", "ne": "<>", "gt": ">", "gte": ">=", "lt": "<", "lte": "<=",
+}
+
+// FilterField filter 参数中可用的字段
+type FilterField struct {
+	Column string
+	Kind   FilterKind
+}
+
+// Filterable 允许 filter 参数的查询条件，key 为字段的 json 名称
+type Filterable interface {
+	CanFilter(key string) (FilterField, bool)
+}
+
+// FilterError 无效的 filter 子句
+type FilterError struct {
+	Clause string
+	Reason string
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("invalid filter %q: %s", e.Clause, e.Reason)
+}
+
+type filterClause struct {
+	FilterField
+	op  string
+	val string
+	arg any
+}
+
+// CheckFilter 检查 filter 参数，子句以分号分隔，格式为 key:op:value，如 status:in:1,2;title:like:go*
+func CheckFilter(s string, p Filterable) error {
+	_, err := parseFilter(s, p)
+	return err
+}
+
+func parseFilter(s string, p Filterable) (clauses []filterClause, err error) {
+	if len(s) == 0 {
+		return
+	}
+	for _, clause := range strings.Split(s, ";") {
+		if len(clause) == 0 {
+			continue
+		}
+		key, rest, _ := strings.Cut(clause, ":")
+		op, val, ok := strings.Cut(rest, ":")
+		if !ok || len(val) == 0 {
+			return nil, &FilterError{clause, "want key:op:value"}
+		}
+		ff, ok := p.CanFilter(key)
+		if !ok {
+			return nil, &FilterError{clause, "unknown field " + key}
+		}
+		if !slices.Contains(filterOps[ff.Kind], op) {
+			return nil, &FilterError{clause, "unsupported operator " + op}
+		}
+		fc := filterClause{FilterField: ff, op: op, val: val}
+		vals := []string{val}
+		if op == "in" {
+			vals = strings.Split(val, ",")
+		}
+		for _, v := range vals {
+			if fc.arg, err = filterValue(ff.Kind, v); err != nil {
+				return nil, &FilterError{clause, fmt.Sprintf("invalid value %q", v)}
+			}
+		}
+		clauses = append(clauses, fc)
+	}
+	return
+}
+
+func filterValue(kind FilterKind, s string) (any, error) {
+	switch kind {
+	case FilterInt:
+		return strconv.ParseInt(s, 10, 64)
+	case FilterFloat:
+		return strconv.ParseFloat(s, 64)
+	case FilterBool:
+		return strconv.ParseBool(s)
+	case FilterOID:
+		_, id, err := oid.Parse(s)
+		return id, err
+	case FilterTime, FilterDateTime:
+		return rangeValue(s, true, kind == FilterDateTime)
+	}
+	return s, nil
+}
+
+// siftFilter 按 filter 参数添加条件，参数应已由 CheckFilter 检查
+func siftFilter(q *ormQuery, s string, p Filterable) *ormQuery {
+	clauses, err := parseFilter(s, p)
+	if err != nil {
+		logger().Infow("invalid filter", "filter", s, "err", err)
+		return q
+	}
+	for _, fc := range clauses {
+		switch {
+		case fc.op == "like":
+			q, _ = siftMatch(q, fc.Column, fc.val, false)
+		case fc.op == "in" && fc.Kind == FilterOID:
+			q, _ = siftOIDs(q, fc.Column, fc.val, false)
+		case fc.op == "in":
+			q, _ = sift(q, fc.Column, "IN", strings.Split(fc.val, ","), false)
+		case fc.op == "eq" && fc.Kind == FilterOID:
+			q, _ = siftOID(q, fc.Column, fc.val, false)
+		case fc.Kind == FilterOID, fc.Kind == FilterTime, fc.Kind == FilterDateTime:
+			q, _ = sift(q, fc.Column, filterSQLOps[fc.op], fc.arg, false)
+		default: // 以原字串传递，避免零值被忽略
+			q, _ = sift(q, fc.Column, filterSQLOps[fc.op], fc.val, false)
+		}
+	}
+	return q
+}
+
+// dropFilter 去掉 filter 参数中指定字段的子句
+func dropFilter(s string, key string) string {
+	if len(s) == 0 {
+		return s
+	}
+	clauses := strings.Split(s, ";")
+	clauses = slices.DeleteFunc(clauses, func(c string) bool {
+		k, _, _ := strings.Cut(c, ":")
+		return k == key
+	})
+	return strings.Join(clauses, ";")
+}
+
+// FieldsError 无效的字段参数
+type FieldsError string
+
+func (e FieldsError) Error() string { return "invalid field: " + string(e) }
+func (e FieldsError) Field() string { return "fields" }
+
+var fieldsDialect = pgdialect.New()
+
+// ContextWithFields 按 json 字段名选择列，多个以逗号分隔，返回的字段名用于裁剪输出
+func ContextWithFields(ctx context.Context, obj pgx.Model, fields string) (context.Context, []string, error) {
+	if len(fields) == 0 {
+		return ctx, nil, nil
+	}
+	table := fieldsDialect.Tables().Get(reflect.TypeOf(obj))
+	var cols []string
+	addCol := func(name string) {
+		if !slices.Contains(cols, name) {
+			cols = append(cols, name)
+		}
+	}
+	for _, f := range table.PKs {
+		addCol(f.Name)
+	}
+	names := strings.Split(fields, ",")
+	for _, name := range names {
+		var found bool
+		for _, f := range table.Fields {
+			if jsonName(f.StructField) == name {
+				addCol(f.Name)
+				found = true
+				break
+			}
+		}
+		for _, rel := range table.Relations {
+			if !found && jsonName(rel.Field.StructField) == name {
+				for _, f := range rel.BaseFields {
+					addCol(f.Name)
+				}
+				found = true
+			}
+		}
+		if !found {
+			return ctx, nil, FieldsError(name)
+		}
+	}
+	return ContextWithColumns(ctx, cols...), names, nil
+}
+
+func jsonName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if len(name) == 0 {
+		return sf.Name
+	}
+	return name
+}
+
+// StatByError 无效的统计分组参数
+type StatByError string
+
+func (e StatByError) Error() string { return "invalid by: " + string(e) }
+func (e StatByError) Field() string { return "by" }
+
+// StatGroup 统计分组的参数名和列
+type StatGroup struct {
+	Key    string
+	Column string
+}
+
+// statGroupBy 由 by 参数选出分组列，多个以逗号分隔，为空时使用全部分组
+func statGroupBy(by string, groups ...StatGroup) (cols []string, err error) {
+	if len(by) == 0 {
+		for _, sg := range groups {
+			cols = append(cols, sg.Column)
+		}
+		return
+	}
+	for _, key := range strings.Split(by, ",") {
+		idx := slices.IndexFunc(groups, func(sg StatGroup) bool { return sg.Key == key })
+		if idx < 0 {
+			return nil, StatByError(key)
+		}
+		if !slices.Contains(cols, groups[idx].Column) {
+			cols = append(cols, groups[idx].Column)
+		}
+	}
+	return
+}
+
+type systemCtxKey struct{}
+
+// ContextWithSystem 标记为系统范围，不限定租户和所有者，仅用于命令行、后台任务等内部调用
+func ContextWithSystem(ctx context.Context) context.Context {
+	return context.WithValue(ctx, systemCtxKey{}, true)
+}
+
+// IsSystemContext 是否为系统范围
+func IsSystemContext(ctx context.Context) bool {
+	ok, _ := ctx.Value(systemCtxKey{}).(bool)
+	return ok
+}
+
 // dbModelMetaUps all local metaUps
 func dbModelMetaUps(ctx context.Context, db ormDB, obj pgx.Model) {
 	// more
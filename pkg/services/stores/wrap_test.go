@@ -0,0 +1,454 @@
+package stores
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cupogo/andvari/models/oid"
+
+	"github.com/cupogo/scaffold/pkg/models/cms1"
+)
+
+func TestInTxAfterCommit(t *testing.T) {
+	ctx := context.Background()
+	drv := &fakeDriver{}
+	w := newFakeWrap(drv)
+
+	var ran []string
+	mark := func(sto Storage, name string) {
+		_ = sto.(*Wrap).afterCommit(ctx, name, func(context.Context) error {
+			ran = append(ran, name)
+			return nil
+		})
+	}
+	errInner := errors.New("inner fail")
+	err := w.InTx(ctx, func(sto Storage) error {
+		mark(sto, "outer")
+		if err := sto.(*Wrap).InTx(ctx, func(sto Storage) error {
+			mark(sto, "rolled back")
+			return errInner
+		}); !errors.Is(err, errInner) {
+			t.Errorf("inner: want %v, got %v", errInner, err)
+		}
+		if err := sto.(*Wrap).InTx(ctx, func(sto Storage) error {
+			mark(sto, "released")
+			return nil
+		}); err != nil {
+			t.Errorf("inner: %s", err)
+		}
+		if len(ran) > 0 {
+			t.Errorf("ran before commit: %v", ran)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"outer", "released"}; !slices.Equal(ran, want) {
+		t.Errorf("after commit: want %v, got %v", want, ran)
+	}
+	if len(drv.Execs("ROLLBACK TO SAVEPOINT")) != 1 || len(drv.Execs("RELEASE SAVEPOINT")) != 1 || len(drv.Execs("COMMIT")) != 1 {
+		t.Errorf("unexpected statements: %q", drv.execs)
+	}
+
+	// 外层回滚时均不执行
+	ran = nil
+	err = w.InTx(ctx, func(sto Storage) error {
+		mark(sto, "outer")
+		_ = sto.(*Wrap).InTx(ctx, func(sto Storage) error {
+			mark(sto, "released")
+			return nil
+		})
+		return errInner
+	})
+	if !errors.Is(err, errInner) || len(ran) > 0 {
+		t.Errorf("outer rollback: %v, ran %v", err, ran)
+	}
+
+	// 不在事务中时立即执行
+	ran = nil
+	mark(w, "direct")
+	if !slices.Equal(ran, []string{"direct"}) {
+		t.Errorf("direct: %v", ran)
+	}
+}
+
+func TestCommitQueue(t *testing.T) {
+	ctx := context.Background()
+	w := newFakeWrap(&fakeDriver{})
+
+	var ran []string
+	mark := func(ctx context.Context, name string) {
+		queueCommit(ctx, name, func(context.Context, *Wrap) error {
+			ran = append(ran, name)
+			return nil
+		})
+	}
+	ctx, cq := withCommits(ctx)
+	mark(ctx, "a")
+	rctx, rq := withCommits(ctx)
+	mark(rctx, "b")
+	mark(ctx, "c")
+	rq.mergeInto(ctx)
+	_, dropped := withCommits(ctx)
+	dropped.mergeInto(context.Background()) // ctx 中没有队列时不并入
+
+	errRun := errors.New("run fail")
+	err := w.InTx(ctx, func(sto Storage) error {
+		queueCommit(ctx, "fail", func(context.Context, *Wrap) error { return errRun })
+		if err := sto.(*Wrap).runCommits(ctx, "Parent", cq); err != nil {
+			t.Errorf("in tx: %s", err)
+		}
+		if len(ran) > 0 {
+			t.Errorf("ran before commit: %v", ran)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "c", "b"}; !slices.Equal(ran, want) {
+		t.Errorf("after commit: want %v, got %v", want, ran)
+	}
+
+	// 不在事务中时立即执行，返回各函数的错误
+	ran = nil
+	mark(ctx, "d")
+	queueCommit(ctx, "fail", func(context.Context, *Wrap) error { return errRun })
+	if err := w.runCommits(ctx, "Parent", cq); !errors.Is(err, errRun) || !slices.Equal(ran, []string{"d"}) {
+		t.Errorf("direct: %v, ran %v", err, ran)
+	}
+	if err := w.runCommits(ctx, "Parent", cq); err != nil {
+		t.Errorf("drained: %v", err)
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	key, id, err := decodeCursor(encodeCursor(ts, int64(42)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != ts.Format(time.RFC3339Nano) || id != json.Number("42") {
+		t.Errorf("want %v 42, got %v %v", ts, key, id)
+	}
+	for _, s := range []string{"", "!", encodeCursor(1, 2)[:4], base64.RawURLEncoding.EncodeToString([]byte(`[1]`))} {
+		if _, _, err := decodeCursor(s); err == nil {
+			t.Errorf("%q: want error", s)
+		}
+	}
+}
+
+func TestQueryCursor(t *testing.T) {
+	ctx := context.Background()
+	t0 := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	row := func(id int64, ts time.Time) []driver.Value { return []driver.Value{id, ts, "t"} }
+	var rows [][]driver.Value
+	drv := &fakeDriver{query: func(q string) ([]string, [][]driver.Value) {
+		return []string{"id", "created", "text"}, rows
+	}}
+	w := newFakeWrap(drv)
+	keyOf := func(o *cms1.Clause) (any, any) { return o.CreatedAt, int64(o.ID) }
+	list := func(spec *ClauseSpec, cs *CursorSpec) (cms1.Clauses, error) {
+		var data cms1.Clauses
+		q := queryList(ctx, w.db, spec, &data)
+		_, err := queryCursor(ctx, spec, cs, q, &data, "created", true, keyOf)
+		return data, err
+	}
+
+	// 第一页，后两条的创建时间相同，以主键区分
+	rows = [][]driver.Value{row(3, t0.Add(time.Minute)), row(2, t0), row(1, t0)}
+	spec, cs := &ClauseSpec{}, &CursorSpec{Cursor: true}
+	spec.Limit = 2
+	data, err := list(spec, cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 2 || len(cs.next) == 0 || len(cs.prev) > 0 {
+		t.Fatalf("first page: %d rows, next %q, prev %q", len(data), cs.next, cs.prev)
+	}
+	q := drv.execs[len(drv.execs)-1]
+	if !strings.Contains(q, `ORDER BY "c"."created" DESC, "c".id DESC LIMIT 3`) {
+		t.Errorf("first page: %s", q)
+	}
+	kv, id, _ := decodeCursor(cs.next)
+	if kv != t0.Format(time.RFC3339Nano) || id != json.Number("2") {
+		t.Errorf("next: want %v 2, got %v %v", t0, kv, id)
+	}
+
+	// 最后一页，从同一时间的下一条开始
+	rows = [][]driver.Value{row(1, t0)}
+	cs = &CursorSpec{After: cs.next}
+	if data, err = list(spec, cs); err != nil {
+		t.Fatal(err)
+	}
+	q = drv.execs[len(drv.execs)-1]
+	if !strings.Contains(q, `("c"."created", "c".id) < ('`+t0.Format(time.RFC3339Nano)+`', '2')`) {
+		t.Errorf("after: %s", q)
+	}
+	if len(data) != 1 || len(cs.next) > 0 || len(cs.prev) == 0 {
+		t.Errorf("last page: %d rows, next %q, prev %q", len(data), cs.next, cs.prev)
+	}
+
+	// 游标分页只能按游标的列排序
+	for sort, ok := range map[string]bool{"": true, "-created": true, "created DESC": true, "created": false, "-id": false, "text,-created": false} {
+		if _, err := list(&ClauseSpec{Sort: sort}, &CursorSpec{Cursor: true}); errors.Is(err, ErrInvalidCursor) == ok {
+			t.Errorf("sort %q: %v", sort, err)
+		}
+	}
+	if _, err := list(spec, &CursorSpec{After: "bad!"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("bad cursor: %v", err)
+	}
+}
+
+func TestCheckSort(t *testing.T) {
+	for _, c := range []struct {
+		sort string
+		ok   bool
+		bad  string // 报错的排序项，json 名已换为列名
+	}{
+		{"", true, ""},
+		{"author", true, ""},
+		{"-newsPublish", true, ""},
+		{"newsPublish desc,id asc", true, ""},
+		{"news_publish", true, ""},
+		{"created DESC,-updated", true, ""},
+		{"title", false, "title"}, // 不可排序的字段
+		{"nope", false, "nope"},
+		{"author,-nope", false, "-nope"},
+		{"newsPublish up", false, "news_publish up"},
+		{"author desc nulls", false, "author desc nulls"},
+		{"-author desc", false, "-author desc"},
+		{"-", false, "-"},
+		{"author,", false, ""},
+	} {
+		spec := &ArticleSpec{}
+		spec.Sort = c.sort
+		err := CheckSort(spec)
+		if c.ok {
+			if err != nil {
+				t.Errorf("%q: %s", c.sort, err)
+			}
+		} else if se, ok := err.(SortError); !ok || string(se) != c.bad {
+			t.Errorf("%q: want SortError(%q), got %v", c.sort, c.bad, err)
+		}
+	}
+}
+
+func TestSortColumns(t *testing.T) {
+	pairs := []string{"newsPublish", "news_publish", "authorID", "author_id"}
+	for _, c := range []struct{ rule, want string }{
+		{"", ""},
+		{"newsPublish", "news_publish"},
+		{"-newsPublish", "-news_publish"},
+		{"newsPublish desc", "news_publish desc"},
+		{"-authorID,newsPublish asc,id", "-author_id,news_publish asc,id"},
+		{"title", "title"},
+		{"newsPublishX", "newsPublishX"}, // 仅整体匹配
+		{"news_publish", "news_publish"},
+		{"-", "-"},
+	} {
+		if got := sortColumns(c.rule, pairs...); got != c.want {
+			t.Errorf("%q: want %q, got %q", c.rule, c.want, got)
+		}
+	}
+	if got := sortColumns("newsPublish", "newsPublish"); got != "newsPublish" {
+		t.Errorf("odd pairs: got %q", got) // 落单的 json 名不替换
+	}
+}
+
+func TestParseRelations(t *testing.T) {
+	names := []string{"Author", "Attachments"}
+	for _, c := range []struct {
+		rel  string
+		want []string
+		bad  string
+	}{
+		{"", nil, ""},
+		{"1", names, ""},
+		{"true", names, ""},
+		{"Attachments", []string{"Attachments"}, ""},
+		{" Attachments, Author ,,Attachments", []string{"Attachments", "Author"}, ""},
+		{"Attachments,Nope", nil, "Nope"},
+		{"attachments", nil, "attachments"},
+		{"0", nil, "0"},
+	} {
+		got, err := ParseRelations(c.rel, names...)
+		var re RelationError
+		if len(c.bad) > 0 {
+			if !errors.As(err, &re) || string(re) != c.bad {
+				t.Errorf("%q: want invalid %q, got %v", c.rel, c.bad, err)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, c.want) {
+			t.Errorf("%q: want %v, got %v %v", c.rel, c.want, got, err)
+		}
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	spec := &ArticleSpec{}
+	for _, c := range []struct {
+		filter string
+		ops    []string // 各子句的 op
+		reason string   // 出错时 FilterError.Reason 的前缀
+	}{
+		{"", nil, ""},
+		{";;", nil, ""},
+		{"status:in:1,2;title:like:go*", []string{"in", "like"}, ""},
+		{"title:eq:a:b", []string{"eq"}, ""}, // 值中可有冒号
+		{"newsPublish:gte:2024-01-01", []string{"gte"}, ""},
+		{"title", nil, "want key:op:value"},
+		{"title:eq", nil, "want key:op:value"},
+		{"title:eq:", nil, "want key:op:value"},
+		{"nope:eq:1", nil, "unknown field"},
+		{"content:eq:x", nil, "unknown field"},  // 未设置 query 的字段
+		{"tenantID:eq:1", nil, "unknown field"}, // 租户由上下文限定
+		{"title:gt:x", nil, "unsupported operator"},
+		{"newsPublish:eq:2024-01-01", nil, "unsupported operator"},
+		{"status:EQ:1", nil, "unsupported operator"},
+		{"status:eq:x", nil, "invalid value"},
+		{"status:in:1,x", nil, "invalid value"},
+		{"authorID:eq:bad", nil, "invalid value"},
+		{"newsPublish:gt:yesterday", nil, "invalid value"},
+		{"title:eq:a;b", nil, "want key:op:value"}, // 分号总是分隔子句
+	} {
+		clauses, err := parseFilter(c.filter, spec)
+		if len(c.reason) > 0 {
+			var fe *FilterError
+			if !errors.As(err, &fe) || !strings.HasPrefix(fe.Reason, c.reason) {
+				t.Errorf("%q: want %q, got %v", c.filter, c.reason, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", c.filter, err)
+			continue
+		}
+		ops := make([]string, len(clauses))
+		for i := range clauses {
+			ops[i] = clauses[i].op
+		}
+		if !slices.Equal(ops, c.ops) {
+			t.Errorf("%q: want ops %v, got %v", c.filter, c.ops, ops)
+		}
+	}
+}
+
+func TestSiftFilter(t *testing.T) {
+	w := newFakeWrap(&fakeDriver{})
+	spec := &ArticleSpec{}
+	aid := oid.NewID(oid.OtAccount)
+	for _, c := range []struct {
+		filter string
+		where  string
+	}{
+		{"title:eq:it's", `("a"."title" = 'it''s')`},
+		{"title:eq:a:b", `("a"."title" = 'a:b')`},
+		{"title:like:go*", `("a"."title" ILIKE 'go%')`},
+		{"status:eq:0", `("a"."status" = '0')`},
+		{"status:in:1,2", `("a"."status" IN ('1', '2'))`},
+		{"status:gt:3;author:ne:bob", `("a"."status" > '3') AND ("a"."author" <> 'bob')`},
+		{"authorID:eq:" + aid.String(), `("a"."author_id" = ` + strconv.FormatInt(int64(aid), 10) + `)`},
+		{"newsPublish:gte:2024-01-01", `("a"."news_publish" >= ` +
+			strconv.FormatInt(time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local).UnixMilli(), 10) + `)`},
+		{"status:gt:3;nope:eq:1", ""}, // 无效时整个参数不生效，应已由 CheckFilter 拒绝
+		{"content:eq:x", ""},
+	} {
+		q := siftFilter(w.db.NewSelect().Model((*cms1.Article)(nil)), c.filter, spec)
+		_, where, _ := strings.Cut(q.String(), " WHERE ")
+		if where != c.where {
+			t.Errorf("%q: want %s, got %s", c.filter, c.where, where)
+		}
+	}
+}
+
+func TestSiftRange(t *testing.T) {
+	w := newFakeWrap(&fakeDriver{})
+	ms := func(y int, m time.Month, d int) string {
+		return strconv.FormatInt(time.Date(y, m, d, 0, 0, 0, 0, time.Local).UnixMilli(), 10)
+	}
+	for _, c := range []struct {
+		field  string
+		s      string
+		isTime bool
+		isOr   bool
+		where  string
+	}{
+		{"status", "1~5", false, false, `("a"."status" >= 1 AND "a"."status" <= 5)`},
+		{"status", "[1~5]", false, false, `("a"."status" >= 1 AND "a"."status" <= 5)`},
+		{"status", "(1~5)", false, false, `("a"."status" > 1 AND "a"."status" < 5)`},
+		{"status", "(1~5]", false, false, `("a"."status" > 1 AND "a"."status" <= 5)`},
+		{"status", "1.5~", false, false, `("a"."status" >= 1.5)`},
+		{"status", "~5)", false, false, `("a"."status" < 5)`},
+		{"status", " 1 ~ 5 ", false, false, `("a"."status" >= 1 AND "a"."status" <= 5)`},
+		{"status", "1~5", false, true, `("a"."status" >= 1 AND "a"."status" <= 5)`},
+		{"a.status", "1~", false, false, `("a"."status" >= 1)`},
+		{"news_publish", "2024-01-01~2024-02-01)", true, false,
+			`("a"."news_publish" >= ` + ms(2024, 1, 1) + ` AND "a"."news_publish" < ` + ms(2024, 2, 1) + `)`},
+		{"status", "", false, false, ""},
+		{"status", "~", false, false, ""},
+		{"status", "()", false, false, ""},
+		{"status", "5", false, false, ""},
+		{"status", "1~x", false, false, ""}, // 任一端无效时整个范围不生效
+		{"status", "x~5", false, false, ""},
+		{"news_publish", "2024-13-01~", true, false, ""},
+		{"news_publish", "yesterday~", true, false, ""},
+	} {
+		q, ok := siftRange(w.db.NewSelect().Model((*cms1.Article)(nil)), c.field, c.s, c.isTime, true, c.isOr)
+		_, where, _ := strings.Cut(q.String(), " WHERE ")
+		if where != c.where || ok != (len(c.where) > 0) {
+			t.Errorf("%s %q: want %s, got %s (%v)", c.field, c.s, c.where, where, ok)
+		}
+	}
+}
+
+func TestRangeValue(t *testing.T) {
+	day := time.Date(2024, 3, 5, 0, 0, 0, 0, time.Local)
+	at := time.Date(2024, 3, 5, 8, 30, 0, 0, time.Local)
+	for _, c := range []struct {
+		s             string
+		isTime, isInt bool
+		want          any
+	}{
+		{"42", false, false, int64(42)},
+		{"-7", false, false, int64(-7)},
+		{"2.5", false, false, 2.5},
+		{"1e3", false, false, 1000.0},
+		{"abc", false, false, nil},
+		{"2024-03-05", true, false, day},
+		{"2024-03-05 08:30:00", true, false, at},
+		{"2024-03-05T08:30:00Z", true, false, time.Date(2024, 3, 5, 8, 30, 0, 0, time.UTC)},
+		{"2024-03-05", true, true, day.UnixMilli()},
+		{"2024-03-05 08:30", true, false, nil},
+		{"1709600000000", true, true, nil}, // 时间范围不接受裸数字
+	} {
+		v, err := rangeValue(c.s, c.isTime, c.isInt)
+		if c.want == nil {
+			if err == nil {
+				t.Errorf("%q: want error, got %v", c.s, v)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", c.s, err)
+			continue
+		}
+		if tv, ok := c.want.(time.Time); ok {
+			if got, _ := v.(time.Time); !got.Equal(tv) {
+				t.Errorf("%q: want %v, got %v", c.s, tv, v)
+			}
+		} else if v != c.want {
+			t.Errorf("%q: want %v (%T), got %v (%T)", c.s, c.want, c.want, v, v)
+		}
+	}
+}
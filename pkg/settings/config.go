@@ -2,6 +2,7 @@ package settings
 
 import (
 	"log"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 )
@@ -13,18 +14,25 @@ const (
 
 // Config ...
 type Config struct {
-	Name         string   `ignored:"true"`
-	Version      string   `ignored:"true"`
-	PgStoreDSN   string   `envconfig:"PG_STORE_DSN" default:"postgres://scaffold@localhost/scaffold?sslmode=disable"`
-	PgTSConfig   string   `envconfig:"PG_TS_CONFIG"`
-	PgQueryDebug bool     `envconfig:"PG_QUERY_DEBUG"`
-	DbAutoInit   bool     `envconfig:"DB_AUTO_INIT"`
-	SentryDSN    string   `envconfig:"SENTRY_DSN" `
-	HTTPListen   string   `envconfig:"HTTP_LISTEN" default:":5010"`
-	GrpcListen   string   `envconfig:"GRPC_LISTEN" default:"127.0.0.1:5012"`
-	RedisURI     string   `envconfig:"redis_uri" default:"redis://localhost:6379/1"`
-	AllowOrigins []string `envconfig:"allow_origins" default:"*"` // CORS: 允许的 Origin 调用来源
-	TrustProxies []string `envconfig:"Trust_Proxies" default:"127.0.0.1,::1"`
+	Name         string        `ignored:"true"`
+	Version      string        `ignored:"true"`
+	PgStoreDSN   string        `envconfig:"PG_STORE_DSN" default:"postgres://scaffold@localhost/scaffold?sslmode=disable"`
+	PgTSConfig   string        `envconfig:"PG_TS_CONFIG"`
+	PgQueryDebug bool          `envconfig:"PG_QUERY_DEBUG"`
+	DbAutoInit   bool          `envconfig:"DB_AUTO_INIT"`
+	SentryDSN    string        `envconfig:"SENTRY_DSN" `
+	HTTPListen   string        `envconfig:"HTTP_LISTEN" default:":5010"`
+	GrpcListen   string        `envconfig:"GRPC_LISTEN" default:"127.0.0.1:5012"`
+	RedisURI     string        `envconfig:"redis_uri" default:"redis://localhost:6379/1"`
+	CacheStore   string        `envconfig:"CACHE_STORE" default:"lru"`  // 模型读缓存: lru 或 redis
+	CacheSize    int           `envconfig:"CACHE_SIZE" default:"10000"` // lru 缓存的条数
+	CacheTTL     time.Duration `envconfig:"CACHE_TTL" default:"10m"`
+	SearchURI    string        `envconfig:"SEARCH_URI"`                // 搜索索引，如 http://localhost:9200
+	AllowOrigins []string      `envconfig:"allow_origins" default:"*"` // CORS: 允许的 Origin 调用来源
+	TrustProxies []string      `envconfig:"Trust_Proxies" default:"127.0.0.1,::1"`
+
+	PgReplicaDSNs    []string      `envconfig:"PG_REPLICA_DSNS"`                  // 只读从库，多个以逗号分隔
+	PgReadYourWrites time.Duration `envconfig:"PG_READ_YOUR_WRITES" default:"5s"` // 写入后此时间内读主库
 }
 
 var (
@@ -1,9 +1,25 @@
 package apiv1
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/cupogo/andvari/models/oid"
 	"github.com/cupogo/scaffold/pkg/services/stores"
+	"github.com/cupogo/scaffold/pkg/settings"
 	"github.com/cupogo/scaffold/pkg/web/resp"
 	"github.com/cupogo/scaffold/pkg/web/routes"
 )
@@ -12,6 +28,7 @@ type Done = resp.Done
 type Failure = resp.Failure
 type ResultData = resp.ResultData
 type ResultID = resp.ResultID
+type ImportReport = resp.ImportReport
 type ResultOk = resp.ResultOk
 
 type HandlerFunc = gin.HandlerFunc
@@ -32,6 +49,15 @@ func regHI(auth bool, method string, path string, rid string, hafn haFunc) {
 	handles = append(handles, handleIn{auth, method, path, rid, hafn})
 }
 
+// adminPerms 仅管理员可用的接口编号，由 authPerm 检查
+var adminPerms = map[string]bool{}
+
+// regAdmin 注册仅管理员可用的接口，需登录且有 RoleAdmin 角色
+func regAdmin(method string, path string, rid string, hafn haFunc) {
+	adminPerms[rid] = true
+	regHI(true, method, path, rid, hafn)
+}
+
 // nolint
 func route(r gin.IRoutes, method, path string, hs ...HandlerFunc) {
 	r.Handle(method, path, hs...)
@@ -47,7 +73,9 @@ func init() {
 }
 
 func strap(router gin.IRouter) {
-	a := newapi(stores.Sgt())
+	sto := stores.Sgt()
+	routes.RegisterWorker("outbox", sto.RunOutbox) // 随服务在后台分发模型变更事件
+	a := newapi(sto)
 	a.Strap(router)
 }
 
@@ -56,11 +84,14 @@ func newapi(sto stores.Storage) *api {
 }
 
 func (a *api) Strap(r gin.IRouter) {
+	if Authenticate == nil { // 否则需要登录的接口均返回 401
+		panic("apiv1: Authenticate is not set")
+	}
 
-	vr := r.Group("/api/v1")
+	vr := r.Group("/api/v1", a.withTrace(), a.withWriteMark())
 	vr.GET("/ping", ping)
 
-	privater := vr.Group("", a.authSignedIn())
+	privater := vr.Group("", a.authSignedIn(), a.withTenant())
 
 	for _, hi := range handles {
 		if hi.auth {
@@ -75,17 +106,169 @@ func (a *api) Strap(r gin.IRouter) {
 	}
 }
 
-// authSignedIn 验证登录中间件
+// Principal 登录的请求者
+type Principal struct {
+	ID    oid.OID  // 账号编号
+	Roles []string // 角色，决定字段的可见和可写
+
+	TenantID oid.OID // 所属的租户，按租户隔离的模型限定在此租户内
+}
+
+// keyPrincipal 登录的请求者在 gin.Context 中的键
+const keyPrincipal = "principal"
+
+// Authenticate 按请求头 token 验证登录，应用须在启动前设置，未设置时 Strap 失败
+var Authenticate func(ctx context.Context, token string) (*Principal, error)
+
+var errSignIn = errors.New("sign in required")
+
+// authSignedIn 验证登录中间件，请求者写入 keyPrincipal 和存储的上下文，其角色写入 resp.KeyRoles
 func (a *api) authSignedIn() gin.HandlerFunc {
-	// TODO:
-	return func(c *gin.Context) {}
+	return func(c *gin.Context) {
+		token := c.GetHeader("token")
+		if len(token) == 0 {
+			fail(c, 401, errSignIn)
+			return
+		}
+		p, err := Authenticate(c.Request.Context(), token)
+		if err != nil {
+			fail(c, 401, err)
+			return
+		}
+		c.Set(keyPrincipal, p)
+		c.Set(resp.KeyRoles, p.Roles)
+		caller := stores.Caller{ID: p.ID, Admin: slices.Contains(p.Roles, RoleAdmin)}
+		c.Request = c.Request.WithContext(stores.ContextWithCaller(c.Request.Context(), caller))
+	}
 }
 
-func (a *api) authPerm(_ string) gin.HandlerFunc {
-	// TODO:
+// RoleAdmin 管理员的角色
+const RoleAdmin = "admin"
+
+var errNoPerm = errors.New("permission denied")
+
+// authPerm 接口权限中间件，在 authSignedIn 之后，管理接口需请求者有 RoleAdmin 角色
+func (a *api) authPerm(permID string) gin.HandlerFunc {
+	if adminPerms[permID] {
+		return func(c *gin.Context) {
+			if !slices.Contains(callerRoles(c), RoleAdmin) {
+				fail(c, 403, errNoPerm)
+			}
+		}
+	}
+	// TODO: 其他接口按 permID 检查
 	return func(c *gin.Context) {}
 }
 
+// withWriteMark 读写分离的中间件，请求写入后的 PG_READ_YOUR_WRITES 时间内读主库
+// 写入时间以 cookie 及响应头 X-Wrote-At 带给客户端，之后的请求带上其一即可，没有从库时不处理
+func (a *api) withWriteMark() gin.HandlerFunc {
+	if len(stores.SgtReplicas()) == 0 {
+		return func(c *gin.Context) {}
+	}
+	maxAge := int(settings.Current.PgReadYourWrites.Seconds()) + 1
+	return func(c *gin.Context) {
+		var last time.Time
+		s, _ := c.Cookie(wroteCookie)
+		for _, v := range []string{s, c.GetHeader(wroteHeader)} {
+			if ms, err := strconv.ParseInt(v, 10, 64); err == nil && time.UnixMilli(ms).After(last) {
+				last = time.UnixMilli(ms)
+			}
+		}
+		if now := time.Now(); last.After(now) {
+			last = now
+		}
+		ctx := stores.ContextWithWriteMark(c.Request.Context(), last)
+		c.Request = c.Request.WithContext(ctx)
+		c.Writer = &wroteWriter{ResponseWriter: c.Writer, stamp: func(h http.Header) {
+			if t := stores.WroteAt(ctx); t.After(last) {
+				ms := strconv.FormatInt(t.UnixMilli(), 10)
+				h.Add("Set-Cookie", (&http.Cookie{Name: wroteCookie, Value: ms,
+					Path: "/", MaxAge: maxAge, HttpOnly: true}).String())
+				h.Set(wroteHeader, ms)
+			}
+		}}
+		c.Next()
+	}
+}
+
+// 写入时间的 cookie 和头，值为毫秒时间戳
+const (
+	wroteCookie = "_wrote"
+	wroteHeader = "X-Wrote-At"
+)
+
+// wroteWriter 在写出响应头之前调用 stamp，以便设置写入时间的 cookie 和头
+type wroteWriter struct {
+	gin.ResponseWriter
+	stamp func(h http.Header)
+	once  sync.Once
+}
+
+func (w *wroteWriter) before() { w.once.Do(func() { w.stamp(w.Header()) }) }
+
+func (w *wroteWriter) WriteHeaderNow() { w.before(); w.ResponseWriter.WriteHeaderNow() }
+
+func (w *wroteWriter) Write(b []byte) (int, error) { w.before(); return w.ResponseWriter.Write(b) }
+
+func (w *wroteWriter) WriteString(s string) (int, error) {
+	w.before()
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Propagator 从请求头接续跟踪的传播器，默认为 W3C traceparent 和 baggage，应用可在启动前替换
+// 不用 otel.GetTextMapPropagator()，其未设置时为空操作，不会接续任何跟踪
+var Propagator propagation.TextMapPropagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{}, propagation.Baggage{},
+)
+
+// withTrace 跟踪中间件，接续请求头中的跟踪，存储方法的跟踪为其子跟踪
+func (a *api) withTrace() gin.HandlerFunc {
+	tracer := otel.Tracer("github.com/cupogo/scaffold/pkg/web")
+	return func(c *gin.Context) {
+		ctx := Propagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		route := c.FullPath()
+		ctx, span := tracer.Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPRequestMethodKey.String(c.Request.Method), semconv.HTTPRoute(route)),
+		)
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
+var errTenant = errors.New("tenant mismatch")
+
+// withTenant 租户中间件，在 authSignedIn 之后，以请求者所属的租户限定存储
+// 请求头 X-Tenant-ID 只用于核对，与所属租户不同时返回 403；不属于租户时按租户隔离的模型返回 403
+func (a *api) withTenant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p := c.MustGet(keyPrincipal).(*Principal)
+		if s := c.GetHeader("X-Tenant-ID"); len(s) > 0 {
+			id, err := oid.CheckID(s)
+			if err != nil {
+				fail(c, 400, err)
+				return
+			}
+			if id != p.TenantID {
+				fail(c, 403, errTenant)
+				return
+			}
+		}
+		if !p.TenantID.IsZero() {
+			c.Request = c.Request.WithContext(stores.ContextWithTenant(c.Request.Context(), p.TenantID))
+		}
+	}
+}
+
 // @Summary API health check
 // @Description API health check
 // @Produce plain
@@ -102,9 +285,32 @@ func success(c *gin.Context, result interface{}) {
 
 // nolint
 func fail(c *gin.Context, code int, args ...interface{}) {
+	if len(args) > 0 {
+		if err, ok := args[0].(error); ok {
+			code = errCode(code, err)
+		}
+	}
 	resp.Fail(c, code, args...)
 }
 
+// errCode 按存储的错误细分 5xx 的状态码
+func errCode(code int, err error) int {
+	if code < 500 {
+		return code
+	}
+	switch {
+	case errors.Is(err, stores.ErrNotFound):
+		return 404 // 不存在或属于其他租户
+	case errors.Is(err, stores.ErrNoTenant):
+		return 403 // 请求者不属于租户
+	case errors.Is(err, stores.ErrNotOwner):
+		return 403 // 不是所有者
+	case stores.IsDuplicateError(err):
+		return 409 // 违反唯一约束
+	}
+	return code
+}
+
 // nolint
 func dtResult(data any, total int) *resp.ResultData {
 	return &resp.ResultData{
@@ -113,6 +319,51 @@ func dtResult(data any, total int) *resp.ResultData {
 	}
 }
 
+// nolint
+func pickFields(data any, fields []string) any {
+	return resp.Pick(data, fields...)
+}
+
+// nolint
+func newExporter(c *gin.Context, name string, obj resp.Exportable, fields []string) (*resp.Exporter, error) {
+	format, err := resp.ExportFormat(c.Request)
+	if err != nil || len(format) == 0 {
+		return nil, err
+	}
+	return resp.NewExporter(c.Writer, format, name, obj, fields, callerRoles(c)...), nil
+}
+
+// nolint
+func exportRows[S ~[]E, E any, P interface {
+	*E
+	resp.Exportable
+}](ex *resp.Exporter, data S) error {
+	return resp.ExportRows[S, E, P](ex, data)
+}
+
+// nolint
+func exportDone(c *gin.Context, ex *resp.Exporter, err error) {
+	if err != nil && !ex.Started() {
+		fail(c, 503, err)
+		return
+	}
+	ex.Close(err)
+}
+
+// nolint
+func readImport[E any, P interface {
+	*E
+	resp.Importable
+}](c *gin.Context) (*resp.Importing[E], error) {
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, resp.ImportMaxBytes)
+	im, err := resp.ReadImport[E, P](body, resp.ImportFormat(c.Request),
+		binding.Validator.ValidateStruct, callerRoles(c)...)
+	if err == nil {
+		im.DryRun, _ = strconv.ParseBool(c.Query("dryRun"))
+	}
+	return im, err
+}
+
 // nolint
 func idResult(id any) *resp.ResultID {
 	return &resp.ResultID{ID: id}
@@ -122,3 +373,36 @@ func idResult(id any) *resp.ResultID {
 func getError(c *gin.Context, code int, err error, args ...any) resp.Error {
 	return resp.GetError(c.Request, code, err, args...)
 }
+
+// bulkDone 批量写入逐条的结果，成功的为编号，失败的为错误；全部成功时为 200，否则为 207
+// nolint
+func bulkDone(c *gin.Context, res []stores.BulkResult) {
+	code := 200
+	ret := make([]any, len(res))
+	for i, r := range res {
+		if r.Error != nil {
+			code = 207
+			ret[i] = getError(c, errCode(503, r.Error), r.Error)
+		} else {
+			ret[i] = idResult(r.ID)
+		}
+	}
+	resp.Out(c, code, dtResult(ret, len(ret)))
+}
+
+// nolint
+func callerRoles(c *gin.Context) []string {
+	return resp.Roles(c)
+}
+
+// viewFor 输出前按请求者的角色隐去 data 中不可见的字段，经 resp.ViewPatcher
+// nolint
+func viewFor[T interface{ RedactFor(roles ...string) }](c *gin.Context, data T) *resp.Patched {
+	return resp.PatchWith(data, func() { data.RedactFor(callerRoles(c)...) })
+}
+
+// fieldDenied 无权写入的字段
+type fieldDenied string
+
+func (f fieldDenied) Error() string { return "field denied: " + string(f) }
+func (f fieldDenied) Field() string { return string(f) }
@@ -0,0 +1,284 @@
+package apiv1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/cupogo/andvari/models/oid"
+	"github.com/cupogo/andvari/stores/pgx"
+	"github.com/cupogo/scaffold/pkg/services/stores"
+)
+
+// newTestRouter 不连接数据库的路由，sto 为空时仅能测试处理函数之前的中间件
+func newTestRouter(t *testing.T, sto stores.Storage, principals map[string]*Principal) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	auth := Authenticate
+	Authenticate = func(_ context.Context, token string) (*Principal, error) {
+		if p, ok := principals[token]; ok {
+			return p, nil
+		}
+		return nil, errors.New("invalid token")
+	}
+	t.Cleanup(func() { Authenticate = auth })
+	r := gin.New()
+	newapi(sto).Strap(r)
+	return r
+}
+
+func serve(r http.Handler, method, path, token string, hdr ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if len(token) > 0 {
+		req.Header.Set("token", token)
+	}
+	for i := 0; i+1 < len(hdr); i += 2 {
+		req.Header.Set(hdr[i], hdr[i+1])
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestTenantRoutesNeedSignIn(t *testing.T) {
+	tenant := oid.NewID(oid.OtCompany)
+	r := newTestRouter(t, nil, map[string]*Principal{"t1": {ID: oid.NewID(oid.OtAccount), TenantID: tenant}})
+	paths := []string{
+		"/api/v1/cms/articles",
+		"/api/v1/cms/articles/stats",
+		"/api/v1/cms/articles/1",
+		"/api/v1/cms/attachments",
+		"/api/v1/cms/attachments/1",
+	}
+	for _, path := range paths {
+		if w := serve(r, "GET", path, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("anonymous %s: want 401, got %d", path, w.Code)
+		}
+		if w := serve(r, "GET", path, "bad"); w.Code != http.StatusUnauthorized {
+			t.Errorf("invalid token %s: want 401, got %d", path, w.Code)
+		}
+		w := serve(r, "GET", path, "t1", "X-Tenant-ID", oid.NewID(oid.OtCompany).String())
+		if w.Code != http.StatusForbidden {
+			t.Errorf("other tenant %s: want 403, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestSignedInCaller(t *testing.T) {
+	uid := oid.NewID(oid.OtAccount)
+	newTestRouter(t, nil, map[string]*Principal{
+		"user":  {ID: uid, Roles: []string{"editor"}},
+		"admin": {ID: uid, Roles: []string{RoleAdmin}},
+	})
+	r := gin.New()
+	var got stores.Caller
+	var ok bool
+	r.GET("/x", newapi(nil).authSignedIn(), func(c *gin.Context) {
+		got, ok = stores.CallerFromContext(c.Request.Context())
+	})
+	for _, c := range []struct {
+		token string
+		code  int
+		want  stores.Caller
+	}{
+		{"", http.StatusUnauthorized, stores.Caller{}},
+		{"user", http.StatusOK, stores.Caller{ID: uid}},
+		{"admin", http.StatusOK, stores.Caller{ID: uid, Admin: true}},
+	} {
+		got, ok = stores.Caller{}, false
+		if w := serve(r, "GET", "/x", c.token); w.Code != c.code {
+			t.Errorf("%q: want %d, got %d", c.token, c.code, w.Code)
+		}
+		if ok != (c.code == http.StatusOK) || got != c.want {
+			t.Errorf("%q: want caller %+v, got %+v %v", c.token, c.want, got, ok)
+		}
+	}
+}
+
+func TestStrapNeedsAuthenticate(t *testing.T) {
+	auth := Authenticate
+	Authenticate = nil
+	t.Cleanup(func() { Authenticate = auth })
+	defer func() {
+		if recover() == nil {
+			t.Error("Strap should fail without Authenticate")
+		}
+	}()
+	newapi(nil).Strap(gin.New())
+}
+
+func TestTraceParent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var got trace.SpanContext
+	r := gin.New()
+	r.GET("/ping", newapi(nil).withTrace(), func(c *gin.Context) {
+		got = trace.SpanContextFromContext(c.Request.Context())
+	})
+
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	tp := "00-" + traceID + "-" + spanID + "-01"
+	serve(r, "GET", "/ping", "", "traceparent", tp)
+	if got.TraceID().String() != traceID || !got.IsSampled() {
+		t.Errorf("want trace %s from traceparent, got %s", traceID, got.TraceID())
+	}
+	// 未设置 TracerProvider 时不新建 span，仍为接续的远端 span
+	if got.SpanID().String() != spanID || !got.IsRemote() {
+		t.Errorf("want remote span %s, got %s", spanID, got.SpanID())
+	}
+
+	for _, hdr := range [][]string{nil, {"traceparent", "00-" + traceID + "-0000000000000000-01"}, {"traceparent", "junk"}} {
+		serve(r, "GET", "/ping", "", hdr...)
+		if got.IsValid() {
+			t.Errorf("%v: want no trace, got %s", hdr, got.TraceID())
+		}
+	}
+
+	pp := Propagator
+	Propagator = propagation.Baggage{}
+	t.Cleanup(func() { Propagator = pp })
+	serve(r, "GET", "/ping", "", "traceparent", tp)
+	if got.IsValid() {
+		t.Errorf("replaced propagator should ignore traceparent, got %s", got.TraceID())
+	}
+}
+
+func TestBulkDone(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, c := range []struct {
+		res   []stores.BulkResult
+		code  int
+		codes []int
+	}{
+		{[]stores.BulkResult{{ID: "a"}, {ID: "b"}}, http.StatusOK, []int{0, 0}},
+		{[]stores.BulkResult{
+			{ID: "a"},
+			{Error: fmt.Errorf("insert: %w", pgx.ErrDuplicate)},
+			{Error: stores.ErrNotFound},
+			{Error: errors.New("db down")},
+		}, http.StatusMultiStatus, []int{0, 409, 404, 503}},
+	} {
+		r, res := gin.New(), c.res
+		r.POST("/x", func(c *gin.Context) { bulkDone(c, res) })
+		w := serve(r, "POST", "/x", "")
+		if w.Code != c.code {
+			t.Errorf("want %d, got %d", c.code, w.Code)
+		}
+		var body struct {
+			Result struct {
+				Data []struct {
+					ID     string `json:"id"`
+					Status int    `json:"status"`
+				} `json:"data"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if len(body.Result.Data) != len(c.codes) {
+			t.Fatalf("want %d items, got %s", len(c.codes), w.Body)
+		}
+		for i, it := range body.Result.Data {
+			if it.Status != c.codes[i] || it.ID != c.res[i].ID {
+				t.Errorf("#%d: want status %d, got %+v", i, c.codes[i], it)
+			}
+		}
+	}
+}
+
+func TestInvalidRelation(t *testing.T) {
+	r := newTestRouter(t, nil, map[string]*Principal{"t1": {ID: oid.NewID(oid.OtAccount), TenantID: oid.NewID(oid.OtCompany)}})
+	for _, path := range []string{
+		"/api/v1/cms/articles?rel=Nope",
+		"/api/v1/cms/articles/" + oid.NewID(oid.OtArticle).String() + "?rel=Attachments,Nope",
+	} {
+		if w := serve(r, "GET", path, "t1"); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: want 400, got %d %s", path, w.Code, w.Body)
+		}
+	}
+}
+
+// fakeReindexer 记下 StartReindex 的上下文
+type fakeReindexer struct {
+	stores.Storage
+	ctx context.Context
+	err error
+}
+
+func (f *fakeReindexer) StartReindex(ctx context.Context, model string, _ stores.ReindexOption) (*stores.ReindexJob, error) {
+	f.ctx = ctx
+	if f.err != nil {
+		return nil, f.err
+	}
+	tid, _ := stores.TenantFromContext(ctx)
+	return &stores.ReindexJob{ID: "j1", Model: model, TenantID: tid, Running: true}, nil
+}
+
+func (f *fakeReindexer) ReindexStates(context.Context) ([]stores.ReindexState, error) {
+	return nil, nil
+}
+func (f *fakeReindexer) ReindexJobs(context.Context) []stores.ReindexJob { return nil }
+func (f *fakeReindexer) ReindexJobOf(context.Context, string) (*stores.ReindexJob, error) {
+	return nil, stores.ErrNotFound
+}
+func (f *fakeReindexer) CancelReindex(context.Context, string) (*stores.ReindexJob, error) {
+	return nil, stores.ErrNotFound
+}
+
+func TestReindexScope(t *testing.T) {
+	tenant := oid.NewID(oid.OtCompany)
+	rx := &fakeReindexer{}
+	r := newTestRouter(t, rx, map[string]*Principal{
+		"sys":    {ID: oid.NewID(oid.OtAccount), Roles: []string{RoleAdmin}},
+		"tadmin": {ID: oid.NewID(oid.OtAccount), Roles: []string{RoleAdmin}, TenantID: tenant},
+		"user":   {ID: oid.NewID(oid.OtAccount), TenantID: tenant},
+	})
+
+	if w := serve(r, "POST", "/api/v1/admin/reindex", "user"); w.Code != http.StatusForbidden {
+		t.Errorf("user: want 403, got %d", w.Code)
+	}
+
+	w := serve(r, "POST", "/api/v1/admin/reindex?model=cms_article", "sys")
+	var res struct {
+		Result stores.ReindexJob `json:"result"`
+	}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &res) != nil || res.Result.ID != "j1" {
+		t.Fatalf("sys: %d %s", w.Code, w.Body)
+	}
+	if !stores.IsSystemContext(rx.ctx) {
+		t.Error("admin without tenant should run in system scope")
+	}
+
+	if w = serve(r, "POST", "/api/v1/admin/reindex", "tadmin"); w.Code != http.StatusOK {
+		t.Fatalf("tadmin: %d %s", w.Code, w.Body)
+	}
+	if id, _ := stores.TenantFromContext(rx.ctx); id != tenant || stores.IsSystemContext(rx.ctx) {
+		t.Errorf("tenant admin should be scoped to tenant, got %s system %v", id, stores.IsSystemContext(rx.ctx))
+	}
+
+	for _, c := range []struct {
+		err  error
+		code int
+	}{
+		{stores.ErrReindexUnknown, http.StatusBadRequest},
+		{stores.ErrReindexRunning, http.StatusConflict},
+	} {
+		rx.err = c.err
+		if w = serve(r, "POST", "/api/v1/admin/reindex", "sys"); w.Code != c.code {
+			t.Errorf("%v: want %d, got %d", c.err, c.code, w.Code)
+		}
+	}
+	if w = serve(r, "GET", "/api/v1/admin/reindex/jobs/j2", "sys"); w.Code != http.StatusNotFound {
+		t.Errorf("missing job: want 404, got %d", w.Code)
+	}
+}
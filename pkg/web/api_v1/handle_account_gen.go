@@ -30,9 +30,10 @@ func init() {
 // @ID v1-accounts-get
 // @Summary 列出账号 🔑
 // @Accept json
-// @Produce json
+// @Produce json,text/csv,application/x-ndjson
 // @Param token    header   string  true "登录票据凭证"
 // @Param   query  query   stores.AccountSpec  true   "Object"
+// @Param   export  query  string  false  "导出格式，csv 或 ndjson，也可由 Accept 指定"
 // @Success 200 {object} Done{result=ResultData{data=accounts.Accounts}}
 // @Failure 400 {object} Failure "请求或参数错误"
 // @Failure 401 {object} Failure "未登录"
@@ -46,14 +47,40 @@ func (a *api) getAccounts(c *gin.Context) {
 		return
 	}
 
-	ctx := c.Request.Context()
+	if err := stores.CheckSort(&spec); err != nil {
+		fail(c, 400, err)
+		return
+	}
+
+	if err := stores.CheckFilter(spec.Filter, &spec); err != nil {
+		fail(c, 400, err)
+		return
+	}
+
+	ctx, fields, err := stores.ContextWithFields(c.Request.Context(), (*accounts.Account)(nil), spec.Fields)
+	if err != nil {
+		fail(c, 400, err)
+		return
+	}
+	ex, err := newExporter(c, "accounts", (*accounts.Account)(nil), fields)
+	if err != nil {
+		fail(c, 400, err)
+		return
+	}
+	if ex != nil {
+		err = a.sto.Account().ExportAccount(ctx, &spec, func(data accounts.Accounts) error {
+			return exportRows(ex, data)
+		})
+		exportDone(c, ex, err)
+		return
+	}
 	data, total, err := a.sto.Account().ListAccount(ctx, &spec)
 	if err != nil {
 		fail(c, 503, err)
 		return
 	}
 
-	success(c, dtResult(data, total))
+	success(c, dtResult(pickFields(viewFor(c, data), fields), total))
 }
 
 // @Tags Cupola-accounts
@@ -63,6 +90,7 @@ func (a *api) getAccounts(c *gin.Context) {
 // @Produce json
 // @Param token    header   string  true "登录票据凭证"
 // @Param   id    path   string  true   "编号"
+// @Param   fields  query  string  false  "返回的字段，多个以逗号分隔"
 // @Success 200 {object} Done{result=accounts.Account}
 // @Failure 400 {object} Failure "请求或参数错误"
 // @Failure 401 {object} Failure "未登录"
@@ -71,13 +99,18 @@ func (a *api) getAccounts(c *gin.Context) {
 // @Router /api/v1/accounts/{id} [get]
 func (a *api) getAccount(c *gin.Context) {
 	id := c.Param("id")
-	obj, err := a.sto.Account().GetAccount(c.Request.Context(), id)
+	ctx, fields, err := stores.ContextWithFields(c.Request.Context(), (*accounts.Account)(nil), c.Query("fields"))
+	if err != nil {
+		fail(c, 400, err)
+		return
+	}
+	obj, err := a.sto.Account().GetAccount(ctx, id)
 	if err != nil {
 		fail(c, 503, err)
 		return
 	}
 
-	success(c, obj)
+	success(c, pickFields(viewFor(c, obj), fields))
 }
 
 // @Tags Cupola-accounts
@@ -91,6 +124,7 @@ func (a *api) getAccount(c *gin.Context) {
 // @Failure 400 {object} Failure "请求或参数错误"
 // @Failure 401 {object} Failure "未登录"
 // @Failure 403 {object} Failure "无权限"
+// @Failure 409 {object} Failure "数据冲突"
 // @Failure 503 {object} Failure "服务端错误"
 // @Router /api/v1/accounts [post]
 func (a *api) postAccount(c *gin.Context) {
@@ -100,8 +134,17 @@ func (a *api) postAccount(c *gin.Context) {
 		return
 	}
 
+	if field := in.DeniedField(callerRoles(c)...); len(field) > 0 {
+		fail(c, 400, fieldDenied(field))
+		return
+	}
+
 	obj, err := a.sto.Account().CreateAccount(c.Request.Context(), in)
 	if err != nil {
+		if stores.IsDuplicateError(err) {
+			fail(c, 409, err)
+			return
+		}
 		fail(c, 503, err)
 		return
 	}
@@ -121,6 +164,7 @@ func (a *api) postAccount(c *gin.Context) {
 // @Failure 400 {object} Failure "请求或参数错误"
 // @Failure 401 {object} Failure "未登录"
 // @Failure 403 {object} Failure "无权限"
+// @Failure 409 {object} Failure "数据冲突"
 // @Failure 503 {object} Failure "服务端错误"
 // @Router /api/v1/accounts/{id} [put]
 func (a *api) putAccount(c *gin.Context) {
@@ -131,8 +175,17 @@ func (a *api) putAccount(c *gin.Context) {
 		return
 	}
 
+	if field := in.DeniedField(callerRoles(c)...); len(field) > 0 {
+		fail(c, 400, fieldDenied(field))
+		return
+	}
+
 	err := a.sto.Account().UpdateAccount(c.Request.Context(), id, in)
 	if err != nil {
+		if stores.IsDuplicateError(err) {
+			fail(c, 409, err)
+			return
+		}
 		fail(c, 503, err)
 		return
 	}
@@ -0,0 +1,28 @@
+package apiv1
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/cupogo/scaffold/pkg/services/stores"
+)
+
+func init() {
+	regAdmin("GET", "/admin/cache", "v1-admin-cache-get", func(a *api) gin.HandlerFunc {
+		return a.getCacheCounts
+	})
+}
+
+// @Tags 默认 文档生成
+// @ID v1-admin-cache-get
+// @Summary 读缓存的命中计数 🔑
+// @Description 键为表名，计数自进程启动起累计
+// @Accept json
+// @Produce json
+// @Param token    header   string  true "登录票据凭证"
+// @Success 200 {object} Done{result=map[string]stores.CacheCount}
+// @Failure 401 {object} Failure "未登录"
+// @Failure 403 {object} Failure "无权限"
+// @Router /api/v1/admin/cache [get]
+func (a *api) getCacheCounts(c *gin.Context) {
+	success(c, stores.CacheCounts())
+}
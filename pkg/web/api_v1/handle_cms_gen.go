@@ -3,6 +3,7 @@
 package apiv1
 
 import (
+	"errors"
 	"strings"
 
 	"github.com/cupogo/scaffold/pkg/models/cms1"
@@ -27,10 +28,13 @@ func init() {
 	regHI(true, "DELETE", "/cms/clauses/:id", "v1-cms-clauses-id-delete", func(a *api) gin.HandlerFunc {
 		return a.deleteCmsClause
 	})
-	regHI(false, "GET", "/cms/articles", "", func(a *api) gin.HandlerFunc {
+	regHI(true, "GET", "/cms/articles", "", func(a *api) gin.HandlerFunc {
 		return a.getContentArticles
 	})
-	regHI(false, "GET", "/cms/articles/:id", "", func(a *api) gin.HandlerFunc {
+	regHI(true, "GET", "/cms/articles/stats", "", func(a *api) gin.HandlerFunc {
+		return a.getContentArticleStats
+	})
+	regHI(true, "GET", "/cms/articles/:id", "", func(a *api) gin.HandlerFunc {
 		return a.getContentArticle
 	})
 	regHI(true, "POST", "/cms/articles", "v1-cms-articles-post", func(a *api) gin.HandlerFunc {
@@ -42,10 +46,13 @@ func init() {
 	regHI(true, "DELETE", "/cms/articles/:id", "v1-cms-articles-id-delete", func(a *api) gin.HandlerFunc {
 		return a.deleteContentArticle
 	})
-	regHI(false, "GET", "/cms/attachments", "", func(a *api) gin.HandlerFunc {
+	regHI(true, "POST", "/cms/articles/import", "v1-cms-articles-import-post", func(a *api) gin.HandlerFunc {
+		return a.importContentArticles
+	})
+	regHI(true, "GET", "/cms/attachments", "", func(a *api) gin.HandlerFunc {
 		return a.getContentAttachments
 	})
-	regHI(false, "GET", "/cms/attachments/:id", "", func(a *api) gin.HandlerFunc {
+	regHI(true, "GET", "/cms/attachments/:id", "", func(a *api) gin.HandlerFunc {
 		return a.getContentAttachment
 	})
 	regHI(true, "POST", "/cms/attachments", "v1-cms-attachments-post", func(a *api) gin.HandlerFunc {
@@ -62,6 +69,7 @@ func init() {
 // @Produce json
 // @Param token    header   string  true "登录票据凭证"
 // @Param   id    path   string  true   "编号"
+// @Param   fields  query  string  false  "返回的字段，多个以逗号分隔"
 // @Success 200 {object} Done{result=cms1.Clause}
 // @Failure 400 {object} Failure "请求或参数错误"
 // @Failure 401 {object} Failure "未登录"
@@ -70,13 +78,18 @@ func init() {
 // @Router /api/v1/cms/clauses/{id} [get]
 func (a *api) getCmsClause(c *gin.Context) {
 	id := c.Param("id")
-	obj, err := a.sto.Content().GetClause(c.Request.Context(), id)
+	ctx, fields, err := stores.ContextWithFields(c.Request.Context(), (*cms1.Clause)(nil), c.Query("fields"))
+	if err != nil {
+		fail(c, 400, err)
+		return
+	}
+	obj, err := a.sto.Content().GetClause(ctx, id)
 	if err != nil {
 		fail(c, 503, err)
 		return
 	}
 
-	success(c, obj)
+	success(c, pickFields(obj, fields))
 }
 
 // @Tags 默认 文档生成
@@ -113,9 +126,10 @@ func (a *api) putCmsClause(c *gin.Context) {
 // @Tags 默认 文档生成
 // @Summary 列出内容条款
 // @Accept json
-// @Produce json
+// @Produce json,text/csv,application/x-ndjson
 // @Param token    header   string  true "登录票据凭证"
 // @Param   query  query   stores.ClauseSpec  true   "Object"
+// @Param   export  query  string  false  "导出格式，csv 或 ndjson，也可由 Accept 指定"
 // @Success 200 {object} Done{result=ResultData{data=cms1.Clauses}}
 // @Failure 400 {object} Failure "请求或参数错误"
 // @Failure 401 {object} Failure "未登录"
@@ -129,14 +143,40 @@ func (a *api) getCmsClauses(c *gin.Context) {
 		return
 	}
 
-	ctx := c.Request.Context()
+	if err := stores.CheckSort(&spec); err != nil {
+		fail(c, 400, err)
+		return
+	}
+
+	if err := stores.CheckFilter(spec.Filter, &spec); err != nil {
+		fail(c, 400, err)
+		return
+	}
+
+	ctx, fields, err := stores.ContextWithFields(c.Request.Context(), (*cms1.Clause)(nil), spec.Fields)
+	if err != nil {
+		fail(c, 400, err)
+		return
+	}
+	ex, err := newExporter(c, "clauses", (*cms1.Clause)(nil), fields)
+	if err != nil {
+		fail(c, 400, err)
+		return
+	}
+	if ex != nil {
+		err = a.sto.Content().ExportClause(ctx, &spec, func(data cms1.Clauses) error {
+			return exportRows(ex, data)
+		})
+		exportDone(c, ex, err)
+		return
+	}
 	data, total, err := a.sto.Content().ListClause(ctx, &spec)
 	if err != nil {
 		fail(c, 503, err)
 		return
 	}
 
-	success(c, dtResult(data, total))
+	success(c, dtResult(pickFields(data, fields), total))
 }
 
 // @Tags 默认 文档生成
@@ -164,11 +204,13 @@ func (a *api) deleteCmsClause(c *gin.Context) {
 }
 
 // @Tags 默认 文档生成
-// @Description <sortable>id,created,updated,author,news_publish</sortable>
+// @Description <sortable>id,created,updated,author,newsPublish</sortable>
 // @Summary 列出文章
 // @Accept json
-// @Produce json
+// @Produce json,text/csv,application/x-ndjson
+// @Param token    header   string  true "登录票据凭证"
 // @Param   query  query   stores.ArticleSpec  true   "Object"
+// @Param   export  query  string  false  "导出格式，csv 或 ndjson，也可由 Accept 指定"
 // @Success 200 {object} Done{result=ResultData{data=cms1.Articles}}
 // @Failure 400 {object} Failure "请求或参数错误"
 // @Failure 401 {object} Failure "未登录"
@@ -182,21 +224,110 @@ func (a *api) getContentArticles(c *gin.Context) {
 		return
 	}
 
-	ctx := c.Request.Context()
+	if err := stores.CheckSort(&spec); err != nil {
+		fail(c, 400, err)
+		return
+	}
+
+	if err := stores.CheckFilter(spec.Filter, &spec); err != nil {
+		fail(c, 400, err)
+		return
+	}
+
+	if _, err := stores.ParseRelations(spec.WithRel, "Attachments"); err != nil {
+		fail(c, 400, err)
+		return
+	}
+
+	ctx, fields, err := stores.ContextWithFields(c.Request.Context(), (*cms1.Article)(nil), spec.Fields)
+	if err != nil {
+		fail(c, 400, err)
+		return
+	}
+	ex, err := newExporter(c, "articles", (*cms1.Article)(nil), fields)
+	if err != nil {
+		fail(c, 400, err)
+		return
+	}
+	if ex != nil {
+		err = a.sto.Content().ExportArticle(ctx, &spec, func(data cms1.Articles) error {
+			return exportRows(ex, data)
+		})
+		exportDone(c, ex, err)
+		return
+	}
+	var facets stores.Facets
+	if spec.Facets {
+		var err error
+		if facets, err = a.sto.Content().FacetArticle(ctx, &spec); err != nil {
+			fail(c, 503, err)
+			return
+		}
+	}
+
 	data, total, err := a.sto.Content().ListArticle(ctx, &spec)
 	if err != nil {
+		if errors.Is(err, stores.ErrInvalidCursor) {
+			fail(c, 400, err)
+			return
+		}
 		fail(c, 503, err)
 		return
 	}
 
-	success(c, dtResult(data, total))
+	res := dtResult(pickFields(data, fields), total)
+	res.Next, res.Prev = spec.Cursors()
+	if spec.Facets {
+		res.SetExtra("facets", facets)
+	}
+	success(c, res)
+}
+
+// @Tags 默认 文档生成
+// @Summary 统计 文章
+// @Accept json
+// @Produce json
+// @Param token    header   string  true "登录票据凭证"
+// @Param   query  query   stores.ArticleStatSpec  true   "Object"
+// @Success 200 {object} Done{result=cms1.ArticleStats}
+// @Failure 400 {object} Failure "请求或参数错误"
+// @Failure 401 {object} Failure "未登录"
+// @Failure 404 {object} Failure "目标未找到"
+// @Failure 503 {object} Failure "服务端错误"
+// @Router /api/v1/cms/articles/stats [get]
+func (a *api) getContentArticleStats(c *gin.Context) {
+	var spec stores.ArticleStatSpec
+	if err := c.Bind(&spec); err != nil {
+		fail(c, 400, err)
+		return
+	}
+
+	if _, err := spec.GroupBy(); err != nil {
+		fail(c, 400, err)
+		return
+	}
+
+	if err := stores.CheckFilter(spec.Filter, &spec); err != nil {
+		fail(c, 400, err)
+		return
+	}
+
+	data, err := a.sto.Content().AggregateArticle(c.Request.Context(), &spec)
+	if err != nil {
+		fail(c, 503, err)
+		return
+	}
+
+	success(c, data)
 }
 
 // @Tags 默认 文档生成
 // @Summary 获取文章
 // @Accept json
 // @Produce json
+// @Param token    header   string  true "登录票据凭证"
 // @Param   id    path   string  true   "编号"
+// @Param   fields  query  string  false  "返回的字段，多个以逗号分隔"
 // @Success 200 {object} Done{result=cms1.Article}
 // @Failure 400 {object} Failure "请求或参数错误"
 // @Failure 401 {object} Failure "未登录"
@@ -205,18 +336,29 @@ func (a *api) getContentArticles(c *gin.Context) {
 // @Router /api/v1/cms/articles/{id} [get]
 func (a *api) getContentArticle(c *gin.Context) {
 	id := c.Param("id")
-	obj, err := a.sto.Content().GetArticle(c.Request.Context(), id)
+	ctx, fields, err := stores.ContextWithFields(c.Request.Context(), (*cms1.Article)(nil), c.Query("fields"))
+	if err != nil {
+		fail(c, 400, err)
+		return
+	}
+	rels, err := stores.ParseRelations(c.Query("rel"), "Attachments")
+	if err != nil {
+		fail(c, 400, err)
+		return
+	}
+	ctx = stores.ContextWithRelation(ctx, rels...)
+	obj, err := a.sto.Content().GetArticle(ctx, id)
 	if err != nil {
 		fail(c, 503, err)
 		return
 	}
 
-	success(c, obj)
+	success(c, pickFields(obj, fields))
 }
 
 // @Tags 默认 文档生成
 // @ID v1-cms-articles-post
-// @Description 本接口支持批量创建，传入数组实体，返回结果也为数组
+// @Description 本接口支持批量创建，传入数组实体，返回结果也为数组，逐条为编号或错误，有失败的条目时状态码为 207
 // @Summary 录入文章 🔑
 // @Accept json,mpfd
 // @Produce json
@@ -253,21 +395,17 @@ func (a *api) postContentArticle(c *gin.Context) {
 		return
 	}
 
-	var ret []any
-	for _, in := range ain {
-		obj, err := a.sto.Content().CreateArticle(c.Request.Context(), in)
-		if err != nil {
-			ret = append(ret, getError(c, 0, err))
-		} else {
-			ret = append(ret, idResult(obj.ID))
-		}
+	res, err := a.sto.Content().CreateArticles(c.Request.Context(), ain)
+	if err != nil {
+		fail(c, 503, err)
+		return
 	}
-	success(c, dtResult(ret, len(ret)))
+	bulkDone(c, res)
 }
 
 // @Tags 默认 文档生成
 // @ID v1-cms-articles-id-put
-// @Description 本接口支持批量更新，路径中传入的主键以逗号分隔，同时使用数组实体，返回结果也为数组
+// @Description 本接口支持批量更新，路径中传入的主键以逗号分隔，同时使用数组实体，返回结果也为数组，逐条为编号或错误，有失败的条目时状态码为 207
 // @Summary 更新文章 🔑
 // @Accept json,mpfd
 // @Produce json
@@ -299,15 +437,12 @@ func (a *api) putContentArticle(c *gin.Context) {
 		return
 	}
 	ctx := c.Request.Context()
-	ret := make([]any, len(ids))
-	for i := 0; i < len(ids); i++ {
-		err := a.sto.Content().UpdateArticle(ctx, ids[i], ain[i])
-		if err != nil {
-			ret[i] = getError(c, 0, err)
-		} else {
-			ret[i] = idResult(ids[i])
-		}
+	res, err := a.sto.Content().UpdateArticles(ctx, ids, ain)
+	if err != nil {
+		fail(c, 503, err)
+		return
 	}
+	bulkDone(c, res)
 }
 
 // @Tags 默认 文档生成
@@ -334,11 +469,38 @@ func (a *api) deleteContentArticle(c *gin.Context) {
 	success(c, "ok")
 }
 
+// @Tags 默认 文档生成
+// @ID v1-cms-articles-import-post
+// @Summary 导入 文章 🔑
+// @Accept text/csv,application/x-ndjson
+// @Produce json
+// @Param token    header   string  true "登录票据凭证"
+// @Param   body  body  string  true  "CSV 或 NDJSON 内容，CSV 表头可用字段名或导出的表头"
+// @Param   dryRun  query  boolean  false  "试运行，只校验和尝试写入，不保存"
+// @Success 200 {object} Done{result=ImportReport}
+// @Failure 400 {object} Failure "请求或参数错误"
+// @Failure 401 {object} Failure "未登录"
+// @Failure 403 {object} Failure "无权限"
+// @Failure 503 {object} Failure "服务端错误"
+// @Router /api/v1/cms/articles/import [post]
+func (a *api) importContentArticles(c *gin.Context) {
+	im, err := readImport[cms1.ArticleBasic](c)
+	if err != nil {
+		fail(c, 400, err)
+		return
+	}
+
+	ids, err := a.sto.Content().ImportArticle(c.Request.Context(), im.Ins, im.DryRun)
+	success(c, im.Done(ids, err))
+}
+
 // @Tags 默认 文档生成
 // @Summary 列出附件
 // @Accept json
-// @Produce json
+// @Produce json,text/csv,application/x-ndjson
+// @Param token    header   string  true "登录票据凭证"
 // @Param   query  query   stores.AttachmentSpec  true   "Object"
+// @Param   export  query  string  false  "导出格式，csv 或 ndjson，也可由 Accept 指定"
 // @Success 200 {object} Done{result=ResultData{data=cms1.Attachments}}
 // @Failure 400 {object} Failure "请求或参数错误"
 // @Failure 401 {object} Failure "未登录"
@@ -352,14 +514,40 @@ func (a *api) getContentAttachments(c *gin.Context) {
 		return
 	}
 
-	ctx := c.Request.Context()
+	if err := stores.CheckSort(&spec); err != nil {
+		fail(c, 400, err)
+		return
+	}
+
+	if err := stores.CheckFilter(spec.Filter, &spec); err != nil {
+		fail(c, 400, err)
+		return
+	}
+
+	ctx, fields, err := stores.ContextWithFields(c.Request.Context(), (*cms1.Attachment)(nil), spec.Fields)
+	if err != nil {
+		fail(c, 400, err)
+		return
+	}
+	ex, err := newExporter(c, "attachments", (*cms1.Attachment)(nil), fields)
+	if err != nil {
+		fail(c, 400, err)
+		return
+	}
+	if ex != nil {
+		err = a.sto.Content().ExportAttachment(ctx, &spec, func(data cms1.Attachments) error {
+			return exportRows(ex, data)
+		})
+		exportDone(c, ex, err)
+		return
+	}
 	data, total, err := a.sto.Content().ListAttachment(ctx, &spec)
 	if err != nil {
 		fail(c, 503, err)
 		return
 	}
 
-	success(c, dtResult(data, total))
+	success(c, dtResult(pickFields(data, fields), total))
 }
 
 // @Tags 默认 文档生成
@@ -370,7 +558,9 @@ func (a *api) getContentAttachments(c *gin.Context) {
 // @Summary 获取附件
 // @Accept json
 // @Produce json
+// @Param token    header   string  true "登录票据凭证"
 // @Param   id    path   string  true   "编号"
+// @Param   fields  query  string  false  "返回的字段，多个以逗号分隔"
 // @Success 200 {object} Done{result=cms1.Attachment}
 // @Failure 400 {object} Failure "请求或参数错误"
 // @Failure 401 {object} Failure "未登录"
@@ -379,13 +569,18 @@ func (a *api) getContentAttachments(c *gin.Context) {
 // @Router /api/v1/cms/attachments/{id} [get]
 func (a *api) getContentAttachment(c *gin.Context) {
 	id := c.Param("id")
-	obj, err := a.sto.Content().GetAttachment(c.Request.Context(), id)
+	ctx, fields, err := stores.ContextWithFields(c.Request.Context(), (*cms1.Attachment)(nil), c.Query("fields"))
+	if err != nil {
+		fail(c, 400, err)
+		return
+	}
+	obj, err := a.sto.Content().GetAttachment(ctx, id)
 	if err != nil {
 		fail(c, 503, err)
 		return
 	}
 
-	success(c, obj)
+	success(c, pickFields(obj, fields))
 }
 
 // @Tags 默认 文档生成
@@ -0,0 +1,194 @@
+package apiv1
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cupogo/scaffold/pkg/services/stores"
+)
+
+func init() {
+	regAdmin("GET", "/admin/reindex", "v1-admin-reindex-get", func(a *api) gin.HandlerFunc {
+		return a.getReindexStates
+	})
+	regAdmin("POST", "/admin/reindex", "v1-admin-reindex-post", func(a *api) gin.HandlerFunc {
+		return a.postReindex
+	})
+	regAdmin("GET", "/admin/reindex/jobs", "v1-admin-reindex-jobs-get", func(a *api) gin.HandlerFunc {
+		return a.getReindexJobs
+	})
+	regAdmin("GET", "/admin/reindex/jobs/:id", "v1-admin-reindex-jobs-id-get", func(a *api) gin.HandlerFunc {
+		return a.getReindexJob
+	})
+	regAdmin("DELETE", "/admin/reindex/jobs/:id", "v1-admin-reindex-jobs-id-delete", func(a *api) gin.HandlerFunc {
+		return a.deleteReindexJob
+	})
+}
+
+// reindexer 可重建搜索索引的存储，即 *stores.Wrap
+type reindexer interface {
+	StartReindex(ctx context.Context, model string, opt stores.ReindexOption) (*stores.ReindexJob, error)
+	ReindexStates(ctx context.Context) ([]stores.ReindexState, error)
+	ReindexJobs(ctx context.Context) []stores.ReindexJob
+	ReindexJobOf(ctx context.Context, id string) (*stores.ReindexJob, error)
+	CancelReindex(ctx context.Context, id string) (*stores.ReindexJob, error)
+}
+
+// reindexContext 重建索引的范围，不属于租户的管理员为系统范围，其他限定于所属的租户
+func reindexContext(c *gin.Context) context.Context {
+	ctx := c.Request.Context()
+	if p := c.MustGet(keyPrincipal).(*Principal); p.TenantID.IsZero() {
+		ctx = stores.ContextWithSystem(ctx)
+	}
+	return ctx
+}
+
+// reindexFail 重建索引的错误，模型未知为 400，范围重叠为 409
+func reindexFail(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, stores.ErrReindexUnknown):
+		fail(c, 400, err)
+	case errors.Is(err, stores.ErrReindexRunning):
+		fail(c, 409, err)
+	default:
+		fail(c, 503, err)
+	}
+}
+
+// @Tags 默认 文档生成
+// @ID v1-admin-reindex-get
+// @Summary 重建搜索索引的进度 🔑
+// @Description 不属于租户的管理员为系统范围，其他只有所属租户按租户隔离的模型
+// @Accept json
+// @Produce json
+// @Param token    header   string  true "登录票据凭证"
+// @Success 200 {object} Done{result=[]stores.ReindexState}
+// @Failure 401 {object} Failure "未登录"
+// @Failure 403 {object} Failure "无权限"
+// @Failure 503 {object} Failure "服务端错误"
+// @Router /api/v1/admin/reindex [get]
+func (a *api) getReindexStates(c *gin.Context) {
+	rx, ok := a.sto.(reindexer)
+	if !ok {
+		fail(c, 503, "reindex unsupported")
+		return
+	}
+	data, err := rx.ReindexStates(reindexContext(c))
+	if err != nil {
+		fail(c, 503, err)
+		return
+	}
+	success(c, data)
+}
+
+// @Tags 默认 文档生成
+// @ID v1-admin-reindex-post
+// @Summary 在后台重建搜索索引 🔑
+// @Description 返回任务，以其编号查看进度或取消；租户的管理员只重建所属租户的记录
+// @Accept json
+// @Produce json
+// @Param token    header   string  true "登录票据凭证"
+// @Param   model  query  string  false  "表名，为空时重建全部"
+// @Param   restart  query  boolean  false  "忽略检查点，从头开始"
+// @Success 200 {object} Done{result=stores.ReindexJob}
+// @Failure 400 {object} Failure "请求或参数错误"
+// @Failure 401 {object} Failure "未登录"
+// @Failure 403 {object} Failure "无权限"
+// @Failure 409 {object} Failure "正在运行"
+// @Failure 503 {object} Failure "服务端错误"
+// @Router /api/v1/admin/reindex [post]
+func (a *api) postReindex(c *gin.Context) {
+	rx, ok := a.sto.(reindexer)
+	if !ok {
+		fail(c, 503, "reindex unsupported")
+		return
+	}
+	var opt stores.ReindexOption
+	opt.Restart, _ = strconv.ParseBool(c.Query("restart"))
+	job, err := rx.StartReindex(reindexContext(c), c.Query("model"), opt)
+	if err != nil {
+		reindexFail(c, err)
+		return
+	}
+
+	success(c, job)
+}
+
+// @Tags 默认 文档生成
+// @ID v1-admin-reindex-jobs-get
+// @Summary 重建搜索索引的任务 🔑
+// @Description 本实例的任务，新的在前
+// @Accept json
+// @Produce json
+// @Param token    header   string  true "登录票据凭证"
+// @Success 200 {object} Done{result=[]stores.ReindexJob}
+// @Failure 401 {object} Failure "未登录"
+// @Failure 403 {object} Failure "无权限"
+// @Failure 503 {object} Failure "服务端错误"
+// @Router /api/v1/admin/reindex/jobs [get]
+func (a *api) getReindexJobs(c *gin.Context) {
+	rx, ok := a.sto.(reindexer)
+	if !ok {
+		fail(c, 503, "reindex unsupported")
+		return
+	}
+	success(c, rx.ReindexJobs(reindexContext(c)))
+}
+
+// @Tags 默认 文档生成
+// @ID v1-admin-reindex-jobs-id-get
+// @Summary 重建搜索索引的任务的进度 🔑
+// @Accept json
+// @Produce json
+// @Param token    header   string  true "登录票据凭证"
+// @Param   id    path   string  true   "任务编号"
+// @Success 200 {object} Done{result=stores.ReindexJob}
+// @Failure 401 {object} Failure "未登录"
+// @Failure 403 {object} Failure "无权限"
+// @Failure 404 {object} Failure "目标未找到"
+// @Failure 503 {object} Failure "服务端错误"
+// @Router /api/v1/admin/reindex/jobs/{id} [get]
+func (a *api) getReindexJob(c *gin.Context) {
+	rx, ok := a.sto.(reindexer)
+	if !ok {
+		fail(c, 503, "reindex unsupported")
+		return
+	}
+	job, err := rx.ReindexJobOf(reindexContext(c), c.Param("id"))
+	if err != nil {
+		fail(c, 503, err)
+		return
+	}
+	success(c, job)
+}
+
+// @Tags 默认 文档生成
+// @ID v1-admin-reindex-jobs-id-delete
+// @Summary 取消重建搜索索引的任务 🔑
+// @Description 当前一批写完后停止，检查点已保存，再次运行时从此继续
+// @Accept json
+// @Produce json
+// @Param token    header   string  true "登录票据凭证"
+// @Param   id    path   string  true   "任务编号"
+// @Success 200 {object} Done{result=stores.ReindexJob}
+// @Failure 401 {object} Failure "未登录"
+// @Failure 403 {object} Failure "无权限"
+// @Failure 404 {object} Failure "目标未找到"
+// @Failure 503 {object} Failure "服务端错误"
+// @Router /api/v1/admin/reindex/jobs/{id} [delete]
+func (a *api) deleteReindexJob(c *gin.Context) {
+	rx, ok := a.sto.(reindexer)
+	if !ok {
+		fail(c, 503, "reindex unsupported")
+		return
+	}
+	job, err := rx.CancelReindex(reindexContext(c), c.Param("id"))
+	if err != nil {
+		fail(c, 503, err)
+		return
+	}
+	success(c, job)
+}
@@ -0,0 +1,225 @@
+package resp
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cupogo/andvari/models/comm"
+)
+
+// 导出格式
+const (
+	ExportCSV    = "csv"
+	ExportNDJSON = "ndjson"
+)
+
+var exportTypes = map[string]string{
+	ExportCSV:    "text/csv; charset=utf-8",
+	ExportNDJSON: "application/x-ndjson",
+}
+
+// Exportable 可导出的记录，列依次为 json 字段名和表头
+type Exportable interface {
+	ExportColumns() [][2]string
+	ExportValue(key string) any
+}
+
+// ExportError 无效的导出格式
+type ExportError string
+
+func (e ExportError) Error() string { return "invalid export: " + string(e) }
+func (e ExportError) Field() string { return "export" }
+
+// ExportFormat 由查询参数 export 或 Accept 得到导出格式，空表示不导出，export 无效时返回 ExportError
+func ExportFormat(r *http.Request) (string, error) {
+	if s := r.URL.Query().Get("export"); len(s) > 0 {
+		if _, ok := exportTypes[s]; ok {
+			return s, nil
+		}
+		return "", ExportError(s)
+	}
+	for _, s := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, _, _ := mime.ParseMediaType(strings.TrimSpace(s))
+		for f, ct := range exportTypes {
+			if ct0, _, _ := strings.Cut(ct, ";"); mt == ct0 {
+				return f, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// Exporter 以 CSV 或 NDJSON 逐条写出记录，首次写出时发送响应头
+type Exporter struct {
+	w      http.ResponseWriter
+	format string
+	name   string
+	cols   [][2]string
+	roles  []string
+
+	started bool
+	ndjson  bool
+	cw      *csv.Writer
+}
+
+// NewExporter fields 不为空时只导出这些字段，roles 用于隐去不可见的字段
+func NewExporter(w http.ResponseWriter, format, name string, obj Exportable, fields []string, roles ...string) *Exporter {
+	cols := obj.ExportColumns()
+	if len(fields) > 0 {
+		cols = slices.DeleteFunc(slices.Clone(cols), func(c [2]string) bool {
+			return !slices.Contains(fields, c[0])
+		})
+	}
+	return &Exporter{w: w, format: format, name: name, cols: cols, roles: roles}
+}
+
+// Started 是否已开始写出，之后出错时无法再返回错误响应
+func (ex *Exporter) Started() bool {
+	return ex.started
+}
+
+func (ex *Exporter) start() error {
+	ex.started = true
+	ex.w.Header().Set("Content-Type", exportTypes[ex.format])
+	ex.w.Header().Set("Content-Disposition",
+		mime.FormatMediaType("attachment", map[string]string{"filename": ex.name + "." + ex.format}))
+	ex.w.WriteHeader(http.StatusOK)
+	if ex.format == ExportNDJSON {
+		ex.ndjson = true
+		return nil
+	}
+	ex.cw = csv.NewWriter(ex.w)
+	if _, err := ex.w.Write([]byte("\xef\xbb\xbf")); err != nil { // BOM 便于表格软件识别编码
+		return err
+	}
+	header := make([]string, len(ex.cols))
+	for i, c := range ex.cols {
+		header[i] = c[1]
+	}
+	return ex.cw.Write(header)
+}
+
+// Write 写出一条记录
+func (ex *Exporter) Write(obj Exportable) error {
+	if !ex.started {
+		if err := ex.start(); err != nil {
+			return err
+		}
+	}
+	if v, ok := obj.(interface{ RedactFor(roles ...string) }); ok {
+		v.RedactFor(ex.roles...)
+	}
+	if ex.ndjson {
+		return ex.writeJSON(obj)
+	}
+	rec := make([]string, len(ex.cols))
+	for i, c := range ex.cols {
+		rec[i] = csvCell(exportText(obj.ExportValue(c[0])))
+	}
+	return ex.cw.Write(rec)
+}
+
+// writeJSON 按列的顺序写出一行 JSON
+func (ex *Exporter) writeJSON(obj Exportable) error {
+	buf := []byte{'{'}
+	for i, c := range ex.cols {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		k, _ := json.Marshal(c[0])
+		v, err := json.Marshal(obj.ExportValue(c[0]))
+		if err != nil {
+			return err
+		}
+		buf = append(append(append(buf, k...), ':'), v...)
+	}
+	_, err := ex.w.Write(append(buf, '}', '\n'))
+	return err
+}
+
+// Flush 写出缓冲的内容，每批记录之后调用
+func (ex *Exporter) Flush() error {
+	if !ex.started {
+		if err := ex.start(); err != nil {
+			return err
+		}
+	}
+	if ex.cw != nil {
+		ex.cw.Flush()
+		if err := ex.cw.Error(); err != nil {
+			return err
+		}
+	}
+	if f, ok := ex.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// Close 结束导出，无记录时也写出表头，err 为中途读取的错误，此时只能记录
+func (ex *Exporter) Close(err error) {
+	if err == nil {
+		err = ex.Flush()
+	}
+	if err != nil {
+		logger().Infow("export fail", "name", ex.name, "format", ex.format, "err", err)
+	}
+}
+
+// ExportRows 写出一批记录并刷新
+func ExportRows[S ~[]E, E any, P interface {
+	*E
+	Exportable
+}](ex *Exporter, data S) error {
+	for i := range data {
+		if err := ex.Write(P(&data[i])); err != nil {
+			return err
+		}
+	}
+	return ex.Flush()
+}
+
+func exportText(v any) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	case time.Time:
+		if s.IsZero() {
+			return ""
+		}
+		return s.Format(time.RFC3339)
+	case *time.Time:
+		if s == nil {
+			return ""
+		}
+		return exportText(*s)
+	case comm.DateTime:
+		if s == 0 {
+			return ""
+		}
+		return s.Time().Format(time.RFC3339)
+	case fmt.Stringer:
+		return s.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// csvCell 以 = + - @ 等开头且不是数字的单元格前加 '，以免被表格软件当作公式执行
+func csvCell(s string) string {
+	if len(s) == 0 || !strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return s
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return s
+	}
+	return "'" + s
+}
@@ -0,0 +1,354 @@
+package resp
+
+import (
+	"bufio"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cupogo/andvari/models/comm"
+	"github.com/go-playground/validator/v10"
+)
+
+// ImportMaxLine NDJSON 单行的最大长度
+var ImportMaxLine = 1 << 20
+
+// ImportMaxBytes 导入请求体的最大长度，超出时读取出错
+var ImportMaxBytes int64 = 32 << 20
+
+var importTypes = map[string]string{
+	"text/csv":             ExportCSV,
+	"application/csv":      ExportCSV,
+	"application/x-ndjson": ExportNDJSON,
+	"application/jsonl":    ExportNDJSON,
+}
+
+// Importable 可导入的记录，列依次为 json 字段名和表头，与导出的列一致
+type Importable interface {
+	ImportColumns() [][2]string
+}
+
+// ImportFormat 由 Content-Type 得到导入格式，不支持时为空
+func ImportFormat(r *http.Request) string {
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return importTypes[mt]
+}
+
+// ImportAccept 接受的行
+type ImportAccept struct {
+	Row int    `json:"row"`          // 行号，从 1 开始，不含表头
+	ID  string `json:"id,omitempty"` // 创建的编号，试运行时为空
+} // @name ImportAccept
+
+// ImportFieldError 字段错误，Field 为空时是整行的错误
+type ImportFieldError struct {
+	Field string `json:"field,omitempty"`
+	Error string `json:"error"`
+} // @name ImportFieldError
+
+// ImportReject 拒绝的行
+type ImportReject struct {
+	Row    int                `json:"row"`
+	Errors []ImportFieldError `json:"errors"`
+} // @name ImportReject
+
+// ImportReport 导入结果
+type ImportReport struct {
+	DryRun   bool           `json:"dryRun,omitempty"` // 是否试运行，试运行不保存
+	Total    int            `json:"total"`            // 总行数
+	Accepted []ImportAccept `json:"accepted"`         // 接受的行
+	Rejected []ImportReject `json:"rejected"`         // 拒绝的行
+} // @name ImportReport
+
+// Importing 读出并校验过的记录，Ins 与 Rows 依次对应
+type Importing[E any] struct {
+	ImportReport
+
+	Ins  []E   // 通过校验的记录
+	Rows []int // 通过校验的记录的行号
+}
+
+// Done 记下写入的结果，ids 与 Ins 依次对应，为空的是出错而跳过的
+// err 含各条的错误（见 stores.ImportErrors）及中断写入的错误，中断后的各行为 not imported
+func (im *Importing[E]) Done(ids []string, err error) *ImportReport {
+	rep := &im.ImportReport
+	rep.Accepted = make([]ImportAccept, 0, len(ids))
+	failures, cause := importFailures(err)
+	for i, row := range im.Rows {
+		if i < len(ids) && len(ids[i]) > 0 {
+			ia := ImportAccept{Row: row}
+			if !rep.DryRun {
+				ia.ID = ids[i]
+			}
+			rep.Accepted = append(rep.Accepted, ia)
+			continue
+		}
+		msg := "not imported"
+		if fe, ok := failures[i]; ok {
+			msg = fe.Error()
+		} else if cause != nil {
+			msg = msg + ": " + cause.Error()
+		}
+		rep.Rejected = append(rep.Rejected, ImportReject{Row: row, Errors: []ImportFieldError{{Error: msg}}})
+	}
+	slices.SortStableFunc(rep.Rejected, func(a, b ImportReject) int { return a.Row - b.Row })
+	return rep
+}
+
+// importFailure 写入第 ImportIndex 条通过校验的记录时的错误，见 stores.ImportError
+type importFailure interface {
+	error
+	ImportIndex() int
+	Unwrap() error
+}
+
+// importFailures 由写入的错误得到各条的错误，以及其他的即中断写入的错误
+func importFailures(err error) (failures map[int]error, cause error) {
+	failures = make(map[int]error)
+	var walk func(err error)
+	walk = func(err error) {
+		var ie importFailure
+		if err == nil {
+			return
+		}
+		if errs, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, e := range errs.Unwrap() {
+				walk(e)
+			}
+		} else if errors.As(err, &ie) {
+			failures[ie.ImportIndex()] = ie.Unwrap()
+		} else if cause == nil {
+			cause = err
+		}
+	}
+	walk(err)
+	return
+}
+
+// ReadImport 读出请求体中的全部行，逐行解析、校验并检查写入权限
+// CSV 的表头可用字段名或导出时的表头，NDJSON 每行一个对象
+func ReadImport[E any, P interface {
+	*E
+	Importable
+}](r io.Reader, format string, valid func(any) error, roles ...string) (*Importing[E], error) {
+	im := &Importing[E]{ImportReport: ImportReport{Rejected: []ImportReject{}}}
+	fields := scanImportFields(reflect.TypeOf((*E)(nil)).Elem(), P(nil).ImportColumns())
+	add := func(row int, in *E, errs []ImportFieldError) {
+		im.Total++
+		if len(errs) == 0 {
+			errs = checkImport(P(in), fields, valid, roles)
+		}
+		if len(errs) > 0 {
+			im.Rejected = append(im.Rejected, ImportReject{Row: row, Errors: errs})
+			return
+		}
+		im.Ins = append(im.Ins, *in)
+		im.Rows = append(im.Rows, row)
+	}
+
+	switch format {
+	case ExportCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		header, err := cr.Read()
+		if err != nil {
+			return nil, fmt.Errorf("read csv header: %w", err)
+		}
+		cols := make([]*importField, len(header))
+		for i, s := range header {
+			if i == 0 {
+				s = strings.TrimPrefix(s, "\xef\xbb\xbf")
+			}
+			s = strings.TrimSpace(s)
+			if cols[i] = fields.find(s); cols[i] == nil && len(s) > 0 {
+				return nil, fmt.Errorf("unknown column %q", s)
+			}
+		}
+		for row := 1; ; row++ {
+			rec, err := cr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			in := new(E)
+			var errs []ImportFieldError
+			rv := reflect.ValueOf(in).Elem()
+			for i, s := range rec {
+				if i >= len(cols) || cols[i] == nil || len(strings.TrimSpace(s)) == 0 {
+					continue
+				}
+				if err := importText(rv.FieldByIndex(cols[i].index), strings.TrimSpace(s)); err != nil {
+					errs = append(errs, ImportFieldError{Field: cols[i].name, Error: err.Error()})
+				}
+			}
+			add(row, in, errs)
+		}
+	case ExportNDJSON:
+		sc := bufio.NewScanner(r)
+		sc.Buffer(nil, ImportMaxLine)
+		for row := 1; sc.Scan(); row++ {
+			line := strings.TrimSpace(sc.Text())
+			if len(line) == 0 {
+				row--
+				continue
+			}
+			in := new(E)
+			var errs []ImportFieldError
+			var obj map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(line), &obj); err != nil {
+				add(row, in, []ImportFieldError{{Error: err.Error()}})
+				continue
+			}
+			keys := make([]string, 0, len(obj))
+			for k := range obj {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			rv := reflect.ValueOf(in).Elem()
+			for _, k := range keys {
+				f := fields.find(k)
+				if f == nil {
+					errs = append(errs, ImportFieldError{Field: k, Error: "unknown field"})
+					continue
+				}
+				if err := importJSON(rv.FieldByIndex(f.index), obj[k]); err != nil {
+					errs = append(errs, ImportFieldError{Field: f.name, Error: err.Error()})
+				}
+			}
+			add(row, in, errs)
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid import format %q", format)
+	}
+	return im, nil
+}
+
+type importField struct {
+	name  string
+	label string
+	sname string // 结构体中的字段名，用于对应校验错误
+	index []int
+}
+
+type importFields []importField
+
+func (fs importFields) find(s string) *importField {
+	for i := range fs {
+		if fs[i].name == s || fs[i].label == s {
+			return &fs[i]
+		}
+	}
+	return nil
+}
+
+func (fs importFields) nameOf(sname string) string {
+	for _, f := range fs {
+		if f.sname == sname {
+			return f.name
+		}
+	}
+	return sname
+}
+
+// scanImportFields 按 json 标签找出可导入的列对应的字段
+func scanImportFields(rt reflect.Type, cols [][2]string) (out importFields) {
+	for _, c := range cols {
+		for _, sf := range reflect.VisibleFields(rt) {
+			if sf.Anonymous || !sf.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+			if name == c[0] {
+				out = append(out, importField{name: c[0], label: c[1], sname: sf.Name, index: sf.Index})
+				break
+			}
+		}
+	}
+	return
+}
+
+// checkImport 校验一条记录，返回字段错误
+func checkImport(obj any, fields importFields, valid func(any) error, roles []string) (errs []ImportFieldError) {
+	if valid != nil {
+		if err := valid(obj); err != nil {
+			var ves validator.ValidationErrors
+			if !errors.As(err, &ves) {
+				return []ImportFieldError{{Error: err.Error()}}
+			}
+			for _, fe := range ves {
+				errs = append(errs, ImportFieldError{Field: fields.nameOf(fe.StructField()), Error: fe.Error()})
+			}
+			return
+		}
+	}
+	if v, ok := obj.(interface{ DeniedField(roles ...string) string }); ok {
+		if field := v.DeniedField(roles...); len(field) > 0 {
+			errs = append(errs, ImportFieldError{Field: field, Error: "field denied"})
+		}
+	}
+	return
+}
+
+var importLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"}
+
+// importText 由文本设置字段，枚举等可由 Decode 解析的类型优先
+func importText(fv reflect.Value, s string) error {
+	switch v := fv.Addr().Interface().(type) {
+	case interface{ Decode(string) error }:
+		return v.Decode(s)
+	case *comm.DateTime:
+		for _, layout := range importLayouts {
+			if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+				*v = comm.NewDateTimeFromTime(t)
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid time: %q", s)
+	case encoding.TextUnmarshaler:
+		return v.UnmarshalText([]byte(s))
+	}
+	if fv.Kind() == reflect.String {
+		fv.SetString(s)
+		return nil
+	}
+	if err := json.Unmarshal([]byte(s), fv.Addr().Interface()); err != nil {
+		b, _ := json.Marshal(s)
+		if json.Unmarshal(b, fv.Addr().Interface()) != nil {
+			return fmt.Errorf("invalid value: %q", s)
+		}
+	}
+	return nil
+}
+
+// importJSON 由 JSON 值设置字段，字符串按文本处理
+func importJSON(fv reflect.Value, raw json.RawMessage) error {
+	if string(raw) == "null" {
+		return nil
+	}
+	if len(raw) > 0 && raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return err
+		}
+		if len(s) == 0 {
+			return nil
+		}
+		return importText(fv, s)
+	}
+	return json.Unmarshal(raw, fv.Addr().Interface())
+}
@@ -0,0 +1,139 @@
+package resp
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type importThing struct {
+	Name   string `json:"name" validate:"required"`
+	Count  int    `json:"count"`
+	Secret string `json:"secret"`
+}
+
+func (*importThing) ImportColumns() [][2]string {
+	return [][2]string{{"name", "名称"}, {"count", "数量"}, {"secret", "密钥"}}
+}
+
+// DeniedField 非管理员不能写入 secret
+func (z *importThing) DeniedField(roles ...string) string {
+	if len(z.Secret) > 0 && !slices.Contains(roles, "admin") {
+		return "secret"
+	}
+	return ""
+}
+
+// rejects 各拒绝行的行号和第一个错误的字段
+func rejects(rep ImportReport) (out []string) {
+	for _, r := range rep.Rejected {
+		out = append(out, fmt.Sprintf("%d:%s", r.Row, r.Errors[0].Field))
+	}
+	return
+}
+
+func TestReadImportCSV(t *testing.T) {
+	valid := validator.New().Struct
+	// 首列表头前有 BOM，表头混用标签和字段名
+	body := "\xef\xbb\xbf名称,count, 密钥 \n" +
+		"a,1,\n" +
+		",2,\n" + // 缺少必填的 name
+		"b,x,\n" + // count 无效
+		"c,3,s\n" + // secret 无权写入
+		" d , ,\n"
+	im, err := ReadImport[importThing](strings.NewReader(body), ExportCSV, valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im.Total != 5 || !slices.Equal(im.Rows, []int{1, 5}) || im.Ins[0].Count != 1 || im.Ins[1].Name != "d" {
+		t.Errorf("accepted: total %d rows %v ins %+v", im.Total, im.Rows, im.Ins)
+	}
+	if got := rejects(im.ImportReport); !slices.Equal(got, []string{"2:name", "3:count", "4:secret"}) {
+		t.Errorf("rejected: %v", got)
+	}
+
+	im, err = ReadImport[importThing](strings.NewReader(body), ExportCSV, valid, "admin")
+	if err != nil || !slices.Equal(im.Rows, []int{1, 4, 5}) {
+		t.Errorf("admin: %v %v", im.Rows, err)
+	}
+
+	if _, err = ReadImport[importThing](strings.NewReader("name,nope\na,b\n"), ExportCSV, valid); err == nil ||
+		!strings.Contains(err.Error(), `"nope"`) {
+		t.Errorf("unknown column: %v", err)
+	}
+	if _, err = ReadImport[importThing](strings.NewReader(""), "xml", valid); err == nil {
+		t.Error("unknown format should fail")
+	}
+}
+
+func TestReadImportNDJSON(t *testing.T) {
+	body := `{"name":"a","count":1}` + "\n\n" +
+		`{"name":"b","extra":1}` + "\n" +
+		`{"name":` + "\n" +
+		`{"name":"c","count":"2"}` + "\n" +
+		`{"name":"d","secret":"s"}` + "\n"
+	im, err := ReadImport[importThing](strings.NewReader(body), ExportNDJSON, validator.New().Struct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 空行不计行号，字串按文本解析
+	if im.Total != 5 || !slices.Equal(im.Rows, []int{1, 4}) || im.Ins[1].Count != 2 {
+		t.Errorf("accepted: total %d rows %v ins %+v", im.Total, im.Rows, im.Ins)
+	}
+	if got := rejects(im.ImportReport); !slices.Equal(got, []string{"2:extra", "3:", "5:secret"}) {
+		t.Errorf("rejected: %v", got)
+	}
+	if e := im.Rejected[0].Errors[0].Error; e != "unknown field" {
+		t.Errorf("unknown field: %q", e)
+	}
+}
+
+// rowError 同 stores.ImportError
+type rowError struct {
+	index int
+	err   error
+}
+
+func (e *rowError) Error() string    { return e.err.Error() }
+func (e *rowError) Unwrap() error    { return e.err }
+func (e *rowError) ImportIndex() int { return e.index }
+
+func TestImportingDone(t *testing.T) {
+	newIm := func() *Importing[importThing] {
+		im := &Importing[importThing]{ImportReport: ImportReport{Total: 5, Rejected: []ImportReject{
+			{Row: 2, Errors: []ImportFieldError{{Field: "name", Error: "required"}}},
+		}}}
+		im.Ins = make([]importThing, 4)
+		im.Rows = []int{1, 3, 4, 5}
+		return im
+	}
+	errDup, errConn := errors.New("duplicate"), errors.New("conn lost")
+
+	// 出错的行被拒绝，其后的照常接受
+	rep := newIm().Done([]string{"i1", "", "i4", "i5"}, errors.Join(&rowError{1, errDup}))
+	if len(rep.Accepted) != 3 || rep.Accepted[2].ID != "i5" || len(rep.Rejected) != 2 ||
+		rep.Rejected[1].Row != 3 || rep.Rejected[1].Errors[0].Error != "duplicate" {
+		t.Errorf("row error: %+v", rep)
+	}
+
+	// 中断后的行为 not imported
+	rep = newIm().Done([]string{"i1", ""}, errors.Join(&rowError{1, errDup}, errConn))
+	if len(rep.Accepted) != 1 || len(rep.Rejected) != 4 {
+		t.Fatalf("interrupted: %+v", rep)
+	}
+	for i, want := range []string{"required", "duplicate", "not imported: conn lost", "not imported: conn lost"} {
+		if got := rep.Rejected[i].Errors[0].Error; got != want {
+			t.Errorf("rejected #%d: want %q, got %q", i, want, got)
+		}
+	}
+
+	im := newIm()
+	im.DryRun = true
+	if rep = im.Done([]string{"i1", "i3", "i4", "i5"}, nil); len(rep.Accepted) != 4 || rep.Accepted[0].ID != "" {
+		t.Errorf("dry run: %+v", rep.Accepted)
+	}
+}
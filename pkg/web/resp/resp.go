@@ -9,6 +9,14 @@ import (
 	"github.com/cupogo/scaffold/pkg/web/i18n"
 )
 
+// KeyRoles 请求者角色在 gin.Context 中的键，由登录验证中间件设置
+const KeyRoles = "roles"
+
+// Roles 当前请求者的角色
+func Roles(c *gin.Context) []string {
+	return c.GetStringSlice(KeyRoles)
+}
+
 // Ok ...
 func Ok(c *gin.Context, args ...any) {
 	Out(c, 200, args...)
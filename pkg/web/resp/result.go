@@ -1,21 +1,108 @@
 package resp
 
+import (
+	"encoding/json"
+	"slices"
+)
+
 type ViewPatcher interface {
 	PatchView()
 }
 
 // ResultData 特定数据集(带JSON数组和总数)，一般用在分页查询结果
 type ResultData struct {
-	Data  any `json:"data,omitempty"`  // 数据集数组
-	Total int `json:"total,omitempty"` // 符合条件的总记录数
+	Data  any    `json:"data,omitempty"`  // 数据集数组
+	Total int    `json:"total,omitempty"` // 符合条件的总记录数
+	Next  string `json:"next,omitempty"`  // 下一页游标，游标分页时有效
+	Prev  string `json:"prev,omitempty"`  // 上一页游标，游标分页时有效
+
+	Extra map[string]any `json:"extra,omitempty"` // 附加数据，如分面计数 facets
 } // @name ResultData
 
+// SetExtra 设置附加数据
+func (dr *ResultData) SetExtra(key string, val any) {
+	if dr.Extra == nil {
+		dr.Extra = make(map[string]any)
+	}
+	dr.Extra[key] = val
+}
+
 func (dr *ResultData) PatchView() {
 	if v, ok := dr.Data.(ViewPatcher); ok {
 		v.PatchView()
 	}
 }
 
+// Patched 输出前先调用 patch 的数据，如按请求者的角色隐去字段
+type Patched struct {
+	Data  any
+	patch func()
+}
+
+// PatchWith 在输出前的 PatchView 中调用 patch，再转给 data 的 PatchView
+func PatchWith(data any, patch func()) *Patched {
+	return &Patched{Data: data, patch: patch}
+}
+
+func (p *Patched) PatchView() {
+	p.patch()
+	if v, ok := p.Data.(ViewPatcher); ok {
+		v.PatchView()
+	}
+}
+
+func (p *Patched) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.Data)
+}
+
+// Picked 只输出指定的字段，其余字段不出现在结果中
+type Picked struct {
+	Data   any
+	Fields []string
+}
+
+// Pick 按字段名裁剪结果，fields 为空时原样返回
+func Pick(data any, fields ...string) any {
+	if len(fields) == 0 {
+		return data
+	}
+	return &Picked{Data: data, Fields: fields}
+}
+
+func (p *Picked) PatchView() {
+	if v, ok := p.Data.(ViewPatcher); ok {
+		v.PatchView()
+	}
+}
+
+func (p *Picked) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(p.Data)
+	if err != nil {
+		return nil, err
+	}
+	var objs []map[string]json.RawMessage
+	if err = json.Unmarshal(b, &objs); err == nil {
+		for _, obj := range objs {
+			p.pick(obj)
+		}
+		return json.Marshal(objs)
+	}
+	var obj map[string]json.RawMessage
+	if err = json.Unmarshal(b, &obj); err != nil {
+		return b, nil
+	}
+	p.pick(obj)
+	return json.Marshal(obj)
+}
+
+func (p *Picked) pick(obj map[string]json.RawMessage) {
+	for k := range obj {
+		if !slices.Contains(p.Fields, k) {
+			delete(obj, k)
+		}
+	}
+}
+
 type ResultID struct {
 	ID any `json:"id"` // 主键值，多数时候是字串
 } // @name ResultID
@@ -0,0 +1,38 @@
+package routes
+
+import (
+	"context"
+	"sync"
+)
+
+// WorkerFunc 随服务运行的后台任务，ctx 结束时应返回
+type WorkerFunc func(ctx context.Context)
+
+var workers = make(map[string]WorkerFunc)
+
+// RegisterWorker 注册后台任务，供各业务包在 Strap 中调用，同名的后者覆盖前者
+func RegisterWorker(name string, fn WorkerFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+	workers[name] = fn
+}
+
+// RunWorkers 在后台运行已注册的任务，返回的 stop 取消其 ctx 并等待全部返回，可多次调用
+func RunWorkers(ctx context.Context) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	mu.RLock()
+	for name, fn := range workers {
+		logger().Infow("start worker", "name", name)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(ctx)
+		}()
+	}
+	mu.RUnlock()
+	return sync.OnceFunc(func() {
+		cancel()
+		wg.Wait()
+	})
+}
@@ -3,6 +3,7 @@ package web
 import (
 	"context"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/getsentry/raven-go"
@@ -24,6 +25,9 @@ type Service interface {
 type server struct {
 	router *gin.Engine
 	hs     *http.Server
+
+	mu          sync.Mutex
+	stopWorkers func() // 停止随服务运行的后台任务，见 routes.RunWorkers
 }
 
 func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -94,6 +98,11 @@ func New(ahs ...string) Service {
 }
 
 func (s *server) Serve(ctx context.Context) error {
+	s.mu.Lock()
+	s.stopWorkers = apis.RunWorkers(ctx)
+	s.mu.Unlock()
+	defer s.stopping()
+
 	// Run HTTP server
 	runErrChan := make(chan error)
 	t := time.AfterFunc(time.Millisecond*200, func() {
@@ -122,6 +131,7 @@ func (s *server) Serve(ctx context.Context) error {
 }
 
 func (s *server) Stop(ctx context.Context) error {
+	defer s.stopping()
 	if err := s.hs.Shutdown(ctx); err != nil {
 		logger().Fatalw("Server Shutdown", "err", err)
 		return err
@@ -129,6 +139,16 @@ func (s *server) Stop(ctx context.Context) error {
 	return nil
 }
 
+// stopping 取消后台任务并等待其返回
+func (s *server) stopping() {
+	s.mu.Lock()
+	stop := s.stopWorkers
+	s.mu.Unlock()
+	if stop != nil {
+		stop()
+	}
+}
+
 func handlePing(c *gin.Context) {
 	c.String(200, "Pong")
 }
@@ -135,6 +135,8 @@ type Document struct {
 	Stores    []Store `yaml:"stores"`
 	WebAPI    WebAPI  `yaml:"webapi"`
 	WebCode   string  `yaml:"webcode"` // default:"gin"
+	Tenant    bool    `yaml:"tenant"`  // 全部模型按租户隔离
+	Trace     bool    `yaml:"trace"`   // 全部模型的存储方法和钩子的跟踪及度量
 }
 
 func (doc *Document) Check() error {
@@ -300,6 +302,105 @@ func (doc *Document) hasStoreEmbed() bool {
 	return false
 }
 
+// storeOfModel 含此模型的存储
+func (doc *Document) storeOfModel(name string) (*Store, bool) {
+	for i := range doc.Stores {
+		if doc.Stores[i].hasModel(name) {
+			return &doc.Stores[i], true
+		}
+	}
+	return nil, false
+}
+
+// hasStoreMethod 存储接口中有此方法，如 ExportArticle
+func (doc *Document) hasStoreMethod(name string) bool {
+	for _, s := range doc.Stores {
+		for _, mth := range s.Methods {
+			if mth.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasCache 有 Get 读缓存的模型
+func (doc *Document) hasCache() bool {
+	for _, m := range doc.Models {
+		if m.canCache() {
+			return true
+		}
+	}
+	return false
+}
+
+// hasOutbox 有写入变更事件的模型
+func (doc *Document) hasOutbox() bool {
+	for _, m := range doc.Models {
+		if m.canOutbox() {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTenant 有按租户隔离的模型
+func (doc *Document) hasTenant() bool {
+	for _, m := range doc.Models {
+		if m.canTenant() {
+			return true
+		}
+	}
+	return false
+}
+
+// hasOwnerOnly 有仅所有者可读写的模型
+func (doc *Document) hasOwnerOnly() bool {
+	for _, m := range doc.Models {
+		if m.canOwnerOnly() {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTrace 有跟踪存储方法的模型
+func (doc *Document) hasTrace() bool {
+	for _, m := range doc.Models {
+		if m.canTrace() {
+			return true
+		}
+	}
+	return false
+}
+
+// hasHookRegistry 有可在运行时注册钩子的模型
+func (doc *Document) hasHookRegistry() bool {
+	for _, m := range doc.Models {
+		if m.canHookRegistry() {
+			return true
+		}
+	}
+	return false
+}
+
+// hasBulk 有批量创建或更新的存储方法
+func (doc *Document) hasBulk() bool {
+	for _, s := range doc.Stores {
+		for _, mth := range s.Methods {
+			if strings.HasSuffix(mth.action, "Bulk") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasIndexer 有同步搜索索引的模型
+func (doc *Document) hasIndexer() bool {
+	return len(doc.loadEsModels()) > 0
+}
+
 func (doc *Document) hasStoreHooks() bool {
 	for _, m := range doc.Models {
 		if len(m.StoHooks) > 0 {
@@ -416,6 +517,16 @@ func (doc *Document) modelWithName(name string) (*Model, bool) {
 	return &Model{}, false
 }
 
+// modelWithPlural 按名称或复数名称查找模型
+func (doc *Document) modelWithPlural(name string) (*Model, bool) {
+	for i := range doc.Models {
+		if m := &doc.Models[i]; m.Name == name || m.GetPlural() == name {
+			return m, true
+		}
+	}
+	return &Model{}, false
+}
+
 // nolint
 func (doc *Document) enumWithName(name string) (*Enum, bool) {
 	for _, m := range doc.Enums {
@@ -612,6 +723,32 @@ func (doc *Document) genStores(dropfirst bool) (err error) {
 
 	_ = doc.ensureWrapPatch()
 
+	if doc.hasCache() {
+		ensureGoFile(path.Join(doc.dirsto, "cache.go"), "stores/cache", doc)
+	}
+	if doc.hasOutbox() {
+		ensureGoFile(path.Join(doc.dirsto, "outbox.go"), "stores/outbox", doc)
+	}
+	if doc.hasTenant() {
+		ensureGoFile(path.Join(doc.dirsto, "tenant.go"), "stores/tenant", doc)
+	}
+	if doc.hasOwnerOnly() {
+		ensureGoFile(path.Join(doc.dirsto, "owner.go"), "stores/owner", doc)
+	}
+	if doc.hasTrace() {
+		ensureGoFile(path.Join(doc.dirsto, "telemetry.go"), "stores/telemetry", doc)
+	}
+	if doc.hasHookRegistry() {
+		ensureGoFile(path.Join(doc.dirsto, "hooks.go"), "stores/hooks", doc)
+	}
+	if doc.hasBulk() {
+		ensureGoFile(path.Join(doc.dirsto, "bulk.go"), "stores/bulk", doc)
+	}
+	if doc.hasIndexer() {
+		ensureGoFile(path.Join(doc.dirsto, "indexer.go"), "stores/indexer", doc)
+		ensureGoFile(path.Join(doc.dirsto, "reindex.go"), "stores/reindex", doc)
+	}
+
 	_ = doc.encureStoMethod()
 
 	return err
@@ -620,6 +757,7 @@ func (doc *Document) genStores(dropfirst bool) (err error) {
 func (doc *Document) ensureWrapPatch() bool {
 	sfile := path.Join(doc.dirsto, storewf)
 	ensureGoFile(sfile, "stores/wrap", doc)
+	ensureGoFile(path.Join(doc.dirsto, "replica.go"), "stores/replica", doc)
 	vd, err := newDST(sfile, storepkg)
 	if err != nil {
 		return false
@@ -636,7 +774,7 @@ func (doc *Document) ensureWrapPatch() bool {
 						continue
 					}
 					fd := store.dstWrapField()
-					if len(cn.Fields.List) < 3 {
+					if len(cn.Fields.List) < 4 {
 						fd.Decs.Before = dst.EmptyLine
 					}
 					cn.Fields.List = append(cn.Fields.List, fd)
@@ -740,11 +878,14 @@ func (doc *Document) genWebAPI(dropfirst bool) error {
 		suf = "_" + doc.WebCode
 	}
 
-	ensureGoFile(path.Join(doc.dirweb, "api.go"), "web/api"+suf, map[string]string{
+	ensureGoFile(path.Join(doc.dirweb, "api.go"), "web/api"+suf, map[string]any{
 		"Module":    doc.Module,
 		"WebPkg":    doc.WebAPI.GetPkgName(),
 		"FormTag":   doc.WebAPI.FormTag,
 		"UriPrefix": doc.WebAPI.GetUriPrefix(),
+		"Tenant":    doc.hasTenant(),
+		"OwnerOnly": doc.hasOwnerOnly(),
+		"Trace":     doc.hasTrace(),
 	})
 
 	outname := path.Join(doc.dirweb, "handle_"+doc.Prefix+doc.gened)
@@ -156,6 +156,9 @@ func (e *Enum) Code() jen.Code {
 					strs = append(strs, ev.Label)
 				}
 				strs = append(strs, ev.Alias...)
+				if label, _, _ := strings.Cut(ev.Label, " "); e.Labeled && len(label) > 0 {
+					strs = append(strs, label) // 导入时可用导出的标签
+				}
 				strs = uniqStrings(strs)
 				cases := make([]jen.Code, len(strs))
 				for i, s := range strs {
@@ -23,10 +23,17 @@ type Field struct {
 
 	IsChangeWith bool `yaml:"changeWith,omitempty"` // has ChangeWith method
 	IgnoreCase   bool `yaml:"icse,omitempty"`       // Ignore case sensitivity equality
+	IsOwned      bool `yaml:"owned,omitempty"`      // has-many children saved with the owner
+	IsFacet      bool `yaml:"facet,omitempty"`      // 列表可返回按值的分面计数
+
+	ReadRoles  []string `yaml:"read,omitempty"`  // 可见的角色，'-' 表示均不可见
+	WriteRoles []string `yaml:"write,omitempty"` // 可写的角色，'-' 表示均不可写
 
 	isOid    bool
+	uniqs    []string // constraints of composite unique
 	isDate   bool
 	isIntDt  bool
+	isTime   bool // range of time
 	siftFn   string
 	siftOp   string
 	siftExt  string
@@ -109,6 +116,14 @@ func (f *Field) bunPatchTags() (out Tags) {
 		v := out["pg"]
 		out["bun"] = replTrimUseZero.Replace(v)
 	}
+	for _, k := range []string{"pg", "bun"} {
+		if v, ok := out[k]; ok {
+			for _, uc := range f.uniqs {
+				v += ",unique:" + uc
+			}
+			out[k] = v
+		}
+	}
 	if f.isOID() && !out.Has(TagSwaggerType) {
 		out[TagSwaggerType] = "string"
 	}
@@ -250,6 +265,9 @@ func (f *Field) inMgm() bool {
 
 // return column name, is in db and is unquie
 func (f *Field) ColName() (cn string, hascol bool, unique bool) {
+	if _, isRel := f.relMode(); isRel {
+		return
+	}
 	if s, ok := f.Tags.GetAny("pg", "bun"); ok && len(s) > 0 && s != "-" {
 		hascol = true
 		if a, b, ok := strings.Cut(s, ","); ok {
@@ -302,6 +320,109 @@ func (f *Field) relMode(dbtag ...string) (string, bool) {
 	return "", false
 }
 
+// relJoinFK 返回一对多关联中子表的外键列名，如 `join:id=article_id` 或 `join_fk:article_id`
+func (f *Field) relJoinFK(owner string) string {
+	if s, ok := f.Tags.GetAny("pg", "bun"); ok {
+		for _, part := range strings.Split(s, ",") {
+			if a, b, ok := strings.Cut(part, ":"); ok {
+				switch a {
+				case "join":
+					if _, fk, ok := strings.Cut(b, "="); ok {
+						return fk
+					}
+				case "join_fk":
+					return b
+				}
+			}
+		}
+	}
+	return Underscore(owner) + "_id"
+}
+
+func (f *Field) shortComment() string {
+	if a, _, ok := strings.Cut(f.Comment, " "); ok {
+		return a
+	}
+	return f.Comment
+}
+
+// jroleDenied 角色不在列表中的条件，nil 表示总是拒绝
+func jroleDenied(roles []string) *jen.Statement {
+	var st *jen.Statement
+	for _, role := range roles {
+		if role == "-" {
+			return nil
+		}
+		jc := jen.Op("!").Qual("slices", "Contains").Call(jen.Id("roles"), jen.Lit(role))
+		if st == nil {
+			st = jc
+		} else {
+			st = st.Op("&&").Add(jc)
+		}
+	}
+	return st
+}
+
+// zeroCode 字段类型的零值
+func (f *Field) zeroCode() jen.Code {
+	qn, typ, isptr := f.cutType()
+	if isptr || strings.HasPrefix(typ, "[]") || strings.HasPrefix(typ, "map[") {
+		return jen.Nil()
+	}
+	switch {
+	case typ == "string":
+		return jen.Lit("")
+	case typ == "bool":
+		return jen.False()
+	case strings.HasPrefix(typ, "int"), strings.HasPrefix(typ, "uint"), strings.HasPrefix(typ, "float"),
+		qn == "oid" && typ == "OID":
+		return jen.Lit(0)
+	}
+	if f.mod != nil && f.maybeEnum() {
+		if _, ok := f.mod.doc.getEnumDoc(f.Type); ok {
+			return jen.Lit(0)
+		}
+	}
+	return f.typeCode().Values()
+}
+
+// filterKind 字段在 filter 参数中的值类型，空为不支持
+func (f *Field) filterKind() string {
+	typ := f.Type
+	if f.mod != nil {
+		if enum, ok := f.mod.doc.enumWithName(typ); ok && len(enum.Type) > 0 {
+			typ = enum.Type
+		}
+	}
+	switch {
+	case typ == "oid.OID":
+		return "FilterOID"
+	case strings.HasSuffix(typ, "DateTime"):
+		return "FilterDateTime"
+	case strings.HasSuffix(typ, "time.Time"):
+		return "FilterTime"
+	case typ == "string":
+		return "FilterString"
+	case typ == "bool":
+		return "FilterBool"
+	case strings.HasPrefix(typ, "int") || strings.HasPrefix(typ, "uint"):
+		return "FilterInt"
+	case strings.HasPrefix(typ, "float"):
+		return "FilterFloat"
+	}
+	return ""
+}
+
+// jsonName json 标签中的字段名，如 createdAt
+func (f *Field) jsonName() string {
+	if j, ok := f.Tags["json"]; ok {
+		if a, _, _ := strings.Cut(j, ","); len(a) > 0 {
+			return a
+		}
+	}
+	return f.Name
+}
+
 func (f *Field) getArgTag() string {
 	if s, ok := f.Tags["form"]; ok {
 		return LcFirst(s)
@@ -405,6 +526,16 @@ func (z Fields) relHasOne() (out Fields) {
 	return
 }
 
+// relHasMany 一对多关联字段，子表通过外键指向本表主键
+func (z Fields) relHasMany() (out Fields) {
+	for i := range z {
+		if n, ok := z[i].relMode(); ok && n == relMasMany {
+			out = append(out, z[i])
+		}
+	}
+	return
+}
+
 func (z Fields) Relations() (out []string) {
 	for i := range z {
 		if _, ok := z[i].relMode(); ok && i > 0 {
@@ -414,6 +545,15 @@ func (z Fields) Relations() (out []string) {
 	return
 }
 
+// jNames 字段名的字面量，用作参数
+func (z Fields) jNames() jen.Code {
+	return jen.ListFunc(func(g *jen.Group) {
+		for i := range z {
+			g.Lit(z[i].Name)
+		}
+	})
+}
+
 func (z Fields) withName(name string) (*Field, bool) {
 	for _, field := range z {
 		if field.Name == name {
@@ -451,6 +591,8 @@ func (f *Field) parseQuery() (q Query, ok bool) {
 		q.sift, ok = "siftGreat", true
 	case "less":
 		q.sift, ok = "siftLess", true
+	case "range":
+		q.sift, ok = "siftRange", true
 	default:
 		q.custom = a == "custom"
 		ok = len(a) > 0 && len(q.ext) > 0
@@ -472,8 +614,11 @@ func (f Field) siftCode(ismg bool) jen.Code {
 		if !ok {
 			return nil
 		}
-		return jen.Id("q").Op("=").Id("mg"+ToExported(f.siftFn)).Call(
-			jen.Id("q"), jen.Lit(cn), jsv)
+		params := []jen.Code{jen.Id("q"), jen.Lit(cn), jsv}
+		if f.siftFn == "siftRange" {
+			params = append(params, jen.Lit(f.isTime), jen.Lit(f.isIntDt))
+		}
+		return jen.Id("q").Op("=").Id("mg"+ToExported(f.siftFn)).Call(params...)
 	}
 	cn, indb, _ := f.ColName()
 	if !indb && len(f.siftFn) == 0 {
@@ -481,7 +626,9 @@ func (f Field) siftCode(ismg bool) jen.Code {
 	}
 	params := []jen.Code{jen.Id("q"), jen.Lit(cn), jsv}
 	cfn := f.siftFn
-	if f.isDate && f.isIntDt {
+	if cfn == "siftRange" {
+		params = append(params, jen.Lit(f.isTime), jen.Lit(f.isIntDt))
+	} else if f.isDate && f.isIntDt {
 		params = append(params, jen.True())
 	}
 	params = append(params, jen.False())
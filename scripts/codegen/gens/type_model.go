@@ -3,6 +3,7 @@ package gens
 
 import (
 	"log"
+	"slices"
 	"sort"
 	"strings"
 
@@ -28,6 +29,11 @@ type Model struct {
 	SpecUp     string   `yaml:"specUp,omitempty"` // spec.{specUp}(ctx,obj) // deprecated
 	Descr      string   `yaml:"descr,omitempty"`
 
+	Uniques [][]string `yaml:"uniques,omitempty"` // 复合唯一键，如 [ParentID, Slug]
+	Cursor  string     `yaml:"cursor,omitempty"`  // 游标分页的排序列，如 -created
+
+	Aggregates *Aggregate `yaml:"aggregates,omitempty"` // 统计的分组与指标
+
 	DiscardUnknown bool `yaml:"discardUnknown,omitempty"` // 忽略未知的列
 	WithCompare    bool `yaml:"withCompare,omitempty"`    // 允许实现比较
 	WithPlural     bool `yaml:"withPlural,omitempty"`     // 允许复数定义
@@ -44,6 +50,12 @@ type Model struct {
 	Bsonable       bool `yaml:"bson,omitempty"`       // for mongodb only
 	RegLoader      bool `yaml:"regLoader,omitempty"`  // 允许注册加载器
 	WithSet        bool `yaml:"withSet,omitempty"`
+	Cache          bool `yaml:"cache,omitempty"`        // Get 时读缓存，写入后清除
+	Outbox         bool `yaml:"outbox,omitempty"`       // 创建、更新、删除时在同一事务中写入变更事件
+	Tenant         bool `yaml:"tenant,omitempty"`       // 按租户隔离，增加 tenant_id 列
+	OwnerOnly      bool `yaml:"ownerOnly,omitempty"`    // 仅所有者可读写，需要 comm.OwnerField
+	Trace          bool `yaml:"trace,omitempty"`        // 存储方法和钩子的跟踪及度量
+	HookRegistry   bool `yaml:"hookRegistry,omitempty"` // 钩子可在运行时注册多个，见 stores.OnHook
 
 	ExportOne  bool `yaml:"export1,omitempty"` // for alias in store
 	ExportMore bool `yaml:"export2,omitempty"` // for alias in store
@@ -145,6 +157,58 @@ func (m *Model) UniqueOne() (u UniField, onlyOne bool) {
 	return
 }
 
+// uniqueKey 复合唯一键
+type uniqueKey struct {
+	Name       string // 字段名连接，如 ParentIDSlug
+	Constraint string // 约束名，如 cms_channel_parent_id_slug_key
+	Fields     Fields
+}
+
+func (m *Model) uniqueKeys() (out []uniqueKey) {
+	for _, names := range m.Uniques {
+		uk := uniqueKey{Constraint: m.tableName()}
+		for _, name := range names {
+			field, ok := m.Fields.withName(name)
+			if !ok {
+				log.Printf("unique of %s: field %s not found", m.Name, name)
+				uk.Fields = nil
+				break
+			}
+			cn, _, _ := field.ColName()
+			uk.Name += field.Name
+			uk.Constraint += "_" + cn
+			uk.Fields = append(uk.Fields, *field)
+		}
+		if len(uk.Fields) > 0 {
+			uk.Constraint += "_key"
+			out = append(out, uk)
+		}
+	}
+	return
+}
+
+func (m *Model) uniqueKey(name string) (uniqueKey, bool) {
+	for _, uk := range m.uniqueKeys() {
+		if uk.Name == name {
+			return uk, true
+		}
+	}
+	return uniqueKey{}, false
+}
+
+// hasUnique 是否有唯一约束，保存时可能冲突
+func (m *Model) hasUnique() bool {
+	if len(m.Uniques) > 0 {
+		return true
+	}
+	for _, field := range m.Fields {
+		if _, _, ok := field.ColName(); ok {
+			return true
+		}
+	}
+	return false
+}
+
 func (m *Model) ChangablCodes() (members []jen.Code, imples []jen.Code, rets []jen.Code) {
 	if m.PreSet {
 		imples = append(imples, jen.Id("z").Dot("PreSet").Call(jen.Op("&").Id("o")))
@@ -322,7 +386,14 @@ func (m *Model) Codes() jen.Code {
 	}).Line()
 
 	mcs, bcs := m.Fields.Codes(basicName, isTable, bsonable)
+	if m.hasBasic() {
+		bcs = append(bcs, m.ownedCodes(false, len(bcs))...)
+	}
 	cs = append(cs, mcs...)
+	if len(m.headlineCols()) > 0 {
+		cs = append(cs, jen.Line().Comment("全文检索的关键词摘要，查询参数 hl 为真时返回").Line().
+			Id("Headline").Map(jen.String()).String().Tag(Tags{"bun": "-", "json": "headline,omitempty", "pg": "-"}))
+	}
 	st.Comment(m.Name + " " + m.Comment).Line()
 	jcodeDesc(st, m.Descr, "@Description ")
 
@@ -338,6 +409,9 @@ func (m *Model) Codes() jen.Code {
 		pname := m.GetPlural()
 		st.Type().Id(pname).Index().Id(m.Name).Line().Line()
 	}
+	if m.hasAggregate() {
+		st.Add(m.statCodes())
+	}
 
 	if jhk := m.hookModelCodes(); jhk != nil {
 		st.Add(jhk)
@@ -367,6 +441,7 @@ func (m *Model) Codes() jen.Code {
 
 	if fields, stmts, rets := m.ChangablCodes(); len(fields) > 0 && (isTable || bsonable || m.WithSet) {
 		changeSetName := m.Name + "Set"
+		fields = append(fields, m.ownedCodes(true, len(fields))...)
 		st.Type().Id(changeSetName).Struct(fields...).Add(jen.Comment("@name " + LcFirst(m.prefix+changeSetName))).Line().Line()
 		// scs = append(scs, jen.Return(jen.Id("z").Dot("CountChange").Call().Op(">0")))
 		st.Func().Params(
@@ -374,6 +449,29 @@ func (m *Model) Codes() jen.Code {
 		).Id("SetWith").Params(jen.Id("o").Id(changeSetName)).Params(rets...).Block(
 			stmts...,
 		).Line()
+		if m.isOwned() {
+			nestedName := m.Name + "Nested"
+			st.Comment(nestedName + " 随主对象保存的" + m.shortComment() + "，有编号的更新，无编号的新建").Line()
+			st.Type().Id(nestedName).Struct(
+				jen.Comment("编号").Line().Id("ID").String().Tag(Tags{"json": "id,omitempty"}),
+				jen.Id(changeSetName),
+			).Add(jen.Comment("@name " + LcFirst(m.prefix+nestedName))).Line().Line()
+		}
+	}
+	if jc := m.roleCodes(withPlual); jc != nil {
+		st.Line().Add(jc)
+	}
+	if jc := m.exportCodes(); jc != nil {
+		st.Add(jc)
+	}
+	if jc := m.importCodes(); jc != nil {
+		st.Add(jc)
+	}
+	if jc := m.indexCodes(); jc != nil {
+		st.Add(jc)
+	}
+	if jc := m.tenantCodes(); jc != nil {
+		st.Add(jc)
 	}
 	if isTable || bsonable {
 		if jc := m.metaAddCodes(); jc != nil {
@@ -398,6 +496,294 @@ func (m *Model) Codes() jen.Code {
 	return st
 }
 
+// exportFields 导出的字段，即有列且可见的非嵌入字段，只用于 bun
+func (m *Model) exportFields() (out Fields) {
+	if !m.canPickFields() {
+		return
+	}
+	for _, f := range m.Fields {
+		if f.isEmbed() {
+			continue
+		}
+		if cn, hascol, _ := f.ColName(); !hascol || len(cn) == 0 || f.jsonName() == "-" {
+			continue
+		}
+		if slices.Contains(f.ReadRoles, "-") {
+			continue
+		}
+		out = append(out, f)
+	}
+	return
+}
+
+// exportCodes 导出的列和取值，表头取字段注释，枚举取其标签
+func (m *Model) exportCodes() jen.Code {
+	if !m.doc.hasStoreMethod("Export" + m.Name) {
+		return nil
+	}
+	fields := m.exportFields()
+	type column struct {
+		key, label string
+		jval       jen.Code
+	}
+	var cols []column
+	_, idf, dtf := m.hasModHook()
+	if len(idf) > 0 {
+		cols = append(cols, column{"id", "编号", jen.Id("z").Dot("StringID").Call()})
+	}
+	if dtf == modelDefault || dtf == modelDunce || dtf == modelSerial || dtf == "DateFields" {
+		cols = append(cols, column{"createdAt", "创建时间", jen.Id("z").Dot("CreatedAt")},
+			column{"updatedAt", "变更时间", jen.Id("z").Dot("UpdatedAt")})
+	}
+	for _, f := range fields {
+		label := columnLabel(f)
+		jval := jen.Id("z").Dot(f.Name)
+		if enum, ok := m.doc.enumWithName(f.Type); ok {
+			if enum.Labeled {
+				jval = jen.Id("z").Dot(f.Name).Dot("Label").Call()
+			} else if enum.Stringer || enum.TextMarshaler {
+				jval = jen.Id("z").Dot(f.Name).Dot("String").Call()
+			}
+		}
+		cols = append(cols, column{f.jsonName(), label, jval})
+	}
+
+	st := jen.Comment("ExportColumns 导出的列，依次为字段名和表头").Line()
+	st.Func().Params(jen.Id("_").Op("*").Id(m.Name)).Id("ExportColumns").Params().Index().Index(jen.Lit(2)).String().Block(
+		jen.Return(jen.Index().Index(jen.Lit(2)).String().ValuesFunc(func(g *jen.Group) {
+			for _, c := range cols {
+				g.Line().Values(jen.Lit(c.key), jen.Lit(c.label))
+			}
+			g.Line()
+		})),
+	).Line().Line()
+	st.Comment("ExportValue 导出的字段值").Line()
+	st.Func().Params(jen.Id("z").Op("*").Id(m.Name)).Id("ExportValue").Params(jen.Id("k").String()).Any().BlockFunc(func(g *jen.Group) {
+		g.Switch(jen.Id("k")).BlockFunc(func(g1 *jen.Group) {
+			for _, c := range cols {
+				g1.Case(jen.Lit(c.key)).Return(c.jval)
+			}
+		})
+		g.Return(jen.Nil())
+	}).Line().Line()
+	return st
+}
+
+// indexType 字段在搜索索引中的类型，全文检索的字串为 text
+func (f *Field) indexType() string {
+	if f.mod != nil {
+		if enum, ok := f.mod.doc.enumWithName(f.Type); ok && (enum.Stringer || enum.TextMarshaler) {
+			return "keyword"
+		}
+	}
+	switch f.filterKind() {
+	case "FilterOID":
+		return "keyword"
+	case "FilterDateTime", "FilterTime":
+		return "date"
+	case "FilterString":
+		if strings.Contains(f.Query, "fts") || strings.Contains(f.Query, "match") {
+			return "text"
+		}
+		return "keyword"
+	case "FilterBool":
+		return "boolean"
+	case "FilterInt":
+		return "long"
+	case "FilterFloat":
+		return "double"
+	}
+	if f.Type == "[]string" || f.Type == "oid.OIDs" {
+		return "keyword"
+	}
+	return "object"
+}
+
+// indexCodes 搜索索引的字段映射，用于有 upsertES 钩子的模型
+func (m *Model) indexCodes() jen.Code {
+	if !m.IsTable() || !m.hasAnyStoreHook(upsertES, deleteES) {
+		return nil
+	}
+	var props [][2]string
+	_, idf, dtf := m.hasModHook()
+	if len(idf) > 0 {
+		props = append(props, [2]string{"id", "keyword"})
+	}
+	if dtf == modelDefault || dtf == modelDunce || dtf == modelSerial || dtf == "DateFields" {
+		props = append(props, [2]string{"createdAt", "date"}, [2]string{"updatedAt", "date"})
+	}
+	for _, f := range m.Fields {
+		if f.isEmbed() || f.jsonName() == "-" || slices.Contains(f.ReadRoles, "-") {
+			continue
+		}
+		if cn, hascol, _ := f.ColName(); !hascol || len(cn) == 0 {
+			continue
+		}
+		props = append(props, [2]string{f.jsonName(), f.indexType()})
+	}
+
+	st := jen.Comment("IndexMapping 搜索索引的字段类型，键为 json 字段名").Line()
+	st.Func().Params(jen.Id("_").Op("*").Id(m.Name)).Id("IndexMapping").Params().Map(jen.String()).String().Block(
+		jen.Return(jen.Map(jen.String()).String().Values(jen.DictFunc(func(d jen.Dict) {
+			for _, p := range props {
+				d[jen.Lit(p[0])] = jen.Lit(p[1])
+			}
+		}))),
+	).Line().Line()
+	return st
+}
+
+// tenantCodes 租户编号的读写方法，供存储层隔离租户
+func (m *Model) tenantCodes() jen.Code {
+	if !m.canTenant() {
+		return nil
+	}
+	joid := jen.Qual("github.com/cupogo/andvari/models/oid", "OID")
+	st := jen.Func().Params(jen.Id("z").Op("*").Id(m.Name)).Id("GetTenantID").Params().Add(joid).Block(
+		jen.Return(jen.Id("z").Dot("TenantID")),
+	).Line().Line()
+	st.Func().Params(jen.Id("z").Op("*").Id(m.Name)).Id("SetTenantID").Params(jen.Id("id").Add(joid)).Block(
+		jen.Id("z").Dot("TenantID").Op("=").Id("id"),
+	).Line().Line()
+	return st
+}
+
+// columnLabel 导出导入时的表头，取字段注释
+func columnLabel(f Field) string {
+	if label := strings.TrimRight(f.shortComment(), ":："); len(label) > 0 {
+		return label
+	}
+	return f.Name
+}
+
+// importFields 导入的字段，即有列的基本字段
+func (m *Model) importFields() (out Fields) {
+	for _, f := range m.Fields {
+		if !(f.IsBasic || f.IsSet) || f.isEmbed() {
+			continue
+		}
+		if cn, hascol, _ := f.ColName(); !hascol || len(cn) == 0 || f.jsonName() == "-" {
+			continue
+		}
+		out = append(out, f)
+	}
+	return
+}
+
+// canBulk 可批量写入，需要编号和 bun 的表；单一唯一键或 forceCreate 的按冲突更新，不能多行写入
+func (m *Model) canBulk() bool {
+	_, idf, _ := m.hasModHook()
+	_, isuniq := m.UniqueOne()
+	return len(idf) > 0 && m.IsTable() && !isuniq && !m.ForceCreate && !m.IsBsonable() && !m.doc.IsPG10()
+}
+
+// canImport 可批量导入，逐条创建时需要事务
+func (m *Model) canImport() bool {
+	_, idf, _ := m.hasModHook()
+	return len(idf) > 0 && !m.IsBsonable() && !m.doc.IsPG10() && len(m.importFields()) > 0
+}
+
+// importCodes 导入的列，表头与导出一致
+func (m *Model) importCodes() jen.Code {
+	if !m.doc.hasStoreMethod("Import"+m.Name) || !m.canImport() {
+		return nil
+	}
+	st := jen.Comment("ImportColumns 导入的列，依次为字段名和表头").Line()
+	st.Func().Params(jen.Id("_").Op("*").Id(m.Name + "Basic")).Id("ImportColumns").Params().Index().Index(jen.Lit(2)).String().Block(
+		jen.Return(jen.Index().Index(jen.Lit(2)).String().ValuesFunc(func(g *jen.Group) {
+			for _, f := range m.importFields() {
+				g.Line().Values(jen.Lit(f.jsonName()), jen.Lit(columnLabel(f)))
+			}
+			g.Line()
+		})),
+	).Line().Line()
+	return st
+}
+
+// hasReadRoles 有按角色限制可见的字段
+func (m *Model) hasReadRoles() bool {
+	for _, field := range m.Fields {
+		if !field.isEmbed() && len(field.ReadRoles) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// roleCodes 按角色隐去不可见字段，检查无权写入的字段
+func (m *Model) roleCodes(withPlural bool) jen.Code {
+	var reads, basics, sets Fields
+	for _, field := range m.Fields {
+		if field.isEmbed() {
+			continue
+		}
+		if len(field.ReadRoles) > 0 {
+			reads = append(reads, field)
+		}
+		if len(field.WriteRoles) > 0 {
+			if field.IsBasic || field.IsSet {
+				basics = append(basics, field)
+			}
+			if field.IsSet {
+				sets = append(sets, field)
+			}
+		}
+	}
+	if len(reads) == 0 && len(basics) == 0 {
+		return nil
+	}
+	st := jen.Empty()
+	if len(reads) > 0 {
+		st.Comment("RedactFor 隐去角色不可见的字段").Line()
+		st.Func().Params(jen.Id("z").Op("*").Id(m.Name)).Id("RedactFor").
+			Params(jen.Id("roles").Op("...").String()).BlockFunc(func(g *jen.Group) {
+			for _, field := range reads {
+				jset := jen.Id("z").Dot(field.Name).Op("=").Add(field.zeroCode())
+				if jcond := jroleDenied(field.ReadRoles); jcond != nil {
+					g.If(jcond).Block(jset)
+				} else {
+					g.Add(jset)
+				}
+			}
+		}).Line().Line()
+		if withPlural {
+			st.Func().Params(jen.Id("z").Id(m.GetPlural())).Id("RedactFor").
+				Params(jen.Id("roles").Op("...").String()).Block(
+				jen.For(jen.Id("i").Op(":=").Range().Id("z")).Block(
+					jen.Id("z").Index(jen.Id("i")).Dot("RedactFor").Call(jen.Id("roles").Op("...")),
+				),
+			).Line()
+		}
+	}
+	utilsQual, _ := m.doc.getQual("utils")
+	jdenied := func(name string, fields Fields, isSet bool) {
+		st.Comment("DeniedField 返回角色无权写入的字段名，为空表示允许").Line()
+		st.Func().Params(jen.Id("o").Id(name)).Id("DeniedField").
+			Params(jen.Id("roles").Op("...").String()).String().BlockFunc(func(g *jen.Group) {
+			for _, field := range fields {
+				var jcond *jen.Statement
+				if isSet {
+					jcond = jen.Id("o").Dot(field.Name).Op("!=").Nil()
+				} else {
+					jcond = jen.Op("!").Qual(utilsQual, "IsZero").Call(jen.Id("o").Dot(field.Name))
+				}
+				if jc := jroleDenied(field.WriteRoles); jc != nil {
+					jcond.Op("&&").Add(jc)
+				}
+				g.If(jcond).Block(jen.Return(jen.Lit(field.getArgTag())))
+			}
+			g.Return(jen.Lit(""))
+		}).Line()
+	}
+	if len(basics) > 0 && m.hasBasic() && (m.IsTable() || m.IsBsonable()) {
+		jdenied(m.Name+"Basic", basics, false)
+	}
+	if len(sets) > 0 && (m.IsTable() || m.IsBsonable() || m.WithSet) {
+		jdenied(m.Name+"Set", sets, true)
+	}
+	return st
+}
+
 func (m *Model) hasBasic() bool {
 	for i := range m.Fields {
 		if m.Fields[i].IsBasic || m.Fields[i].IsSet {
@@ -463,6 +849,137 @@ func (mod *Model) IsTable() bool {
 	return false
 }
 
+// canCache Get 可读缓存，需要编号
+func (m *Model) canCache() bool {
+	_, idf, _ := m.hasModHook()
+	return m.Cache && len(idf) > 0 && !m.IsBsonable() && !m.doc.IsPG10()
+}
+
+// jcacheDel 清除编号为 jid 的缓存
+func (m *Model) jcacheDel(jid jen.Code) jen.Code {
+	return jen.Id("cacheDel").Types(jen.Qual(m.getIPath(), m.Name)).Call(
+		jen.Id("ctx"), jen.Id("s").Dot("w"), jen.Lit(m.tableName()), jid)
+}
+
+// canOutbox 可写入变更事件，需要编号和事务
+func (m *Model) canOutbox() bool {
+	_, idf, _ := m.hasModHook()
+	return m.Outbox && len(idf) > 0 && !m.IsBsonable() && !m.doc.IsPG10()
+}
+
+// canTenant 按租户隔离，文档或模型开启，需要编号和表
+func (m *Model) canTenant() bool {
+	if !m.Tenant && !m.doc.Tenant {
+		return false
+	}
+	_, idf, _ := m.hasModHook()
+	_, isuniq := m.UniqueOne()
+	return len(idf) > 0 && m.IsTable() && !isuniq && !m.IsBsonable() && !m.doc.IsPG10()
+}
+
+// tenantField 租户编号的字段，由 init 加在模型的字段之后
+func (m *Model) tenantField() Field {
+	return Field{
+		Name: "TenantID", Type: "oid.OID", Qual: "github.com/cupogo/andvari/models/oid",
+		Tags:    Tags{"json": "tenantID", "pg": "tenant_id,notnull"},
+		Comment: "租户编号", mod: m,
+	}
+}
+
+// canOwnerOnly 仅所有者可读写，需要所有者字段和表
+func (m *Model) canOwnerOnly() bool {
+	if !m.OwnerOnly || !m.IsTable() || m.IsBsonable() || m.doc.IsPG10() {
+		return false
+	}
+	for _, f := range m.Fields {
+		if f.isOwner() {
+			return true
+		}
+	}
+	return false
+}
+
+// canTrace 存储方法和钩子的跟踪，文档或模型开启
+func (m *Model) canTrace() bool {
+	return m.Trace || m.doc.Trace
+}
+
+// codeTraceStart 开始存储方法的跟踪，需要命名的返回值 err
+func (m *Model) codeTraceStart(g *jen.Group, action string) {
+	if !m.canTrace() {
+		return
+	}
+	g.List(jen.Id("ctx"), jen.Id("ts")).Op(":=").Id("traceStart").Call(jen.Id("ctx"), jen.Lit(m.Name), jen.Lit(action))
+	g.Defer().Func().Params().Block(jen.Id("ts").Dot("End").Call(jen.Id("ctx"), jen.Err())).Call()
+}
+
+// jErrRet 仅返回错误时的返回值，跟踪时命名为 err
+func (m *Model) jErrRet() jen.Code {
+	if m.canTrace() {
+		return jen.Err().Error()
+	}
+	return jen.Error()
+}
+
+// jHook 调用钩子 fn，首个参数为 ctx，跟踪时包在钩子的跟踪中
+func (m *Model) jHook(hk storeHook, fn jen.Code, args ...jen.Code) jen.Code {
+	if hk.reg {
+		fn, args = hk.jRegCall(fn, args)
+	}
+	args = append([]jen.Code{jen.Id("ctx")}, args...)
+	if !m.canTrace() {
+		return jen.Add(fn).Call(args...)
+	}
+	return jen.Id("traceHook").Call(jen.Id("ctx"), jen.Lit(m.Name), jen.Lit(hk.k),
+		jen.Func().Params(jactx).Error().Block(jen.Return(jen.Add(fn).Call(args...))))
+}
+
+// jAfterCommit 依次调用提交后的钩子，在 InTx 中时待最外层事务提交后再调用，见 Wrap.afterCommit
+func (m *Model) jAfterCommit(calls ...jen.Code) jen.Code {
+	return jen.Id("s").Dot("w").Dot("afterCommit").Call(jen.Id("ctx"), jen.Lit(m.Name),
+		jen.Func().Params(jactx).Error().BlockFunc(func(g *jen.Group) {
+			for _, c := range calls[:len(calls)-1] {
+				g.If(jen.Err().Op(":=").Add(c).Op(";").Err().Op("!=").Nil()).Block(jen.Return(jen.Err()))
+			}
+			g.Return(calls[len(calls)-1])
+		}))
+}
+
+// esByOutbox 搜索索引由变更事件同步，出错时按变更事件退避重试，见 registerOutboxIndex
+func (m *Model) esByOutbox() bool {
+	return m.canOutbox() && m.hasAnyStoreHook(upsertES, deleteES)
+}
+
+// jDoneHooks 写入提交后对 obj 调用的 hn 和 hes 钩子，搜索索引由变更事件同步时不调用 hes
+func (m *Model) jDoneHooks(obj string, hn, hes string) (calls []jen.Code) {
+	for _, name := range []string{hn, hes} {
+		if name == hes && m.esByOutbox() {
+			continue
+		}
+		if hk, ok := m.hasStoreHook(name); ok {
+			calls = append(calls, m.jHook(hk, jen.Id("s").Dot(hk.FunName), jen.Id(obj)))
+		}
+	}
+	return
+}
+
+// fnGetPK 按编号读取的函数，租户隔离时限定在上下文的租户内
+func (m *Model) fnGetPK() string {
+	if m.canTenant() {
+		return "dbGetWithTenant"
+	}
+	return "dbGetWithPKID"
+}
+
+// jOutbox 在事务 jdb 中写入 obj 的变更事件
+func (m *Model) jOutbox(jdb jen.Code, obj string, action string) jen.Code {
+	jcv := jen.Nil()
+	if action == "OutboxUpdate" {
+		jcv = jen.Id(obj).Dot("ChangedValues").Call()
+	}
+	return jen.Id("dbOutbox").Call(jen.Id("ctx"), jdb, jen.Lit(m.Name), jen.Id(obj).Dot("StringID").Call(), jen.Id(action), jcv)
+}
+
 func (m *Model) IsBsonable() bool {
 	return m.Bsonable || len(m.CollName) > 0
 }
@@ -570,7 +1087,15 @@ func (m *Model) specFields() (out Fields) {
 			} else if q.ext == "hasVals" {
 				f.Comment += " (多值数字相加)"
 			}
-			if f.Type == "oid.OID" {
+			if q.sift == "siftRange" {
+				f.isTime = strings.HasSuffix(f.Type, "Time")
+				f.isIntDt = strings.HasSuffix(f.Type, "DateTime")
+				f.Type = "string"
+				f.siftFn = q.sift
+				f.Tags = f.Tags.Clone()
+				delete(f.Tags, TagSwaggerType)
+				f.Comment += " (范围 min~max，可省略一端，以 ( ) 包围表示不含边界)"
+			} else if f.Type == "oid.OID" {
 				f.Type = "string"
 				f.isOid = true
 				if q.sift == "siftOIDs" {
@@ -637,22 +1162,112 @@ func (m *Model) specFields() (out Fields) {
 	return
 }
 
-func (m *Model) sortableColumns() (cs []string) {
+// sortableFields 可排序的字段，依次为 json 名和列名
+func (m *Model) sortableFields() (out [][2]string) {
 	for _, f := range m.Fields {
 		if f.isEmbed() {
 			if f.isOwner() && f.Sortable {
-				cs = append(cs, "owner_id")
+				out = append(out, [2]string{"owner", "owner_id"})
 			}
 			continue
 		}
 
 		if cn, ok, _ := f.ColName(); ok && len(cn) > 0 && f.Sortable {
-			cs = append(cs, cn)
+			out = append(out, [2]string{f.jsonName(), cn})
+		}
+	}
+	return
+}
+
+func (m *Model) sortableColumns() (cs []string) {
+	for _, p := range m.sortableFields() {
+		cs = append(cs, p[1])
+	}
+	return
+}
+
+// sortKeys 可排序的全部字段的 json 名，含默认的 id,created,updated，只用于 pg 和 bun
+func (m *Model) sortKeys() []string {
+	if m.IsBsonable() || m.doc.IsMongo() {
+		return nil
+	}
+	keys := []string{"id", "created", "updated"}
+	for _, p := range m.sortableFields() {
+		keys = append(keys, p[0])
+	}
+	return keys
+}
+
+// sortAliases 与列名不同的可排序字段，依次为 json 名和列名
+func (m *Model) sortAliases() (out []jen.Code) {
+	for _, p := range m.sortableFields() {
+		if p[0] != p[1] {
+			out = append(out, jen.Lit(p[0]), jen.Lit(p[1]))
+		}
+	}
+	return
+}
+
+// canPickFields 可按 fields 参数选择列并裁剪输出，只用于 bun
+func (m *Model) canPickFields() bool {
+	return m.IsTable() && !m.IsBsonable() && !m.doc.IsMongo() && !m.doc.IsPG10()
+}
+
+// filterFields 可用于 filter 参数的字段，即有查询定义的列
+func (m *Model) filterFields() (out Fields) {
+	if !m.canPickFields() {
+		return
+	}
+	for _, f := range m.Fields {
+		if f.isEmbed() {
+			continue
+		}
+		q, ok := f.parseQuery()
+		if cn, hascol, _ := f.ColName(); !ok || q.custom || !hascol || len(cn) == 0 {
+			continue
+		}
+		if len(f.filterKind()) > 0 {
+			out = append(out, f)
+		}
+	}
+	return
+}
+
+// facetFields 可分面计数的字段，取值应为有限的标量，只用于 bun
+func (m *Model) facetFields() (out Fields) {
+	if m.IsBsonable() || m.doc.IsPG10() {
+		return
+	}
+	for _, f := range m.Fields {
+		if !f.IsFacet || f.isEmbed() {
+			continue
+		}
+		if cn, hascol, _ := f.ColName(); !hascol || len(cn) == 0 {
+			continue
+		}
+		switch f.filterKind() {
+		case "FilterString", "FilterInt", "FilterBool", "FilterOID":
+			out = append(out, f)
+		default:
+			log.Printf("WARN: facet field %s.%s is not a scalar", m.Name, f.Name)
 		}
 	}
 	return
 }
 
+// jsortField 覆盖 PageSpec.Sort，在文档中列出可用的值
+func (m *Model) jsortField(cols []string) jen.Code {
+	var enums []string
+	for _, c := range cols {
+		enums = append(enums, c, "-"+c)
+	}
+	return jen.Comment("排序，多个以逗号分隔，前缀 - 表示倒序，如 -created,id").Line().
+		Id("Sort").String().Tag(map[string]string{
+		"json": "sort,omitempty", "form": "sort", "extensions": "x-order=|",
+		TagSwaggerType: "array,string", "collectionFormat": "csv", "enums": strings.Join(enums, ","),
+	})
+}
+
 func (m *Model) getExportName(ss ...string) string {
 	return getExportName(m.Name, m.SpecNs, ss...)
 }
@@ -776,20 +1391,65 @@ func (m *Model) getSpecCodes() jen.Code {
 	if m.hasAudit() {
 		fcs = append(fcs, jen.Id("AuditSpec"))
 	}
+	if m.canTenant() {
+		fcs = append(fcs, jen.Id("TenantSpec"))
+	}
+	if m.canOwnerOnly() {
+		fcs = append(fcs, jen.Id("OwnerSpec"))
+	}
 	for _, sifter := range m.Sifters {
 		fcs = append(fcs, jen.Id(sifter))
 	}
 	colTS, okTS := m.HasTextSearch()
-	if okTS || len(colTS) > 0 {
+	if m.hasTsRank() {
+		fcs = append(fcs, jen.Id("TsRankSpec"))
+	} else if okTS || len(colTS) > 0 {
 		fcs = append(fcs, jen.Id("TextSearchSpec"))
 	}
-
-	var idx int
-	specFields := m.specFields()
-	if len(specFields) > 0 {
-		// log.Printf("specFields: %+v", specFields)
-		fcs = append(fcs, jen.Empty())
-		for _, field := range specFields {
+	if _, _, ok := m.cursorKey(); ok {
+		fcs = append(fcs, jen.Id("CursorSpec"))
+	}
+	withSift := len(fcs) > 2
+	sortCols := m.sortKeys()
+	if len(sortCols) > 0 {
+		fcs = append(fcs, jen.Empty(), m.jsortField(sortCols))
+	}
+	filterFields := m.filterFields()
+	if len(filterFields) > 0 {
+		var keys []string
+		for _, f := range filterFields {
+			keys = append(keys, f.getArgTag())
+		}
+		fcs = append(fcs, jen.Comment("过滤条件，子句以分号分隔，格式 key:op:value，如 "+keys[0]+":eq:x").Line().
+			Comment("可用的字段: "+strings.Join(keys, ",")+"; op: eq,ne,in,like,gt,gte,lt,lte").Line().
+			Id("Filter").String().Tag(map[string]string{
+			"json": "filter,omitempty", "form": "filter", "extensions": "x-order=~",
+		}))
+	}
+	if m.canPickFields() {
+		fcs = append(fcs, jen.Comment("返回的字段，多个以逗号分隔，省略时为全部").Line().
+			Id("Fields").String().Tag(map[string]string{
+			"json": "fields,omitempty", "form": "fields", "extensions": "x-order=~",
+		}))
+	}
+	facetFields := m.facetFields()
+	if len(facetFields) > 0 {
+		var keys []string
+		for _, f := range facetFields {
+			keys = append(keys, f.getArgTag())
+		}
+		fcs = append(fcs, jen.Comment("是否返回分面计数，字段: "+strings.Join(keys, ",")).Line().
+			Id("Facets").Bool().Tag(map[string]string{
+			"json": "facets,omitempty", "form": "facets", "extensions": "x-order=~",
+		}))
+	}
+
+	var idx int
+	specFields := m.specFields()
+	if len(specFields) > 0 {
+		// log.Printf("specFields: %+v", specFields)
+		fcs = append(fcs, jen.Empty())
+		for _, field := range specFields {
 			fcs = append(fcs, field.queryCode(idx, m.doc.getModQual(field.getType())))
 			idx++
 		}
@@ -797,8 +1457,7 @@ func (m *Model) getSpecCodes() jen.Code {
 	}
 
 	withRel := "WithRel"
-	_, okAL := m.hasStoreHook(afterList)
-	relFields := m.Fields.relHasOne()
+	relFields := m.specRelFields()
 	relations := m.Fields.Relations()
 	if len(relFields) > 0 || len(relations) > 0 {
 		jtag := "rel"
@@ -818,47 +1477,54 @@ func (m *Model) getSpecCodes() jen.Code {
 	}
 
 	st := jen.Type().Id(tname).Struct(fcs...).Line()
-	if len(fcs) > 2 {
+	if withSift || idx > 0 {
 		isPG10 := m.doc.IsPG10()
 		st.Func().Params(jen.Id("spec").Op("*").Id(tname)).Id("Sift").Params(args...).Params(rets...)
 		st.BlockFunc(func(g *jen.Group) {
 			// if m.IsBsonable() || m.doc.IsMongo() {
 			// 	g.Var().Id("qd").Id("BD")
 			// }
-			if len(relFields) > 0 && !okAL {
-
-				if len(relFields) == 1 {
-					g.If(jen.Id("spec").Dot(withRel).Op("==").Lit("1").Op("||").Id("spec").Dot(withRel).Op("==").Lit(relFields[0].Name)).Block(
-						jen.Id("q").Dot("Relation").Call(jen.Lit(relFields[0].Name)),
-					)
-				} else {
-					jcond := jen.Len(jen.Id("spec").Dot(withRel)).Op(">0")
-					jrels := make([]jen.Code, len(relFields))
-					for i, relField := range relFields {
-						jrels[i] = jen.Lit(relField.Name)
+			if len(relFields) > 0 {
+				// 按租户隔离的一对多子记录也加上租户的条件
+				var tenantRels []string
+				for _, rf := range m.relHasManyLoad() {
+					if m.relTenant(rf) {
+						tenantRels = append(tenantRels, rf.Name)
 					}
-					g.If(jcond).BlockFunc(func(g2 *jen.Group) {
-						g2.For(jen.Id("_,rel").Op(":=").Range().Qual("strings", "Split").Call(jen.Id("spec").Dot(withRel), jen.Lit(","))).BlockFunc(func(g3 *jen.Group) {
-							g3.Switch(jen.Id("rel")).BlockFunc(func(gs *jen.Group) {
-								gs.Case(jrels...).Block(
-									jen.Id("q").Dot("Relation").Call(jen.Id("rel")),
-								)
-							})
-						})
-					})
-
-					// g.Switch(jen.Id("spec").Dot(withRel)).BlockFunc(func(gs *jen.Group) {
-					// 	for _, relField := range relFields {
-					// 		gs.Case(jen.Lit(relField.Name)).Block(
-					// 			jen.Id("q").Dot("Relation").Call(jen.Lit(relField.Name)),
-					// 		)
-					// 	}
-					// })
-
 				}
+				var jrels, jtrels []jen.Code
+				for _, relField := range relFields {
+					if slices.Contains(tenantRels, relField.Name) {
+						jtrels = append(jtrels, jen.Lit(relField.Name))
+					} else {
+						jrels = append(jrels, jen.Lit(relField.Name))
+					}
+				}
+				// 已由接口经 ParseRelations 检查，此处忽略无效的
+				g.List(jen.Id("rels"), jen.Id("_")).Op(":=").Id("ParseRelations").Call(jen.Id("spec").Dot(withRel), relFields.jNames())
+				g.For(jen.Id("_,rel").Op(":=").Range().Id("rels")).BlockFunc(func(g3 *jen.Group) {
+					g3.Switch(jen.Id("rel")).BlockFunc(func(gs *jen.Group) {
+						if len(jrels) > 0 {
+							gs.Case(jrels...).Block(
+								jen.Id("q").Dot("Relation").Call(jen.Id("rel")),
+							)
+						}
+						if len(jtrels) > 0 {
+							gs.Case(jtrels...).Block(
+								jen.Id("q").Dot("Relation").Call(jen.Id("rel"), jen.Id("spec").Dot("TenantSpec").Dot("Sift")),
+							)
+						}
+					})
+				})
 				g.Line()
 			}
 			g.Add(jfSiftCall("ModelSpec"))
+			if m.canTenant() {
+				g.Add(jfSiftCall("TenantSpec"))
+			}
+			if m.canOwnerOnly() {
+				g.Add(jfSiftCall("OwnerSpec"))
+			}
 
 			if m.hasAudit() {
 				g.Add(jfSiftCall("AuditSpec"))
@@ -880,11 +1546,17 @@ func (m *Model) getSpecCodes() jen.Code {
 				}
 
 			}
+			if len(filterFields) > 0 {
+				g.Id("q").Op("=").Id("siftFilter").Call(jen.Id("q"), jen.Id("spec").Dot("Filter"), jen.Id("spec"))
+			}
 			if okTS || len(colTS) > 0 {
 				// g.Add(jfSiftCall("TextSearchSpec"))
 				g.Id("q").Op("=").Id("spec").Dot("TextSearchSpec").Dot("SiftTS").Call(
 					jen.Id("q"), jen.Op("!spec").Dot("HasColumn").Call())
 			}
+			if m.hasTsRank() {
+				g.Id("q").Op("=").Id("spec").Dot("SiftRank").Call(jen.Id("q"), jen.Id("spec").Dot("GetSort").Call())
+			}
 			g.Line()
 
 			if isPG10 {
@@ -896,6 +1568,67 @@ func (m *Model) getSpecCodes() jen.Code {
 		}).Line()
 	}
 
+	if len(sortCols) > 0 {
+		if alias := m.sortAliases(); len(alias) > 0 {
+			st.Comment("GetSort 排序参数，其中的 json 名换为列名").Line()
+			st.Func().Params(jen.Id("spec").Op("*").Id(tname)).Id("GetSort").Params().String().Block(
+				jen.Return(jen.Id("sortColumns").Call(append([]jen.Code{jen.Id("spec").Dot("Sort")}, alias...)...)),
+			).Line()
+		} else {
+			st.Func().Params(jen.Id("spec").Op("*").Id(tname)).Id("GetSort").Params().String().Block(
+				jen.Return(jen.Id("spec").Dot("Sort")),
+			).Line()
+		}
+	}
+
+	if len(filterFields) > 0 {
+		st.Func().Params(jen.Id("spec").Op("*").Id(tname)).Id("CanFilter").Params(jen.Id("k").String()).Params(jen.Id("FilterField"), jen.Bool())
+		st.BlockFunc(func(g *jen.Group) {
+			g.Switch(jen.Id("k")).BlockFunc(func(g1 *jen.Group) {
+				for _, f := range filterFields {
+					cn, _, _ := f.ColName()
+					g1.Case(jen.Lit(f.getArgTag())).Return(jen.Id("FilterField").Values(jen.Lit(cn), jen.Id(f.filterKind())), jen.True())
+				}
+			})
+			g.Return(jen.Id("FilterField").Values(), jen.False())
+		}).Line()
+	}
+
+	if len(facetFields) > 0 {
+		st.Comment("facetSift 去掉分面字段自身条件的查询条件").Line()
+		st.Func().Params(jen.Id("spec").Op("*").Id(tname)).Id("facetSift").Params(jen.Id("key").String()).Func().Params(jen.Op("*").Id("ormQuery")).Op("*").Id("ormQuery")
+		st.BlockFunc(func(g *jen.Group) {
+			g.Var().Id("zero").Id(tname)
+			g.Id("sp").Op(":=").Op("*").Id("spec")
+			if len(filterFields) > 0 {
+				g.Id("sp").Dot("Filter").Op("=").Id("dropFilter").Call(jen.Id("sp").Dot("Filter"), jen.Id("key"))
+			}
+			if m.hasTsRank() {
+				g.Id("sp").Dot("SetTsRank").Call(jen.False())
+			}
+			g.Switch(jen.Id("key")).BlockFunc(func(g1 *jen.Group) {
+				for _, f := range facetFields {
+					var names []string
+					for _, sf := range specFields {
+						if sf.Name == f.Name || (sf.multable && sf.Name == Plural(f.Name)) {
+							names = append(names, sf.Name)
+						}
+					}
+					if len(names) == 0 {
+						continue
+					}
+					jl, jr := make([]jen.Code, len(names)), make([]jen.Code, len(names))
+					for i, name := range names {
+						jl[i] = jen.Id("sp").Dot(name)
+						jr[i] = jen.Id("zero").Dot(name)
+					}
+					g1.Case(jen.Lit(f.getArgTag())).Block(jen.List(jl...).Op("=").List(jr...))
+				}
+			})
+			g.Return(jen.Id("sp").Dot("Sift"))
+		}).Line()
+	}
+
 	if cols := m.sortableColumns(); len(cols) > 0 {
 		log.Printf("sortable: %+v", cols)
 		st.Func().Params(jen.Id("spec").Op("*").Id(tname)).Id("CanSort").Params(jen.Id("k").Id("string")).Bool()
@@ -914,7 +1647,44 @@ func (m *Model) getSpecCodes() jen.Code {
 	return st
 }
 
+// hookEvents 可在运行时注册的钩子及依次分发的事件，创建和更新时含保存的
+var hookEvents = map[string][]string{
+	beforeSaving:   {beforeSaving},
+	afterSaving:    {afterSaving},
+	beforeCreating: {beforeCreating, beforeSaving},
+	afterCreating:  {afterCreating, afterSaving},
+	beforeUpdating: {beforeUpdating, beforeSaving},
+	afterUpdating:  {afterUpdating, afterSaving},
+	beforeDeleting: {beforeDeleting},
+	afterDeleting:  {afterDeleting},
+	afterCreated:   {afterCreated},
+	afterUpdated:   {afterUpdated},
+	afterDeleted:   {afterDeleted},
+	afterLoad:      {afterLoad},
+}
+
+// canHookRegistry 钩子可在运行时注册，需要表
+func (m *Model) canHookRegistry() bool {
+	return m.HookRegistry && m.IsTable() && !m.IsBsonable() && !m.doc.IsPG10()
+}
+
+// hasStoreHook 模型的钩子，可注册时总是有，由 runTxHooks 或 runHooks 分发
 func (m *Model) hasStoreHook(k string) (sh storeHook, ok bool) {
+	if evs, isReg := hookEvents[k]; isReg && m.canHookRegistry() {
+		sh = storeHook{k: k, reg: true, evs: evs}
+		for _, ev := range evs { // 同未注册时，创建和更新的优先于保存的
+			if hk, ok := m.definedHook(ev); ok {
+				sh.FunName = hk.FunName
+				break
+			}
+		}
+		return sh, true
+	}
+	return m.definedHook(k)
+}
+
+// definedHook 在 hooks 中定义的钩子
+func (m *Model) definedHook(k string) (sh storeHook, ok bool) {
 	var v string
 	if v, ok = m.StoHooks[k]; ok {
 		sh, ok = ParseHook(m.Name, m.HookNs, k, v)
@@ -997,6 +1767,29 @@ func createdUpCode(idx int) jen.Code {
 	return code
 }
 
+// hasTsRank 全文检索可按相关度排序，只用于 bun
+func (m *Model) hasTsRank() bool {
+	_, ok := m.HasTextSearch()
+	return ok && !m.doc.IsPG10()
+}
+
+// headlineCols 可返回摘要的全文检索列，依次为列名和摘要的键
+func (m *Model) headlineCols() (out [][2]string) {
+	if !m.hasTsRank() {
+		return
+	}
+	if _, ok := m.jcursorField("id"); !ok {
+		return
+	}
+	for _, field := range m.Fields {
+		if strings.HasSuffix(field.Query, "fts") {
+			cn, _, _ := field.ColName()
+			out = append(out, [2]string{cn, field.jsonName()})
+		}
+	}
+	return
+}
+
 func (m *Model) HasTextSearch() (cols []string, ok bool) {
 	if m.IsBsonable() {
 		return
@@ -1091,10 +1884,405 @@ func (m *Model) jvdbcall(c rune) (db jen.Code, cn string, isBson bool) {
 		if s, ok := methodsPGx[c]; ok {
 			cn = s
 		}
+		if (c == 'L' || c == 'G') && m.canReplica() { // 由 codeReadDB 声明
+			db = jen.Id("db")
+			if c == 'L' {
+				cn = "db.ListModel"
+			}
+		}
+	}
+	return
+}
+
+// canReplica 事务外的读取可使用从库，仅适用于 bun；读缓存的仍读主库，以免缓存从库的旧数据
+func (m *Model) canReplica() bool {
+	return !m.IsBsonable() && !m.doc.IsPG10() && !m.canCache()
+}
+
+// codeReadDB 声明读取使用的数据库 db，见 Wrap.rdb
+func (m *Model) codeReadDB(g *jen.Group) {
+	if m.canReplica() {
+		g.Id("db").Op(":=").Id("s").Dot("w").Dot("rdb").Call(jen.Id("ctx"))
+	}
+}
+
+// cursorKey 游标分页的排序列，仅支持 pgx 的表
+func (m *Model) cursorKey() (col string, desc bool, ok bool) {
+	if len(m.Cursor) == 0 || !m.IsTable() || m.IsBsonable() || m.doc.IsPG10() {
+		return
+	}
+	col, desc = strings.TrimPrefix(m.Cursor, "-"), strings.HasPrefix(m.Cursor, "-")
+	_, ok = m.jcursorField(col)
+	return
+}
+
+// jcursorField 记录中排序列或主键的值，编号类型转为整数以便编码
+func (m *Model) jcursorField(col string) (jen.Code, bool) {
+	_, idf, dtf := m.hasModHook()
+	switch {
+	case col == "id":
+		if idf == modelDefault || idf == "IDField" {
+			return jen.Int64().Call(jen.Id("o").Dot("ID")), true
+		}
+		return jen.Id("o").Dot("ID"), true
+	case col == "created" && (dtf == modelDefault || dtf == modelDunce || dtf == "DateFields"):
+		return jen.Id("o").Dot("CreatedAt"), true
+	}
+	for _, field := range m.Fields {
+		if cn, ok, _ := field.ColName(); ok && cn == col {
+			qn, typ, isptr := field.cutType()
+			if isptr {
+				break
+			}
+			if (qn == "oid" && typ == "OID") || strings.HasSuffix(typ, "DateTime") {
+				return jen.Int64().Call(jen.Id("o").Dot(field.Name)), true
+			}
+			return jen.Id("o").Dot(field.Name), true
+		}
+	}
+	log.Printf("invalid cursor %q of %s", col, m.Name)
+	return nil, false
+}
+
+// Aggregate 统计定义，按字段分组并计算指标
+type Aggregate struct {
+	GroupBy []string `yaml:"groupBy"`           // 分组字段，如 [Status, Src]
+	Metrics []string `yaml:"metrics,omitempty"` // 指标，如 count, sum:Size, min:Created, max:Created，默认 count
+}
+
+// statMetric 统计指标，count 时无字段
+type statMetric struct {
+	Fn    string
+	Field *Field
+	col   string
+	isInt bool
+}
+
+// Name 统计行中的字段名，如 Count, SumSize
+func (sm statMetric) Name() string {
+	if sm.Field == nil {
+		return ToExported(sm.Fn)
+	}
+	return ToExported(sm.Fn) + sm.Field.Name
+}
+
+// Alias 统计查询中的列名，如 count, sum_size
+func (sm statMetric) Alias() string {
+	if sm.Field == nil {
+		return sm.Fn
+	}
+	return sm.Fn + "_" + sm.col
+}
+
+func (sm statMetric) expr() string {
+	switch {
+	case sm.Field == nil:
+		return "count(*)"
+	case sm.Fn == "sum" && sm.isInt:
+		return "sum(t." + sm.col + ")::bigint"
+	case sm.Fn == "sum":
+		return "sum(t." + sm.col + ")::float8"
+	}
+	return sm.Fn + "(t." + sm.col + ")"
+}
+
+// typeCode 合计为 int64 或 float64，最小/最大值可能为空
+func (sm statMetric) typeCode() jen.Code {
+	switch {
+	case sm.Field == nil, sm.Fn == "sum" && sm.isInt:
+		return jen.Int64()
+	case sm.Fn == "sum":
+		return jen.Float64()
+	}
+	return jen.Op("*").Add(sm.Field.typeCode())
+}
+
+// hasAggregate 有统计定义，只用于 bun 的表
+func (m *Model) hasAggregate() bool {
+	return m.Aggregates != nil && m.canPickFields() && len(m.statGroups()) > 0
+}
+
+// statGroups 统计的分组字段
+func (m *Model) statGroups() (out Fields) {
+	if m.Aggregates == nil {
+		return
+	}
+	for _, name := range m.Aggregates.GroupBy {
+		field, ok := m.Fields.withName(name)
+		if !ok {
+			log.Printf("aggregate of %s: field %s not found", m.Name, name)
+			continue
+		}
+		if cn, hascol, _ := field.ColName(); !hascol || len(cn) == 0 {
+			log.Printf("aggregate of %s: field %s has no column", m.Name, name)
+			continue
+		}
+		out = append(out, *field)
 	}
 	return
 }
 
+// statMetrics 统计的指标，无效的定义将被忽略
+func (m *Model) statMetrics() (out []statMetric) {
+	if m.Aggregates == nil {
+		return
+	}
+	metrics := m.Aggregates.Metrics
+	if len(metrics) == 0 {
+		metrics = []string{"count"}
+	}
+	for _, s := range metrics {
+		fn, name, _ := strings.Cut(s, ":")
+		if fn == "count" {
+			out = append(out, statMetric{Fn: fn})
+			continue
+		}
+		if fn != "sum" && fn != "min" && fn != "max" {
+			log.Printf("aggregate of %s: invalid metric %q", m.Name, s)
+			continue
+		}
+		field, ok := m.Fields.withName(name)
+		if !ok {
+			log.Printf("aggregate of %s: field %s not found", m.Name, name)
+			continue
+		}
+		cn, hascol, _ := field.ColName()
+		if !hascol || len(cn) == 0 {
+			log.Printf("aggregate of %s: field %s has no column", m.Name, name)
+			continue
+		}
+		sm := statMetric{Fn: fn, Field: field, col: cn}
+		if fn == "sum" {
+			switch field.filterKind() {
+			case "FilterInt":
+				sm.isInt = true
+			case "FilterFloat":
+			default:
+				log.Printf("aggregate of %s: field %s is not numeric", m.Name, name)
+				continue
+			}
+		}
+		out = append(out, sm)
+	}
+	return
+}
+
+// statCodes 统计行的类型定义
+func (m *Model) statCodes() jen.Code {
+	name := m.Name + "Stat"
+	var cs []jen.Code
+	for _, field := range m.statGroups() {
+		cn, _, _ := field.ColName()
+		cs = append(cs, jen.Comment(field.shortComment()).Line().Id(field.Name).Op("*").Add(field.typeCode()).
+			Tag(Tags{"bun": cn, "json": field.getArgTag() + ",omitempty"}))
+	}
+	for _, sm := range m.statMetrics() {
+		comment := "数量"
+		if sm.Field != nil {
+			comment = sm.Field.shortComment() + " " + map[string]string{"sum": "合计", "min": "最小值", "max": "最大值"}[sm.Fn]
+		}
+		json := LcFirst(sm.Name())
+		if sm.Fn == "min" || sm.Fn == "max" {
+			json += ",omitempty"
+		}
+		cs = append(cs, jen.Comment(comment).Line().Id(sm.Name()).Add(sm.typeCode()).
+			Tag(Tags{"bun": sm.Alias(), "json": json}))
+	}
+	st := jen.Comment(name + " " + m.shortComment() + "统计的一行，未参与分组的字段为空").Line()
+	st.Type().Id(name).Struct(cs...).Add(jen.Comment("@name " + LcFirst(m.prefix+name))).Line().Line()
+	st.Type().Id(name + "s").Index().Id(name).Line().Line()
+	return st
+}
+
+func (m *Model) getStatSpecName() string {
+	return m.getExportName("StatSpec")
+}
+
+// getStatSpecCodes 统计的查询条件，复用列表的条件并增加分组参数
+func (m *Model) getStatSpecCodes() jen.Code {
+	tname := m.getStatSpecName()
+	var keys []string
+	var groups []jen.Code
+	for _, field := range m.statGroups() {
+		cn, _, _ := field.ColName()
+		keys = append(keys, field.getArgTag())
+		groups = append(groups, jen.Id("StatGroup").Values(jen.Lit(field.getArgTag()), jen.Lit(cn)))
+	}
+	st := jen.Comment(tname + " " + m.shortComment() + "统计的查询条件").Line()
+	st.Type().Id(tname).Struct(
+		jen.Id(m.getSpecName()).Line(),
+		jen.Comment("分组，多个以逗号分隔，默认全部").Line().Id("By").String().Tag(map[string]string{
+			"json": "by,omitempty", "form": "by",
+			TagSwaggerType: "array,string", "collectionFormat": "csv", "enums": strings.Join(keys, ","),
+		}),
+	).Line().Line()
+	st.Comment("GroupBy 选出的分组列，参数无效时返回 StatByError").Line()
+	st.Func().Params(jen.Id("spec").Op("*").Id(tname)).Id("GroupBy").Params().Params(jen.Index().String(), jen.Error()).Block(
+		jen.Return(jen.Id("statGroupBy").Call(append([]jen.Code{jen.Id("spec").Dot("By")}, groups...)...)),
+	).Line()
+	return st
+}
+
+// codeStoreAggregate 按分组统计，条件在子查询中由 Sift 添加
+func (m *Model) codeStoreAggregate() ([]jen.Code, []jen.Code, *jen.Statement) {
+	jcol := func(fn string) jen.Code {
+		return jen.Dot(fn).Call(jen.Lit("t.?"), jen.Id("pgIdent").Call(jen.Id("col")))
+	}
+	return []jen.Code{jen.Id("spec").Op("*").Id(m.getStatSpecName())},
+		[]jen.Code{jen.Id("data").Qual(m.getIPath(), m.Name+"Stats"), jen.Err().Error()},
+		jen.BlockFunc(func(g *jen.Group) {
+			m.codeTraceStart(g, "Aggregate")
+			g.List(jen.Id("cols"), jen.Err()).Op(":=").Id("spec").Dot("GroupBy").Call()
+			g.If(jen.Err().Op("!=").Nil()).Block(jen.Return())
+			m.codeScopeSpec(g)
+			m.codeTsSpec(g, false)
+			g.Id("spec").Dot("Column").Call(jen.Id("cols").Op("..."))
+			var mcols []string
+			for _, sm := range m.statMetrics() {
+				if sm.Field != nil && !slices.Contains(mcols, sm.col) {
+					mcols = append(mcols, sm.col)
+				}
+			}
+			if len(mcols) > 0 {
+				g.Id("spec").Dot("Column").CallFunc(func(g1 *jen.Group) {
+					for _, col := range mcols {
+						g1.Lit(col)
+					}
+				})
+			}
+			g.Id("sub").Op(":=").Id("spec").Dot("Sift").Call(
+				jen.Id("s").Dot("w").Dot("db").Dot("NewSelect").Call().Dot("Model").Call(m.codeNilInstance()))
+			g.Id("q").Op(":=").Id("s").Dot("w").Dot("db").Dot("NewSelect").Call().Dot("TableExpr").Call(jen.Lit("(?) AS t"), jen.Id("sub"))
+			g.For(jen.Id("_").Op(",").Id("col").Op(":=").Range().Id("cols")).Block(
+				jen.Id("q").Add(jcol("ColumnExpr")).Add(jcol("GroupExpr")).Add(jcol("OrderExpr")),
+			)
+			for _, sm := range m.statMetrics() {
+				g.Id("q").Dot("ColumnExpr").Call(jen.Lit(sm.expr() + " AS " + sm.Alias()))
+			}
+			g.Err().Op("=").Id("q").Dot("Scan").Call(jen.Id("ctx"), jen.Op("&").Id("data"))
+			g.Return()
+		})
+}
+
+// canExport 可流式导出，需要按主键分批读取
+func (m *Model) canExport() bool {
+	_, ok := m.jcursorField("id")
+	return ok && len(m.exportFields()) > 0
+}
+
+// codeStoreExport 按条件分批读取，每批调用 fn
+func (m *Model) codeStoreExport() ([]jen.Code, []jen.Code, *jen.Statement) {
+	jid, _ := m.jcursorField("id")
+	jret := m.jErrRet()
+	if m.canTenant() || m.canOwnerOnly() { // 返回 SetTenant 或 SetOwner 的错误
+		jret = jen.Err().Error()
+	}
+	return []jen.Code{jen.Id("spec").Op("*").Id(m.getSpecName()),
+			jen.Id("fn").Func().Params(jen.Qual(m.getIPath(), m.GetPlural())).Error()},
+		[]jen.Code{jret},
+		jen.BlockFunc(func(g *jen.Group) {
+			m.codeTraceStart(g, "Export")
+			m.codeScopeSpec(g)
+			m.codeTsSpec(g, false)
+			g.Id("spec").Dot("Column").Call(jen.Id("ColumnsFromContext").Call(jen.Id("ctx")).Op("..."))
+			g.Return(jen.Id("queryBatches").Call(jen.Id("ctx"), jen.Id("s").Dot("w").Dot("db"), jen.Id("spec").Dot("Sift"), jen.Id("fn"),
+				jen.Func().Params(jen.Id("o").Op("*").Qual(m.getIPath(), m.Name)).Any().Block(jen.Return(jid)),
+			))
+		})
+}
+
+// codeStoreFacet 各分面字段按去掉自身条件的查询分组计数
+func (m *Model) codeStoreFacet() ([]jen.Code, []jen.Code, *jen.Statement) {
+	return []jen.Code{jen.Id("spec").Op("*").Id(m.getSpecName())},
+		[]jen.Code{jen.Id("data").Id("Facets"), jen.Err().Error()},
+		jen.BlockFunc(func(g *jen.Group) {
+			m.codeTraceStart(g, "Facet")
+			m.codeScopeSpec(g)
+			m.codeTsSpec(g, true)
+			g.Return(jen.Id("queryFacets").CallFunc(func(g1 *jen.Group) {
+				g1.Id("ctx")
+				g1.Id("s").Dot("w").Dot("db")
+				g1.Parens(jen.Op("*").Qual(m.getIPath(), m.Name)).Parens(jen.Nil())
+				g1.Id("spec").Dot("facetSift")
+				for _, f := range m.facetFields() {
+					cn, _, _ := f.ColName()
+					g1.Id("FacetField").Values(jen.Lit(f.getArgTag()), jen.Lit(cn), jen.Id(f.filterKind()))
+				}
+			}))
+		})
+}
+
+// codeStoreImport 按批在事务中创建，返回与 in 依次对应的编号，出错而跳过的为空
+func (m *Model) codeStoreImport() ([]jen.Code, []jen.Code, *jen.Statement) {
+	jobj := jen.Id("obj").Op("*").Qual(m.getIPath(), m.Name)
+	return []jen.Code{jen.Id("in").Index().Qual(m.getIPath(), m.Name+"Basic"), jen.Id("dryRun").Bool()},
+		[]jen.Code{jen.Id("ids").Index().String(), jen.Err().Error()},
+		jen.BlockFunc(func(g *jen.Group) {
+			m.codeTraceStart(g, "Import")
+			m.codeOwnedCommits(g)
+			g.List(jen.Id("objs"), jen.Err()).Op(":=").Id("importChunks").Call(jen.Id("ctx"), jen.Id("s").Dot("w").Dot("db"), jen.Id("in"), jen.Id("dryRun"),
+				jen.Func().Params(jactx, jen.Id("tx").Id("pgTx"), jen.Id("in").Qual(m.getIPath(), m.Name+"Basic")).Params(jobj, jen.Err().Error()).BlockFunc(func(g1 *jen.Group) {
+					m.codeCreateObj(g1, jen.Id("tx"))
+					g1.Return()
+				}),
+			)
+			m.codeRunCommitsLog(g, false) // 出错前已提交的各批
+			g.For(jen.Id("_, obj").Op(":=").Range().Id("objs")).BlockFunc(func(g1 *jen.Group) {
+				g1.Comment("出错而跳过的")
+				g1.If(jen.Id("obj").Op("==").Nil()).Block(
+					jen.Id("ids").Op("=").Append(jen.Id("ids"), jen.Lit("")),
+					jen.Continue(),
+				)
+				g1.Id("ids").Op("=").Append(jen.Id("ids"), jen.Id("obj").Dot("StringID").Call())
+				if calls := m.jDoneHooks("obj", afterCreated, upsertES); len(calls) > 0 {
+					g1.If(jen.Op("!").Id("dryRun")).Block(
+						jen.If(jen.Id("err1").Op(":=").Add(m.jAfterCommit(calls...)), jen.Id("err1").Op("!=").Nil()).Block(
+							jen.Id("logger").Call().Dot("Infow").Call(jen.Lit("import after created fail"), jen.Lit("id"), jen.Id("obj").Dot("ID"), jen.Lit("err"), jen.Id("err1")),
+						),
+					)
+				}
+			})
+			g.Return()
+		})
+}
+
+// specRelFields 列表可加载的关联，有 afterList 钩子时不含一对一；一对多由 ORM 在主查询后按 IN 批量加载，避免逐条查询
+func (m *Model) specRelFields() (out Fields) {
+	if _, okAL := m.hasStoreHook(afterList); !okAL {
+		out = m.Fields.relHasOne()
+	}
+	return append(out, m.relHasManyLoad()...)
+}
+
+// codeScopeSpec 列表类的查询限定在上下文的租户和请求者内，没有租户或请求者时返回错误
+func (m *Model) codeScopeSpec(g *jen.Group) {
+	if m.canTenant() {
+		g.If(jen.Err().Op("=").Id("spec").Dot("SetTenant").Call(jen.Id("ctx")).Op(";").Err().Op("!=").Nil()).Block(jen.Return())
+	}
+	if m.canOwnerOnly() {
+		g.If(jen.Err().Op("=").Id("spec").Dot("SetOwner").Call(jen.Id("ctx")).Op(";").Err().Op("!=").Nil()).Block(jen.Return())
+	}
+}
+
+// codeTsSpec 全文检索的配置和回退列，rank 为假时不按相关度排序
+func (m *Model) codeTsSpec(g *jen.Group, rank bool) {
+	if cols, ok := m.HasTextSearch(); ok || len(cols) > 0 {
+		if ok {
+			g.Id("spec").Dot("SetTsConfig").Call(jen.Id("s.w.db.GetTsCfg").Call())
+		}
+		if len(cols) > 0 {
+			g.Id("spec").Dot("SetTsFallback").Call(jen.ListFunc(func(g1 *jen.Group) {
+				for _, s := range cols {
+					g1.Lit(s)
+				}
+			}))
+		}
+	}
+	if !rank && m.hasTsRank() {
+		g.Id("spec").Dot("SetTsRank").Call(jen.False())
+	}
+}
+
 func (m *Model) codeStoreList(_ Method) ([]jen.Code, []jen.Code, *jen.Statement) {
 	// TODO: export
 	jdataptr := jen.Op("&").Id("data")
@@ -1110,21 +2298,34 @@ func (m *Model) codeStoreList(_ Method) ([]jen.Code, []jen.Code, *jen.Statement)
 		[]jen.Code{jen.Id("data").Qual(m.getIPath(), m.GetPlural()),
 			jen.Id("total").Int(), jen.Err().Error()},
 		jen.BlockFunc(func(g *jen.Group) {
-			if cols, ok := m.HasTextSearch(); ok || len(cols) > 0 {
-				if ok {
-					g.Id("spec").Dot("SetTsConfig").Call(jen.Id("s.w.db.GetTsCfg").Call())
-				}
-				if len(cols) > 0 {
-					g.Id("spec").Dot("SetTsFallback").Call(jen.ListFunc(func(g1 *jen.Group) {
-						for _, s := range cols {
-							g1.Lit(s)
-						}
-					}))
+			m.codeTraceStart(g, "List")
+			m.codeReadDB(g)
+			m.codeScopeSpec(g)
+			m.codeTsSpec(g, true)
+
+			if m.canPickFields() {
+				g.Id("spec").Dot("Column").Call(jen.Id("ColumnsFromContext").Call(jen.Id("ctx")).Op("..."))
+				if col, _, ok := m.cursorKey(); ok {
+					g.If(jen.Id("spec").Dot("HasColumn").Call()).Block(jen.Id("spec").Dot("Column").Call(jen.Lit(col)))
 				}
 			}
 
 			isPG10 := m.doc.IsPG10()
-			if hkBL, okBL := m.hasStoreHook(beforeList); okBL {
+			if col, desc, ok := m.cursorKey(); ok {
+				g.Id("q").Op(":=").Id("queryList").Call(jen.Id("ctx"), swdb, jspec, jdataptr)
+				if hkBL, okBL := m.hasStoreHook(beforeList); okBL {
+					g.If(jen.Err().Op("=").Add(m.jHook(hkBL, jen.Id("s").Dot(hkBL.FunName), jspec, jen.Id("q"))).Op(";").Err().Op("!=").Nil()).Block(jen.Return())
+				}
+				jkey, _ := m.jcursorField(col)
+				jid, _ := m.jcursorField("id")
+				g.Id("total").Op(",").Err().Op("=").Id("queryCursor").Call(
+					jen.Id("ctx"), jspec, jen.Op("&").Id("spec").Dot("CursorSpec"), jen.Id("q"), jdataptr,
+					jen.Lit(col), jen.Lit(desc),
+					jen.Func().Params(jen.Id("o").Op("*").Qual(m.getIPath(), m.Name)).Params(jen.Any(), jen.Any()).Block(
+						jen.Return(jkey, jid),
+					),
+				)
+			} else if hkBL, okBL := m.hasStoreHook(beforeList); okBL {
 				var jcall jen.Code
 				if isPG10 {
 					jcall = jen.Dot("ModelContext").Call(jen.Id("ctx"), jdataptr)
@@ -1132,7 +2333,7 @@ func (m *Model) codeStoreList(_ Method) ([]jen.Code, []jen.Code, *jen.Statement)
 					jcall = jen.Dot("NewSelect").Call().Dot("Model").Call(jdataptr)
 				}
 				g.Id("q").Op(":=").Add(swdb, jcall) //.Dot("Apply").Call(jen.Id("spec").Dot("Sift"))
-				g.If(jen.Err().Op("=").Id("s").Dot(hkBL.FunName).Call(jen.Id("ctx"), jspec, jen.Id("q")).Op(";").Err().Op("!=").Nil()).Block(jen.Return())
+				g.If(jen.Err().Op("=").Add(m.jHook(hkBL, jen.Id("s").Dot(hkBL.FunName), jspec, jen.Id("q"))).Op(";").Err().Op("!=").Nil()).Block(jen.Return())
 				g.Id("total").Op(",").Err().Op("=").Id("queryPager").Call(jen.Id("ctx"), jspec, jen.Id("q"))
 			} else {
 				g.Id("total").Op(",").Id("err").Op("=").Id(mList).Call(
@@ -1140,9 +2341,28 @@ func (m *Model) codeStoreList(_ Method) ([]jen.Code, []jen.Code, *jen.Statement)
 				)
 			}
 
+			if cols := m.headlineCols(); len(cols) > 0 {
+				jid, _ := m.jcursorField("id")
+				jobj := jen.Id("o").Op("*").Qual(m.getIPath(), m.Name)
+				g.If(jen.Err().Op("==").Nil()).Block(
+					jen.Err().Op("=").Id("queryHeadlines").CallFunc(func(g1 *jen.Group) {
+						g1.Id("ctx")
+						g1.Add(swdb)
+						g1.Op("&").Id("spec").Dot("TsRankSpec")
+						g1.Id("data")
+						g1.Func().Params(jobj).Any().Block(jen.Return(jid))
+						g1.Func().Params(jobj, jen.Id("hl").Map(jen.String()).String()).Block(
+							jen.Id("o").Dot("Headline").Op("=").Id("hl"))
+						for _, c := range cols {
+							g1.Index(jen.Lit(2)).String().Values(jen.Lit(c[0]), jen.Lit(c[1]))
+						}
+					}),
+				)
+			}
+
 			if hkAL, okAL := m.hasStoreHook(afterList); okAL {
 				jb := new(jen.Statement)
-				args := []jen.Code{jen.Id("ctx"), jen.Id("spec")}
+				args := []jen.Code{jen.Id("spec")}
 				if hkAL.isPtr {
 					args = append(args, jen.Id("&data"))
 				} else {
@@ -1153,7 +2373,7 @@ func (m *Model) codeStoreList(_ Method) ([]jen.Code, []jen.Code, *jen.Statement)
 					jb.Id("total").Op(",")
 					args = append(args, jen.Id("total"))
 				}
-				jb.Err().Op("=").Id("s").Dot(hkAL.FunName).Call(args...)
+				jb.Err().Op("=").Add(m.jHook(hkAL, jen.Id("s").Dot(hkAL.FunName), args...))
 				g.If(jen.Err().Op("==").Nil()).Block(jb)
 			}
 			g.Return()
@@ -1168,9 +2388,15 @@ func (mod *Model) codeStoreGet(mth Method) (arg []jen.Code, ret []jen.Code, addi
 
 	jload := jen.Id("err").Op("=")
 	swdb, fnGet, isBson := mod.jvdbcall('G')
+	if mod.canTenant() {
+		fnGet = mod.fnGetPK()
+	}
+	colGet := mth.ColGet || mod.canPickFields()
 
-	jaf := func(g *jen.Group, jdb jen.Code) {
-		g.Id("obj").Op("=").New(jen.Qual(mod.getIPath(), mod.Name))
+	jaf := func(g *jen.Group, jdb jen.Code, renew bool) {
+		if renew {
+			g.Id("obj").Op("=").New(jen.Qual(mod.getIPath(), mod.Name))
+		}
 		uf, isuniq := mod.UniqueOne()
 		args := []jen.Code{jen.Id("ctx"), jdb, jen.Id("obj")}
 		if isuniq && !isBson {
@@ -1178,7 +2404,7 @@ func (mod *Model) codeStoreGet(mth Method) (arg []jen.Code, ret []jen.Code, addi
 		} else {
 			args = append(args, jen.Id("id"))
 		}
-		if mth.Export || mth.ColGet {
+		if mth.Export || colGet {
 			args = append(args, jen.Id("cols").Op("..."))
 		}
 		jload.Id(fnGet).Call(args...)
@@ -1196,7 +2422,7 @@ func (mod *Model) codeStoreGet(mth Method) (arg []jen.Code, ret []jen.Code, addi
 				fnGet2 = "dbGetWith"
 				args = append(args, jen.Lit(ukey), jen.Lit(uf.Op()), jen.Id("id"))
 			}
-			if mth.Export || mth.ColGet {
+			if mth.Export || colGet {
 				args = append(args, jen.Id("cols").Op("..."))
 			}
 
@@ -1216,23 +2442,60 @@ func (mod *Model) codeStoreGet(mth Method) (arg []jen.Code, ret []jen.Code, addi
 		args = append(args, arg...)
 		args = append(args, jen.Id("cols").Op("...").String())
 		addition = jen.Func().Id(mth.Name).Params(args...).Params(ret...).BlockFunc(func(g *jen.Group) {
-			jaf(g, jen.Id("db"))
+			jaf(g, jen.Id("db"), true)
 			g.Return()
 		}).Line()
 	}
 
 	blkcode = jen.BlockFunc(func(g *jen.Group) {
-		if mth.Export && !isBson {
-			args := []jen.Code{jen.Id("ctx"), swdb, jen.Id("id")}
-			if mth.ColGet {
-				args = append(args, jen.Id("ColumnsFromContext").Call(jen.Id("ctx")).Op("..."))
+		mod.codeTraceStart(g, "Get")
+		mod.codeReadDB(g)
+		cached := mod.canCache()
+		jcols := jen.Id("ColumnsFromContext").Call(jen.Id("ctx"))
+		if mod.canOwnerOnly() { // 校验所有者需要其列
+			jcols = jen.Id("ownerColumns").Call(jcols)
+		}
+		jget := func(g *jen.Group) {
+			if mth.Export && !isBson {
+				args := []jen.Code{jen.Id("ctx"), swdb, jen.Id("id")}
+				if colGet {
+					args = append(args, jen.Add(jcols).Op("..."))
+				}
+				g.Id("obj").Op(",").Err().Op("=").Id(mth.Name).Call(args...)
+			} else {
+				if colGet {
+					g.Id("cols").Op(":=").Add(jcols)
+				}
+				jaf(g, swdb, !cached)
 			}
-			g.Id("obj").Op(",").Err().Op("=").Id(mth.Name).Call(args...)
-		} else {
-			if mth.ColGet {
-				g.Id("cols").Op(":=").Id("ColumnsFromContext").Call(jen.Id("ctx"))
+		}
+		if cached { // 命中缓存时不读库，关联和 afterLoad 照常
+			jtn := jen.Lit(mod.tableName())
+			g.Id("obj").Op("=").New(jen.Qual(mod.getIPath(), mod.Name))
+			fnCache := "cacheGet"
+			if _, isuniq := mod.UniqueOne(); isuniq { // 缓存只按编号，别名读库
+				fnCache = "cacheGetByID"
+			}
+			jcond := jen.Op("!").Id(fnCache).Call(jen.Id("ctx"), jen.Id("s").Dot("w"), jtn, jen.Id("id"), jen.Id("obj"))
+			if mod.canTenant() { // 缓存不分租户，其他租户的按未命中读库
+				jcond.Op("||").Op("!").Id("tenantMatch").Call(jen.Id("ctx"), jen.Id("obj"))
 			}
-			jaf(g, swdb)
+			g.If(jcond).BlockFunc(func(g2 *jen.Group) {
+				if mod.canTenant() {
+					g2.Id("obj").Op("=").New(jen.Qual(mod.getIPath(), mod.Name))
+				}
+				jget(g2)
+				g2.If(jen.Err().Op("==").Nil()).Block(
+					jen.Id("cacheSet").Call(jen.Id("ctx"), jen.Id("s").Dot("w"), jtn, jen.Id("obj")),
+				)
+			})
+		} else {
+			jget(g)
+		}
+		if mod.canOwnerOnly() {
+			g.If(jen.Err().Op("==").Nil()).Block(
+				jen.Err().Op("=").Id("ownerCheck").Call(jen.Id("ctx"), jen.Id("obj")),
+			)
 		}
 		jer := jen.Empty()
 		if mod.doc.hasQualErrors() {
@@ -1244,18 +2507,34 @@ func (mod *Model) codeStoreGet(mth Method) (arg []jen.Code, ret []jen.Code, addi
 
 		if hkEL, okEL := mod.hasStoreHook(errorLoad); okEL {
 			g.If(jen.Err().Op("!=").Nil()).Block(
-				jen.Err().Op("=").Id("s").Dot(hkEL.FunName).Call(jen.Id("ctx"), jen.Id("id"), jen.Err(), jen.Id("obj")),
+				jen.Err().Op("=").Add(mod.jHook(hkEL, jen.Id("s").Dot(hkEL.FunName), jen.Id("id"), jen.Err(), jen.Id("obj"))),
 			)
 		}
 
+		mrels := mod.relHasManyLoad()
+		jmrels := func(g2 *jen.Group) {
+			for _, rf := range mrels {
+				jq := mod.jRelSelect(swdb, jen.Op("&").Id("obj").Dot(rf.Name), rf.relJoinFK(mod.Name), jen.Id("obj").Dot("ID"), mod.relTenant(rf))
+				g2.If(jen.Id("rn").Op("==").Lit(rf.Name)).Block(
+					jen.If(jen.Err().Op("=").Add(jq).Op(";").Err().Op("!=").Nil()).Block(jen.Return()),
+					jen.Continue(),
+				)
+			}
+		}
+
 		if hkAL, okAL := mod.hasStoreHook(afterLoad); okAL {
+			if len(mrels) > 0 { // 一对多先于 afterLoad 加载
+				g.If(jen.Err().Op("==").Nil()).Block(
+					jen.For().Op("_,").Id("rn").Op(":=").Range().Id("RelationFromContext").Call(jen.Id("ctx")).BlockFunc(jmrels),
+				)
+			}
 			g.If(jen.Err().Op("==").Nil()).Block(
-				jen.Err().Op("=").Id("s").Dot(hkAL.FunName).Call(jen.Id("ctx"), jen.Id("obj")),
+				jen.Err().Op("=").Add(mod.jHook(hkAL, jen.Id("s").Dot(hkAL.FunName), jen.Id("obj"))),
 			)
 			if mod.doc.hasQualErrors() {
 				g.Add(jer)
 			}
-		} else if rels := mod.Fields.relHasOne(); len(rels) > 0 {
+		} else if rels := mod.Fields.relHasOne(); len(rels) > 0 || len(mrels) > 0 {
 			g.If(jen.Err().Op("!=").Nil()).BlockFunc(func(g1 *jen.Group) {
 				if mod.doc.hasQualErrors() {
 					g1.Add(jer)
@@ -1271,16 +2550,20 @@ func (mod *Model) codeStoreGet(mth Method) (arg []jen.Code, ret []jen.Code, addi
 					} else {
 						jck = jen.Op("!").Qual(utilsQual, "IsZero").Call(jen.Id("obj." + lastName))
 					}
+					fnRel := "dbGetWithPKID"
+					if mod.relTenant(rf) {
+						fnRel = "dbGetWithTenant"
+					}
 					g2.If(jen.Id("rn").Op("==").Lit(rf.Name).Op("&&").Add(jck)).Block(
 						jen.Id("ro").Op(":=").New(rf.typeCode(mod.getIPath())),
-						jen.If(jen.Err().Op("=").Id("dbGetWithPKID").Call(
+						jen.If(jen.Err().Op("=").Id(fnRel).Call(
 							jen.Id("ctx"), swdb, jen.Id("ro"), jen.Id("obj").Dot(lastName)).Op(";").Err().Op("==").Nil()).Block(
 							jen.Id("obj").Dot(rf.Name).Op("=").Id("ro"),
 							jen.Continue(),
 						),
 					)
 				}
-
+				jmrels(g2)
 			})
 		} else {
 			g.Add(jer)
@@ -1291,78 +2574,459 @@ func (mod *Model) codeStoreGet(mth Method) (arg []jen.Code, ret []jen.Code, addi
 	return
 }
 
-func (mod *Model) codeStoreCreate(mth Method) (arg []jen.Code, ret []jen.Code, addition jen.Code, blkcode *jen.Statement) {
-	tname := mod.Name + "Basic"
+// relHasManyLoad 可在 Get 中按需加载的一对多关联
+func (mod *Model) relHasManyLoad() Fields {
+	if mod.IsBsonable() || mod.doc.IsMongo() {
+		return nil
+	}
+	return mod.Fields.relHasMany()
+}
 
-	hkBC, okBC := mod.hasStoreHook(beforeCreating)
-	hkAC, okAC := mod.hasStoreHook(afterCreating)
-	hkBS, okBS := mod.hasStoreHook(beforeSaving)
-	hkAS, okAS := mod.hasStoreHook(afterSaving)
-	hookTxing := okBC || okAC || okBS || okAS
+// relTenant 主模型和关联的模型均按租户隔离
+func (mod *Model) relTenant(rf Field) bool {
+	_, typ, _ := rf.cutType()
+	rm, ok := mod.doc.modelWithPlural(strings.TrimPrefix(typ, "[]"))
+	return ok && mod.canTenant() && rm.canTenant()
+}
 
-	isPG10 := mod.doc.IsPG10()
+// jRelSelect 按外键查询一对多的子记录，tenant 为真时限定上下文的租户
+func (mod *Model) jRelSelect(jdb, jdataptr jen.Code, fk string, jid jen.Code, tenant bool) jen.Code {
+	jfk := jen.Lit(fk + " = ?")
+	if mod.doc.IsPG10() {
+		return jen.Add(jdb).Dot("ModelContext").Call(jen.Id("ctx"), jdataptr).
+			Dot("Where").Call(jfk, jid).Dot("Select").Call()
+	}
+	jq := jen.Add(jdb).Dot("NewSelect").Call().Dot("Model").Call(jdataptr).Dot("Where").Call(jfk, jid)
+	if tenant {
+		jq.Dot("Apply").Call(jen.Id("tenantSift").Call(jen.Id("ctx")))
+	}
+	return jq.Dot("Scan").Call(jen.Id("ctx"))
+}
 
-	swdb, fnCreate, _ := mod.jvdbcall('C')
+// ownedRel 从属的一对多关联，子对象随主对象在同一事务中保存
+type ownedRel struct {
+	field Field
+	child *Model
+	fk    string // 子对象中指向主对象的字段名
+}
 
-	arg = []jen.Code{jen.Id("in").Qual(mod.getIPath(), tname)}
-	ret = []jen.Code{jen.Id("obj").Op("*").Qual(mod.getIPath(), mod.Name), jen.Err().Error()}
-	jaf := func(g *jen.Group, jdb jen.Code) {
-		nname := "New" + mod.Name + "WithBasic"
-		g.Id("obj").Op("=").Qual(mod.getIPath(), nname).Call(jen.Id("in"))
-
-		targs := []jen.Code{jen.Id("ctx"), jdb, jen.Id("obj")}
-		jfCheck := func() {
-			unfd, isuniq := mod.UniqueOne()
-			if isuniq && !mod.IsBsonable() {
-				var jcond jen.Code
-				if unfd.isOID() {
-					jcond = jen.Id("obj").Dot(unfd.Name).Dot("IsZero").Call()
-				} else {
-					jcond = jen.Id("obj").Dot(unfd.Name).Op("==").Lit("")
-				}
-				g.If(jcond).Block(
-					jen.Err().Op("=").Id("ErrEmptyKey"),
-					jen.Return())
-				targs = append(targs, jen.Lit(unfd.Column))
-			} else if mod.ForceCreate {
-				targs = append(targs, jen.Lit(true))
+func (mod *Model) ownedRelations() (out []ownedRel) {
+	if mod.doc == nil || mod.IsBsonable() || mod.doc.IsMongo() {
+		return
+	}
+	for _, field := range mod.Fields.relHasMany() {
+		if !field.IsOwned {
+			continue
+		}
+		_, typ, _ := field.cutType()
+		typ = strings.TrimPrefix(typ, "[]")
+		child, ok := mod.doc.modelWithPlural(typ)
+		if !ok {
+			log.Printf("owned %s.%s: unknown model %s", mod.Name, field.Name, typ)
+			continue
+		}
+		fkcol := field.relJoinFK(mod.Name)
+		var fk string
+		for _, cf := range child.Fields {
+			if cn, ok, _ := cf.ColName(); ok && cn == fkcol {
+				fk = cf.Name
 			}
 		}
+		if len(fk) == 0 {
+			log.Printf("owned %s.%s: field of %s not found in %s", mod.Name, field.Name, fkcol, child.Name)
+			continue
+		}
+		out = append(out, ownedRel{field: field, child: child, fk: fk})
+	}
+	return
+}
 
-		if jt, ok := mod.textSearchCodes("obj", false); ok {
-			g.Add(jt)
+// isOwned 是否为其他模型的从属子对象
+func (mod *Model) isOwned() bool {
+	if mod.doc == nil {
+		return false
+	}
+	for i := range mod.doc.Models {
+		for _, or := range mod.doc.Models[i].ownedRelations() {
+			if or.child.Name == mod.Name {
+				return true
+			}
 		}
-		if hookTxing {
-			if okBC {
-				g.If(jen.Err().Op("=").Id(hkBC.FunName).Call(jen.Id("ctx"), jdb, jen.Id("obj")).Op(";").Err().Op("!=")).Nil().Block(
-					jen.Return(),
-				)
-			} else if okBS {
-				g.If(jen.Err().Op("=").Id(hkBS.FunName).Call(jen.Id("ctx"), jdb, jen.Id("obj")).Op(";").Err().Op("!=")).Nil().Block(
-					jen.Return(),
-				)
+	}
+	return false
+}
+
+// ownedCodes 主对象的 Basic 或 Set 中接收从属子对象的字段
+func (mod *Model) ownedCodes(isSet bool, idx int) (out []jen.Code) {
+	for _, or := range mod.ownedRelations() {
+		field := Field{Name: or.field.Name, Comment: or.field.Comment, Tags: Tags{}}
+		if js, ok := or.field.Tags["json"]; ok {
+			field.Tags["json"] = js
+		}
+		if isSet {
+			field.Type = "*[]" + or.child.Name + "Nested"
+		} else {
+			field.Type = "[]" + or.child.Name + "Basic"
+			field.Tags["bun"] = "-"
+			field.Tags["pg"] = "-"
+		}
+		idx++
+		out = append(out, field.Code(idx, idx))
+	}
+	return
+}
+
+func (or ownedRel) jfname(mod *Model, act string) string {
+	return "db" + act + mod.Name + or.field.Name
+}
+
+// jChildHooks 子对象的事务钩子
+func (or ownedRel) jChildHooks(g *jen.Group, id string, keys ...string) {
+	for _, k := range keys {
+		if hk, ok := or.child.hasStoreHook(k); ok {
+			g.If(jen.Err().Op("=").Add(or.child.jHook(hk, jen.Id(hk.FunName), jen.Id("db"), jen.Id(id))).Op(";").Err().Op("!=").Nil()).Block(jen.Return())
+			return
+		}
+	}
+}
+
+// jChildCommit 子对象写入后记下提交后的缓存清除及 hn 和 hes 钩子，由主对象的存储方法在提交后执行，见 queueCommit
+func (or ownedRel) jChildCommit(g *jen.Group, id string, hn, hes string, cache bool) {
+	calls := or.child.jDoneHooks("&cc", hn, hes)
+	cache = cache && or.child.canCache()
+	if len(calls) == 0 && !cache {
+		return
+	}
+	sto, ok := or.child.doc.storeOfModel(or.child.Name)
+	if !ok {
+		log.Printf("owned %s: store not found, skip after commit", or.child.Name)
+		return
+	}
+	g.Id("cc").Op(":=").Op("*").Id(id)
+	g.Id("queueCommit").Call(jen.Id("ctx"), jen.Lit(or.child.Name), jen.Func().Params(jactx, jen.Id("w").Op("*").Id(storewn)).Error().BlockFunc(func(g1 *jen.Group) {
+		g1.Id("s").Op(":=").Id("w").Dot(sto.Name)
+		if cache {
+			g1.Add(or.child.jcacheDel(jen.Id("cc").Dot("StringID").Call()))
+		}
+		if len(calls) == 0 {
+			g1.Return(jen.Nil())
+			return
+		}
+		for _, c := range calls[:len(calls)-1] {
+			g1.If(jen.Err().Op(":=").Add(c).Op(";").Err().Op("!=").Nil()).Block(jen.Return(jen.Err()))
+		}
+		g1.Return(calls[len(calls)-1])
+	}))
+}
+
+// hasOwnedCommits 从属的子对象有提交后的缓存清除或钩子，存储方法需要 withCommits
+func (mod *Model) hasOwnedCommits() bool {
+	for _, or := range mod.ownedRelations() {
+		if or.child.canCache() {
+			return true
+		}
+		if len(or.child.jDoneHooks("co", afterCreated, upsertES)) > 0 ||
+			len(or.child.jDoneHooks("co", afterUpdated, upsertES)) > 0 ||
+			len(or.child.jDoneHooks("co", afterDeleted, deleteES)) > 0 {
+			if _, ok := or.child.doc.storeOfModel(or.child.Name); ok {
+				return true
 			}
-			jfCheck()
-			mod.codeMetaUp(g, jdb, "obj")
+		}
+	}
+	return false
+}
 
-			g.Err().Op("=").Id(fnCreate).Call(targs...)
-			if okAC {
-				g.If(jen.Err().Op("==")).Nil().Block(
-					jen.Err().Op("=").Id(hkAC.FunName).Call(jen.Id("ctx"), jdb, jen.Id("obj")),
-				)
-			} else if okAS {
-				g.If(jen.Err().Op("==")).Nil().Block(
-					jen.Err().Op("=").Id(hkAS.FunName).Call(jen.Id("ctx"), jdb, jen.Id("obj")),
-				)
+// codeOwnedCommits 存储方法开始时加入提交后的队列，见 withCommits
+func (mod *Model) codeOwnedCommits(g *jen.Group) {
+	if mod.hasOwnedCommits() {
+		g.List(jen.Id("ctx"), jen.Id("cq")).Op(":=").Id("withCommits").Call(jen.Id("ctx"))
+	}
+}
+
+// jRunCommits 提交后执行从属子对象记下的函数，见 Wrap.runCommits
+func (mod *Model) jRunCommits() jen.Code {
+	return jen.Id("s").Dot("w").Dot("runCommits").Call(jen.Id("ctx"), jen.Lit(mod.Name), jen.Id("cq"))
+}
+
+// codeRunCommitsLog 批量写入提交后执行从属子对象记下的函数，出错时只记日志，
+// needOK 为真时仅在整个事务成功时执行
+func (mod *Model) codeRunCommitsLog(g *jen.Group, needOK bool) {
+	if !mod.hasOwnedCommits() {
+		return
+	}
+	jst := jen.If(jen.Id("err1").Op(":=").Add(mod.jRunCommits()), jen.Id("err1").Op("!=").Nil()).Block(
+		jen.Id("logger").Call().Dot("Infow").Call(jen.Lit("owned after commit fail"), jen.Lit("err"), jen.Id("err1")),
+	)
+	if needOK {
+		jst = jen.If(jen.Err().Op("==").Nil()).Block(jst)
+	}
+	g.Add(jst)
+}
+
+// ownedStoreCodes 创建或保存从属子对象的函数
+func (mod *Model) ownedStoreCodes(isUpdate bool) jen.Code {
+	ors := mod.ownedRelations()
+	if len(ors) == 0 {
+		return nil
+	}
+	st := jen.Empty()
+	jobj := jen.Id("obj").Op("*").Qual(mod.getIPath(), mod.Name)
+	for _, or := range ors {
+		cqual := or.child.getIPath()
+		jsave := func(g *jen.Group, isNew bool) {
+			g.Id("co").Dot(or.fk).Op("=").Id("obj").Dot("ID")
+			if isNew && mod.relTenant(or.field) {
+				g.Id("co").Dot("TenantID").Op("=").Id("obj").Dot("TenantID")
+			} else if isNew && or.child.canTenant() {
+				g.If(jen.Err().Op("=").Id("tenantStamp").Call(jen.Id("ctx"), jen.Id("co")).Op(";").Err().Op("!=").Nil()).Block(jen.Return())
 			}
+			if or.child.canOwnerOnly() {
+				fn := "ownerCheck"
+				if isNew {
+					fn = "ownerStamp"
+				}
+				g.If(jen.Err().Op("=").Id(fn).Call(jen.Id("ctx"), jen.Id("co")).Op(";").Err().Op("!=").Nil()).Block(jen.Return())
+			}
+			if jt, ok := or.child.textSearchCodes("co", !isNew); ok {
+				g.Add(jt)
+			}
+			if isNew {
+				or.jChildHooks(g, "co", beforeCreating, beforeSaving)
+			} else {
+				or.jChildHooks(g, "co", beforeUpdating, beforeSaving)
+			}
+			or.child.codeMetaUp(g, jen.Id("db"), "co")
+			if isNew {
+				g.If(jen.Err().Op("=").Id("dbInsert").Call(jen.Id("ctx"), jen.Id("db"), jen.Id("co")).Op(";").Err().Op("!=").Nil()).Block(jen.Return())
+				or.jChildHooks(g, "co", afterCreating, afterSaving)
+				if or.child.canOutbox() {
+					g.If(jen.Err().Op("=").Add(or.child.jOutbox(jen.Id("db"), "co", "OutboxCreate")).Op(";").Err().Op("!=").Nil()).Block(jen.Return())
+				}
+				or.jChildCommit(g, "co", afterCreated, upsertES, false)
+			} else {
+				g.If(jen.Err().Op("=").Id("dbUpdate").Call(jen.Id("ctx"), jen.Id("db"), jen.Id("co")).Op(";").Err().Op("!=").Nil()).Block(jen.Return())
+				or.jChildHooks(g, "co", afterUpdating, afterSaving)
+				if or.child.canOutbox() {
+					g.If(jen.Err().Op("=").Add(or.child.jOutbox(jen.Id("db"), "co", "OutboxUpdate")).Op(";").Err().Op("!=").Nil()).Block(jen.Return())
+				}
+				or.jChildCommit(g, "co", afterUpdated, upsertES, true)
+			}
+			g.Id("obj").Dot(or.field.Name).Op("=").Append(jen.Id("obj").Dot(or.field.Name), jen.Op("*").Id("co"))
+		}
+
+		if !isUpdate {
+			fname := or.jfname(mod, "Create")
+			st.Comment(fname + " 创建从属的" + or.child.shortComment()).Line()
+			st.Func().Id(fname).Params(jactx, jadbO, jobj, jen.Id("items").Index().Qual(cqual, or.child.Name+"Basic")).
+				Params(jen.Err().Error()).BlockFunc(func(g *jen.Group) {
+				g.For(jen.Id("_, in").Op(":=").Range().Id("items")).BlockFunc(func(g2 *jen.Group) {
+					g2.Id("co").Op(":=").Qual(cqual, "New"+or.child.Name+"WithBasic").Call(jen.Id("in"))
+					jsave(g2, true)
+				})
+				g.Return()
+			}).Line()
+			continue
+		}
+
+		fname := or.jfname(mod, "Save")
+		st.Comment(fname + " 保存从属的" + or.child.shortComment() + "，有编号的更新，无编号的新建，不在列表中的删除").Line()
+		st.Func().Id(fname).Params(jactx, jadbO, jobj, jen.Id("items").Index().Qual(cqual, or.child.Name+"Nested")).
+			Params(jen.Err().Error()).BlockFunc(func(g *jen.Group) {
+			g.Var().Id("olds").Qual(cqual, or.child.GetPlural())
+			g.If(jen.Err().Op("=").Add(mod.jRelSelect(jen.Id("db"), jen.Op("&").Id("olds"), or.field.relJoinFK(mod.Name), jen.Id("obj").Dot("ID"), or.child.canTenant())).
+				Op(";").Err().Op("!=").Nil()).Block(jen.Return())
+			g.Id("obj").Dot(or.field.Name).Op("=").Nil()
+			g.For(jen.Id("_, it").Op(":=").Range().Id("items")).BlockFunc(func(g2 *jen.Group) {
+				g2.If(jen.Len(jen.Id("it").Dot("ID")).Op("==").Lit(0)).BlockFunc(func(g3 *jen.Group) {
+					g3.Id("co").Op(":=").New(jen.Qual(cqual, or.child.Name))
+					g3.Id("co").Dot("SetWith").Call(jen.Id("it").Dot(or.child.Name + "Set"))
+					jsave(g3, true)
+					g3.Continue()
+				})
+				g2.Id("i").Op(":=").Qual("slices", "IndexFunc").Call(jen.Id("olds"),
+					jen.Func().Params(jen.Id("o").Qual(cqual, or.child.Name)).Bool().Block(
+						jen.Return(jen.Id("o").Dot("StringID").Call().Op("==").Id("it").Dot("ID")),
+					))
+				g2.If(jen.Id("i").Op("<").Lit(0)).Block(jen.Return(jen.Id("ErrNotFound")))
+				g2.Id("co").Op(":=").Op("&").Id("olds").Index(jen.Id("i"))
+				g2.Id("co").Dot("SetIsUpdate").Call(jen.Lit(true))
+				g2.Id("co").Dot("SetWith").Call(jen.Id("it").Dot(or.child.Name + "Set"))
+				jsave(g2, false)
+				g2.Id("olds").Op("=").Qual("slices", "Delete").Call(jen.Id("olds"), jen.Id("i"), jen.Id("i").Op("+").Lit(1))
+			})
+			g.For(jen.Id("i").Op(":=").Range().Id("olds")).BlockFunc(func(g2 *jen.Group) {
+				g2.Id("co").Op(":=").Op("&").Id("olds").Index(jen.Id("i"))
+				if or.child.canOwnerOnly() {
+					g2.If(jen.Err().Op("=").Id("ownerCheck").Call(jen.Id("ctx"), jen.Id("co")).Op(";").Err().Op("!=").Nil()).Block(jen.Return())
+				}
+				or.jChildHooks(g2, "co", beforeDeleting)
+				g2.If(jen.Err().Op("=").Id("dbDeleteM").Call(jen.Id("ctx"), jen.Id("db"),
+					jen.Id("dbSchema").Call(), jen.Id("dbSchemaCrap").Call(), jen.Id("co")).
+					Op(";").Err().Op("!=").Nil()).Block(jen.Return())
+				or.jChildHooks(g2, "co", afterDeleting)
+				if or.child.canOutbox() {
+					g2.If(jen.Err().Op("=").Add(or.child.jOutbox(jen.Id("db"), "co", "OutboxDelete")).Op(";").Err().Op("!=").Nil()).Block(jen.Return())
+				}
+				or.jChildCommit(g2, "co", afterDeleted, deleteES, true)
+			})
+			g.Return()
+		}).Line()
+	}
+	return st
+}
 
+func (mod *Model) codeStoreGetBy(mth Method) (arg []jen.Code, ret []jen.Code, blkcode *jen.Statement) {
+	uk, _ := mod.uniqueKey(mth.ukey)
+	oidQual, _ := mod.doc.getQual("oid")
+	ret = []jen.Code{jen.Id("obj").Op("*").Qual(mod.getIPath(), mod.Name), jen.Err().Error()}
+	var conds []string
+	vals := []jen.Code{jen.Id("ctx"), jen.Id("s").Dot("w").Dot("db"), jen.Id("obj"), nil}
+	for _, field := range uk.Fields {
+		an := LcFirst(field.Name)
+		cn, _, _ := field.ColName()
+		conds = append(conds, cn+" = ?")
+		if field.isOID() {
+			arg = append(arg, jen.Id(an).String())
+			vals = append(vals, jen.Qual(oidQual, "Cast").Call(jen.Id(an)))
 		} else {
-			jfCheck()
-			mod.codeMetaUp(g, jdb, "obj")
+			arg = append(arg, jen.Id(an).Add(field.typeCode(mod.doc.getModQual(field.getType()))))
+			vals = append(vals, jen.Id(an))
+		}
+	}
+	vals[3] = jen.Lit(strings.Join(conds, " AND "))
+	blkcode = jen.BlockFunc(func(g *jen.Group) {
+		mod.codeTraceStart(g, "GetBy")
+		g.Id("obj").Op("=").New(jen.Qual(mod.getIPath(), mod.Name))
+		g.Err().Op("=").Id("dbGet").Call(vals...)
+		if mod.canTenant() {
+			g.If(jen.Err().Op("==").Nil()).Block(
+				jen.Err().Op("=").Id("tenantCheck").Call(jen.Id("ctx"), jen.Id("obj")),
+			)
+		}
+		if mod.canOwnerOnly() {
+			g.If(jen.Err().Op("==").Nil()).Block(
+				jen.Err().Op("=").Id("ownerCheck").Call(jen.Id("ctx"), jen.Id("obj")),
+			)
+		}
+		g.Return()
+	})
+	return
+}
 
-			g.Err().Op("=").Id(fnCreate).Call(targs...)
+// codeCreateObj 由 in 新建 obj 并写入，含创建和保存的钩子及从属的对象
+func (mod *Model) codeCreateObj(g *jen.Group, jdb jen.Code) {
+	_, okBC := mod.hasStoreHook(beforeCreating)
+	_, okAC := mod.hasStoreHook(afterCreating)
+	_, okBS := mod.hasStoreHook(beforeSaving)
+	_, okAS := mod.hasStoreHook(afterSaving)
+	hookTxing := okBC || okAC || okBS || okAS || len(mod.ownedRelations()) > 0 || mod.canOutbox()
+
+	_, fnCreate, _ := mod.jvdbcall('C')
+
+	mod.codeCreateNew(g)
+
+	targs := []jen.Code{jen.Id("ctx"), jdb, jen.Id("obj")}
+	jfCheck := func() {
+		unfd, isuniq := mod.UniqueOne()
+		if isuniq && !mod.IsBsonable() {
+			var jcond jen.Code
+			if unfd.isOID() {
+				jcond = jen.Id("obj").Dot(unfd.Name).Dot("IsZero").Call()
+			} else {
+				jcond = jen.Id("obj").Dot(unfd.Name).Op("==").Lit("")
+			}
+			g.If(jcond).Block(
+				jen.Err().Op("=").Id("ErrEmptyKey"),
+				jen.Return())
+			targs = append(targs, jen.Lit(unfd.Column))
+		} else if mod.ForceCreate {
+			targs = append(targs, jen.Lit(true))
 		}
 	}
+
+	if hookTxing {
+		mod.codeCreateBefore(g, jdb)
+		jfCheck()
+		mod.codeMetaUp(g, jdb, "obj")
+
+		g.Err().Op("=").Id(fnCreate).Call(targs...)
+		mod.codeCreateAfter(g, jdb)
+
+	} else {
+		jfCheck()
+		mod.codeMetaUp(g, jdb, "obj")
+
+		g.Err().Op("=").Id(fnCreate).Call(targs...)
+	}
+}
+
+// codeCreateNew 由 in 新建 obj，写入上下文的租户和所有者及全文检索的配置
+func (mod *Model) codeCreateNew(g *jen.Group) {
+	nname := "New" + mod.Name + "WithBasic"
+	g.Id("obj").Op("=").Qual(mod.getIPath(), nname).Call(jen.Id("in"))
+	if mod.canTenant() {
+		g.If(jen.Err().Op("=").Id("tenantStamp").Call(jen.Id("ctx"), jen.Id("obj")).Op(";").Err().Op("!=").Nil()).Block(jen.Return())
+	}
+	if mod.canOwnerOnly() {
+		g.If(jen.Err().Op("=").Id("ownerStamp").Call(jen.Id("ctx"), jen.Id("obj")).Op(";").Err().Op("!=").Nil()).Block(jen.Return())
+	}
+	if jt, ok := mod.textSearchCodes("obj", false); ok {
+		g.Add(jt)
+	}
+}
+
+// codeCreateBefore 写入前的创建或保存的钩子
+func (mod *Model) codeCreateBefore(g *jen.Group, jdb jen.Code) {
+	if hk, ok := mod.hasStoreHook(beforeCreating); ok {
+		g.If(jen.Err().Op("=").Add(mod.jHook(hk, jen.Id(hk.FunName), jdb, jen.Id("obj"))).Op(";").Err().Op("!=")).Nil().Block(
+			jen.Return(),
+		)
+	} else if hk, ok := mod.hasStoreHook(beforeSaving); ok {
+		g.If(jen.Err().Op("=").Add(mod.jHook(hk, jen.Id(hk.FunName), jdb, jen.Id("obj"))).Op(";").Err().Op("!=")).Nil().Block(
+			jen.Return(),
+		)
+	}
+}
+
+// codeCreateAfter 写入后的创建或保存的钩子、从属的对象及变更事件
+func (mod *Model) codeCreateAfter(g *jen.Group, jdb jen.Code) {
+	if hk, ok := mod.hasStoreHook(afterCreating); ok {
+		g.If(jen.Err().Op("==")).Nil().Block(
+			jen.Err().Op("=").Add(mod.jHook(hk, jen.Id(hk.FunName), jdb, jen.Id("obj"))),
+		)
+	} else if hk, ok := mod.hasStoreHook(afterSaving); ok {
+		g.If(jen.Err().Op("==")).Nil().Block(
+			jen.Err().Op("=").Add(mod.jHook(hk, jen.Id(hk.FunName), jdb, jen.Id("obj"))),
+		)
+	}
+	for _, or := range mod.ownedRelations() {
+		g.If(jen.Err().Op("==").Nil().Op("&&").Len(jen.Id("in").Dot(or.field.Name)).Op(">").Lit(0)).Block(
+			jen.Err().Op("=").Id(or.jfname(mod, "Create")).Call(jen.Id("ctx"), jdb, jen.Id("obj"), jen.Id("in").Dot(or.field.Name)),
+		)
+	}
+	if mod.canOutbox() {
+		g.If(jen.Err().Op("==").Nil()).Block(
+			jen.Err().Op("=").Add(mod.jOutbox(jdb, "obj", "OutboxCreate")),
+		)
+	}
+}
+
+func (mod *Model) codeStoreCreate(mth Method) (arg []jen.Code, ret []jen.Code, addition jen.Code, blkcode *jen.Statement) {
+	tname := mod.Name + "Basic"
+
+	_, okBC := mod.hasStoreHook(beforeCreating)
+	_, okAC := mod.hasStoreHook(afterCreating)
+	_, okBS := mod.hasStoreHook(beforeSaving)
+	_, okAS := mod.hasStoreHook(afterSaving)
+	hookTxing := okBC || okAC || okBS || okAS || len(mod.ownedRelations()) > 0 || mod.canOutbox()
+
+	isPG10 := mod.doc.IsPG10()
+
+	swdb, _, _ := mod.jvdbcall('C')
+
+	arg = []jen.Code{jen.Id("in").Qual(mod.getIPath(), tname)}
+	ret = []jen.Code{jen.Id("obj").Op("*").Qual(mod.getIPath(), mod.Name), jen.Err().Error()}
+	jaf := mod.codeCreateObj
 	efname := mth.getExportAction() + mod.getExportName()
 	if mth.Export {
 		args := []jen.Code{jactx, jadbO}
@@ -1372,8 +3036,16 @@ func (mod *Model) codeStoreCreate(mth Method) (arg []jen.Code, ret []jen.Code, a
 			g.Return()
 		}).Line()
 	}
+	if jc := mod.ownedStoreCodes(false); jc != nil {
+		if addition != nil {
+			jc = jen.Add(addition, jc)
+		}
+		addition = jc
+	}
 
 	blkcode = jen.BlockFunc(func(g *jen.Group) {
+		mod.codeTraceStart(g, "Create")
+		mod.codeOwnedCommits(g)
 		jbf := func(g2 *jen.Group, jdb jen.Code) {
 			if mth.Export {
 				args := []jen.Code{jen.Id("ctx"), jdb, jen.Id("in")}
@@ -1402,15 +3074,14 @@ func (mod *Model) codeStoreCreate(mth Method) (arg []jen.Code, ret []jen.Code, a
 			jbf(g, swdb)
 		}
 
-		if hk, ok := mod.hasStoreHook(afterCreated); ok {
+		if mod.hasOwnedCommits() {
 			g.If(jen.Err().Op("==").Nil()).Block(
-				jen.Err().Op("=").Id("s").Dot(hk.FunName).Call(jen.Id("ctx"), jen.Id("obj")),
+				jen.Err().Op("=").Add(mod.jRunCommits()),
 			)
 		}
-
-		if fc, ok := mod.hasStoreHook(upsertES); ok {
+		if calls := mod.jDoneHooks("obj", afterCreated, upsertES); len(calls) > 0 {
 			g.If(jen.Err().Op("==").Nil()).Block(
-				jen.Err().Op("=").Id("s").Dot(fc.FunName).Call(jen.Id("ctx"), jen.Id("obj")),
+				jen.Err().Op("=").Add(mod.jAfterCommit(calls...)),
 			)
 		}
 
@@ -1420,7 +3091,7 @@ func (mod *Model) codeStoreCreate(mth Method) (arg []jen.Code, ret []jen.Code, a
 }
 
 func (mod *Model) codeStoreUpdate(mth Method) (arg []jen.Code, ret []jen.Code, addition jen.Code, blkc *jen.Statement) {
-	fnGet := "dbGetWithPKID"
+	fnGet := mod.fnGetPK()
 	swdb, fnUpdate, isBson := mod.jvdbcall('U')
 	if isBson {
 		fnGet = "mgGet"
@@ -1429,15 +3100,15 @@ func (mod *Model) codeStoreUpdate(mth Method) (arg []jen.Code, ret []jen.Code, a
 	hkAU, okAU := mod.hasStoreHook(afterUpdating)
 	hkBS, okBS := mod.hasStoreHook(beforeSaving)
 	hkAS, okAS := mod.hasStoreHook(afterSaving)
-	hookTxing := okBU || okAU || okBS || okAS
+	ors := mod.ownedRelations()
+	hookTxing := okBU || okAU || okBS || okAS || len(ors) > 0 || mod.canOutbox()
 
-	hkAX, okAX := mod.hasStoreHook(afterUpdated)
-	hkue, okue := mod.hasStoreHook(upsertES)
-	hookTxDone := okAX || okue
+	hookTxDone := len(mod.jDoneHooks("exist", afterUpdated, upsertES)) > 0
+	ownedDone := hookTxing && mod.hasOwnedCommits()
 
 	tname := mod.Name + "Set"
 	arg = []jen.Code{jen.Id("id").String(), jen.Id("in").Qual(mod.getIPath(), tname)}
-	ret = []jen.Code{jen.Error()}
+	ret = []jen.Code{mod.jErrRet()}
 
 	isPG10 := mod.doc.IsPG10()
 	jretf := func(cs ...jen.Code) jen.Code {
@@ -1465,6 +3136,9 @@ func (mod *Model) codeStoreUpdate(mth Method) (arg []jen.Code, ret []jen.Code, a
 		g.If(jen.Err().Op(eop).Id(fnGet).Call(
 			jen.Id("ctx"), jdb, jen.Id("exist"), jen.Id("id"),
 		).Op(";").Err().Op("!=").Nil()).Block(jretf())
+		if mod.canOwnerOnly() {
+			g.If(jen.Err().Op(eop).Id("ownerCheck").Call(jen.Id("ctx"), jen.Id("exist")).Op(";").Err().Op("!=").Nil()).Block(jretf())
+		}
 
 		if mod.IsBsonable() {
 			g.Id("up").Op(eop).Id("exist").Dot("SetWith").Call(jen.Id("in"))
@@ -1489,19 +3163,32 @@ func (mod *Model) codeStoreUpdate(mth Method) (arg []jen.Code, ret []jen.Code, a
 				return jen.If(jen.Err().Op(eop).Add(jnbc).Op(";").Err().Op("!=")).Nil().Block(jretf())
 			}
 			if okBU {
-				g.Add(jcondf(eop, jen.Id(hkBU.FunName).Call(jen.Id("ctx"), jdb, jen.Id("exist"))))
+				g.Add(jcondf(eop, mod.jHook(hkBU, jen.Id(hkBU.FunName), jdb, jen.Id("exist"))))
 			} else if okBS {
-				g.Add(jcondf(eop, jen.Id(hkBS.FunName).Call(jen.Id("ctx"), jdb, jen.Id("exist"))))
+				g.Add(jcondf(eop, mod.jHook(hkBS, jen.Id(hkBS.FunName), jdb, jen.Id("exist"))))
+			}
+			for _, or := range ors {
+				g.If(jen.Id("in").Dot(or.field.Name).Op("!=").Nil()).Block(
+					jcondf(eop, jen.Id(or.jfname(mod, "Save")).Call(jen.Id("ctx"), jdb, jen.Id("exist"), jen.Op("*").Id("in").Dot(or.field.Name))),
+				)
 			}
 
 			mod.codeMetaUp(g, jdb, "exist")
 
-			if okAU {
+			if mod.canOutbox() {
+				g.Add(jcondf(eop, jup))
+				if okAU {
+					g.Add(jcondf(eop, mod.jHook(hkAU, jen.Id(hkAU.FunName), jdb, jen.Id("exist"))))
+				} else if okAS {
+					g.Add(jcondf(eop, mod.jHook(hkAS, jen.Id(hkAS.FunName), jdb, jen.Id("exist"))))
+				}
+				g.Add(jretf(mod.jOutbox(jdb, "exist", "OutboxUpdate")))
+			} else if okAU {
 				g.Add(jcondf(eop, jup))
-				g.Add(jretf(jen.Id(hkAU.FunName).Call(jen.Id("ctx"), jdb, jen.Id("exist"))))
+				g.Add(jretf(mod.jHook(hkAU, jen.Id(hkAU.FunName), jdb, jen.Id("exist"))))
 			} else if okAS {
 				g.Add(jcondf(eop, jup))
-				g.Add(jretf(jen.Id(hkAS.FunName).Call(jen.Id("ctx"), jdb, jen.Id("exist"))))
+				g.Add(jretf(mod.jHook(hkAS, jen.Id(hkAS.FunName), jdb, jen.Id("exist"))))
 			} else if mth.Export {
 				g.Err().Op("=").Add(jup)
 				g.Return()
@@ -1537,8 +3224,19 @@ func (mod *Model) codeStoreUpdate(mth Method) (arg []jen.Code, ret []jen.Code, a
 			jaf(g, jen.Id("db"), false)
 		}).Line()
 	}
+	if jc := mod.ownedStoreCodes(true); jc != nil {
+		if addition != nil {
+			jc = jen.Add(addition, jc)
+		}
+		addition = jc
+	}
 
 	blkc = jen.BlockFunc(func(g *jen.Group) {
+		mod.codeTraceStart(g, "Update")
+		mod.codeOwnedCommits(g)
+		if mod.canCache() {
+			g.Defer().Add(mod.jcacheDel(jen.Id("id")))
+		}
 		jbf := func(g2 *jen.Group, jdb jen.Code, inTx bool) {
 			if mth.Export {
 				op := ":="
@@ -1549,6 +3247,9 @@ func (mod *Model) codeStoreUpdate(mth Method) (arg []jen.Code, ret []jen.Code, a
 				if hookTxDone {
 					g2.Id("exist").Op(",").Err().Op(op).Id(efname).Call(args...)
 				} else {
+					if mod.canTrace() { // err 为命名的返回值
+						op = "="
+					}
 					g2.Id("_").Op(",").Err().Op(op).Id(efname).Call(args...)
 				}
 			} else {
@@ -1575,7 +3276,7 @@ func (mod *Model) codeStoreUpdate(mth Method) (arg []jen.Code, ret []jen.Code, a
 					g1.Func().Params(jactx, jen.Id("tx").Id("pgTx")).Params(jen.Err().Error()).BlockFunc(jxf)
 				}
 			})
-			if hookTxDone {
+			if hookTxDone || ownedDone {
 				g.If(jen.Err().Op(":=").Add(jfbd).Op(";").Err().Op("!=").Nil()).Block(
 					jen.Return(jen.Err()),
 				)
@@ -1592,19 +3293,15 @@ func (mod *Model) codeStoreUpdate(mth Method) (arg []jen.Code, ret []jen.Code, a
 			}
 		}
 
-		if okAX && okue {
-			callau := jen.Id("s").Dot(hkAX.FunName).Call(jen.Id("ctx"), jen.Id("exist"))
-			g.If(jen.Err().Op(":=").Add(callau).Op(";").Err().Op("!=").Nil()).Block(
+		if ownedDone && hookTxDone {
+			g.If(jen.Err().Op(":=").Add(mod.jRunCommits()).Op(";").Err().Op("!=").Nil()).Block(
 				jen.Return(jen.Err()),
 			)
-			callke := jen.Id("s").Dot(hkue.FunName).Call(jen.Id("ctx"), jen.Id("exist"))
-			g.Return(callke)
-		} else if okAX {
-			callau := jen.Id("s").Dot(hkAX.FunName).Call(jen.Id("ctx"), jen.Id("exist"))
-			g.Return(callau)
-		} else if okue {
-			callke := jen.Id("s").Dot(hkue.FunName).Call(jen.Id("ctx"), jen.Id("exist"))
-			g.Return(callke)
+		} else if ownedDone {
+			g.Return(mod.jRunCommits())
+		}
+		if hookTxDone {
+			g.Return(mod.jAfterCommit(mod.jDoneHooks("exist", afterUpdated, upsertES)...))
 		} else if mth.Export && !hookTxing {
 			g.Return(jen.Err())
 		}
@@ -1612,7 +3309,136 @@ func (mod *Model) codeStoreUpdate(mth Method) (arg []jen.Code, ret []jen.Code, a
 	return
 }
 
+// codeStoreCreateBulk 在一个事务中批量创建，逐条调用钩子，以多行的 INSERT 写入，出错的只回滚该条，见 bulkCreate
+func (mod *Model) codeStoreCreateBulk() ([]jen.Code, []jen.Code, *jen.Statement) {
+	jin := jen.Qual(mod.getIPath(), mod.Name+"Basic")
+	jobj := jen.Op("*").Qual(mod.getIPath(), mod.Name)
+	return []jen.Code{jen.Id("in").Index().Add(jin)},
+		[]jen.Code{jen.Id("res").Index().Id("BulkResult"), jen.Err().Error()},
+		jen.BlockFunc(func(g *jen.Group) {
+			mod.codeTraceStart(g, "CreateBulk")
+			mod.codeOwnedCommits(g)
+			jtx := jen.Id("tx")
+			_, okAC := mod.hasStoreHook(afterCreating)
+			_, okAS := mod.hasStoreHook(afterSaving)
+			jafter := jen.Nil()
+			if okAC || okAS || len(mod.ownedRelations()) > 0 || mod.canOutbox() {
+				jafter = jen.Func().Params(jactx, jen.Id("tx").Id("pgTx"), jen.Id("in").Add(jin), jen.Id("obj").Add(jobj)).Params(jen.Err().Error()).BlockFunc(func(g1 *jen.Group) {
+					mod.codeCreateAfter(g1, jtx)
+					g1.Return()
+				})
+			}
+			jobjs, op := jen.Id("_"), "="
+			if len(mod.jDoneHooks("obj", afterCreated, upsertES)) > 0 {
+				jobjs, op = jen.Id("objs"), ":="
+			}
+			g.List(jobjs, jen.Id("res"), jen.Err()).Op(op).Id("bulkCreate").Call(jen.Id("ctx"), jen.Id("s").Dot("w").Dot("db"), jen.Id("in"),
+				jen.Func().Params(jactx, jen.Id("tx").Id("pgTx"), jen.Id("in").Add(jin)).Params(jen.Id("obj").Add(jobj), jen.Err().Error()).BlockFunc(func(g1 *jen.Group) {
+					mod.codeCreateNew(g1)
+					mod.codeCreateBefore(g1, jtx)
+					mod.codeMetaUp(g1, jtx, "obj")
+					g1.Return()
+				}),
+				jafter,
+			)
+			mod.codeRunCommitsLog(g, true)
+			mod.codeBulkDone(g, afterCreated)
+			g.Return()
+		})
+}
+
+// codeStoreUpdateBulk 在一个事务中批量更新，逐条读取并调用钩子，按变化的列批量写入，出错的只回滚该条，见 bulkUpdate
+func (mod *Model) codeStoreUpdateBulk() ([]jen.Code, []jen.Code, *jen.Statement) {
+	jin := jen.Qual(mod.getIPath(), mod.Name+"Set")
+	jobj := jen.Op("*").Qual(mod.getIPath(), mod.Name)
+	hkBU, okBU := mod.hasStoreHook(beforeUpdating)
+	hkAU, okAU := mod.hasStoreHook(afterUpdating)
+	hkBS, okBS := mod.hasStoreHook(beforeSaving)
+	hkAS, okAS := mod.hasStoreHook(afterSaving)
+	jtx := jen.Id("tx")
+	jcondf := func(jc jen.Code) jen.Code {
+		return jen.If(jen.Err().Op("=").Add(jc).Op(";").Err().Op("!=").Nil()).Block(jen.Return())
+	}
+	return []jen.Code{jen.Id("ids").Index().String(), jen.Id("in").Index().Add(jin)},
+		[]jen.Code{jen.Id("res").Index().Id("BulkResult"), jen.Err().Error()},
+		jen.BlockFunc(func(g *jen.Group) {
+			mod.codeTraceStart(g, "UpdateBulk")
+			mod.codeOwnedCommits(g)
+			if mod.canCache() {
+				g.Defer().Func().Params().Block(
+					jen.For(jen.Id("_, id").Op(":=").Range().Id("ids")).Block(mod.jcacheDel(jen.Id("id"))),
+				).Call()
+			}
+			jafter := jen.Nil()
+			if okAU || okAS || mod.canOutbox() {
+				jafter = jen.Func().Params(jactx, jen.Id("tx").Id("pgTx"), jen.Id("in").Add(jin), jen.Id("exist").Add(jobj)).Params(jen.Err().Error()).BlockFunc(func(g1 *jen.Group) {
+					if okAU {
+						g1.Add(jcondf(mod.jHook(hkAU, jen.Id(hkAU.FunName), jtx, jen.Id("exist"))))
+					} else if okAS {
+						g1.Add(jcondf(mod.jHook(hkAS, jen.Id(hkAS.FunName), jtx, jen.Id("exist"))))
+					}
+					if mod.canOutbox() {
+						g1.Return(mod.jOutbox(jtx, "exist", "OutboxUpdate"))
+					} else {
+						g1.Return()
+					}
+				})
+			}
+			jobjs, op := jen.Id("_"), "="
+			if len(mod.jDoneHooks("obj", afterUpdated, upsertES)) > 0 {
+				jobjs, op = jen.Id("objs"), ":="
+			}
+			g.List(jobjs, jen.Id("res"), jen.Err()).Op(op).Id("bulkUpdate").Call(jen.Id("ctx"), jen.Id("s").Dot("w").Dot("db"), jen.Id("ids"), jen.Id("in"),
+				jen.Func().Params(jactx, jen.Id("tx").Id("pgTx"), jen.Id("id").String(), jen.Id("in").Add(jin)).Params(jen.Id("exist").Add(jobj), jen.Err().Error()).BlockFunc(func(g1 *jen.Group) {
+					g1.Id("exist").Op("=").New(jen.Qual(mod.getIPath(), mod.Name))
+					g1.Add(jcondf(jen.Id(mod.fnGetPK()).Call(jen.Id("ctx"), jtx, jen.Id("exist"), jen.Id("id"))))
+					if mod.canOwnerOnly() {
+						g1.Add(jcondf(jen.Id("ownerCheck").Call(jen.Id("ctx"), jen.Id("exist"))))
+					}
+					g1.Id("exist").Dot("SetIsUpdate").Call(jen.Lit(true))
+					g1.Id("exist").Dot("SetWith").Call(jen.Id("in"))
+					if jt, ok := mod.textSearchCodes("exist", true); ok {
+						g1.Add(jt)
+					}
+					if okBU {
+						g1.Add(jcondf(mod.jHook(hkBU, jen.Id(hkBU.FunName), jtx, jen.Id("exist"))))
+					} else if okBS {
+						g1.Add(jcondf(mod.jHook(hkBS, jen.Id(hkBS.FunName), jtx, jen.Id("exist"))))
+					}
+					for _, or := range mod.ownedRelations() {
+						g1.If(jen.Id("in").Dot(or.field.Name).Op("!=").Nil()).Block(
+							jcondf(jen.Id(or.jfname(mod, "Save")).Call(jen.Id("ctx"), jtx, jen.Id("exist"), jen.Op("*").Id("in").Dot(or.field.Name))),
+						)
+					}
+					mod.codeMetaUp(g1, jtx, "exist")
+					g1.Return()
+				}),
+				jafter,
+			)
+			mod.codeRunCommitsLog(g, true)
+			mod.codeBulkDone(g, afterUpdated)
+			g.Return()
+		})
+}
+
+// codeBulkDone 批量写入提交后对写入的各条调用 hn 和 upsertES 钩子，出错时只记日志
+func (mod *Model) codeBulkDone(g *jen.Group, hn string) {
+	calls := mod.jDoneHooks("obj", hn, upsertES)
+	if len(calls) == 0 {
+		return
+	}
+	g.For(jen.Id("i, obj").Op(":=").Range().Id("objs")).BlockFunc(func(g1 *jen.Group) {
+		g1.If(jen.Id("res").Index(jen.Id("i")).Dot("Error").Op("!=").Nil()).Block(jen.Continue())
+		g1.If(jen.Id("err1").Op(":=").Add(mod.jAfterCommit(calls...)), jen.Id("err1").Op("!=").Nil()).Block(
+			jen.Id("logger").Call().Dot("Infow").Call(jen.Lit("bulk after commit fail"), jen.Lit("id"), jen.Id("obj").Dot("ID"), jen.Lit("err"), jen.Id("err1")),
+		)
+	})
+}
+
 func (mod *Model) codeStorePut(isSimp bool) ([]jen.Code, []jen.Code, *jen.Statement) {
+	if mod.canTenant() || mod.canOwnerOnly() {
+		log.Printf("tenant or ownerOnly %s: Put is not scoped", mod.Name)
+	}
 	jqset := jen.Qual(mod.getIPath(), mod.Name+"Set")
 	jqobp := jen.Op("*").Qual(mod.getIPath(), mod.Name)
 	var jret *jen.Statement
@@ -1625,10 +3451,16 @@ func (mod *Model) codeStorePut(isSimp bool) ([]jen.Code, []jen.Code, *jen.Statem
 	return []jen.Code{jen.Id("id").String(), jen.Id("in").Add(jqset)},
 		[]jen.Code{jret, jen.Err().Error()},
 		jen.BlockFunc(func(g *jen.Group) {
+			mod.codeTraceStart(g, "Put")
 
 			if isSimp {
 				g.Var().Id("obj").Add(jqobp)
 			}
+			if mod.canCache() { // 按唯一键保存时编号取自记录
+				g.Defer().Func().Params().Block(
+					jen.If(jen.Id("obj").Op("!=").Nil()).Block(mod.jcacheDel(jen.Id("obj").Dot("StringID").Call())),
+				).Call()
+			}
 			cpms := []jen.Code{
 				jen.Id("ctx"), swdb, jen.Id("in"),
 			}
@@ -1665,7 +3497,7 @@ func (mod *Model) codeStorePut(isSimp bool) ([]jen.Code, []jen.Code, *jen.Statem
 							g2.Id("obj").Op("=").New(jen.Qual(mod.getIPath(), mod.Name))
 							g2.Id("obj").Id("SetID").Call(jen.Id("id"))
 							g2.Id("obj").Id("SetWith").Call(jen.Id("in"))
-							g2.If(jen.Err().Op("=").Id(hkBS.FunName).Call(jen.Id("ctx"), jdb, jen.Id("obj")).Op(";").Err().Op("!=")).Nil().Block(
+							g2.If(jen.Err().Op("=").Add(mod.jHook(hkBS, jen.Id(hkBS.FunName), jdb, jen.Id("obj"))).Op(";").Err().Op("!=")).Nil().Block(
 								jen.Return(jen.Err()),
 							)
 						}
@@ -1678,7 +3510,7 @@ func (mod *Model) codeStorePut(isSimp bool) ([]jen.Code, []jen.Code, *jen.Statem
 
 						if okAS {
 							g2.If(jen.Err().Op("==")).Nil().Block(
-								jen.Err().Op("=").Id(hkAS.FunName).Call(jen.Id("ctx"), jdb, jen.Id("obj")),
+								jen.Err().Op("=").Add(mod.jHook(hkAS, jen.Id(hkAS.FunName), jdb, jen.Id("obj"))),
 							)
 						}
 
@@ -1708,32 +3540,48 @@ func (mod *Model) codeStoreDelete() ([]jen.Code, []jen.Code, *jen.Statement) {
 	jqual := jen.Qual(mod.getIPath(), mod.Name)
 	jtabl := jen.Qual(mod.getIPath(), mod.Name+"Table")
 	return []jen.Code{jen.Id("id").String()},
-		[]jen.Code{jen.Error()},
+		[]jen.Code{mod.jErrRet()},
 		jen.BlockFunc(func(g *jen.Group) {
+			mod.codeTraceStart(g, "Delete")
+			if mod.canCache() {
+				g.Defer().Add(mod.jcacheDel(jen.Id("id")))
+			}
 			jfbd := jen.Empty()
 			g.Id("obj").Op(":=").New(jqual)
 			hkBD, okBD := mod.hasStoreHook(beforeDeleting)
 			hkAD, okAD := mod.hasStoreHook(afterDeleting)
-			if okBD || okAD {
-				g.If(jen.Id("err").Op(":=").Id("dbGetWithPKID").Call(
+			jload := func() {
+				g.If(jen.Id("err").Op(":=").Id(mod.fnGetPK()).Call(
 					jen.Id("ctx"), swdb, jen.Id("obj"), jen.Id("id"),
 				).Op(";").Id("err").Op("!=").Nil()).Block(jen.Return(jen.Err()))
+				if mod.canOwnerOnly() {
+					g.If(jen.Id("err").Op(":=").Id("ownerCheck").Call(jen.Id("ctx"), jen.Id("obj")).Op(";").Id("err").Op("!=").Nil()).Block(jen.Return(jen.Err()))
+				}
+			}
+			if okBD || okAD || mod.canOutbox() {
+				jload()
 
 				jfbd.Add(swdb).Dot(mod.dbTxFn()).CallFunc(func(g1 *jen.Group) {
 					g1.Id("ctx")
 					jbf := func(g2 *jen.Group) {
 						if okBD {
-							g2.If(jen.Err().Op("=").Id(hkBD.FunName).Call(jen.Id("ctx"), jen.Id("tx"),
-								jen.Id("obj")).Op(";").Err().Op("!=").Nil()).Block(jen.Return())
+							g2.If(jen.Err().Op("=").Add(mod.jHook(hkBD, jen.Id(hkBD.FunName), jen.Id("tx"),
+								jen.Id("obj"))).Op(";").Err().Op("!=").Nil()).Block(jen.Return())
 						}
 
 						g2.Err().Op("=").Id("dbDeleteM").Call(jen.Id("ctx"), jen.Id("tx"),
 							jen.Add(swdb).Dot("Schema").Call(),
 							jen.Add(swdb).Dot("SchemaCrap").Call(),
 							jen.Id("obj"))
-						if okAD {
+						if mod.canOutbox() {
+							g2.If(jen.Err().Op("!=").Nil()).Block(jen.Return())
+							if okAD {
+								g2.If(jen.Err().Op("=").Add(mod.jHook(hkAD, jen.Id(hkAD.FunName), jen.Id("tx"), jen.Id("obj"))).Op(";").Err().Op("!=").Nil()).Block(jen.Return())
+							}
+							g2.Return(mod.jOutbox(jen.Id("tx"), "obj", "OutboxDelete"))
+						} else if okAD {
 							g2.If(jen.Err().Op("!=").Nil()).Block(jen.Return())
-							g2.Return(jen.Id(hkAD.FunName).Call(jen.Id("ctx"), jen.Id("tx"), jen.Id("obj")))
+							g2.Return(mod.jHook(hkAD, jen.Id(hkAD.FunName), jen.Id("tx"), jen.Id("obj")))
 						} else {
 							g2.Return()
 						}
@@ -1755,6 +3603,9 @@ func (mod *Model) codeStoreDelete() ([]jen.Code, []jen.Code, *jen.Statement) {
 						jen.Id("ctx"), jtabl, jen.Id("obj").Dot("ID"),
 					)
 				} else {
+					if mod.canTenant() || mod.canOwnerOnly() { // 先读出以校验租户和所有者
+						jload()
+					}
 					jfbd.Id(mDelete).Call(
 						jen.Id("ctx"), jen.Id("obj"), jen.Id("id"),
 					)
@@ -1762,34 +3613,11 @@ func (mod *Model) codeStoreDelete() ([]jen.Code, []jen.Code, *jen.Statement) {
 
 			}
 
-			hkad, okad := mod.hasStoreHook(afterDeleted)
-			hkde, okde := mod.hasStoreHook(deleteES)
-
-			if okad && okde {
-				g.If(jen.Err().Op(":=").Add(jfbd).Op(";").Err().Op("!=").Nil()).Block(
-					jen.Return(jen.Err()),
-				)
-
-				callad := jen.Id("s").Dot(hkad.FunName).Call(jen.Id("ctx"), jen.Id("obj"))
-				g.If(jen.Err().Op(":=").Add(callad).Op(";").Err().Op("!=").Nil()).Block(
-					jen.Return(jen.Err()),
-				)
-
-				callde := jen.Id("s").Dot(hkde.FunName).Call(jen.Id("ctx"), jen.Id("obj"))
-				g.Return(callde)
-
-			} else if okad {
-				g.If(jen.Err().Op(":=").Add(jfbd).Op(";").Err().Op("!=").Nil()).Block(
-					jen.Return(jen.Err()),
-				)
-				callad := jen.Id("s").Dot(hkad.FunName).Call(jen.Id("ctx"), jen.Id("obj"))
-				g.Return(callad)
-			} else if okde {
+			if calls := mod.jDoneHooks("obj", afterDeleted, deleteES); len(calls) > 0 {
 				g.If(jen.Err().Op(":=").Add(jfbd).Op(";").Err().Op("!=").Nil()).Block(
 					jen.Return(jen.Err()),
 				)
-				callde := jen.Id("s").Dot(hkde.FunName).Call(jen.Id("ctx"), jen.Id("obj"))
-				g.Return(callde)
+				g.Return(mod.jAfterCommit(calls...))
 			} else {
 				g.Return(jfbd)
 			}
@@ -1922,4 +3750,25 @@ func (m *Model) init(doc *Document) {
 	for j := range m.SpecExtras {
 		m.SpecExtras[j].mod = m
 	}
+	if m.canTenant() {
+		if _, ok := m.Fields.withName("TenantID"); !ok {
+			m.Fields = append(m.Fields, m.tenantField())
+		}
+	} else if _, isuniq := m.UniqueOne(); isuniq && (m.Tenant || doc.Tenant) {
+		log.Printf("tenant %s: unique key is global, not scoped", m.Name)
+	}
+	if m.OwnerOnly && !m.canOwnerOnly() {
+		log.Printf("ownerOnly %s: need comm.OwnerField in a bun table", m.Name)
+	}
+	if m.IsTable() {
+		for _, uk := range m.uniqueKeys() {
+			for _, uf := range uk.Fields {
+				for j := range m.Fields {
+					if m.Fields[j].Name == uf.Name {
+						m.Fields[j].uniqs = append(m.Fields[j].uniqs, uk.Constraint)
+					}
+				}
+			}
+		}
+	}
 }
@@ -4,7 +4,6 @@ package gens
 import (
 	"go/token"
 	"log"
-	"strconv"
 	"strings"
 
 	"github.com/dave/dst"
@@ -15,6 +14,7 @@ var (
 	hods = map[rune]string{
 		'L': "List", 'G': "Get", 'P': "Put",
 		'C': "Create", 'U': "Update", 'D': "Delete",
+		'I': "Import",
 	}
 )
 
@@ -41,6 +41,7 @@ type Method struct {
 
 	action string
 	model  string
+	ukey   string // name of unique key for GetBy
 }
 
 func newMethod(act, mod string, ex bool) Method {
@@ -122,6 +123,10 @@ func (s *Store) prepareMethods() {
 		}
 		for _, c := range hod.Value {
 			if a, ok := hods[c]; ok {
+				if mod, ok := s.doc.modelWithName(m); a == "Import" && (!ok || !mod.canImport()) {
+					log.Printf("WARN: %s cannot import", m)
+					continue
+				}
 				k := a + m
 				if _, ok := s.allMM[k]; !ok {
 					export := strings.ContainsRune(hod.Export, c)
@@ -141,9 +146,125 @@ func (s *Store) prepareMethods() {
 			s.Methods[i].action, s.Methods[i].model, _ = cutMethod(s.Methods[i].Name)
 		}
 	}
+	s.prepareGetBy()
+	s.prepareAggregate()
+	s.prepareExport()
+	s.prepareFacet()
+	s.prepareBulk()
 	log.Printf("inited store methods: %d", len(s.Methods))
 }
 
+// prepareGetBy 为有复合唯一键的模型在 Get 之后添加 Get<Model>By<Key>
+func (s *Store) prepareGetBy() {
+	var out []Method
+	for _, mth := range s.Methods {
+		out = append(out, mth)
+		if mth.action != "Get" {
+			continue
+		}
+		mod, ok := s.doc.modelWithName(mth.model)
+		if !ok || mod.IsBsonable() {
+			continue
+		}
+		for _, uk := range mod.uniqueKeys() {
+			k := mth.Name + "By" + uk.Name
+			if _, ok := s.allMM[k]; !ok {
+				out = append(out, Method{Name: k, action: "GetBy", model: mth.model, ukey: uk.Name})
+				s.allMM[k] = true
+			}
+		}
+	}
+	s.Methods = out
+}
+
+// prepareAggregate 为有统计定义的模型在 List 之后添加 Aggregate<Model>
+func (s *Store) prepareAggregate() {
+	var out []Method
+	for _, mth := range s.Methods {
+		out = append(out, mth)
+		if mth.action != "List" {
+			continue
+		}
+		mod, ok := s.doc.modelWithName(mth.model)
+		if !ok || !mod.hasAggregate() {
+			continue
+		}
+		k := "Aggregate" + mth.model
+		if _, ok := s.allMM[k]; !ok {
+			out = append(out, Method{Name: k, action: "Aggregate", model: mth.model})
+			s.allMM[k] = true
+		}
+	}
+	s.Methods = out
+}
+
+// prepareExport 为可导出的模型在 List 之后添加 Export<Model>
+func (s *Store) prepareExport() {
+	var out []Method
+	for _, mth := range s.Methods {
+		out = append(out, mth)
+		if mth.action != "List" {
+			continue
+		}
+		mod, ok := s.doc.modelWithName(mth.model)
+		if !ok || !mod.canExport() {
+			continue
+		}
+		k := "Export" + mth.model
+		if _, ok := s.allMM[k]; !ok {
+			out = append(out, Method{Name: k, action: "Export", model: mth.model})
+			s.allMM[k] = true
+		}
+	}
+	s.Methods = out
+}
+
+// prepareFacet 为有分面字段的模型在 List 之后添加 Facet<Model>
+func (s *Store) prepareFacet() {
+	var out []Method
+	for _, mth := range s.Methods {
+		out = append(out, mth)
+		if mth.action != "List" {
+			continue
+		}
+		mod, ok := s.doc.modelWithName(mth.model)
+		if !ok || len(mod.facetFields()) == 0 {
+			continue
+		}
+		k := "Facet" + mth.model
+		if _, ok := s.allMM[k]; !ok {
+			out = append(out, Method{Name: k, action: "Facet", model: mth.model})
+			s.allMM[k] = true
+		}
+	}
+	s.Methods = out
+}
+
+// prepareBulk 为接口批量创建或更新的模型在 Create、Update 之后添加 Create<Plural>、Update<Plural>
+func (s *Store) prepareBulk() {
+	var out []Method
+	for _, mth := range s.Methods {
+		out = append(out, mth)
+		if mth.action != "Create" && mth.action != "Update" {
+			continue
+		}
+		mod, ok := s.doc.modelWithName(mth.model)
+		if !ok || !s.doc.WebAPI.isBatch(mth.model, mth.action) {
+			continue
+		}
+		if !mod.canBulk() || mod.GetPlural() == mod.Name {
+			log.Printf("WARN: %s cannot bulk %s", mod.Name, mth.action)
+			continue
+		}
+		k := mth.action + mod.GetPlural()
+		if _, ok := s.allMM[k]; !ok {
+			out = append(out, Method{Name: k, action: mth.action + "Bulk", model: mth.model})
+			s.allMM[k] = true
+		}
+	}
+	s.Methods = out
+}
+
 func (s *Store) hasModel(name string) bool {
 	if _, ok := s.hodMn[name]; ok {
 		return true
@@ -172,10 +293,26 @@ func (s *Store) Interfaces(modelpkg string) (tcs, mcs []jen.Code, nap []bool, ad
 			args, rets, addition, blkcode = mod.codeStoreGet(mth)
 			additions = append(additions, addition)
 			blocks = append(blocks, blkcode)
+		case "GetBy":
+			args, rets, blkcode = mod.codeStoreGetBy(mth)
+			blocks = append(blocks, blkcode)
 		case "List":
 			tcs = append(tcs, mod.getSpecCodes())
 			args, rets, blkcode = mod.codeStoreList(mth)
 			blocks = append(blocks, blkcode)
+		case "Export":
+			args, rets, blkcode = mod.codeStoreExport()
+			blocks = append(blocks, blkcode)
+		case "Facet":
+			args, rets, blkcode = mod.codeStoreFacet()
+			blocks = append(blocks, blkcode)
+		case "Aggregate":
+			tcs = append(tcs, mod.getStatSpecCodes())
+			args, rets, blkcode = mod.codeStoreAggregate()
+			blocks = append(blocks, blkcode)
+		case "Import":
+			args, rets, blkcode = mod.codeStoreImport()
+			blocks = append(blocks, blkcode)
 		case "Create":
 			args, rets, addition, blkcode = mod.codeStoreCreate(mth)
 			additions = append(additions, addition)
@@ -184,6 +321,12 @@ func (s *Store) Interfaces(modelpkg string) (tcs, mcs []jen.Code, nap []bool, ad
 			args, rets, addition, blkcode = mod.codeStoreUpdate(mth)
 			additions = append(additions, addition)
 			blocks = append(blocks, blkcode)
+		case "CreateBulk":
+			args, rets, blkcode = mod.codeStoreCreateBulk()
+			blocks = append(blocks, blkcode)
+		case "UpdateBulk":
+			args, rets, blkcode = mod.codeStoreUpdateBulk()
+			blocks = append(blocks, blkcode)
 		case "Put":
 			args, rets, blkcode = mod.codeStorePut(mth.Simple)
 			blocks = append(blocks, blkcode)
@@ -274,11 +417,18 @@ func (s *Store) Codes(modelpkg string) jen.Code {
 	if !s.extInit && (s.PostNew || len(esModels) > 0) {
 		st.Func().Id("new" + in).Params(jw).Op("*").Id(s.Name).BlockFunc(func(g *jen.Group) {
 			g.Id("s").Op(":=&").Id(s.Name).Values(jen.Id("w:w"))
-			for _, mod := range esModels {
-				g.Id("RegisterESMigrate").Call(
-					mod.codeNilInstance(),
-					jen.Id("s").Dot(MigrateES+mod.Name),
-				)
+			if len(esModels) > 0 { // InTx 中的实例不注册
+				g.If(jen.Op("!").Id("w").Dot("inTx").Call()).BlockFunc(func(g1 *jen.Group) {
+					for _, mod := range esModels {
+						g1.Id("RegisterReindex").Call(
+							mod.codeNilInstance(),
+							jen.Id("s").Dot(MigrateES+mod.Name),
+						)
+						if mod.esByOutbox() {
+							g1.Id("registerOutboxIndex").Call(jen.Lit(mod.Name), jen.Id("s").Dot("outboxES"+mod.Name))
+						}
+					}
+				})
 			}
 			if s.extStrap {
 				g.Id("s").Dot("strap").Call()
@@ -287,6 +437,11 @@ func (s *Store) Codes(modelpkg string) jen.Code {
 			g.Return(jen.Id("s"))
 		}).Line()
 	}
+	for _, mod := range esModels {
+		if mod.esByOutbox() {
+			st.Add(s.codeOutboxES(&mod))
+		}
+	}
 
 	if !s.CustomStruct && !s.extType {
 	st.Type().Id(s.Name).Struct(jw).Line()
@@ -300,6 +455,31 @@ func (s *Store) Codes(modelpkg string) jen.Code {
 	return st
 }
 
+// codeOutboxES 由变更事件同步 mod 的搜索索引，删除的或已不存在的删除其文档
+func (s *Store) codeOutboxES(mod *Model) jen.Code {
+	fname := "outboxES" + mod.Name
+	jnew := jen.Qual(mod.getIPath(), "New"+mod.Name+"WithID").Call(jen.Id("ev").Dot("ObjID"))
+	st := jen.Comment(fname + " 由变更事件同步" + mod.shortComment() + "的搜索索引，出错时按事件退避重试").Line()
+	st.Func().Params(jen.Id("s").Op("*").Id(s.Name)).Id(fname).Params(jactx, jen.Id("ev").Op("*").Id("OutboxEvent")).Error().BlockFunc(func(g *jen.Group) {
+		g.Id("obj").Op(":=").Add(jnew)
+		jdel := jen.Return(jen.Nil())
+		if hk, ok := mod.hasStoreHook(deleteES); ok {
+			jdel = jen.Return(jen.Id("s").Dot(hk.FunName).Call(jen.Id("ctx"), jen.Id("obj")))
+		}
+		g.If(jen.Id("ev").Dot("Action").Op("==").Id("OutboxDelete")).Block(jdel)
+		hk, ok := mod.hasStoreHook(upsertES)
+		if !ok {
+			g.Return(jen.Nil())
+			return
+		}
+		g.Err().Op(":=").Id("dbGetWithPKID").Call(jen.Id("ctx"), jen.Id("s").Dot("w").Dot("db"), jen.Id("obj"), jen.Id("ev").Dot("ObjID"))
+		g.If(jen.Qual("errors", "Is").Call(jen.Err(), jen.Id("ErrNotFound"))).Block(jdel) // 之后已删除
+		g.If(jen.Err().Op("!=").Nil()).Block(jen.Return(jen.Err()))
+		g.Return(jen.Id("s").Dot(hk.FunName).Call(jen.Id("ctx"), jen.Id("obj")))
+	}).Line()
+	return st
+}
+
 func (s *Store) HasPostNew() bool {
 	return s.PostNew || len(s.doc.loadEsModels()) > 0
 }
@@ -375,6 +555,9 @@ type storeHook struct {
 	isPtr bool
 	isTot bool
 
+	reg bool     // 可在运行时注册
+	evs []string // 注册时分发的事件
+
 	k string
 	m *Model
 	s *Store
@@ -392,21 +575,43 @@ func (sh *storeHook) IsPtrFN() bool {
 	return isPtrFN(sh.FunName)
 }
 
+// jRegCall 分发到注册的钩子，fn 为定义的钩子，未定义时为 nil，事务中的参数为 db 和 obj，其余为 obj
+func (sh *storeHook) jRegCall(fn jen.Code, args []jen.Code) (jen.Code, []jen.Code) {
+	if len(sh.FunName) == 0 {
+		fn = jen.Nil()
+	}
+	fname, db, obj := "runTxHooks", jen.Code(nil), args[len(args)-1]
+	if strings.HasSuffix(sh.k, "ing") {
+		db = args[0]
+	} else {
+		fname, db = "runHooks", jen.Id("s").Dot("w").Dot("db")
+	}
+	out := []jen.Code{db, obj, fn}
+	for _, ev := range sh.evs {
+		out = append(out, jen.Id("Hook"+ToExported(ev)))
+	}
+	return jen.Id(fname), out
+}
+
 func (sh *storeHook) esMainStmt(typ string) []dst.Stmt {
-	var (
-		arg dst.Expr
-	)
+	tableCall := &dst.CallExpr{
+		Fun: &dst.SelectorExpr{
+			X:   dst.NewIdent("obj"),
+			Sel: dst.NewIdent("IdentityTable"),
+		}}
+	var args []dst.Expr
 	switch typ {
 	case upsertES:
-		typ = "UpsertESDoc"
-		arg = dst.NewIdent("obj")
+		typ = "indexUpsert"
+		args = []dst.Expr{dst.NewIdent("ctx"), dst.NewIdent("obj")}
 	case deleteES:
-		typ = "DeleteESDoc"
-		arg = &dst.CallExpr{
-			Fun: &dst.SelectorExpr{
-				X:   dst.NewIdent("obj"),
-				Sel: dst.NewIdent("StringID"),
-			}}
+		typ = "indexDelete"
+		args = []dst.Expr{dst.NewIdent("ctx"), tableCall,
+			&dst.CallExpr{
+				Fun: &dst.SelectorExpr{
+					X:   dst.NewIdent("obj"),
+					Sel: dst.NewIdent("StringID"),
+				}}}
 	}
 	mainStmts := make([]dst.Stmt, 0)
 	st := dst.IfStmt{
@@ -423,66 +628,10 @@ func (sh *storeHook) esMainStmt(typ string) []dst.Stmt {
 	}
 	st.Decs.After = dst.NewLine
 
-	st1 := dst.AssignStmt{
-		Lhs: []dst.Expr{dst.NewIdent("err")},
-		Tok: token.DEFINE,
-		Rhs: []dst.Expr{
-			&dst.CallExpr{
-				Fun: &dst.Ident{
-					Name: typ,
-				},
-				Args: []dst.Expr{
-					dst.NewIdent("ctx"),
-					&dst.CallExpr{
-						Fun: &dst.SelectorExpr{
-							X:   dst.NewIdent("obj"),
-							Sel: dst.NewIdent("IdentityTable"),
-						}},
-					arg,
-				},
-			},
-		},
-		Decs: dst.AssignStmtDecorations{},
-	}
-	if typ == "UpsertESDoc" {
-		st1.Decs.Start.Append("// TODO:")
-	}
-	st1.Decs.After = dst.NewLine
-
-	st2 := dst.IfStmt{
-		Cond: &dst.BinaryExpr{
-			X:  dst.NewIdent("err"),
-			Op: token.NEQ,
-			Y:  dst.NewIdent("nil"),
-		},
-		Body: &dst.BlockStmt{
-			List: []dst.Stmt{
-				&dst.ExprStmt{
-					X: &dst.CallExpr{
-						Fun: &dst.SelectorExpr{
-							X:   &dst.CallExpr{Fun: dst.NewIdent("logger")},
-							Sel: dst.NewIdent("Infow")},
-						Args: []dst.Expr{
-							&dst.BasicLit{Kind: token.STRING, Value: strconv.Quote(typ)},
-							&dst.BasicLit{Kind: token.STRING, Value: strconv.Quote("index")},
-							&dst.CallExpr{
-								Fun: &dst.SelectorExpr{
-									X:   dst.NewIdent("obj"),
-									Sel: dst.NewIdent("IdentityTable"),
-								}},
-							&dst.BasicLit{Kind: token.STRING, Value: strconv.Quote("error")},
-							dst.NewIdent("err"),
-						},
-					},
-				},
-				&dst.ReturnStmt{Results: []dst.Expr{dst.NewIdent("nil")}},
-			},
-		},
-	}
-
-	st2.Decs.After = dst.NewLine
+	// 出错时返回，由调用者重试或报告，见 outboxES 和 afterCommit
+	st1 := dst.ReturnStmt{Results: []dst.Expr{&dst.CallExpr{Fun: dst.NewIdent(typ), Args: args}}}
 
-	return append(mainStmts, &st, &st1, &st2)
+	return append(mainStmts, &st, &st1)
 }
 
 func (sh *storeHook) dstFuncDecl(modipath string) *dst.FuncDecl {
@@ -525,10 +674,10 @@ func (sh *storeHook) dstFuncDecl(modipath string) *dst.FuncDecl {
 
 	bretst := &dst.ReturnStmt{Results: bsts}
 	bretst.Decs.Before = dst.NewLine
-	if sh.k != deleteES && sh.k != upsertES {
+	if sh.k != deleteES && sh.k != upsertES { // 搜索索引的已由 esMainStmt 返回
 		bretst.Decs.Start.Append("// TODO: need implement")
+		bodyst.List = append(bodyst.List, bretst)
 	}
-	bodyst.List = append(bodyst.List, bretst)
 
 	f := &dst.FuncDecl{
 		Name: dst.NewIdent(sh.FunName),
@@ -568,18 +717,7 @@ loop:
 							if !find {
 								inf.Methods.List = append(inf.Methods.List, &dst.Field{
 									Names: []*dst.Ident{dst.NewIdent(sh.FunName)},
-									Type: &dst.FuncType{
-										Params: &dst.FieldList{
-											List: []*dst.Field{
-												newField("ctx", &dst.Ident{Name: "Context", Path: "context"}, false),
-											},
-										},
-										Results: &dst.FieldList{
-											List: []*dst.Field{
-												newField("err", "error", false),
-											},
-										},
-									},
+									Type:  sh.dstMEFuncType(&dst.Ident{Name: "Context", Path: "context"}),
 								})
 								ins.Type = inf
 								d.Specs[j] = ins
@@ -601,202 +739,29 @@ func (sh *storeHook) dstMEFuncDecl(modipath string) *dst.FuncDecl {
 	ctxIdent := dst.NewIdent("Context")
 	ctxIdent.Path = "context"
 
-	// var
-	varStmt := &dst.DeclStmt{
-		Decl: &dst.GenDecl{
-			Tok: token.VAR,
-			Specs: []dst.Spec{
-				&dst.ValueSpec{
-					Names: []*dst.Ident{
-						dst.NewIdent("ms")},
-					Type: &dst.Ident{Path: modipath, Name: sh.m.GetPlural()},
-				},
-				&dst.ValueSpec{
-					Names: []*dst.Ident{
-						dst.NewIdent("limit"),
-						dst.NewIdent("page"),
-					},
-					Values: []dst.Expr{
-						&dst.BasicLit{Kind: token.INT, Value: "1000"},
-						&dst.BasicLit{Kind: token.INT, Value: "1"},
-					},
-				},
-			},
-		},
-	}
-	varStmt.Decs.After = dst.NewLine
-
-	specStmt := dst.DeclStmt{
-		Decl: &dst.GenDecl{
-			Tok: token.VAR,
-			Specs: []dst.Spec{
-				&dst.ValueSpec{
-					Names: []*dst.Ident{dst.NewIdent("spec")},
-					Type:  dst.NewIdent(sh.m.getSpecName()),
-				},
+	// return reindexBatch[Models](ctx, s.w.db, after, limit)
+	retStmt := &dst.ReturnStmt{Results: []dst.Expr{
+		&dst.CallExpr{
+			Fun: &dst.IndexExpr{
+				X:     dst.NewIdent("reindexBatch"),
+				Index: &dst.Ident{Path: modipath, Name: sh.m.GetPlural()},
 			},
-		},
-	}
-	limitStmt := dst.AssignStmt{
-		Lhs: []dst.Expr{&dst.SelectorExpr{X: dst.NewIdent("spec"), Sel: dst.NewIdent("Limit")}},
-		Tok: token.ASSIGN,
-		Rhs: []dst.Expr{dst.NewIdent("limit")},
-	}
-	pageStmt := dst.AssignStmt{
-		Lhs: []dst.Expr{&dst.SelectorExpr{X: dst.NewIdent("spec"), Sel: dst.NewIdent("Page")}},
-		Tok: token.ASSIGN,
-		Rhs: []dst.Expr{dst.NewIdent("page")},
-	}
-	sortStmt := dst.AssignStmt{
-		Lhs: []dst.Expr{&dst.SelectorExpr{X: dst.NewIdent("spec"), Sel: dst.NewIdent("Sort")}},
-		Tok: token.ASSIGN,
-		Rhs: []dst.Expr{&dst.BasicLit{Kind: token.STRING, Value: strconv.Quote("created desc")}},
-	}
-
-	// migrate data
-	upsertFunc, _ := sh.m.storeHookName(upsertES, "yes")
-	forStmt := &dst.ForStmt{
-		Body: &dst.BlockStmt{
-			List: []dst.Stmt{
-				&specStmt,
-				&limitStmt,
-				&pageStmt,
-				&sortStmt,
-				&dst.AssignStmt{
-					Lhs: []dst.Expr{
-						dst.NewIdent("ms"),
-						dst.NewIdent("_"),
-						dst.NewIdent("err"),
-					},
-					Tok: token.ASSIGN,
-					Rhs: []dst.Expr{
-						&dst.CallExpr{
-							Fun: &dst.SelectorExpr{
-								X: &dst.CallExpr{
-									Fun: &dst.SelectorExpr{
-										X: &dst.SelectorExpr{
-											X:   dst.NewIdent("s"),
-											Sel: dst.NewIdent("w"),
-										},
-										Sel: dst.NewIdent(sh.s.ShortIName()),
-									}},
-								Sel: dst.NewIdent("List" + sh.m.Name),
-							},
-							Args: []dst.Expr{
-								dst.NewIdent("ctx"),
-								dst.NewIdent("&spec"),
-							},
-						},
-					},
-					Decs: dst.AssignStmtDecorations{
-						NodeDecs: dst.NodeDecs{
-							Before: dst.NewLine,
-							Start:  dst.Decorations{"// TODO:"},
-						},
-					},
-				},
-				&dst.IfStmt{
-					Cond: &dst.BinaryExpr{
-						X: &dst.BinaryExpr{
-							X:  dst.NewIdent("err"),
-							Op: token.NEQ,
-							Y:  dst.NewIdent("nil"),
-						},
-						Op: token.LAND,
-						Y: &dst.BinaryExpr{
-							X:  dst.NewIdent("err"),
-							Op: token.NEQ,
-							Y:  dst.NewIdent("ErrNoRows"),
-						},
-					},
-					Body: &dst.BlockStmt{
-						List: []dst.Stmt{
-							&dst.ExprStmt{
-								X: &dst.CallExpr{
-									Fun: &dst.SelectorExpr{
-										X:   &dst.CallExpr{Fun: dst.NewIdent("logger")},
-										Sel: dst.NewIdent("Infow")},
-									Args: []dst.Expr{
-										&dst.BasicLit{Kind: token.STRING, Value: strconv.Quote("get " + sh.m.Name)},
-										&dst.BasicLit{Kind: token.STRING, Value: strconv.Quote("error")},
-										dst.NewIdent("err"),
-									},
-								},
-							},
-							&dst.ReturnStmt{},
-						},
-					},
-				},
-				&dst.IfStmt{
-					Cond: &dst.BinaryExpr{
-						X: &dst.CallExpr{
-							Fun:  dst.NewIdent("len"),
-							Args: []dst.Expr{dst.NewIdent("ms")},
-						},
-						Op: token.EQL,
-						Y:  dst.NewIdent("0"),
-					},
-					Body: &dst.BlockStmt{
-						List: []dst.Stmt{&dst.BranchStmt{Tok: token.BREAK}},
-					},
-				},
-				&dst.RangeStmt{
-					Key: dst.NewIdent("i"),
-					Tok: token.DEFINE,
-					X:   dst.NewIdent("ms"),
-					Body: &dst.BlockStmt{
-						List: []dst.Stmt{
-							&dst.AssignStmt{
-								Lhs: []dst.Expr{dst.NewIdent("err")},
-								Tok: token.ASSIGN,
-								Rhs: []dst.Expr{
-									&dst.CallExpr{
-										Fun: &dst.SelectorExpr{
-											X:   dst.NewIdent("s"),
-											Sel: dst.NewIdent(upsertFunc),
-										},
-										Args: []dst.Expr{
-											dst.NewIdent("ctx"),
-											&dst.UnaryExpr{
-												Op: token.AND,
-												X: &dst.IndexExpr{
-													X:     dst.NewIdent("ms"),
-													Index: dst.NewIdent("i"),
-												},
-											},
-										},
-									},
-								},
-							},
-							&dst.IfStmt{
-								Cond: &dst.BinaryExpr{
-									X:  dst.NewIdent("err"),
-									Op: token.NEQ,
-									Y:  dst.NewIdent("nil"),
-								},
-								Body: &dst.BlockStmt{List: []dst.Stmt{&dst.ReturnStmt{}}},
-							},
-						},
-					},
-				},
-				&dst.IncDecStmt{
-					X:   dst.NewIdent("page"),
-					Tok: token.INC,
+			Args: []dst.Expr{
+				dst.NewIdent("ctx"),
+				&dst.SelectorExpr{
+					X:   &dst.SelectorExpr{X: dst.NewIdent("s"), Sel: dst.NewIdent("w")},
+					Sel: dst.NewIdent("db"),
 				},
+				dst.NewIdent("after"),
+				dst.NewIdent("limit"),
 			},
 		},
-	}
-	forStmt.Decs.After = dst.NewLine
+	}}
 
 	f := &dst.FuncDecl{
 		Name: dst.NewIdent(sh.FunName),
-		Type: &dst.FuncType{
-			Params: &dst.FieldList{List: []*dst.Field{
-				newField("ctx", ctxIdent, false)}},
-			Results: &dst.FieldList{List: []*dst.Field{
-				newField("err", "error", false),
-			}}},
-		Body: &dst.BlockStmt{List: []dst.Stmt{varStmt, forStmt, &dst.ReturnStmt{}}},
+		Type: sh.dstMEFuncType(ctxIdent),
+		Body: &dst.BlockStmt{List: []dst.Stmt{retStmt}},
 	}
 	if !sh.IsDB() {
 		f.Recv = &dst.FieldList{List: []*dst.Field{newField("s", sh.s.Name, true)}}
@@ -804,3 +769,19 @@ func (sh *storeHook) dstMEFuncDecl(modipath string) *dst.FuncDecl {
 
 	return f
 }
+
+// dstMEFuncType 同 ReindexFunc
+func (sh *storeHook) dstMEFuncType(ctxIdent *dst.Ident) *dst.FuncType {
+	return &dst.FuncType{
+		Params: &dst.FieldList{List: []*dst.Field{
+			newField("ctx", ctxIdent, false),
+			newField("after", "string", false),
+			newField("limit", "int", false),
+		}},
+		Results: &dst.FieldList{List: []*dst.Field{
+			newField("last", "string", false),
+			newField("n", "int", false),
+			newField("err", "error", false),
+		}},
+	}
+}
@@ -14,33 +14,42 @@ var preFails = map[int]string{
 	401: `401 {object} Failure "未登录"`,
 	403: `403 {object} Failure "无权限"`,
 	404: `404 {object} Failure "目标未找到"`,
+	409: `409 {object} Failure "数据冲突"`,
 	503: `503 {object} Failure "服务端错误"`,
 }
 
 var msmethods = map[string]string{
-	"List":   "GET",
-	"Get":    "GET",
-	"Create": "POST",
-	"Update": "PUT",
-	"Put":    "PUT",
-	"Delete": "DELETE",
+	"List":      "GET",
+	"Get":       "GET",
+	"GetBy":     "GET",
+	"Aggregate": "GET",
+	"Create":    "POST",
+	"Import":    "POST",
+	"Update":    "PUT",
+	"Put":       "PUT",
+	"Delete":    "DELETE",
 }
 
 var mslabels = map[string]string{
-	"List":   "查询 %s 列表",
-	"Get":    "获取 %s 详情",
-	"Create": "录入 %s",
-	"Update": "更新 %s",
-	"Put":    "录入/更新 %s",
-	"Delete": "删除 %s",
+	"List":      "查询 %s 列表",
+	"Get":       "获取 %s 详情",
+	"Aggregate": "统计 %s",
+	"Create":    "录入 %s",
+	"Import":    "导入 %s",
+	"Update":    "更新 %s",
+	"Put":       "录入/更新 %s",
+	"Delete":    "删除 %s",
 }
 
 var skipAiActions = map[string]string{
-	"List":   "L",
-	"Get":    "G",
-	"Create": "C",
-	"Update": "U",
-	"Delete": "D",
+	"List":      "L",
+	"Get":       "G",
+	"GetBy":     "G",
+	"Aggregate": "L",
+	"Create":    "C",
+	"Import":    "C",
+	"Update":    "U",
+	"Delete":    "D",
 }
 
 const paramAuth = `token    header   string  true "登录票据凭证"`
@@ -118,6 +127,14 @@ func (wa *WebAPI) HandlerParams() jen.Code {
 	return jen.Params(jen.Id("c").Op("*").Qual(ginQual, "Context"))
 }
 
+// HandlerArgs 调用帮助函数时传入的请求参数
+func (wa *WebAPI) HandlerArgs() []jen.Code {
+	if wa.IsChi() {
+		return []jen.Code{jen.Id("w"), jen.Id("r")}
+	}
+	return []jen.Code{jen.Id("c")}
+}
+
 func (wa *WebAPI) ContextVar() string {
 	if wa.IsChi() {
 		return "r"
@@ -137,6 +154,15 @@ func (wa *WebAPI) SuccessCall(g *jen.Group, args ...jen.Code) {
 	}
 }
 
+// BulkDoneCall 批量写入逐条的结果，见 bulkDone
+func (wa *WebAPI) BulkDoneCall(g *jen.Group, res jen.Code) {
+	if wa.IsChi() {
+		g.Id("bulkDone").Call(jen.Id("w"), jen.Id("r"), res)
+	} else {
+		g.Id("bulkDone").Call(jen.Id("c"), res)
+	}
+}
+
 func (wa *WebAPI) SuccessCallVar(ctx jen.Code, args ...jen.Code) jen.Code {
 	if wa.IsChi() {
 		allArgs := []jen.Code{jen.Id("w"), jen.Id("r")}
@@ -240,6 +266,9 @@ func (wa *WebAPI) genHandle(us UriSpot, mth Method, stoName string) (hdl Handle,
 		uri = prefix + "/" + strings.ToLower(plural)
 	}
 
+	if mth.action == "Export" || mth.action == "Facet" || strings.HasSuffix(mth.action, "Bulk") { // 由 List 接口按需导出或计数，批量的由 Create、Update 接口调用
+		return hdl, false
+	}
 	method := msmethods[mth.action]
 	fct := strings.ToLower(method)
 	var cat string
@@ -247,11 +276,28 @@ func (wa *WebAPI) genHandle(us UriSpot, mth Method, stoName string) (hdl Handle,
 		cat = stoName
 	}
 	name := fct + cat + mod.Name
+	summary := fmt.Sprintf(mslabels[mth.action], mod.shortComment())
 	switch mth.action {
 	case "Get", "Update", "Put", "Delete":
 		uri = uri + "/{id}"
+	case "GetBy":
+		uri = uri + "/by-" + strings.ReplaceAll(Underscore(mth.ukey), "_", "-")
+		name = name + "By" + mth.ukey
+		var names []string
+		if uk, ok := mod.uniqueKey(mth.ukey); ok {
+			for _, field := range uk.Fields {
+				names = append(names, field.shortComment())
+			}
+		}
+		summary = fmt.Sprintf(mslabels["Get"], mod.shortComment()) + " 按" + strings.Join(names, "+")
 	case "List":
 		name = fct + cat + plural
+	case "Aggregate":
+		uri = uri + "/stats"
+		name = name + "Stats"
+	case "Import":
+		uri = uri + "/import"
+		name = "import" + cat + plural
 	}
 	// log.Printf("uri: %s [%s]", uri, method)
 
@@ -261,15 +307,18 @@ func (wa *WebAPI) genHandle(us UriSpot, mth Method, stoName string) (hdl Handle,
 		Method:  mth.Name,
 		Store:   stoName,
 		Route:   fmt.Sprintf("%s [%s]", uri, strings.ToLower(method)),
-		Summary: fmt.Sprintf(mslabels[mth.action], mod.shortComment()),
+		Summary: summary,
 		wa:      wa,
 	}
 	if !us.NoPerm {
-		hdl.NeedPerm = mth.action == "Create" || mth.action == "Update" ||
+		hdl.NeedPerm = mth.action == "Create" || mth.action == "Import" || mth.action == "Update" ||
 			mth.action == "Put" || mth.action == "Delete" || wa.NeedPerm || us.NeedPerm || us.Perm
 	}
 
 	hdl.NeedAuth = hdl.NeedPerm || wa.NeedAuth || us.NeedPerm || us.NeedAuth || us.Perm || us.Auth
+	if mod.canTenant() || mod.canOwnerOnly() { // 租户和所有者取自登录的请求者，见 withTenant、authSignedIn
+		hdl.NeedAuth = true
+	}
 	hdl.NoPost = us.NoPost
 	if len(wa.TagLabel) > 0 {
 		hdl.Tags = wa.TagLabel
@@ -369,6 +418,7 @@ type Handle struct {
 
 	act  string // action
 	mona string // model name
+	ukey string // unique key name
 	mth  Method
 
 	wa *WebAPI
@@ -376,13 +426,34 @@ type Handle struct {
 
 func (h *Handle) cuted() (ok bool) {
 	h.act, h.mona, ok = cutMethod(h.Method)
+	if ok && h.act == "Get" && h.wa != nil && h.wa.doc != nil {
+		if a, b, found := strings.Cut(h.mona, "By"); found {
+			if mod, ok := h.wa.doc.modelWithName(a); ok {
+				if _, ok := mod.uniqueKey(b); ok {
+					h.act, h.mona, h.ukey = "GetBy", a, b
+				}
+			}
+		}
+	}
 	return
 }
 
+// isDupable 模型有唯一约束，保存时可能冲突
+func (h *Handle) isDupable() bool {
+	if h.act != "Create" && h.act != "Update" && h.act != "Put" {
+		return false
+	}
+	mod, ok := h.wa.doc.modelWithName(h.mona)
+	return ok && mod.hasUnique()
+}
+
 func (h *Handle) GetAccept() string {
 	if len(h.Accept) > 0 {
 		return h.Accept
 	}
+	if h.act == "Import" {
+		return "text/csv,application/x-ndjson"
+	}
 	if _, b, ok := strings.Cut(h.Route, " "); ok {
 		b = strings.Trim(b, "[]")
 		if b == "post" || b == "put" {
@@ -396,6 +467,9 @@ func (h *Handle) GetProduce() string {
 	if len(h.Produce) > 0 {
 		return h.Produce
 	}
+	if h.act == "List" && h.canExport() {
+		return "json,text/csv,application/x-ndjson"
+	}
 	return "json"
 }
 
@@ -446,7 +520,11 @@ func (h *Handle) GetFails(act string) []int {
 		return []int{200, 401}
 	}
 	if h.Failures == nil {
-		return getDftFails(act)
+		fails := getDftFails(act)
+		if h.isDupable() { // 409 在 503 之前
+			return append(fails[:len(fails)-1], 409, 503)
+		}
+		return fails
 	}
 	return h.Failures
 }
@@ -459,6 +537,16 @@ func (us UriSpot) IsBatchUpdate() bool {
 	return strings.ContainsRune(us.Batch, 'U')
 }
 
+// isBatch 模型的接口是否批量创建或更新，act 为 Create 或 Update
+func (wa *WebAPI) isBatch(model, act string) bool {
+	for _, us := range wa.URIs {
+		if us.Model == model && (act == "Create" && us.IsBatchCreate() || act == "Update" && us.IsBatchUpdate()) {
+			return true
+		}
+	}
+	return false
+}
+
 func (h *Handle) shouldSkipAI() bool {
 	if len(h.SkipAI) == 0 {
 		return false
@@ -491,15 +579,19 @@ func (h *Handle) CommentCodes(doc *Document) jen.Code {
 	if h.act == "List" {
 		jcodeDesc(st, h.DocL, "@Description ")
 		if mod, ok := doc.modelWithName(h.mona); ok {
-			if cols := mod.sortableColumns(); len(cols) > 0 {
-				st.Comment("@Description <sortable>id,created,updated," + strings.Join(cols, ",") + "</sortable>").Line()
+			if fs := mod.sortableFields(); len(fs) > 0 {
+				keys := []string{"id", "created", "updated"}
+				for _, p := range fs {
+					keys = append(keys, p[0])
+				}
+				st.Comment("@Description <sortable>" + strings.Join(keys, ",") + "</sortable>").Line()
 			}
 		}
 	}
 	if h.act == "Create" && h.IsBatchCreate() {
-		st.Comment("@Description 本接口支持批量创建，传入数组实体，返回结果也为数组").Line()
+		st.Comment("@Description 本接口支持批量创建，传入数组实体，返回结果也为数组，逐条为编号或错误，有失败的条目时状态码为 207").Line()
 	} else if h.act == "Update" && h.IsBatchUpdate() {
-		st.Comment("@Description 本接口支持批量更新，路径中传入的主键以逗号分隔，同时使用数组实体，返回结果也为数组").Line()
+		st.Comment("@Description 本接口支持批量更新，路径中传入的主键以逗号分隔，同时使用数组实体，返回结果也为数组，逐条为编号或错误，有失败的条目时状态码为 207").Line()
 	}
 	var suffix string
 	if h.NeedPerm {
@@ -524,6 +616,11 @@ func (h *Handle) CommentCodes(doc *Document) jen.Code {
 	}
 	mth := h.mth
 
+	if !paramed && h.act == "Import" {
+		paramed = true
+		st.Comment("@Param   body  body  string  true  \"CSV 或 NDJSON 内容，CSV 表头可用字段名或导出的表头\"").Line()
+		st.Comment("@Param   dryRun  query  boolean  false  \"试运行，只校验和尝试写入，不保存\"").Line()
+	}
 	if !paramed {
 		for _, arg := range mth.Args {
 			if arg.Name == "ctx" {
@@ -531,17 +628,27 @@ func (h *Handle) CommentCodes(doc *Document) jen.Code {
 			}
 			if arg.Name == "id" {
 				st.Comment("@Param   id    path   string  true   \"编号\"").Line()
+				if h.act == "Get" && h.canPickFields() {
+					st.Comment("@Param   fields  query  string  false  \"返回的字段，多个以逗号分隔\"").Line()
+				}
+			} else if h.act == "GetBy" {
+				if field, ok := h.ukeyField(arg.Name); ok {
+					st.Comment("@Param   " + field.getArgTag() + "  query  " + swagType(arg.Type) + "  true  \"" + field.shortComment() + "\"").Line()
+				}
 			} else if arg.Type == "string" && strings.Contains(h.Route, "{"+arg.Name+"}") {
 				st.Comment("@Param   " + arg.Name + "  path  " + arg.Type + "  true  \"\"").Line()
 			} else if strings.Contains(arg.Type, ".") {
 				ppos := "formData"
 				switch h.act {
-				case "List":
+				case "List", "Aggregate":
 					ppos = "query"
 				case "Create", "Update", "Put":
 					ppos = "body"
 				}
 				st.Comment("@Param   query  " + ppos + "   " + arg.Type + "  true   \"Object\"").Line()
+				if h.act == "List" && h.canExport() {
+					st.Comment("@Param   export  query  string  false  \"导出格式，csv 或 ndjson，也可由 Accept 指定\"").Line()
+				}
 			} else {
 				log.Printf("unknown arg: %s(%s)", arg.Name, arg.Type)
 			}
@@ -556,6 +663,8 @@ func (h *Handle) CommentCodes(doc *Document) jen.Code {
 			success = true
 			if h.act == "List" {
 				st.Comment("@Success 200 {object} Done{result=ResultData{data=" + mth.Rets[0].Type + "}}").Line()
+			} else if h.act == "Import" {
+				st.Comment("@Success 200 {object} Done{result=ImportReport}").Line()
 			} else if h.act == "Create" {
 				st.Comment("@Success 200 {object} Done{result=ResultID}").Line()
 			} else {
@@ -586,6 +695,19 @@ func (h *Handle) jcall() jen.Code {
 	return jen.Id("a").Dot("sto").Dot(h.Store).Call().Dot(h.Method)
 }
 
+// jcallBulk 批量的存储方法 Create<Plural> 或 Update<Plural>，见 Store.prepareBulk
+func (h *Handle) jcallBulk() (jen.Code, bool) {
+	mod, ok := h.wa.doc.modelWithName(h.mona)
+	if !ok {
+		return nil, false
+	}
+	name := h.act + mod.GetPlural()
+	if !h.wa.doc.hasStoreMethod(name) {
+		return nil, false
+	}
+	return jen.Id("a").Dot("sto").Dot(h.Store).Call().Dot(name), true
+}
+
 func (h *Handle) codeEnumList(doc *Document) jen.Code {
 	st := jen.Add(h.CommentCodes(doc))
 	st.Func().Params(jen.Id("a").Op("*").Id("api")).Id(h.Name).Add(h.wa.HandlerParams())
@@ -621,8 +743,8 @@ func (h *Handle) Codes(doc *Document) jen.Code {
 		if strings.Contains(h.Route, "{id}") { // Get, Put, Delete
 			if h.act == "Get" || h.act == "Load" {
 				g.Id("id").Op(":=").Add(h.wa.ParamCall("id"))
-				rels := mod.Fields.relHasOne()
-				h.codeLoad(g, rels, doc.qual(mth.Rets[0].Type))
+				rels := append(mod.Fields.relHasOne(), mod.relHasManyLoad()...)
+				h.codeLoad(g, rels, doc.qual(mth.Rets[0].Type), mod)
 				return
 			}
 			if (h.act == "Put" || h.act == "Update") && len(mth.Args) > 2 {
@@ -637,6 +759,14 @@ func (h *Handle) Codes(doc *Document) jen.Code {
 			log.Printf("invalid act: %s", h.act)
 			return
 		}
+		if h.act == "GetBy" {
+			h.codeGetBy(g, doc)
+			return
+		}
+		if h.act == "Aggregate" && len(mth.Args) > 1 {
+			h.codeAggregate(g, doc.qual(mth.Args[1].Type), mod)
+			return
+		}
 		if h.act == "List" && len(mth.Args) > 1 {
 			h.codeList(g, doc.qual(mth.Args[1].Type), mod)
 			return
@@ -645,6 +775,10 @@ func (h *Handle) Codes(doc *Document) jen.Code {
 			h.codeCreate(g, doc.qual(mth.Args[1].Type))
 			return
 		}
+		if h.act == "Import" {
+			h.codeImport(g, mod)
+			return
+		}
 		log.Printf("invalid act: %s", h.act)
 
 	})
@@ -654,7 +788,7 @@ func (h *Handle) Codes(doc *Document) jen.Code {
 	return st
 }
 
-func (h *Handle) codeLoad(g *jen.Group, rels Fields, jarg jen.Code) {
+func (h *Handle) codeLoad(g *jen.Group, rels Fields, jarg jen.Code, mod *Model) {
 	op := ":="
 	needDef := strings.ContainsAny(h.Ignore, "CU")
 	if needDef { // Explicit import is required for API document generation.
@@ -662,25 +796,109 @@ func (h *Handle) codeLoad(g *jen.Group, rels Fields, jarg jen.Code) {
 		g.Var().Id("obj").Op("*").Add(jarg)
 		g.Var().Err().Error()
 	}
+	pickable := h.act == "Get" && mod.canPickFields()
+	if pickable {
+		jq := h.wa.QueryCall("fields")
+		if !h.wa.IsChi() {
+			jq = jen.Id(h.wa.ContextVar()).Dot("Query").Call(jen.Lit("fields"))
+		}
+		g.Add(h.jfields(mod, jq))
+	}
 	if len(rels) > 0 {
-		g.Id("ctx").Op(":=").Add(h.wa.ContextCall())
-		g.If(
-			jen.Id("rels").Op(",").Id("ok").Op(":=").Add(h.wa.QueryArrayCall("rel")).
-				Op(";").Id("ok").Op("&&").Len(jen.Id("rels")).Op(">").Lit(0)).
-			Block(
-				jen.Id("ctx").Op("=").Id("stores").Dot("ContextWithRelation").Call(
-					jen.Id("ctx"), jen.Id("rels").Op("..."),
-				),
-			)
+		if !pickable {
+			g.Id("ctx").Op(":=").Add(h.wa.ContextCall())
+		}
+		jq := h.wa.QueryCall("rel")
+		if !h.wa.IsChi() {
+			jq = jen.Id(h.wa.ContextVar()).Dot("Query").Call(jen.Lit("rel"))
+		}
+		g.List(jen.Id("rels"), jen.Err()).Op(":=").Id("stores").Dot("ParseRelations").Call(jq, rels.jNames())
+		g.If(jen.Err().Op("!=").Nil()).Block(h.jfails(400)...)
+		g.Id("ctx").Op("=").Id("stores").Dot("ContextWithRelation").Call(jen.Id("ctx"), jen.Id("rels").Op("..."))
 
 		g.Id("obj").Op(",").Err().Op(op).Add(h.jcall()).Call(jen.Id("ctx"), jen.Id("id"))
 
+	} else if pickable {
+		g.Id("obj").Op(",").Err().Op(op).Add(h.jcall()).Call(jen.Id("ctx"), jen.Id("id"))
 	} else {
 		g.Id("obj").Op(",").Err().Op(op).Add(h.jcall()).Call(
 			h.wa.ContextCall(), jen.Id("id"),
 		)
 	}
 
+	g.If(jen.Err().Op("!=").Nil()).Block(
+		h.jfails(503)...,
+	).Line()
+	if pickable {
+		h.wa.SuccessCall(g, jen.Id("pickFields").Call(h.jview("obj", false), jen.Id("fields")))
+		return
+	}
+	h.wa.SuccessCall(g, h.jview("obj", false))
+}
+
+// canPickFields 支持 fields 参数的读取接口
+func (h *Handle) canPickFields() bool {
+	mod, ok := h.wa.doc.modelWithName(h.mona)
+	return ok && mod.canPickFields()
+}
+
+// canExport 列表接口支持 export 参数
+func (h *Handle) canExport() bool {
+	mod, ok := h.wa.doc.modelWithName(h.mona)
+	return ok && mod.canExport()
+}
+
+// jfields 由 fields 参数得到选择了列的上下文，无效时返回 400
+func (h *Handle) jfields(mod *Model, jfields jen.Code) jen.Code {
+	return jen.Id("ctx").Op(",").Id("fields").Op(",").Err().Op(":=").Id("stores").Dot("ContextWithFields").Call(
+		h.wa.ContextCall(), jen.Parens(jen.Op("*").Qual(mod.getIPath(), mod.Name)).Parens(jen.Nil()), jfields,
+	).Line().If(jen.Err().Op("!=").Nil()).Block(
+		h.jfails(400)...,
+	)
+}
+
+func (h *Handle) ukeyField(arg string) (*Field, bool) {
+	if mod, ok := h.wa.doc.modelWithName(h.mona); ok {
+		if uk, ok := mod.uniqueKey(h.ukey); ok {
+			for _, field := range uk.Fields {
+				if LcFirst(field.Name) == arg {
+					return &field, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// swagType 简单参数的 swagger 类型
+func swagType(typ string) string {
+	switch {
+	case typ == "bool":
+		return "boolean"
+	case strings.HasPrefix(typ, "int"), strings.HasPrefix(typ, "uint"):
+		return "integer"
+	case strings.HasPrefix(typ, "float"):
+		return "number"
+	}
+	return "string"
+}
+
+// codeGetBy 按复合唯一键获取，键值来自查询参数
+func (h *Handle) codeGetBy(g *jen.Group, doc *Document) {
+	var members []jen.Code
+	args := []jen.Code{h.wa.ContextCall()}
+	for _, arg := range h.mth.Args[1:] {
+		field, ok := h.ukeyField(arg.Name)
+		if !ok {
+			log.Printf("invalid arg %s of %s", arg.Name, h.Method)
+			continue
+		}
+		members = append(members, jen.Id(field.Name).Add(doc.qual(arg.Type)).Tag(Tags{"form": field.getArgTag()}))
+		args = append(args, jen.Id("in").Dot(field.Name))
+	}
+	g.Var().Id("in").Struct(members...)
+	g.Add(h.jbind("in"))
+	g.Id("obj").Op(",").Err().Op(":=").Add(h.jcall()).Call(args...)
 	g.If(jen.Err().Op("!=").Nil()).Block(
 		h.jfails(503)...,
 	).Line()
@@ -694,24 +912,33 @@ func (h *Handle) codeUpdate(g *jen.Group, jarg jen.Code, simple bool) {
 		g.Var().Id("ain").Index().Add(jarg)
 		g.Add(h.jbindWith("ain", true, h.jfails(400)...))
 		g.If(jen.Len(jen.Id("ids")).Op("!=").Len(jen.Id("ain"))).Block(h.jfails(400, jen.Lit("mismatch length"))...)
+		if h.isWriteRoled() {
+			g.For(jen.Id("_,in").Op(":=").Range().Id("ain")).Block(h.jdenied("in"))
+		}
 		g.Id("ctx").Op(":=").Add(h.wa.ContextCall())
-		g.Id("ret").Op(":=").Make(jen.Index().Any(), jen.Len(jen.Id("ids")))
-		g.For(jen.Id("i").Op(":=0;").Id("i").Op("<").Len(jen.Id("ids")).Op(";i++")).Block(
-			jen.Err().Op(":=").Add(h.jcall()).Call(
-				jen.Id("ctx"), jen.Id("ids").Index(jen.Id("i")), jen.Id("ain").Index(jen.Id("i")),
-			),
-			jen.If(jen.Err().Op("!=").Nil()).Block(
-				jen.Id("ret").Index(jen.Id("i")).Op("=").Add(h.wa.GetErrorVar(jen.Lit(0), jen.Err())),
-			).Else().Block(
-				jen.Id("ret").Index(jen.Id("i")).Op("=").Id("idResult").Call(jen.Id("ids").Index(jen.Id("i"))),
-			),
-		)
+		if jbulk, ok := h.jcallBulk(); ok {
+			g.List(jen.Id("res"), jen.Err()).Op(":=").Add(jbulk).Call(jen.Id("ctx"), jen.Id("ids"), jen.Id("ain"))
+			g.If(jen.Err().Op("!=").Nil()).Block(h.jfailsSave()...)
+		} else {
+			g.Id("res").Op(":=").Make(jen.Index().Id("stores").Dot("BulkResult"), jen.Len(jen.Id("ids")))
+			g.For(jen.Id("i").Op(":=").Range().Id("ids")).Block(
+				jen.If(jen.Err().Op(":=").Add(h.jcall()).Call(
+					jen.Id("ctx"), jen.Id("ids").Index(jen.Id("i")), jen.Id("ain").Index(jen.Id("i")),
+				), jen.Err().Op("!=").Nil()).Block(
+					jen.Id("res").Index(jen.Id("i")).Dot("Error").Op("=").Err(),
+				).Else().Block(
+					jen.Id("res").Index(jen.Id("i")).Dot("ID").Op("=").Id("ids").Index(jen.Id("i")),
+				),
+			)
+		}
+		h.wa.BulkDoneCall(g, jen.Id("res"))
 		return
 	}
 
 	g.Id("id").Op(":=").Add(h.wa.ParamCall("id"))
 	g.Var().Id("in").Add(jarg)
 	g.Add(h.jbindIn("in"))
+	g.Add(h.jdenied("in"))
 	var retName string
 	if h.act == "Put" {
 		if simple {
@@ -728,7 +955,7 @@ func (h *Handle) codeUpdate(g *jen.Group, jarg jen.Code, simple bool) {
 		)
 	}
 	g.If(jen.Err().Op("!=").Nil()).Block(
-		h.jfails(503)...,
+		h.jfailsSave()...,
 	).Line()
 
 	if h.act == "Put" {
@@ -754,10 +981,43 @@ func (h *Handle) codeDelete() jen.Code {
 func (h *Handle) codeList(g *jen.Group, spec jen.Code, mod *Model) {
 	g.Var().Id("spec").Add(spec)
 	g.Add(h.jbind("spec"))
-	g.Id("ctx").Op(":=").Add(h.wa.ContextCall())
+	if len(mod.sortKeys()) > 0 {
+		g.If(jen.Err().Op(":=").Id("stores").Dot("CheckSort").Call(jen.Op("&").Id("spec")), jen.Err().Op("!=").Nil()).Block(
+			h.jfails(400)...,
+		).Line()
+	}
+	if len(mod.filterFields()) > 0 {
+		g.If(jen.Err().Op(":=").Id("stores").Dot("CheckFilter").Call(jen.Id("spec").Dot("Filter"), jen.Op("&").Id("spec")), jen.Err().Op("!=").Nil()).Block(
+			h.jfails(400)...,
+		).Line()
+	}
+	if rels := mod.specRelFields(); len(rels) > 0 {
+		g.If(jen.List(jen.Id("_"), jen.Err()).Op(":=").Id("stores").Dot("ParseRelations").Call(jen.Id("spec").Dot("WithRel"), rels.jNames()), jen.Err().Op("!=").Nil()).Block(
+			h.jfails(400)...,
+		).Line()
+	}
+	pickable := mod.canPickFields()
+	if pickable {
+		g.Add(h.jfields(mod, jen.Id("spec").Dot("Fields")))
+	} else {
+		g.Id("ctx").Op(":=").Add(h.wa.ContextCall())
+	}
 	if len(mod.SpecUp) > 0 { // deprecated
 		g.Id("spec").Dot(mod.SpecUp).Call(jen.Id("ctx"), jen.Lit(mod.Name))
 	}
+	if mod.canExport() {
+		h.codeExport(g, mod)
+	}
+	hasFacet := len(mod.facetFields()) > 0 && h.wa.doc.hasStoreMethod("Facet"+h.mona)
+	if hasFacet {
+		g.Var().Id("facets").Id("stores").Dot("Facets")
+		g.If(jen.Id("spec").Dot("Facets")).BlockFunc(func(g1 *jen.Group) {
+			g1.Var().Err().Error()
+			g1.If(jen.List(jen.Id("facets"), jen.Err()).Op("=").Id("a").Dot("sto").Dot(h.Store).Call().Dot("Facet"+h.mona).Call(
+				jen.Id("ctx"), jen.Op("&").Id("spec"),
+			), jen.Err().Op("!=").Nil()).Block(h.jfails(503)...)
+		}).Line()
+	}
 	var r2 = "total"
 	if h.CalcPage {
 		r2 = "_"
@@ -765,28 +1025,93 @@ func (h *Handle) codeList(g *jen.Group, spec jen.Code, mod *Model) {
 	g.Id("data").Op(",").Id(r2).Op(",").Err().Op(":=").Add(h.jcall()).Call(
 		jen.Id("ctx"), jen.Op("&").Id("spec"),
 	)
+	var jfails []jen.Code
+	_, _, isCursor := mod.cursorKey()
+	if isCursor {
+		jfails = append(jfails, jen.If(jen.Qual("errors", "Is").Call(jen.Err(), jen.Id("stores").Dot("ErrInvalidCursor"))).Block(h.jfails(400)...))
+	}
 	g.If(jen.Err().Op("!=").Nil()).Block(
-		h.jfails(503)...,
+		append(jfails, h.jfails(503)...)...,
 	).Line()
 	if h.NotNull {
 		g.If(jen.Id("data").Op("==").Nil()).Block(
 			jen.Id("data").Op("=").Id(h.mth.Rets[0].Type).Block(),
 		)
 	}
-	args := []jen.Code{jen.Id("data"), jen.Id("total")}
+	args := []jen.Code{h.jview("data", true), jen.Id("total")}
+	if pickable {
+		args[0] = jen.Id("pickFields").Call(args[0], jen.Id("fields"))
+	}
 	if h.CalcPage {
 		args[1] = jen.Op("&").Id("spec")
 	}
+	if isCursor || hasFacet {
+		g.Id("res").Op(":=").Id("dtResult").Call(args...)
+		if isCursor {
+			g.Id("res").Dot("Next").Op(",").Id("res").Dot("Prev").Op("=").Id("spec").Dot("Cursors").Call()
+		}
+		if hasFacet {
+			g.If(jen.Id("spec").Dot("Facets")).Block(jen.Id("res").Dot("SetExtra").Call(jen.Lit("facets"), jen.Id("facets")))
+		}
+		h.wa.SuccessCall(g, jen.Id("res"))
+		return
+	}
 	h.wa.SuccessCall(g, jen.Id("dtResult").Call(args...))
 }
 
+// codeExport 请求导出时按同样的条件流式写出，不再分页，导出格式无效时返回 400
+func (h *Handle) codeExport(g *jen.Group, mod *Model) {
+	jctx := h.wa.HandlerArgs()
+	jcall := jen.Id("a").Dot("sto").Dot(h.Store).Call().Dot("Export" + h.mona)
+	g.List(jen.Id("ex"), jen.Err()).Op(":=").Id("newExporter").Call(append(jctx,
+		jen.Lit(strings.ToLower(mod.GetPlural())), jen.Parens(jen.Op("*").Qual(mod.getIPath(), mod.Name)).Parens(jen.Nil()), jen.Id("fields"))...)
+	g.If(jen.Err().Op("!=").Nil()).Block(h.jfails(400)...)
+	g.If(jen.Id("ex").Op("!=").Nil()).Block(
+		jen.Err().Op("=").Add(jcall).Call(jen.Id("ctx"), jen.Op("&").Id("spec"),
+			jen.Func().Params(jen.Id("data").Qual(mod.getIPath(), mod.GetPlural())).Error().Block(
+				jen.Return(jen.Id("exportRows").Call(jen.Id("ex"), jen.Id("data"))),
+			)),
+		jen.Id("exportDone").Call(append(jctx, jen.Id("ex"), jen.Err())...),
+		jen.Return(),
+	)
+}
+
+// codeImport 读出并校验全部行，通过的按批写入，返回各行的结果，格式无效时返回 400
+func (h *Handle) codeImport(g *jen.Group, mod *Model) {
+	g.List(jen.Id("im"), jen.Err()).Op(":=").Id("readImport").Types(jen.Qual(mod.getIPath(), mod.Name+"Basic")).Call(h.wa.HandlerArgs()...)
+	g.If(jen.Err().Op("!=").Nil()).Block(h.jfails(400)...).Line()
+	g.List(jen.Id("ids"), jen.Err()).Op(":=").Add(h.jcall()).Call(h.wa.ContextCall(), jen.Id("im").Dot("Ins"), jen.Id("im").Dot("DryRun"))
+	h.wa.SuccessCall(g, jen.Id("im").Dot("Done").Call(jen.Id("ids"), jen.Err()))
+}
+
+// codeAggregate 统计，分组和过滤参数无效时返回 400
+func (h *Handle) codeAggregate(g *jen.Group, spec jen.Code, mod *Model) {
+	g.Var().Id("spec").Add(spec)
+	g.Add(h.jbind("spec"))
+	g.If(jen.Id("_").Op(",").Err().Op(":=").Id("spec").Dot("GroupBy").Call(), jen.Err().Op("!=").Nil()).Block(
+		h.jfails(400)...,
+	).Line()
+	if len(mod.filterFields()) > 0 {
+		g.If(jen.Err().Op(":=").Id("stores").Dot("CheckFilter").Call(jen.Id("spec").Dot("Filter"), jen.Op("&").Id("spec")), jen.Err().Op("!=").Nil()).Block(
+			h.jfails(400)...,
+		).Line()
+	}
+	g.Id("data").Op(",").Err().Op(":=").Add(h.jcall()).Call(
+		h.wa.ContextCall(), jen.Op("&").Id("spec"),
+	)
+	g.If(jen.Err().Op("!=").Nil()).Block(
+		h.jfails(503)...,
+	).Line()
+	h.wa.SuccessCall(g, jen.Id("data"))
+}
+
 func (h *Handle) jStoModCall() jen.Code {
 	ctxVar := h.wa.ContextVar()
 	return jen.Id("obj").Op(",").Err().Op(":=").Add(h.jcall()).Call(
 		h.wa.ContextCall(), jen.Id("in"),
 	).Line().
 		If(jen.Err().Op("!=").Nil()).Block(
-		h.jfails(503)...,
+		h.jfailsSave()...,
 	).Line().Line().
 		Line().
 		Add(h.wa.SuccessCallVar(jen.Id(ctxVar), jen.Id("idResult").Call(jen.Id("obj").Dot("ID"))))
@@ -799,21 +1124,31 @@ func (h *Handle) codeCreate(g *jen.Group, jarg jen.Code) {
 		g.Add(h.jbindWith("ain", true,
 			jen.Var().Id("in").Add(jarg),
 			jen.Add(h.jbindWith("in", true, h.jfails(400)...)),
+			h.jdenied("in"),
 			h.jStoModCall(),
 			jen.Return(),
 		))
-		g.Var().Id("ret").Index().Any()
-		g.For(jen.Id("_,in").Op(":=").Range().Id("ain")).Block(jen.Id("obj").Op(",").Err().Op(":=").Add(h.jcall()).Call(
-			h.wa.ContextCall(), jen.Id("in"),
-		), jen.If(jen.Err().Op("!=").Nil()).Block(
-			jen.Id("ret").Op("=").Append(jen.Id("ret"), h.wa.GetErrorVar(jen.Lit(0), jen.Err())),
-		).Else().Block(
-			jen.Id("ret").Op("=").Append(jen.Id("ret"), jen.Id("idResult").Call(jen.Id("obj").Dot("ID"))),
-		))
-		h.wa.SuccessCall(g, jen.Id("dtResult").Call(jen.Id("ret"), jen.Len(jen.Id("ret"))))
+		if h.isWriteRoled() {
+			g.For(jen.Id("_,in").Op(":=").Range().Id("ain")).Block(h.jdenied("in"))
+		}
+		if jbulk, ok := h.jcallBulk(); ok {
+			g.List(jen.Id("res"), jen.Err()).Op(":=").Add(jbulk).Call(h.wa.ContextCall(), jen.Id("ain"))
+			g.If(jen.Err().Op("!=").Nil()).Block(h.jfailsSave()...)
+		} else {
+			g.Id("res").Op(":=").Make(jen.Index().Id("stores").Dot("BulkResult"), jen.Len(jen.Id("ain")))
+			g.For(jen.Id("i, in").Op(":=").Range().Id("ain")).Block(jen.Id("obj").Op(",").Err().Op(":=").Add(h.jcall()).Call(
+				h.wa.ContextCall(), jen.Id("in"),
+			), jen.If(jen.Err().Op("!=").Nil()).Block(
+				jen.Id("res").Index(jen.Id("i")).Dot("Error").Op("=").Err(),
+			).Else().Block(
+				jen.Id("res").Index(jen.Id("i")).Dot("ID").Op("=").Id("obj").Dot("StringID").Call(),
+			))
+		}
+		h.wa.BulkDoneCall(g, jen.Id("res"))
 	} else {
 		g.Var().Id("in").Add(jarg)
 		g.Add(h.jbindIn("in"))
+		g.Add(h.jdenied("in"))
 		g.Add(h.jStoModCall())
 	}
 }
@@ -869,7 +1204,7 @@ func (wa *WebAPI) Codes(doc *Document) jen.Code {
 }
 
 func getDftFails(act string) []int {
-	if act == "List" || act == "Get" {
+	if act == "List" || act == "Get" || act == "GetBy" || act == "Aggregate" {
 		return []int{400, 401, 404, 503}
 	}
 	return []int{400, 401, 403, 503}
@@ -885,6 +1220,51 @@ func (h *Handle) jfails(sc int, ae ...jen.Code) []jen.Code {
 	return append([]jen.Code{}, jen.Id("fail").Call(jen.Id("c"), jen.Lit(sc), ae[0]), jen.Return())
 }
 
+// isWriteRoled 有按角色限制写入的字段
+func (h *Handle) isWriteRoled() bool {
+	mod, ok := h.wa.doc.modelWithName(h.mona)
+	if !ok {
+		return false
+	}
+	for _, field := range mod.Fields {
+		if len(field.WriteRoles) > 0 && (field.IsSet || field.IsBasic && h.act == "Create") {
+			return true
+		}
+	}
+	return false
+}
+
+// jview 输出前按请求者的角色隐去不可见的字段，模型有 read 时经 viewFor
+func (h *Handle) jview(id string, isPlural bool) jen.Code {
+	mod, ok := h.wa.doc.modelWithName(h.mona)
+	if !ok || !mod.hasReadRoles() || isPlural && mod.GetPlural() == mod.Name {
+		return jen.Id(id)
+	}
+	return jen.Id("viewFor").Call(jen.Id(h.wa.ContextVar()), jen.Id(id))
+}
+
+// jdenied 拒绝写入无权的字段
+func (h *Handle) jdenied(id string) jen.Code {
+	if !h.isWriteRoled() {
+		return jen.Empty()
+	}
+	ctxVar := h.wa.ContextVar()
+	return jen.If(
+		jen.Id("field").Op(":=").Id(id).Dot("DeniedField").Call(jen.Id("callerRoles").Call(jen.Id(ctxVar)).Op("...")),
+		jen.Len(jen.Id("field")).Op(">").Lit(0),
+	).Block(h.jfails(400, jen.Id("fieldDenied").Call(jen.Id("field")))...).Line()
+}
+
+// jfailsSave 保存失败，违反唯一约束时返回 409
+func (h *Handle) jfailsSave() []jen.Code {
+	if !h.isDupable() {
+		return h.jfails(503)
+	}
+	return append([]jen.Code{
+		jen.If(jen.Id("stores").Dot("IsDuplicateError").Call(jen.Err())).Block(h.jfails(409)...),
+	}, h.jfails(503)...)
+}
+
 func (h *Handle) jbind(id string) jen.Code {
 	return h.jbindBody(id, false)
 }
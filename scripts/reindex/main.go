@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/cupogo/scaffold/pkg/services/stores"
+)
+
+var (
+	model   string
+	restart bool
+	batch   int
+	list    bool
+)
+
+func main() {
+	flag.StringVar(&model, "model", "", "table name of model, empty for all")
+	flag.BoolVar(&restart, "restart", false, "ignore checkpoint and start over")
+	flag.IntVar(&batch, "batch", stores.ReindexBatch, "records per batch")
+	flag.BoolVar(&list, "list", false, "show progress only")
+	flag.Parse()
+
+	ctx, cancel := signal.NotifyContext(stores.ContextWithSystem(context.Background()), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	sto := stores.Sgt()
+	defer sto.Close()
+
+	if list {
+		states, err := sto.ReindexStates(ctx)
+		if err != nil {
+			log.Fatalf("load states fail: %s", err)
+		}
+		for _, st := range states {
+			fmt.Printf("%-24s total %-8d last %-16s errors %-4d done %v %s\n",
+				st.Model, st.Total, st.LastID, st.Errors, st.DoneAt != nil, st.LastError)
+		}
+		return
+	}
+
+	log.Printf("reindex %s", strings.Join(stores.ReindexModels(), ","))
+	err := sto.Reindex(ctx, model, stores.ReindexOption{
+		Restart: restart,
+		Batch:   batch,
+		Progress: func(st *stores.ReindexState) {
+			if st.DoneAt != nil {
+				log.Printf("%s: done, %d indexed", st.Model, st.Total)
+			} else if len(st.LastError) == 0 {
+				log.Printf("%s: %d indexed, last %q", st.Model, st.Total, st.LastID)
+			}
+		},
+	})
+	if err != nil {
+		log.Fatalf("reindex fail: %s", err)
+	}
+}
@@ -2,10 +2,11 @@ package templates
 
 import (
 	"embed"
-	"html/template"
 	"io/fs"
 	"log/slog"
 	"os"
+	"path"
+	"text/template"
 )
 
 //go:embed */*.tmpl
@@ -16,7 +17,9 @@ func FS() fs.FS {
 }
 
 func Render(src, dest string, data any) error {
-	t := template.Must(template.ParseFS(tplfs, src+".tmpl"))
+	// 生成的是 Go 代码，html/template 会把其中的 < 转义为 &lt;
+	// 数据为 map 时缺少的键报错，以免键名写错时生成 <no value>
+	t := template.Must(template.New(path.Base(src) + ".tmpl").Option("missingkey=error").ParseFS(tplfs, src+".tmpl"))
 	wr, err := os.OpenFile(dest, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return err